@@ -0,0 +1,39 @@
+package dto
+
+import "time"
+
+// ExtractionJobDTO is the state of an asynchronous extraction job
+type ExtractionJobDTO struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// Progress is the most recent document progress, absent until the first document is classified
+	Progress *DocumentProgressDTO `json:"progress,omitempty"`
+	// Result is set once the job has succeeded
+	Result *ExtractTransactionsResponse `json:"result,omitempty"`
+	Error  string                       `json:"error,omitempty"`
+	// ErrorCode is the domain error code of a failed job, when there is one
+	ErrorCode string `json:"error_code,omitempty"`
+}
+
+// DocumentProgressDTO reports a single document reaching a pipeline stage
+type DocumentProgressDTO struct {
+	Index     int    `json:"index"`
+	Total     int    `json:"total"`
+	Completed int    `json:"completed"`
+	Filename  string `json:"filename"`
+	Kind      string `json:"kind"`
+	Stage     string `json:"stage"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ExtractionEventDTO is a single server-sent event on a job's event stream
+type ExtractionEventDTO struct {
+	Seq      int                  `json:"seq"`
+	Type     string               `json:"type"`
+	Time     time.Time            `json:"time"`
+	Status   string               `json:"status"`
+	Document *DocumentProgressDTO `json:"document,omitempty"`
+}
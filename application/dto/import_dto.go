@@ -0,0 +1,38 @@
+package dto
+
+// ImportTransactionsRequest is a spreadsheet of transactions to turn into a
+// recap report without running an extraction backend
+type ImportTransactionsRequest struct {
+	Filename string
+	Content  []byte
+	// Sheet selects the worksheet of a workbook; empty reads the first one
+	Sheet string
+	// Mapping maps fields of the documented layout to the headers the file uses instead
+	Mapping map[string]string
+	// Trip holds trip fields sent with the file, keyed like the columns; they
+	// take precedence over the trip columns of the file
+	Trip map[string]string
+}
+
+// ImportTransactionsResponse is the report built from an imported spreadsheet
+type ImportTransactionsResponse struct {
+	Report RecapReportDTO `json:"report"`
+	// Sheet is the worksheet that was read; empty for CSV
+	Sheet string `json:"sheet,omitempty"`
+	// Rows is the number of transaction rows imported
+	Rows int `json:"rows"`
+	// Columns maps each recognised field to the header it was read from
+	Columns map[string]string `json:"columns"`
+	// LodgingOverages lists accommodation priced above the traveller's SBM ceiling
+	LodgingOverages []LodgingOverageDTO `json:"lodging_overages"`
+	Warnings        []string            `json:"warnings"`
+}
+
+// ImportRowErrorDTO is a problem with one row of an imported spreadsheet. Row
+// is the line number as shown by a spreadsheet program, header row included,
+// and is left out for a trip field sent as a form field.
+type ImportRowErrorDTO struct {
+	Row     int    `json:"row,omitempty"`
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
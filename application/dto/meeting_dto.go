@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/invopop/validation"
+	"sandbox/domain/date"
 	"sandbox/domain/meeting"
 )
 
@@ -48,7 +49,7 @@ func parseIndonesianDateTime(datetimeStr string) (time.Time, error) {
 	}
 
 	// Parse month
-	month, exists := IndonesianMonths[monthStr]
+	month, exists := date.IndonesianMonths[monthStr]
 	if !exists {
 		return time.Time{}, fmt.Errorf("invalid month: %s", monthStr)
 	}
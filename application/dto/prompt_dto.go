@@ -0,0 +1,24 @@
+package dto
+
+import "github.com/invopop/validation"
+
+// PromptVersionDTO describes one prompt template version
+type PromptVersionDTO struct {
+	ID string `json:"id"`
+	// Hash identifies the template text, which changes when a template file is edited
+	Hash   string `json:"hash"`
+	Source string `json:"source"`
+	Active bool   `json:"active"`
+}
+
+// ActivatePromptRequest selects the prompt template version used by the LLM backends
+type ActivatePromptRequest struct {
+	Version string `json:"version"`
+}
+
+// Validate validates the activation request
+func (r ActivatePromptRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Version, validation.Required),
+	)
+}
@@ -2,49 +2,13 @@ package dto
 
 import (
 	"fmt"
-	"regexp"
-	"strconv"
 	"strings"
-	"time"
+
+	"sandbox/domain/date"
 
 	"github.com/invopop/validation"
 )
 
-var dateFormatRegex = regexp.MustCompile(`^\d{1,2}\s+(Januari|Februari|Maret|April|Mei|Juni|Juli|Agustus|September|Oktober|November|Desember)\s+\d{4}$`)
-
-// parseIndonesianDate parses Indonesian date format (e.g., "25 Oktober 2025")
-func parseIndonesianDate(dateStr string) (time.Time, error) {
-	// Extract day, month, and year
-	parts := strings.Fields(dateStr)
-	if len(parts) != 3 {
-		return time.Time{}, fmt.Errorf("invalid date format")
-	}
-
-	dayStr := parts[0]
-	monthStr := parts[1]
-	yearStr := parts[2]
-
-	// Parse day
-	day, err := strconv.Atoi(dayStr)
-	if err != nil {
-		return time.Time{}, fmt.Errorf("invalid day: %s", dayStr)
-	}
-
-	// Parse month
-	month, exists := IndonesianMonths[monthStr]
-	if !exists {
-		return time.Time{}, fmt.Errorf("invalid month: %s", monthStr)
-	}
-
-	// Parse year
-	year, err := strconv.Atoi(yearStr)
-	if err != nil {
-		return time.Time{}, fmt.Errorf("invalid year: %s", yearStr)
-	}
-
-	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC), nil
-}
-
 // TransactionDTO represents the data transfer object for transactions
 type TransactionDTO struct {
 	Name            string `json:"name"`
@@ -56,6 +20,29 @@ type TransactionDTO struct {
 	PaymentType     string `json:"payment_type"`
 	Description     string `json:"description"`
 	TransportDetail string `json:"transport_detail"`
+	// Date is when the expense took place (travel, check-in or ride date), when the document shows it
+	Date date.Date `json:"date"`
+	// Source tells which uploaded file the transaction was read from
+	Source *SourceDTO `json:"source,omitempty"`
+}
+
+// SourceDTO records where an extracted value came from and how sure the extractor was
+type SourceDTO struct {
+	Filename string `json:"filename"`
+	Page     int    `json:"page,omitempty"`
+	Snippet  string `json:"snippet,omitempty"`
+	// Confidence ranges from 0 (guess) to 1 (certain)
+	Confidence float64 `json:"confidence"`
+	// NeedsReview is set when Confidence is below the configured threshold
+	NeedsReview bool `json:"needs_review,omitempty"`
+	// Email names the email the value was read from, for documents sent as emails
+	Email *EmailDTO `json:"email,omitempty"`
+}
+
+// EmailDTO names the email a document was the body or an attachment of
+type EmailDTO struct {
+	Subject string `json:"subject"`
+	From    string `json:"from"`
 }
 
 func (tx *TransactionDTO) Validate(fieldPrefix string) error {
@@ -102,6 +89,8 @@ type AssigneeDTO struct {
 	Position     string           `json:"position"`
 	Rank         string           `json:"rank"`
 	Transactions []TransactionDTO `json:"transactions"`
+	// FieldSources holds provenance per assignee field, keyed by JSON field name
+	FieldSources map[string]SourceDTO `json:"field_sources,omitempty"`
 }
 
 func (a *AssigneeDTO) Validate(index int) error {
@@ -134,28 +123,38 @@ func (a *AssigneeDTO) Validate(index int) error {
 
 // RecapReportDTO represents the overall structure of the recap report
 type RecapReportDTO struct {
-	StartDate            string        `json:"startDate"`
-	EndDate              string        `json:"endDate"`
+	StartDate            date.Date     `json:"startDate"`
+	EndDate              date.Date     `json:"endDate"`
 	ActivityPurpose      string        `json:"activityPurpose"` // This maps to Destination in current GenerateRecapExcelRequest
 	DestinationCity      string        `json:"destinationCity"`
-	SpdDate              string        `json:"spdDate"`
-	DepartureDate        string        `json:"departureDate"`
-	ReturnDate           string        `json:"returnDate"`
-	ReceiptSignatureDate string        `json:"receiptSignatureDate"`
+	SpdDate              date.Date     `json:"spdDate"`
+	DepartureDate        date.Date     `json:"departureDate"`
+	ReturnDate           date.Date     `json:"returnDate"`
+	ReceiptSignatureDate date.Date     `json:"receiptSignatureDate"`
 	Assignees            []AssigneeDTO `json:"assignees"`
+	// Unassigned holds receipts whose booker could not be matched to an assignee.
+	// They must be moved to an assignee before the Excel recap is generated.
+	Unassigned []UnassignedTransactionDTO `json:"unassigned"`
+}
+
+// UnassignedTransactionDTO is a transaction waiting for the user to pick its assignee
+type UnassignedTransactionDTO struct {
+	Transaction TransactionDTO `json:"transaction"`
+	// Suggestion is the closest assignee name, if any came near
+	Suggestion string  `json:"suggestion,omitempty"`
+	Score      float64 `json:"score"`
 }
 
 func (r *RecapReportDTO) Validate() error {
 	// Validate main report structure
 	if err := validation.ValidateStruct(r,
-		validation.Field(&r.StartDate, validation.Required, validation.Match(dateFormatRegex)),
-		validation.Field(&r.EndDate, validation.Required, validation.Match(dateFormatRegex)),
+		validation.Field(&r.StartDate, requiredDate),
+		validation.Field(&r.EndDate, requiredDate),
 		validation.Field(&r.ActivityPurpose, validation.Required, validation.Length(1, 1000)),
 		validation.Field(&r.DestinationCity, validation.Required, validation.Length(1, 100)),
-		validation.Field(&r.SpdDate, validation.Required, validation.Match(dateFormatRegex)),
-		validation.Field(&r.DepartureDate, validation.Required, validation.Match(dateFormatRegex)),
-		validation.Field(&r.ReturnDate, validation.Required, validation.Match(dateFormatRegex)),
-		validation.Field(&r.ReceiptSignatureDate, validation.Match(dateFormatRegex)),
+		validation.Field(&r.SpdDate, requiredDate),
+		validation.Field(&r.DepartureDate, requiredDate),
+		validation.Field(&r.ReturnDate, requiredDate),
 		validation.Field(&r.Assignees, validation.Required),
 	); err != nil {
 		return err
@@ -171,6 +170,10 @@ func (r *RecapReportDTO) Validate() error {
 		return validation.NewError("assignees", "at least one assignee is required")
 	}
 
+	if len(r.Unassigned) > 0 {
+		return validation.NewError("unassigned", fmt.Sprintf("%d transaction(s) are not assigned to anyone; move them to an assignee first", len(r.Unassigned)))
+	}
+
 	for i, assignee := range r.Assignees {
 		if err := assignee.Validate(i); err != nil {
 			return err
@@ -181,57 +184,107 @@ func (r *RecapReportDTO) Validate() error {
 }
 
 func (r *RecapReportDTO) validateDateLogic() error {
-	startDate, err := parseIndonesianDate(r.StartDate)
-	if err != nil {
-		return validation.NewError("startDate", fmt.Sprintf("invalid start date format: %v (expected format: '25 Oktober 2025')", err))
+	// Validate date relationships
+	if r.StartDate.After(r.EndDate) {
+		return validation.NewError("date_range", "start date must be before or equal to end date")
 	}
 
-	endDate, err := parseIndonesianDate(r.EndDate)
-	if err != nil {
-		return validation.NewError("endDate", fmt.Sprintf("invalid end date format: %v (expected format: '25 Oktober 2025')", err))
+	if r.DepartureDate.After(r.ReturnDate) {
+		return validation.NewError("travel_dates", "departure date must be before or equal to return date")
 	}
 
-	_, err = parseIndonesianDate(r.SpdDate)
-	if err != nil {
-		return validation.NewError("spdDate", fmt.Sprintf("invalid SPD date format: %v (expected format: '25 Oktober 2025')", err))
+	// Receipt signature date validation (if provided)
+	if !r.ReceiptSignatureDate.IsZero() && r.ReceiptSignatureDate.Before(r.ReturnDate) {
+		return validation.NewError("receiptSignatureDate", "receipt signature date must be after or equal to return date")
 	}
 
-	departureDate, err := parseIndonesianDate(r.DepartureDate)
-	if err != nil {
-		return validation.NewError("departureDate", fmt.Sprintf("invalid departure date format: %v (expected format: '25 Oktober 2025')", err))
-	}
+	return nil
+}
 
-	returnDate, err := parseIndonesianDate(r.ReturnDate)
-	if err != nil {
-		return validation.NewError("returnDate", fmt.Sprintf("invalid return date format: %v (expected format: '25 Oktober 2025')", err))
+// requiredDate rejects unset dates; the format itself is checked when the JSON is decoded
+var requiredDate = validation.By(func(value interface{}) error {
+	if d, ok := value.(date.Date); ok && d.IsZero() {
+		return validation.NewError("validation_required", "cannot be blank")
 	}
+	return nil
+})
+
+// ValidateExtracted checks a report produced by an extraction backend before it
+// is handed back to the user. Unlike Validate it accepts the partial report of a
+// single receipt.
+func (r *RecapReportDTO) ValidateExtracted(requireTripDetails bool) error {
+	errs := validation.Errors{}
+
+	if requireTripDetails {
+		required := map[string]string{
+			"activityPurpose": r.ActivityPurpose,
+			"destinationCity": r.DestinationCity,
+		}
+		for field, value := range required {
+			if strings.TrimSpace(value) == "" {
+				errs[field] = validation.NewError("required", "cannot be blank")
+			}
+		}
 
-	// Validate date relationships
-	if startDate.After(endDate) {
-		return validation.NewError("date_range", "start date must be before or equal to end date")
-	}
+		dates := map[string]date.Date{
+			"startDate":     r.StartDate,
+			"endDate":       r.EndDate,
+			"spdDate":       r.SpdDate,
+			"departureDate": r.DepartureDate,
+			"returnDate":    r.ReturnDate,
+		}
+		for field, value := range dates {
+			if value.IsZero() {
+				errs[field] = validation.NewError("required", "cannot be blank")
+			}
+		}
+		if r.StartDate.After(r.EndDate) && !r.EndDate.IsZero() {
+			errs["date_range"] = validation.NewError("date_range", "start date must be before or equal to end date")
+		}
+		if r.DepartureDate.After(r.ReturnDate) && !r.ReturnDate.IsZero() {
+			errs["travel_dates"] = validation.NewError("travel_dates", "departure date must be before or equal to return date")
+		}
 
-	if departureDate.After(returnDate) {
-		return validation.NewError("travel_dates", "departure date must be before or equal to return date")
+		if len(r.Assignees) == 0 {
+			errs["assignees"] = validation.NewError("required", "at least one assignee is required")
+		}
 	}
 
-	// Receipt signature date validation (if provided)
-	if r.ReceiptSignatureDate != "" {
-		receiptDate, err := parseIndonesianDate(r.ReceiptSignatureDate)
-		if err != nil {
-			return validation.NewError("receiptSignatureDate", fmt.Sprintf("invalid receipt signature date format: %v (expected format: '25 Oktober 2025')", err))
+	for i, assignee := range r.Assignees {
+		prefix := fmt.Sprintf("assignees[%d]", i)
+		if requireTripDetails {
+			if strings.TrimSpace(assignee.Name) == "" {
+				errs[prefix+".name"] = validation.NewError("required", "cannot be blank")
+			}
+			if strings.TrimSpace(assignee.EmployeeID) == "" {
+				errs[prefix+".employee_id"] = validation.NewError("required", "cannot be blank")
+			}
 		}
-		if receiptDate.Before(returnDate) {
-			return validation.NewError("receiptSignatureDate", "receipt signature date must be after or equal to return date")
+		for j, tx := range assignee.Transactions {
+			txPrefix := fmt.Sprintf("%s.transactions[%d]", prefix, j)
+			if err := tx.Validate(txPrefix); err != nil {
+				errs[txPrefix] = err
+			}
 		}
 	}
 
-	return nil
+	return errs.Filter()
 }
 
 // ExtractTransactionsRequest represents the request for extracting transactions
 type ExtractTransactionsRequest struct {
 	Files []FileUpload
+	// Backend selects the extraction backend; empty uses the deployment default
+	Backend string
+	// Refresh bypasses cached results for the same documents
+	Refresh bool
+	// TripCategory selects the daily allowance rate: luar_kota (default), dalam_kota or diklat
+	TripCategory string
+	// Assignees are the names of the expected travellers, passed to the prompt as hints
+	Assignees []string
+	// Endpoint and Client attribute the tokens spent to the route and API client that asked
+	Endpoint string
+	Client   string
 }
 
 // FileUpload represents an uploaded file
@@ -239,23 +292,110 @@ type FileUpload struct {
 	Content  []byte
 	Filename string
 	MimeType string
+	// OriginalSize is the size of the file as uploaded, before conversion and preprocessing
+	OriginalSize int64
+	// Preprocessing lists the steps applied to the upload, if any
+	Preprocessing []string
+	// Pages are the pages of the uploaded PDF this document was split from; empty when it was not split
+	Pages []int
+	// Email is the email the document was taken from; nil for other uploads
+	Email *EmailDTO
 }
 
 // ExtractTransactionsResponse represents the response
 type ExtractTransactionsResponse struct {
-	Report RecapReportDTO `json:"report"`
+	Report  RecapReportDTO `json:"report"`
+	Backend string         `json:"backend"`
+	// PromptVersion is the prompt template the report was extracted with; empty for backends without a prompt
+	PromptVersion string              `json:"prompt_version"`
+	Documents     []DocumentResultDTO `json:"documents"`
+	// Duplicates lists every pair of transactions that looked like the same expense
+	Duplicates []DuplicateDecisionDTO `json:"duplicates"`
+	// LodgingOverages lists accommodation priced above the traveller's SBM ceiling
+	LodgingOverages []LodgingOverageDTO `json:"lodging_overages"`
+	// Warnings lists post-processing steps that could not be completed, such as the daily allowance
+	Warnings []string `json:"warnings"`
+	// Cached is true when the report was served from the cache without calling the backend
+	Cached bool `json:"cached"`
+	// Usage is the tokens the LLM calls of this request were billed for
+	Usage TokenUsageDTO `json:"usage"`
+}
+
+// LodgingOverageDTO is an accommodation transaction above the per-night lodging
+// ceiling for the destination province and the traveller's class. The rekap
+// reimburses Ceiling per night and shows Excess separately.
+type LodgingOverageDTO struct {
+	Assignee    string            `json:"assignee"`
+	Province    string            `json:"province"`
+	Class       string            `json:"class"`
+	Ceiling     int32             `json:"ceiling"`
+	PerNight    int32             `json:"per_night"`
+	Nights      int32             `json:"nights"`
+	Excess      int32             `json:"excess"`
+	Version     string            `json:"version"`
+	Transaction TransactionRefDTO `json:"transaction"`
+}
+
+// DuplicateDecisionDTO records how two transactions that looked like the same
+// expense were handled: "merged" into one, or both kept and "flagged" for review
+type DuplicateDecisionDTO struct {
+	Assignee  string            `json:"assignee"`
+	Action    string            `json:"action"`
+	Score     float64           `json:"score"`
+	Reason    string            `json:"reason"`
+	Kept      TransactionRefDTO `json:"kept"`
+	Duplicate TransactionRefDTO `json:"duplicate"`
+}
+
+// TransactionRefDTO identifies a transaction in a duplicate decision
+type TransactionRefDTO struct {
+	Type        string    `json:"type"`
+	Subtype     string    `json:"subtype"`
+	Subtotal    int32     `json:"subtotal"`
+	Date        date.Date `json:"date"`
+	Description string    `json:"description"`
+	Filename    string    `json:"filename,omitempty"`
 }
 
+// DocumentResultDTO reports how a single uploaded file was classified and whether it was extracted
+type DocumentResultDTO struct {
+	Filename string `json:"filename"`
+	// Pages are the pages of the uploaded PDF the document was split from
+	Pages []int  `json:"pages,omitempty"`
+	Kind  string `json:"kind"`
+	// Parser names the offline vendor parser that read the document, when one recognized it
+	Parser string `json:"parser,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Preprocessing reports how the file was converted or shrunk before extraction; absent when it was sent as uploaded
+	Preprocessing *PreprocessingDTO `json:"preprocessing,omitempty"`
+	// Email is the email the document was the body or an attachment of
+	Email *EmailDTO `json:"email,omitempty"`
+}
+
+// PreprocessingDTO reports the steps applied to an uploaded file and the bytes they saved
+type PreprocessingDTO struct {
+	Steps         []string `json:"steps"`
+	OriginalBytes int64    `json:"original_bytes"`
+	Bytes         int64    `json:"bytes"`
+	BytesSaved    int64    `json:"bytes_saved"`
+}
+
+const (
+	DocumentStatusExtracted = "extracted"
+	DocumentStatusFailed    = "failed"
+)
+
 // GenerateRecapExcelRequest represents the request for generating the recap Excel
 type GenerateRecapExcelRequest struct {
-	StartDate            string        `json:"startDate"`
-	EndDate              string        `json:"endDate"`
+	StartDate            date.Date     `json:"startDate"`
+	EndDate              date.Date     `json:"endDate"`
 	ActivityPurpose      string        `json:"activityPurpose"`
 	DestinationCity      string        `json:"destinationCity"`
-	SpdDate              string        `json:"spdDate"`
-	DepartureDate        string        `json:"departureDate"`
-	ReturnDate           string        `json:"returnDate"`
-	ReceiptSignatureDate string        `json:"receiptSignatureDate"`
+	SpdDate              date.Date     `json:"spdDate"`
+	DepartureDate        date.Date     `json:"departureDate"`
+	ReturnDate           date.Date     `json:"returnDate"`
+	ReceiptSignatureDate date.Date     `json:"receiptSignatureDate"`
 	Assignees            []AssigneeDTO `json:"assignees"`
 }
 
@@ -0,0 +1,51 @@
+package dto
+
+import "github.com/invopop/validation"
+
+// TokenUsageDTO is the tokens billed for one or more LLM calls and their estimated cost
+type TokenUsageDTO struct {
+	PromptTokens    int64 `json:"prompt_tokens"`
+	CandidateTokens int64 `json:"candidate_tokens"`
+	TotalTokens     int64 `json:"total_tokens"`
+	Calls           int   `json:"calls"`
+	// CostUSD is estimated from the configured prices; zero when none are set
+	CostUSD float64 `json:"cost_usd"`
+}
+
+// UsageRowDTO is the usage of one day, endpoint or API client
+type UsageRowDTO struct {
+	Key string `json:"key"`
+	TokenUsageDTO
+}
+
+// BudgetStatusDTO is the monthly token budget and how much of it is used
+type BudgetStatusDTO struct {
+	Month string `json:"month"`
+	Used  int64  `json:"used"`
+	// SoftLimit and HardLimit are zero when no budget is configured
+	SoftLimit int64  `json:"soft_limit"`
+	HardLimit int64  `json:"hard_limit"`
+	State     string `json:"state"`
+}
+
+// UsageReportDTO is the token usage of one month
+type UsageReportDTO struct {
+	Month      string          `json:"month"`
+	Total      TokenUsageDTO   `json:"total"`
+	ByDay      []UsageRowDTO   `json:"by_day"`
+	ByEndpoint []UsageRowDTO   `json:"by_endpoint"`
+	ByClient   []UsageRowDTO   `json:"by_client"`
+	Budget     BudgetStatusDTO `json:"budget"`
+}
+
+// UsageReportRequest selects the month to report, formatted as 2006-01; empty is the current month
+type UsageReportRequest struct {
+	Month string `query:"month"`
+}
+
+// Validate validates the report request
+func (r UsageReportRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Month, validation.Date("2006-01").Error("must be formatted as YYYY-MM")),
+	)
+}
@@ -2,37 +2,206 @@ package usecase
 
 import (
 	"context"
+	"fmt"
+	"log"
 
 	"sandbox/application/dto"
+	"sandbox/domain/sbm"
 	"sandbox/domain/transaction"
+	"sandbox/domain/usage"
 )
 
 type ExtractTransactionsUseCase struct {
 	transactionService *transaction.Service
+	ledger             *usage.Ledger
 }
 
-func NewExtractTransactionsUseCase(transactionService *transaction.Service) *ExtractTransactionsUseCase {
+func NewExtractTransactionsUseCase(transactionService *transaction.Service, ledger *usage.Ledger) *ExtractTransactionsUseCase {
 	return &ExtractTransactionsUseCase{
 		transactionService: transactionService,
+		ledger:             ledger,
 	}
 }
 
+// CheckBudget refuses new extractions once the monthly token budget is spent
+func (uc *ExtractTransactionsUseCase) CheckBudget() error {
+	return uc.ledger.Check()
+}
+
 func (uc *ExtractTransactionsUseCase) Execute(ctx context.Context, req dto.ExtractTransactionsRequest) (*dto.ExtractTransactionsResponse, error) {
+	return uc.ExecuteWithProgress(ctx, req, nil)
+}
+
+// ExecuteWithProgress runs the extraction, calling progress, when set, as each
+// document is classified and extracted
+func (uc *ExtractTransactionsUseCase) ExecuteWithProgress(ctx context.Context, req dto.ExtractTransactionsRequest, progress func(dto.DocumentProgressDTO)) (*dto.ExtractTransactionsResponse, error) {
+	if err := uc.CheckBudget(); err != nil {
+		return nil, err
+	}
+
 	documents := make([]transaction.Document, len(req.Files))
 	for i, file := range req.Files {
 		documents[i] = transaction.Document{
 			Content:  file.Content,
 			MimeType: file.MimeType,
 			Filename: file.Filename,
+			Pages:    file.Pages,
+		}
+		if file.Email != nil {
+			documents[i].Email = &transaction.EmailOrigin{Subject: file.Email.Subject, From: file.Email.From}
 		}
 	}
 
-	recapReport, err := uc.transactionService.ExtractTransactions(ctx, documents)
+	category, err := sbm.ParseTripCategory(req.TripCategory)
 	if err != nil {
 		return nil, err
 	}
 
+	opts := transaction.ExtractOptions{
+		Backend:       req.Backend,
+		Refresh:       req.Refresh,
+		TripCategory:  category,
+		AssigneeHints: req.Assignees,
+	}
+	if progress != nil {
+		opts.Progress = func(p transaction.DocumentProgress) {
+			progress(toDocumentProgressDTO(p))
+		}
+	}
+
+	// Tokens are billed for failed extractions too, so they are recorded either way
+	meter := &usage.Meter{}
+	result, err := uc.transactionService.ExtractTransactions(usage.WithMeter(ctx, meter), documents, opts)
+	tokens := meter.Tokens()
+	budget, recordErr := uc.ledger.Record(context.WithoutCancel(ctx), req.Endpoint, req.Client, tokens)
+	if recordErr != nil {
+		log.Printf("Failed to record token usage: %v", recordErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	warnings := append([]string{}, result.Warnings...)
+	switch budget.State {
+	case usage.BudgetStateWarning:
+		warnings = append(warnings, fmt.Sprintf("monthly token budget nearly spent: %d of %d tokens used in %s",
+			budget.Used, budget.HardLimit, budget.Month))
+	case usage.BudgetStateExceeded:
+		warnings = append(warnings, fmt.Sprintf("monthly token budget exceeded: %d of %d tokens used in %s; new extractions are refused until next month",
+			budget.Used, budget.HardLimit, budget.Month))
+	}
+
+	documentResults := make([]dto.DocumentResultDTO, len(result.Documents))
+	for i, outcome := range result.Documents {
+		documentResults[i] = dto.DocumentResultDTO{
+			Filename: outcome.Filename,
+			Pages:    outcome.Pages,
+			Kind:     string(outcome.Kind),
+			Parser:   outcome.Parser,
+			Status:   dto.DocumentStatusExtracted,
+		}
+		if outcome.Err != nil {
+			documentResults[i].Status = dto.DocumentStatusFailed
+			documentResults[i].Error = outcome.Err.Error()
+		}
+		// Outcomes keep the order of the uploaded files
+		documentResults[i].Preprocessing = toPreprocessingDTO(req.Files[i])
+		documentResults[i].Email = req.Files[i].Email
+	}
+
+	duplicates := make([]dto.DuplicateDecisionDTO, len(result.Duplicates))
+	for i, decision := range result.Duplicates {
+		duplicates[i] = dto.DuplicateDecisionDTO{
+			Assignee:  decision.Assignee,
+			Action:    string(decision.Action),
+			Score:     decision.Score,
+			Reason:    decision.Reason,
+			Kept:      toTransactionRefDTO(decision.Kept),
+			Duplicate: toTransactionRefDTO(decision.Duplicate),
+		}
+	}
+
 	return &dto.ExtractTransactionsResponse{
-		Report: *recapReport,
+		Report:          *result.Report,
+		Backend:         result.Backend,
+		PromptVersion:   result.PromptVersion,
+		Documents:       documentResults,
+		Duplicates:      duplicates,
+		LodgingOverages: toLodgingOverageDTOs(result.LodgingOverages),
+		Warnings:        warnings,
+		Cached:          result.Cached,
+		Usage:           toTokenUsageDTO(tokens, uc.ledger.Prices()),
 	}, nil
 }
+
+func toTokenUsageDTO(t usage.Tokens, prices usage.Prices) dto.TokenUsageDTO {
+	return dto.TokenUsageDTO{
+		PromptTokens:    t.Prompt,
+		CandidateTokens: t.Candidates,
+		TotalTokens:     t.Total,
+		Calls:           t.Calls,
+		CostUSD:         prices.Cost(t),
+	}
+}
+
+func toTransactionRefDTO(tx dto.TransactionDTO) dto.TransactionRefDTO {
+	ref := dto.TransactionRefDTO{
+		Type:        tx.Type,
+		Subtype:     tx.Subtype,
+		Subtotal:    tx.Subtotal,
+		Date:        tx.Date,
+		Description: tx.Description,
+	}
+	if tx.Source != nil {
+		ref.Filename = tx.Source.Filename
+	}
+	return ref
+}
+
+func toLodgingOverageDTOs(overages []transaction.LodgingOverage) []dto.LodgingOverageDTO {
+	dtos := make([]dto.LodgingOverageDTO, len(overages))
+	for i, overage := range overages {
+		dtos[i] = dto.LodgingOverageDTO{
+			Assignee:    overage.Assignee,
+			Province:    overage.Ceiling.Province,
+			Class:       string(overage.Ceiling.Class),
+			Ceiling:     overage.Ceiling.PerNight,
+			PerNight:    overage.PerNight,
+			Nights:      overage.Nights,
+			Excess:      overage.Excess,
+			Version:     overage.Ceiling.Version,
+			Transaction: toTransactionRefDTO(overage.Transaction),
+		}
+	}
+	return dtos
+}
+
+func toDocumentProgressDTO(p transaction.DocumentProgress) dto.DocumentProgressDTO {
+	progress := dto.DocumentProgressDTO{
+		Index:     p.Index,
+		Total:     p.Total,
+		Completed: p.Completed,
+		Filename:  p.Filename,
+		Kind:      string(p.Kind),
+		Stage:     string(p.Stage),
+	}
+	if p.Err != nil {
+		progress.Error = p.Err.Error()
+	}
+	return progress
+}
+
+// toPreprocessingDTO reports what was done to an upload before extraction, or
+// nil when it was sent as uploaded
+func toPreprocessingDTO(file dto.FileUpload) *dto.PreprocessingDTO {
+	if len(file.Preprocessing) == 0 {
+		return nil
+	}
+	size := int64(len(file.Content))
+	return &dto.PreprocessingDTO{
+		Steps:         file.Preprocessing,
+		OriginalBytes: file.OriginalSize,
+		Bytes:         size,
+		BytesSaved:    file.OriginalSize - size,
+	}
+}
@@ -0,0 +1,114 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+
+	"sandbox/application/dto"
+	domainErrors "sandbox/domain/errors"
+	"sandbox/domain/job"
+)
+
+// ExtractionJobsUseCase runs extractions in the background so that clients do
+// not have to hold a connection open while the extractor works
+type ExtractionJobsUseCase struct {
+	extractUseCase *ExtractTransactionsUseCase
+	queue          *job.Queue
+}
+
+func NewExtractionJobsUseCase(extractUseCase *ExtractTransactionsUseCase, queue *job.Queue) *ExtractionJobsUseCase {
+	return &ExtractionJobsUseCase{
+		extractUseCase: extractUseCase,
+		queue:          queue,
+	}
+}
+
+// Submit queues an extraction and returns the job without waiting for it
+func (uc *ExtractionJobsUseCase) Submit(req dto.ExtractTransactionsRequest) (*dto.ExtractionJobDTO, error) {
+	if err := uc.extractUseCase.CheckBudget(); err != nil {
+		return nil, err
+	}
+
+	submitted, err := uc.queue.Submit(func(ctx context.Context, progress func(interface{})) (interface{}, error) {
+		return uc.extractUseCase.ExecuteWithProgress(ctx, req, func(p dto.DocumentProgressDTO) {
+			progress(p)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ToExtractionJobDTO(submitted), nil
+}
+
+// Get returns the current state of a job
+func (uc *ExtractionJobsUseCase) Get(id string) (*dto.ExtractionJobDTO, error) {
+	found, err := uc.queue.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	return ToExtractionJobDTO(found), nil
+}
+
+// Cancel stops a queued or running job
+func (uc *ExtractionJobsUseCase) Cancel(id string) (*dto.ExtractionJobDTO, error) {
+	cancelled, err := uc.queue.Cancel(id)
+	if err != nil {
+		return nil, err
+	}
+	return ToExtractionJobDTO(cancelled), nil
+}
+
+// Subscribe returns the job's past events and a channel of the ones that follow;
+// see job.Queue.Subscribe
+func (uc *ExtractionJobsUseCase) Subscribe(id string) ([]job.Event, <-chan job.Event, func(), error) {
+	return uc.queue.Subscribe(id)
+}
+
+// ToExtractionJobDTO converts a job snapshot into its API representation
+func ToExtractionJobDTO(j job.Job) *dto.ExtractionJobDTO {
+	jobDTO := &dto.ExtractionJobDTO{
+		ID:        j.ID,
+		Status:    string(j.Status),
+		CreatedAt: j.CreatedAt,
+	}
+
+	if !j.StartedAt.IsZero() {
+		startedAt := j.StartedAt
+		jobDTO.StartedAt = &startedAt
+	}
+	if !j.FinishedAt.IsZero() {
+		finishedAt := j.FinishedAt
+		jobDTO.FinishedAt = &finishedAt
+	}
+	if progress, ok := j.LastProgress.(dto.DocumentProgressDTO); ok {
+		jobDTO.Progress = &progress
+	}
+	if result, ok := j.Result.(*dto.ExtractTransactionsResponse); ok {
+		jobDTO.Result = result
+	}
+
+	if j.Err != nil {
+		jobDTO.Error = j.Err.Error()
+		var domainErr *domainErrors.DomainError
+		if errors.As(j.Err, &domainErr) {
+			jobDTO.ErrorCode = domainErr.Code
+		}
+	}
+
+	return jobDTO
+}
+
+// ToExtractionEventDTO converts a job event into its API representation
+func ToExtractionEventDTO(event job.Event) dto.ExtractionEventDTO {
+	eventDTO := dto.ExtractionEventDTO{
+		Seq:    event.Seq,
+		Type:   string(event.Type),
+		Time:   event.Time,
+		Status: string(event.Status),
+	}
+	if progress, ok := event.Data.(dto.DocumentProgressDTO); ok {
+		eventDTO.Document = &progress
+	}
+	return eventDTO
+}
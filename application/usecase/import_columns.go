@@ -0,0 +1,259 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sandbox/domain/date"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// importField is a column of the documented import layout. Headers are
+// matched on the field name or one of its aliases, ignoring case, spaces and
+// punctuation, so "No. SPD" matches spd_number.
+type importField struct {
+	name    string
+	aliases []string
+}
+
+// Assignee and transaction columns, one row per transaction
+var importRowFields = []importField{
+	{name: "name", aliases: []string{"nama", "nama_pegawai"}},
+	{name: "employee_id", aliases: []string{"nip"}},
+	{name: "spd_number", aliases: []string{"nomor_spd", "no_spd"}},
+	{name: "position", aliases: []string{"jabatan"}},
+	{name: "rank", aliases: []string{"pangkat", "golongan", "pangkat_golongan"}},
+	{name: "type", aliases: []string{"jenis"}},
+	{name: "subtype", aliases: []string{"sub_jenis", "subjenis"}},
+	{name: "amount", aliases: []string{"harga", "tarif", "biaya", "nominal"}},
+	{name: "total_night", aliases: []string{"malam", "jumlah_malam"}},
+	{name: "subtotal", aliases: []string{"jumlah", "total"}},
+	{name: "payment_type", aliases: []string{"cara_bayar", "pembayaran"}},
+	{name: "description", aliases: []string{"keterangan", "uraian"}},
+	{name: "transport_detail", aliases: []string{"detail_transport"}},
+	{name: "date", aliases: []string{"tanggal", "tanggal_transaksi"}},
+}
+
+// Trip columns, which may instead be sent as form fields. A trip column must
+// hold the same value on every row that fills it.
+var importTripFields = []importField{
+	{name: "start_date", aliases: []string{"tanggal_mulai"}},
+	{name: "end_date", aliases: []string{"tanggal_selesai"}},
+	{name: "activity_purpose", aliases: []string{"maksud_perjalanan", "kegiatan"}},
+	{name: "destination_city", aliases: []string{"kota_tujuan", "tujuan"}},
+	{name: "spd_date", aliases: []string{"tanggal_spd"}},
+	{name: "departure_date", aliases: []string{"tanggal_berangkat"}},
+	{name: "return_date", aliases: []string{"tanggal_kembali"}},
+	{name: "receipt_signature_date", aliases: []string{"tanggal_kwitansi"}},
+}
+
+// ImportTripFields returns the names of the trip fields, which an import
+// request may send as form fields instead of columns
+func ImportTripFields() []string {
+	names := make([]string, len(importTripFields))
+	for i, field := range importTripFields {
+		names[i] = field.name
+	}
+	return names
+}
+
+// requiredImportFields must have a column; amount or subtotal must too
+var requiredImportFields = []string{"name", "employee_id", "spd_number", "position", "rank", "type"}
+
+// importTypes maps the accepted spellings of a transaction type to the type
+var importTypes = map[string]string{
+	"accommodation": "accommodation",
+	"akomodasi":     "accommodation",
+	"penginapan":    "accommodation",
+	"hotel":         "accommodation",
+	"transport":     "transport",
+	"transportasi":  "transport",
+	"allowance":     "allowance",
+	"uang_harian":   "allowance",
+	"other":         "other",
+	"lainnya":       "other",
+	"lain_lain":     "other",
+}
+
+// importLayout locates the fields of the layout among the columns of a file
+type importLayout struct {
+	columns map[string]int
+	headers map[string]string
+}
+
+// newImportLayout matches the header row against the layout. A mapping entry
+// names the header holding a field, overriding the header matching that field.
+func newImportLayout(header []string, mapping map[string]string) (*importLayout, error) {
+	layout := &importLayout{columns: map[string]int{}, headers: map[string]string{}}
+
+	known := map[string]string{}
+	for _, fields := range [][]importField{importRowFields, importTripFields} {
+		for _, field := range fields {
+			known[field.name] = field.name
+			for _, alias := range field.aliases {
+				known[alias] = field.name
+			}
+		}
+	}
+
+	mapped := map[int]bool{}
+	fields := make([]string, 0, len(mapping))
+	for field := range mapping {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		name := normalizeHeader(field)
+		if known[name] != name {
+			return nil, fmt.Errorf("mapping names unknown field %q", field)
+		}
+		column := -1
+		for i, h := range header {
+			if normalizeHeader(h) == normalizeHeader(mapping[field]) {
+				column = i
+				break
+			}
+		}
+		if column < 0 {
+			return nil, fmt.Errorf("column %q mapped to %s is not in the file", mapping[field], name)
+		}
+		layout.columns[name] = column
+		layout.headers[name] = header[column]
+		mapped[column] = true
+	}
+
+	for i, h := range header {
+		field := known[normalizeHeader(h)]
+		if field == "" || mapped[i] {
+			continue
+		}
+		if _, ok := layout.columns[field]; !ok {
+			layout.columns[field] = i
+			layout.headers[field] = h
+		}
+	}
+
+	var missing []string
+	for _, field := range requiredImportFields {
+		if _, ok := layout.columns[field]; !ok {
+			missing = append(missing, field)
+		}
+	}
+	if !layout.has("amount") && !layout.has("subtotal") {
+		missing = append(missing, "amount or subtotal")
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("file has no column for %s; use the documented headers or send a mapping", strings.Join(missing, ", "))
+	}
+	return layout, nil
+}
+
+func (l *importLayout) has(field string) bool {
+	_, ok := l.columns[field]
+	return ok
+}
+
+// value returns the cell of field in row, or "" when the file has no such column
+func (l *importLayout) value(row []string, field string) string {
+	if column, ok := l.columns[field]; ok && column < len(row) {
+		return row[column]
+	}
+	return ""
+}
+
+// header names the column of field as the file does, for error messages
+func (l *importLayout) header(field string) string {
+	if h, ok := l.headers[field]; ok {
+		return h
+	}
+	return field
+}
+
+// normalizeHeader lowercases a header and joins its words with underscores
+func normalizeHeader(h string) string {
+	words := strings.FieldsFunc(strings.ToLower(h), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	})
+	return strings.Join(words, "_")
+}
+
+// parseImportType reads a transaction type in English or Indonesian
+func parseImportType(s string) (string, error) {
+	if t, ok := importTypes[normalizeHeader(s)]; ok {
+		return t, nil
+	}
+	return "", fmt.Errorf("%q is not a transaction type; use accommodation, transport, allowance or other", s)
+}
+
+// parseImportAmount reads a rupiah amount written as a plain number, with
+// Indonesian (1.450.000,00) or English (1,450,000.00) separators, and with or
+// without an Rp or IDR prefix. Cents are rounded.
+func parseImportAmount(s string) (int32, error) {
+	cleaned := strings.NewReplacer(" ", "", "\u00a0", "", "RP", "", "IDR", "").Replace(strings.ToUpper(s))
+	cleaned = strings.TrimLeft(cleaned, ".:")
+	cleaned = strings.TrimSuffix(strings.TrimSuffix(cleaned, ",-"), ".-")
+	if strings.HasPrefix(cleaned, "-") {
+		return 0, errors.New("amount cannot be negative")
+	}
+
+	// A separator is the decimal point when it is the last of two kinds, or
+	// the only one and not followed by exactly three digits
+	integer, fraction := cleaned, ""
+	lastDot, lastComma := strings.LastIndex(cleaned, "."), strings.LastIndex(cleaned, ",")
+	if last := max(lastDot, lastComma); last >= 0 {
+		separator := cleaned[last : last+1]
+		bothKinds := lastDot >= 0 && lastComma >= 0
+		if bothKinds || strings.Count(cleaned, separator) == 1 && len(cleaned)-last-1 != 3 {
+			integer, fraction = cleaned[:last], cleaned[last+1:]
+		}
+		integer = strings.NewReplacer(".", "", ",", "").Replace(integer)
+	}
+
+	value, err := strconv.ParseFloat(integer+"."+fraction+"0", 64)
+	if err != nil || integer == "" {
+		return 0, fmt.Errorf("%q is not an amount", s)
+	}
+	value = math.Round(value)
+	if value > math.MaxInt32 {
+		return 0, fmt.Errorf("%s is above the largest supported amount", s)
+	}
+	return int32(value), nil
+}
+
+// parseImportCount reads a whole, positive number such as a night count,
+// which a workbook may store as 2 or 2.0
+func parseImportCount(s string) (int32, error) {
+	value, err := strconv.ParseFloat(strings.ReplaceAll(s, ",", "."), 64)
+	if err != nil || value != math.Trunc(value) {
+		return 0, fmt.Errorf("%q is not a whole number", s)
+	}
+	if value < 1 || value > math.MaxInt16 {
+		return 0, fmt.Errorf("%s is not a positive number of nights", s)
+	}
+	return int32(value), nil
+}
+
+// parseImportDate reads a date in any format date.Parse accepts, or as the
+// serial number a workbook stores a date cell as
+func parseImportDate(s string) (date.Date, error) {
+	if serial, err := strconv.ParseFloat(s, 64); err == nil {
+		if serial < 1 || serial > 2958465 {
+			return date.Date{}, fmt.Errorf("%q is not a date", s)
+		}
+		t, err := excelize.ExcelDateToTime(serial, false)
+		if err != nil {
+			return date.Date{}, fmt.Errorf("%q is not a date", s)
+		}
+		return date.FromTime(t), nil
+	}
+	d, err := date.Parse(s)
+	if err != nil {
+		return date.Date{}, fmt.Errorf("%q is not a date", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,336 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"sandbox/application/dto"
+	"sandbox/domain/date"
+	domainErrors "sandbox/domain/errors"
+	"sandbox/domain/transaction"
+	"sandbox/infrastructure/spreadsheet"
+)
+
+// maxImportRowErrors bounds the row errors listed for one file
+const maxImportRowErrors = 100
+
+// ImportTransactionsUseCase builds a recap report from a spreadsheet of
+// transactions kept by the unit itself, as an alternative to extraction
+type ImportTransactionsUseCase struct {
+	transactionService *transaction.Service
+}
+
+func NewImportTransactionsUseCase(transactionService *transaction.Service) *ImportTransactionsUseCase {
+	return &ImportTransactionsUseCase{
+		transactionService: transactionService,
+	}
+}
+
+// Execute reads one transaction per row, grouping the rows into assignees by
+// employee ID. Every invalid row is reported at once, with its row number, so
+// the file can be fixed in one pass. The amounts are kept as given; lodging
+// above the SBM ceiling is only reported.
+func (uc *ImportTransactionsUseCase) Execute(ctx context.Context, req dto.ImportTransactionsRequest) (*dto.ImportTransactionsResponse, error) {
+	table, err := spreadsheet.Read(req.Filename, req.Content, req.Sheet)
+	if err != nil {
+		return nil, domainErrors.NewValidationError(fmt.Sprintf("cannot read %s: %v", req.Filename, err))
+	}
+
+	headerRow := -1
+	for i, row := range table.Rows {
+		if !isBlankRow(row) {
+			headerRow = i
+			break
+		}
+	}
+	if headerRow < 0 {
+		return nil, domainErrors.NewValidationError(fmt.Sprintf("%s has no header row", req.Filename))
+	}
+	layout, err := newImportLayout(table.Rows[headerRow], req.Mapping)
+	if err != nil {
+		return nil, domainErrors.NewValidationError(err.Error())
+	}
+
+	builder := &importBuilder{
+		layout:    layout,
+		filename:  req.Filename,
+		assignees: map[string]int{},
+		tripRows:  map[string]int{},
+		trip:      map[string]string{},
+	}
+	for field, value := range req.Trip {
+		if value = strings.TrimSpace(value); value != "" {
+			builder.trip[field] = value
+			builder.tripRows[field] = 0
+		}
+	}
+
+	rows := 0
+	for i := headerRow + 1; i < len(table.Rows); i++ {
+		if isBlankRow(table.Rows[i]) {
+			continue
+		}
+		builder.addRow(i+1, table.Rows[i])
+		rows++
+	}
+	if rows == 0 {
+		return nil, domainErrors.NewValidationError(fmt.Sprintf("%s has no transaction rows", req.Filename))
+	}
+
+	builder.setTrip()
+	if len(builder.errors) > 0 {
+		sort.SliceStable(builder.errors, func(i, j int) bool {
+			return builder.errors[i].Row < builder.errors[j].Row
+		})
+		invalid := map[int]bool{}
+		for _, rowErr := range builder.errors {
+			invalid[rowErr.Row] = true
+		}
+		details := builder.errors
+		if len(details) > maxImportRowErrors {
+			details = details[:maxImportRowErrors]
+		}
+		return nil, domainErrors.NewImportValidationError(len(invalid), details)
+	}
+
+	report := &builder.report
+	if err := report.Validate(); err != nil {
+		return nil, domainErrors.NewValidationError(err.Error())
+	}
+
+	overages, warnings := uc.transactionService.CheckLodging(report)
+	columns := make(map[string]string, len(layout.headers))
+	for field, header := range layout.headers {
+		columns[field] = header
+	}
+
+	return &dto.ImportTransactionsResponse{
+		Report:          *report,
+		Sheet:           table.Sheet,
+		Rows:            rows,
+		Columns:         columns,
+		LodgingOverages: toLodgingOverageDTOs(overages),
+		Warnings:        append([]string{}, warnings...),
+	}, nil
+}
+
+// importBuilder collects the report and the row errors of an import
+type importBuilder struct {
+	layout   *importLayout
+	filename string
+	report   dto.RecapReportDTO
+	// assignees indexes report.Assignees by employee ID; assigneeRows holds the
+	// row each assignee was first read from
+	assignees    map[string]int
+	assigneeRows []int
+	// trip holds the trip fields read so far and tripRows the row each came
+	// from, 0 for the form fields sent with the file
+	trip     map[string]string
+	tripRows map[string]int
+	errors   []dto.ImportRowErrorDTO
+}
+
+func (b *importBuilder) fail(row int, field, message string) {
+	b.errors = append(b.errors, dto.ImportRowErrorDTO{Row: row, Column: b.layout.header(field), Message: message})
+}
+
+// required returns the cell of field, failing the row when it is empty
+func (b *importBuilder) required(number int, row []string, field string) string {
+	value := b.layout.value(row, field)
+	if value == "" {
+		b.fail(number, field, "cannot be blank")
+	}
+	return value
+}
+
+func (b *importBuilder) addRow(number int, row []string) {
+	failed := len(b.errors)
+	for _, field := range importTripFields {
+		b.addTripValue(number, field.name, b.layout.value(row, field.name))
+	}
+
+	assignee := dto.AssigneeDTO{
+		Name:       b.required(number, row, "name"),
+		EmployeeID: b.required(number, row, "employee_id"),
+		SpdNumber:  b.required(number, row, "spd_number"),
+		Position:   b.required(number, row, "position"),
+		Rank:       b.required(number, row, "rank"),
+	}
+	tx := b.transaction(number, row)
+	if len(b.errors) > failed || assignee.EmployeeID == "" {
+		return
+	}
+	tx.Name = assignee.Name
+
+	key := strings.Join(strings.Fields(assignee.EmployeeID), "")
+	index, seen := b.assignees[key]
+	if !seen {
+		b.assignees[key] = len(b.report.Assignees)
+		b.assigneeRows = append(b.assigneeRows, number)
+		assignee.Transactions = []dto.TransactionDTO{tx}
+		b.report.Assignees = append(b.report.Assignees, assignee)
+		return
+	}
+
+	// Every row of an assignee repeats the same details
+	existing := &b.report.Assignees[index]
+	for _, details := range []struct{ field, first, value string }{
+		{"name", existing.Name, assignee.Name},
+		{"spd_number", existing.SpdNumber, assignee.SpdNumber},
+		{"position", existing.Position, assignee.Position},
+		{"rank", existing.Rank, assignee.Rank},
+	} {
+		if !strings.EqualFold(details.first, details.value) {
+			b.fail(number, details.field, fmt.Sprintf("%q differs from %q on row %d for employee %s",
+				details.value, details.first, b.assigneeRows[index], assignee.EmployeeID))
+		}
+	}
+	if len(b.errors) == failed {
+		existing.Transactions = append(existing.Transactions, tx)
+	}
+}
+
+// transaction reads the transaction columns of a row. A missing subtotal is
+// the amount times the nights; a missing amount is the subtotal per night.
+func (b *importBuilder) transaction(number int, row []string) dto.TransactionDTO {
+	tx := dto.TransactionDTO{
+		Subtype:         b.layout.value(row, "subtype"),
+		PaymentType:     b.layout.value(row, "payment_type"),
+		Description:     b.layout.value(row, "description"),
+		TransportDetail: b.layout.value(row, "transport_detail"),
+		Source: &dto.SourceDTO{
+			Filename:   b.filename,
+			Snippet:    fmt.Sprintf("row %d", number),
+			Confidence: 1,
+		},
+	}
+
+	if value := b.required(number, row, "type"); value != "" {
+		t, err := parseImportType(value)
+		if err != nil {
+			b.fail(number, "type", err.Error())
+		}
+		tx.Type = t
+	}
+
+	nights := int32(1)
+	if value := b.layout.value(row, "total_night"); value != "" {
+		n, err := parseImportCount(value)
+		if err != nil {
+			b.fail(number, "total_night", err.Error())
+		} else {
+			nights = n
+			tx.TotalNight = &n
+		}
+	}
+
+	amounts := map[string]*int32{"amount": &tx.Amount, "subtotal": &tx.Subtotal}
+	for _, field := range []string{"amount", "subtotal"} {
+		value := b.layout.value(row, field)
+		if value == "" {
+			continue
+		}
+		amount, err := parseImportAmount(value)
+		switch {
+		case err != nil:
+			b.fail(number, field, err.Error())
+		case amount == 0:
+			b.fail(number, field, "must be above 0")
+		default:
+			*amounts[field] = amount
+		}
+	}
+	switch {
+	case tx.Amount == 0 && tx.Subtotal == 0:
+		if b.layout.value(row, "amount") == "" && b.layout.value(row, "subtotal") == "" {
+			b.fail(number, "amount", "amount or subtotal is required")
+		}
+	case tx.Subtotal == 0:
+		if int64(tx.Amount)*int64(nights) > math.MaxInt32 {
+			b.fail(number, "amount", "amount times nights is above the largest supported amount")
+		} else {
+			tx.Subtotal = tx.Amount * nights
+		}
+	case tx.Amount == 0:
+		tx.Amount = tx.Subtotal / nights
+	}
+
+	if value := b.layout.value(row, "date"); value != "" {
+		d, err := parseImportDate(value)
+		if err != nil {
+			b.fail(number, "date", err.Error())
+		}
+		tx.Date = d
+	}
+	return tx
+}
+
+// addTripValue records a trip field read from a row, failing the row when it
+// differs from the value given earlier
+func (b *importBuilder) addTripValue(number int, field, value string) {
+	if value == "" {
+		return
+	}
+	existing, ok := b.trip[field]
+	switch {
+	case !ok:
+		b.trip[field] = value
+		b.tripRows[field] = number
+	case b.tripRows[field] == 0:
+		// The form field sent with the file takes precedence
+	case !strings.EqualFold(existing, value):
+		b.fail(number, field, fmt.Sprintf("%q differs from %q on row %d; the trip must be the same on every row",
+			value, existing, b.tripRows[field]))
+	}
+}
+
+// setTrip fills the trip header of the report from the collected trip fields
+func (b *importBuilder) setTrip() {
+	b.report.ActivityPurpose = b.trip["activity_purpose"]
+	b.report.DestinationCity = b.trip["destination_city"]
+
+	dates := map[string]*date.Date{
+		"start_date":             &b.report.StartDate,
+		"end_date":               &b.report.EndDate,
+		"spd_date":               &b.report.SpdDate,
+		"departure_date":         &b.report.DepartureDate,
+		"return_date":            &b.report.ReturnDate,
+		"receipt_signature_date": &b.report.ReceiptSignatureDate,
+	}
+	for _, field := range importTripFields {
+		target, ok := dates[field.name]
+		value := b.trip[field.name]
+		if !ok || value == "" {
+			continue
+		}
+		d, err := parseImportDate(value)
+		switch {
+		case err == nil:
+			*target = d
+		case b.tripRows[field.name] == 0:
+			b.errors = append(b.errors, dto.ImportRowErrorDTO{Column: field.name, Message: err.Error() + " (form field)"})
+		default:
+			b.fail(b.tripRows[field.name], field.name, err.Error())
+		}
+	}
+
+	// Travel dates default to the trip dates, as they are usually the same
+	if b.report.DepartureDate.IsZero() {
+		b.report.DepartureDate = b.report.StartDate
+	}
+	if b.report.ReturnDate.IsZero() {
+		b.report.ReturnDate = b.report.EndDate
+	}
+}
+
+func isBlankRow(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
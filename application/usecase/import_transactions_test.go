@@ -0,0 +1,151 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"sandbox/application/dto"
+	"sandbox/domain/date"
+	domainErrors "sandbox/domain/errors"
+	"sandbox/domain/transaction"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func newImportUseCase() *ImportTransactionsUseCase {
+	return NewImportTransactionsUseCase(transaction.NewService(transaction.NewRegistry(""), transaction.ServiceConfig{}))
+}
+
+var importTrip = map[string]string{
+	"start_date":       "3 Maret 2025",
+	"end_date":         "2025-03-05",
+	"activity_purpose": "Rapat koordinasi",
+	"destination_city": "Denpasar",
+	"spd_date":         "28/02/2025",
+}
+
+func TestImportBuildsReportFromCSV(t *testing.T) {
+	csv := "\xEF\xBB\xBFNama;NIP;No. SPD;Jabatan;Golongan;Jenis;Harga;Malam;Tanggal;Keterangan\n" +
+		"Budi;19800101 200501 1 001;SPD-01;Analis;III/a;penginapan;Rp 725.000;2;03/03/2025;Hotel Santika\n" +
+		"Budi;198001012005011001;SPD-01;Analis;III/a;transportasi;\"1,450,000.00\";;2025-03-03;GA 404\n" +
+		";;;;;;;;;\n" +
+		"Sari;197902022006042002;SPD-02;Kepala Seksi;III/d;Lainnya;150000;;;Taksi\n"
+
+	resp, err := newImportUseCase().Execute(context.Background(), dto.ImportTransactionsRequest{
+		Filename: "biaya.csv",
+		Content:  []byte(csv),
+		Trip:     importTrip,
+	})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	report := resp.Report
+	if resp.Rows != 3 || len(report.Assignees) != 2 {
+		t.Fatalf("imported %d rows into %d assignees, want 3 into 2", resp.Rows, len(report.Assignees))
+	}
+	if !report.DepartureDate.Equal(date.New(2025, 3, 3)) || !report.ReturnDate.Equal(date.New(2025, 3, 5)) {
+		t.Errorf("travel dates = %v - %v, want the trip dates", report.DepartureDate, report.ReturnDate)
+	}
+
+	budi := report.Assignees[0]
+	if budi.Name != "Budi" || budi.Rank != "III/a" || len(budi.Transactions) != 2 {
+		t.Fatalf("first assignee = %+v", budi)
+	}
+	hotel := budi.Transactions[0]
+	if hotel.Type != "accommodation" || hotel.Amount != 725000 || hotel.Subtotal != 1450000 || *hotel.TotalNight != 2 {
+		t.Errorf("hotel = %+v", hotel)
+	}
+	if hotel.Source.Snippet != "row 2" || hotel.Source.Filename != "biaya.csv" {
+		t.Errorf("hotel source = %+v", hotel.Source)
+	}
+	if flight := budi.Transactions[1]; flight.Subtotal != 1450000 || !flight.Date.Equal(date.New(2025, 3, 3)) {
+		t.Errorf("flight = %+v", flight)
+	}
+	if taxi := report.Assignees[1].Transactions[0]; taxi.Type != "other" || taxi.Source.Snippet != "row 5" {
+		t.Errorf("taxi = %+v", taxi)
+	}
+}
+
+func TestImportReportsEveryInvalidRow(t *testing.T) {
+	csv := "name,employee_id,spd_number,position,rank,type,amount\n" +
+		"Budi,1980,SPD-01,Analis,III/a,hotel,725000\n" +
+		"Budi,1980,SPD-09,Analis,III/a,makan,-5\n" +
+		"Sari,,SPD-02,Kepala Seksi,III/d,transport,abc\n"
+
+	_, err := newImportUseCase().Execute(context.Background(), dto.ImportTransactionsRequest{
+		Filename: "biaya.csv",
+		Content:  []byte(csv),
+		Trip:     importTrip,
+	})
+
+	var domainErr *domainErrors.DomainError
+	if !errors.As(err, &domainErr) || domainErr.Code != "IMPORT_VALIDATION_ERROR" {
+		t.Fatalf("Execute() error = %v, want an import validation error", err)
+	}
+	want := []dto.ImportRowErrorDTO{
+		{Row: 3, Column: "type", Message: `"makan" is not a transaction type; use accommodation, transport, allowance or other`},
+		{Row: 3, Column: "amount", Message: "amount cannot be negative"},
+		{Row: 4, Column: "employee_id", Message: "cannot be blank"},
+		{Row: 4, Column: "amount", Message: `"abc" is not an amount`},
+	}
+	if got := domainErr.Details; !reflect.DeepEqual(got, want) {
+		t.Errorf("row errors = %+v\nwant %+v", got, want)
+	}
+
+	// A row that is valid on its own must still agree with the assignee's first row
+	csv = "name,employee_id,spd_number,position,rank,type,amount\n" +
+		"Budi,1980,SPD-01,Analis,III/a,hotel,725000\n" +
+		"Budi,1980,SPD-09,Analis,III/a,hotel,725000\n"
+	_, err = newImportUseCase().Execute(context.Background(), dto.ImportTransactionsRequest{
+		Filename: "biaya.csv",
+		Content:  []byte(csv),
+		Trip:     importTrip,
+	})
+	if !errors.As(err, &domainErr) || len(domainErr.Details.([]dto.ImportRowErrorDTO)) != 1 {
+		t.Fatalf("Execute() error = %v, want one conflicting SPD number", err)
+	}
+}
+
+func TestImportReadsWorkbookWithColumnMapping(t *testing.T) {
+	workbook := excelize.NewFile()
+	rows := [][]interface{}{
+		{"Pegawai", "NIP", "SPD", "Jabatan", "Gol", "Kategori", "Total Biaya", "Tgl Mulai", "Tgl Selesai"},
+		{"Budi", "1980", "SPD-01", "Analis", "III/a", "transport", 1450000, 45719, 45721},
+	}
+	for i, row := range rows {
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		if err := workbook.SetSheetRow("Sheet1", cell, &row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf, err := workbook.WriteToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := newImportUseCase().Execute(context.Background(), dto.ImportTransactionsRequest{
+		Filename: "biaya.xlsx",
+		Content:  buf.Bytes(),
+		Mapping: map[string]string{
+			"name": "Pegawai", "spd_number": "SPD", "rank": "Gol", "type": "Kategori",
+			"subtotal": "Total Biaya", "start_date": "Tgl Mulai", "end_date": "Tgl Selesai",
+		},
+		Trip: map[string]string{"activity_purpose": "Rapat", "destination_city": "Denpasar", "spd_date": "2025-02-28"},
+	})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if !resp.Report.StartDate.Equal(date.New(2025, 3, 3)) || !resp.Report.EndDate.Equal(date.New(2025, 3, 5)) {
+		t.Errorf("trip dates = %v - %v, want the serial dates of the workbook", resp.Report.StartDate, resp.Report.EndDate)
+	}
+	if tx := resp.Report.Assignees[0].Transactions[0]; tx.Amount != 1450000 || tx.Subtotal != 1450000 {
+		t.Errorf("transaction = %+v", tx)
+	}
+	if resp.Sheet != "Sheet1" || resp.Columns["subtotal"] != "Total Biaya" {
+		t.Errorf("sheet %q, columns %v", resp.Sheet, resp.Columns)
+	}
+}
@@ -0,0 +1,48 @@
+package usecase
+
+import (
+	"sandbox/application/dto"
+	domainErrors "sandbox/domain/errors"
+	"sandbox/domain/transaction"
+)
+
+// ManagePromptsUseCase lists the prompt template versions and selects the active one
+type ManagePromptsUseCase struct {
+	catalog transaction.PromptCatalog
+}
+
+func NewManagePromptsUseCase(catalog transaction.PromptCatalog) *ManagePromptsUseCase {
+	return &ManagePromptsUseCase{
+		catalog: catalog,
+	}
+}
+
+// List returns every available version
+func (uc *ManagePromptsUseCase) List() ([]dto.PromptVersionDTO, error) {
+	versions, err := uc.catalog.PromptVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]dto.PromptVersionDTO, len(versions))
+	for i, v := range versions {
+		result[i] = dto.PromptVersionDTO{
+			ID:     v.ID,
+			Hash:   v.Hash,
+			Source: v.Source,
+			Active: v.Active,
+		}
+	}
+	return result, nil
+}
+
+// Activate selects the version used from the next extraction on and returns the updated list
+func (uc *ManagePromptsUseCase) Activate(req dto.ActivatePromptRequest) ([]dto.PromptVersionDTO, error) {
+	if err := req.Validate(); err != nil {
+		return nil, domainErrors.NewValidationError(err.Error())
+	}
+	if err := uc.catalog.ActivatePrompt(req.Version); err != nil {
+		return nil, err
+	}
+	return uc.List()
+}
@@ -0,0 +1,58 @@
+package usecase
+
+import (
+	"sandbox/application/dto"
+	domainErrors "sandbox/domain/errors"
+	"sandbox/domain/usage"
+)
+
+// ReportUsageUseCase reports the tokens spent on LLM calls against the monthly budget
+type ReportUsageUseCase struct {
+	ledger *usage.Ledger
+}
+
+func NewReportUsageUseCase(ledger *usage.Ledger) *ReportUsageUseCase {
+	return &ReportUsageUseCase{
+		ledger: ledger,
+	}
+}
+
+// Execute returns the usage of the requested month by day, endpoint and API client
+func (uc *ReportUsageUseCase) Execute(req dto.UsageReportRequest) (*dto.UsageReportDTO, error) {
+	if err := req.Validate(); err != nil {
+		return nil, domainErrors.NewValidationError(err.Error())
+	}
+
+	month := req.Month
+	if month == "" {
+		month = uc.ledger.CurrentMonth()
+	}
+
+	report := uc.ledger.Report(month)
+	prices := uc.ledger.Prices()
+	return &dto.UsageReportDTO{
+		Month:      report.Month,
+		Total:      toTokenUsageDTO(report.Total, prices),
+		ByDay:      toUsageRowDTOs(report.ByDay, prices),
+		ByEndpoint: toUsageRowDTOs(report.ByEndpoint, prices),
+		ByClient:   toUsageRowDTOs(report.ByClient, prices),
+		Budget: dto.BudgetStatusDTO{
+			Month:     report.Budget.Month,
+			Used:      report.Budget.Used,
+			SoftLimit: report.Budget.SoftLimit,
+			HardLimit: report.Budget.HardLimit,
+			State:     string(report.Budget.State),
+		},
+	}, nil
+}
+
+func toUsageRowDTOs(rows []usage.Row, prices usage.Prices) []dto.UsageRowDTO {
+	result := make([]dto.UsageRowDTO, len(rows))
+	for i, row := range rows {
+		result[i] = dto.UsageRowDTO{
+			Key:           row.Key,
+			TokenUsageDTO: toTokenUsageDTO(row.Tokens, prices),
+		}
+	}
+	return result
+}
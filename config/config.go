@@ -1,8 +1,14 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"sandbox/infrastructure/gemini"
 
 	"github.com/joho/godotenv"
 )
@@ -10,7 +16,17 @@ import (
 // Config holds all application configuration
 type Config struct {
 	Server       ServerConfig
+	Extractor    ExtractorConfig
+	Jobs         JobsConfig
+	HTTP         HTTPConfig
+	Cache        CacheConfig
+	Prompts      PromptConfig
+	Admin        AdminConfig
+	Usage        UsageConfig
+	Uploads      UploadConfig
+	Images       ImageConfig
 	Gemini       GeminiConfig
+	OpenAI       OpenAIConfig
 	Zoom         ZoomConfig
 	Drive        DriveConfig
 	Notification NotificationConfig
@@ -22,9 +38,141 @@ type ServerConfig struct {
 	Port string
 }
 
+// ExtractorConfig holds transaction extraction configuration
+type ExtractorConfig struct {
+	// Backend is the extractor used when a request does not ask for one
+	Backend string
+	// Concurrency bounds how many documents are extracted in parallel
+	Concurrency int
+	// ReviewThreshold is the confidence below which extracted values are flagged for review
+	ReviewThreshold float64
+	// AssigneeThreshold is the name match score at which a receipt is attached to an assignee
+	AssigneeThreshold float64
+	// OfflineParsers reads e-receipts of known vendors without calling the backend
+	OfflineParsers bool
+}
+
+// JobsConfig holds configuration for asynchronous extraction jobs
+type JobsConfig struct {
+	// Workers is the number of extraction jobs run at the same time
+	Workers int
+	// QueueSize is the number of jobs that may wait for a worker
+	QueueSize int
+	// Timeout cancels a job that runs longer
+	Timeout time.Duration
+	// Retention is how long finished jobs can still be queried
+	Retention time.Duration
+}
+
+// HTTPConfig holds the retry and circuit breaker policy for outbound calls
+type HTTPConfig struct {
+	// MaxRetries is how many times a failed call is repeated
+	MaxRetries int
+	// RetryBaseDelay is the backoff before the first retry; it doubles on every retry
+	RetryBaseDelay time.Duration
+	// RetryMaxDelay caps the backoff and the Retry-After a service may ask for
+	RetryMaxDelay time.Duration
+	// BreakerThreshold is the number of consecutive failures that stops calls to a service
+	BreakerThreshold int
+	// BreakerCooldown is how long calls stay stopped before a service is tried again
+	BreakerCooldown time.Duration
+}
+
+// CacheConfig holds configuration of the extraction result cache
+type CacheConfig struct {
+	// Backend is one of memory, disk or none
+	Backend string
+	// Dir is where the disk backend keeps its files
+	Dir string
+	// MaxEntries bounds the memory backend
+	MaxEntries int
+	// TTL is how long a cached result is served; zero keeps results until evicted
+	TTL time.Duration
+}
+
+// PromptConfig holds the prompt templates of the LLM backends
+type PromptConfig struct {
+	// Dir holds template files added to the built-in ones; empty uses only the built-in ones
+	Dir string
+	// Version is the template active at startup
+	Version string
+	// Locale is the language and number format of the documents, passed to the extraction template
+	Locale string
+}
+
+// AdminConfig holds configuration of the admin endpoints
+type AdminConfig struct {
+	// Token must be sent as a bearer token; empty disables the admin endpoints
+	Token string
+}
+
+// UsageConfig holds token accounting and the monthly budget of the LLM backends
+type UsageConfig struct {
+	// MonthlyTokenBudget refuses new extractions once reached; zero means unlimited
+	MonthlyTokenBudget int
+	// SoftLimit is the share of the budget past which responses carry a warning
+	SoftLimit float64
+	// File keeps the usage ledger across restarts; empty keeps it in memory only
+	File string
+	// Clients are the X-Client-ID values accounted by name; other callers are anonymous
+	Clients []string
+	// RetentionMonths is how many calendar months of usage are kept, the current one included
+	RetentionMonths int
+	// PromptPricePerMillion and OutputPricePerMillion are the US dollar prices used to estimate costs
+	PromptPricePerMillion float64
+	OutputPricePerMillion float64
+}
+
+// UploadConfig holds the limits on what an upload request may carry
+type UploadConfig struct {
+	// MaxFileMB bounds each uploaded file and each document unpacked from an archive
+	MaxFileMB int
+	// MaxRequestMB bounds a whole request body; larger requests are refused before being read
+	MaxRequestMB int
+	// MaxFiles bounds the files of one request, an archive counting as one
+	MaxFiles int
+	// MaxArchiveMB bounds a ZIP upload, and separately what it unpacks to
+	MaxArchiveMB      int
+	MaxArchiveEntries int
+	// SpoolDir is where uploads are written while a request is handled; empty uses the OS temp dir
+	SpoolDir string
+}
+
+// ImageConfig holds how uploaded photos are prepared before extraction
+type ImageConfig struct {
+	// Preprocess turns photos upright, shrinks and re-encodes them; false sends them as uploaded
+	Preprocess bool
+	// MaxDimension caps the longer side of an image, in pixels
+	MaxDimension int
+	// JPEGQuality is the quality, 1-100, images are re-encoded at
+	JPEGQuality int
+	// Grayscale and BoostContrast optionally drop colour and stretch the brightness range
+	Grayscale     bool
+	BoostContrast bool
+}
+
 // GeminiConfig holds Gemini API configuration
 type GeminiConfig struct {
 	APIKey string
+	// BaseURL and Model select the API endpoint, e.g. a local stand-in, and the model
+	BaseURL string
+	Model   string
+	// Mode is live, record (save responses as fixtures) or replay (answer from fixtures offline)
+	Mode string
+	// FixturesDir holds the recorded responses
+	FixturesDir string
+	// MaxRepairAttempts is how many times an answer that fails validation is sent back for correction
+	MaxRepairAttempts int
+	// InlineLimitMB is the encoded document size above which documents go through the File API
+	InlineLimitMB int
+}
+
+// OpenAIConfig holds configuration for an OpenAI-compatible chat endpoint,
+// such as a self-hosted Ollama or llama.cpp server
+type OpenAIConfig struct {
+	BaseURL string
+	APIKey  string
+	Model   string
 }
 
 // ZoomConfig holds Zoom API configuration
@@ -57,8 +205,77 @@ func Load() (*Config, error) {
 		Server: ServerConfig{
 			Port: getEnv("PORT", "5002"),
 		},
+		Extractor: ExtractorConfig{
+			Backend:           strings.ToLower(getEnv("EXTRACTOR_BACKEND", "gemini")),
+			Concurrency:       getEnvInt("EXTRACTOR_CONCURRENCY", 4),
+			ReviewThreshold:   getEnvFloat("EXTRACTOR_REVIEW_THRESHOLD", 0.7),
+			AssigneeThreshold: getEnvFloat("EXTRACTOR_ASSIGNEE_THRESHOLD", 0.6),
+			OfflineParsers:    getEnvBool("EXTRACTOR_OFFLINE_PARSERS", true),
+		},
+		Jobs: JobsConfig{
+			Workers:   getEnvInt("JOB_WORKERS", 2),
+			QueueSize: getEnvInt("JOB_QUEUE_SIZE", 100),
+			Timeout:   getEnvDuration("JOB_TIMEOUT", 10*time.Minute),
+			Retention: getEnvDuration("JOB_RETENTION", time.Hour),
+		},
+		HTTP: HTTPConfig{
+			MaxRetries:       getEnvInt("HTTP_MAX_RETRIES", 3),
+			RetryBaseDelay:   getEnvDuration("HTTP_RETRY_BASE_DELAY", 500*time.Millisecond),
+			RetryMaxDelay:    getEnvDuration("HTTP_RETRY_MAX_DELAY", 30*time.Second),
+			BreakerThreshold: getEnvInt("HTTP_BREAKER_THRESHOLD", 5),
+			BreakerCooldown:  getEnvDuration("HTTP_BREAKER_COOLDOWN", 30*time.Second),
+		},
+		Cache: CacheConfig{
+			Backend:    strings.ToLower(getEnv("CACHE_BACKEND", "memory")),
+			Dir:        getEnv("CACHE_DIR", "./cache/extractions"),
+			MaxEntries: getEnvInt("CACHE_MAX_ENTRIES", 256),
+			TTL:        getEnvDuration("CACHE_TTL", 24*time.Hour),
+		},
+		Prompts: PromptConfig{
+			Dir:     os.Getenv("PROMPT_DIR"),
+			Version: os.Getenv("PROMPT_VERSION"),
+			Locale:  getEnv("PROMPT_LOCALE", "id-ID"),
+		},
+		Admin: AdminConfig{
+			Token: os.Getenv("ADMIN_TOKEN"),
+		},
+		Usage: UsageConfig{
+			MonthlyTokenBudget:    getEnvInt("USAGE_MONTHLY_TOKEN_BUDGET", 0),
+			SoftLimit:             getEnvFloat("USAGE_SOFT_LIMIT", 0.8),
+			File:                  os.Getenv("USAGE_FILE"),
+			Clients:               getEnvList("USAGE_CLIENTS"),
+			RetentionMonths:       getEnvInt("USAGE_RETENTION_MONTHS", 12),
+			PromptPricePerMillion: getEnvFloat("USAGE_PRICE_PROMPT_PER_MILLION", 0),
+			OutputPricePerMillion: getEnvFloat("USAGE_PRICE_OUTPUT_PER_MILLION", 0),
+		},
+		Uploads: UploadConfig{
+			MaxFileMB:         getEnvInt("UPLOAD_MAX_FILE_MB", 10),
+			MaxRequestMB:      getEnvInt("UPLOAD_MAX_REQUEST_MB", 50),
+			MaxFiles:          getEnvInt("UPLOAD_MAX_FILES", 20),
+			MaxArchiveMB:      getEnvInt("UPLOAD_MAX_ARCHIVE_MB", 100),
+			MaxArchiveEntries: getEnvInt("UPLOAD_MAX_ARCHIVE_ENTRIES", 200),
+			SpoolDir:          os.Getenv("UPLOAD_SPOOL_DIR"),
+		},
+		Images: ImageConfig{
+			Preprocess:    getEnvBool("IMAGE_PREPROCESS", true),
+			MaxDimension:  getEnvInt("IMAGE_MAX_DIMENSION", 2048),
+			JPEGQuality:   getEnvInt("IMAGE_JPEG_QUALITY", 85),
+			Grayscale:     getEnvBool("IMAGE_GRAYSCALE", false),
+			BoostContrast: getEnvBool("IMAGE_BOOST_CONTRAST", false),
+		},
 		Gemini: GeminiConfig{
-			APIKey: os.Getenv("GEMINI_API_KEY"),
+			APIKey:            os.Getenv("GEMINI_API_KEY"),
+			BaseURL:           getEnv("GEMINI_BASE_URL", gemini.DefaultBaseURL),
+			Model:             getEnv("GEMINI_MODEL", gemini.DefaultModel),
+			Mode:              strings.ToLower(getEnv("GEMINI_MODE", "live")),
+			FixturesDir:       getEnv("GEMINI_FIXTURES_DIR", "./testdata/gemini"),
+			MaxRepairAttempts: getEnvInt("GEMINI_MAX_REPAIR_ATTEMPTS", 2),
+			InlineLimitMB:     getEnvInt("GEMINI_INLINE_LIMIT_MB", 18),
+		},
+		OpenAI: OpenAIConfig{
+			BaseURL: os.Getenv("OPENAI_BASE_URL"),
+			APIKey:  os.Getenv("OPENAI_API_KEY"),
+			Model:   os.Getenv("OPENAI_MODEL"),
 		},
 		Zoom: ZoomConfig{
 			APIKey:    os.Getenv("ZOOM_API_KEY"),
@@ -86,8 +303,92 @@ func Load() (*Config, error) {
 func (c *Config) Validate() error {
 	// Gemini API Key is optional for basic functionality
 	// If not provided, transaction extraction won't work but other features will
-	if c.Gemini.APIKey == "" {
-		log.Println("⚠️  WARNING: GEMINI_API_KEY not set - transaction extraction will not work")
+	if c.Gemini.APIKey == "" && c.Gemini.Mode != "replay" {
+		log.Println("⚠️  WARNING: GEMINI_API_KEY not set - the gemini extraction backend will not work")
+	}
+
+	switch c.Extractor.Backend {
+	case "gemini", "openai", "rulebased":
+	default:
+		return fmt.Errorf("invalid EXTRACTOR_BACKEND %q: must be one of gemini, openai, rulebased", c.Extractor.Backend)
+	}
+
+	if c.Extractor.Concurrency < 1 {
+		return fmt.Errorf("EXTRACTOR_CONCURRENCY must be at least 1, got %d", c.Extractor.Concurrency)
+	}
+
+	if c.Jobs.Workers < 1 {
+		return fmt.Errorf("JOB_WORKERS must be at least 1, got %d", c.Jobs.Workers)
+	}
+
+	if c.Jobs.QueueSize < 0 {
+		return fmt.Errorf("JOB_QUEUE_SIZE must not be negative, got %d", c.Jobs.QueueSize)
+	}
+
+	switch c.Cache.Backend {
+	case "memory", "disk", "none":
+	default:
+		return fmt.Errorf("invalid CACHE_BACKEND %q: must be one of memory, disk, none", c.Cache.Backend)
+	}
+
+	if c.HTTP.MaxRetries < 0 {
+		return fmt.Errorf("HTTP_MAX_RETRIES must not be negative, got %d", c.HTTP.MaxRetries)
+	}
+
+	if c.Extractor.ReviewThreshold < 0 || c.Extractor.ReviewThreshold > 1 {
+		return fmt.Errorf("EXTRACTOR_REVIEW_THRESHOLD must be between 0 and 1, got %g", c.Extractor.ReviewThreshold)
+	}
+
+	if c.Extractor.AssigneeThreshold <= 0 || c.Extractor.AssigneeThreshold > 1 {
+		return fmt.Errorf("EXTRACTOR_ASSIGNEE_THRESHOLD must be greater than 0 and at most 1, got %g", c.Extractor.AssigneeThreshold)
+	}
+
+	switch c.Gemini.Mode {
+	case "live", "record", "replay":
+	default:
+		return fmt.Errorf("invalid GEMINI_MODE %q: must be one of live, record, replay", c.Gemini.Mode)
+	}
+
+	if c.Gemini.InlineLimitMB < 1 || c.Gemini.InlineLimitMB > 20 {
+		return fmt.Errorf("GEMINI_INLINE_LIMIT_MB must be between 1 and 20, got %d", c.Gemini.InlineLimitMB)
+	}
+
+	if c.Usage.MonthlyTokenBudget < 0 {
+		return fmt.Errorf("USAGE_MONTHLY_TOKEN_BUDGET must not be negative, got %d", c.Usage.MonthlyTokenBudget)
+	}
+
+	if c.Usage.SoftLimit <= 0 || c.Usage.SoftLimit > 1 {
+		return fmt.Errorf("USAGE_SOFT_LIMIT must be greater than 0 and at most 1, got %g", c.Usage.SoftLimit)
+	}
+
+	if c.Usage.RetentionMonths < 1 {
+		return fmt.Errorf("USAGE_RETENTION_MONTHS must be at least 1, got %d", c.Usage.RetentionMonths)
+	}
+
+	if c.Uploads.MaxFileMB < 1 || c.Uploads.MaxFileMB > c.Uploads.MaxRequestMB {
+		return fmt.Errorf("UPLOAD_MAX_FILE_MB must be at least 1 and at most UPLOAD_MAX_REQUEST_MB (%d), got %d",
+			c.Uploads.MaxRequestMB, c.Uploads.MaxFileMB)
+	}
+
+	if c.Uploads.MaxFiles < 1 {
+		return fmt.Errorf("UPLOAD_MAX_FILES must be at least 1, got %d", c.Uploads.MaxFiles)
+	}
+
+	if c.Uploads.MaxArchiveMB < 1 || c.Uploads.MaxArchiveEntries < 1 {
+		return fmt.Errorf("UPLOAD_MAX_ARCHIVE_MB and UPLOAD_MAX_ARCHIVE_ENTRIES must be at least 1, got %d and %d",
+			c.Uploads.MaxArchiveMB, c.Uploads.MaxArchiveEntries)
+	}
+
+	if c.Images.MaxDimension < 256 {
+		return fmt.Errorf("IMAGE_MAX_DIMENSION must be at least 256, got %d", c.Images.MaxDimension)
+	}
+
+	if c.Images.JPEGQuality < 1 || c.Images.JPEGQuality > 100 {
+		return fmt.Errorf("IMAGE_JPEG_QUALITY must be between 1 and 100, got %d", c.Images.JPEGQuality)
+	}
+
+	if c.Extractor.Backend == "openai" && (c.OpenAI.BaseURL == "" || c.OpenAI.Model == "") {
+		return fmt.Errorf("EXTRACTOR_BACKEND=openai requires OPENAI_BASE_URL and OPENAI_MODEL")
 	}
 
 	// Optional validation for meeting functionality
@@ -106,3 +407,70 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+// getEnvList reads a comma-separated list, skipping empty items
+func getEnvList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("⚠️  WARNING: %s=%q is not a number, using default %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("⚠️  WARNING: %s=%q is not a boolean, using default %t", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("⚠️  WARNING: %s=%q is not a number, using default %g", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("⚠️  WARNING: %s=%q is not a duration, using default %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
@@ -1,15 +1,30 @@
 package config
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
 	"sandbox/application/usecase"
+	"sandbox/domain/job"
 	domainMeeting "sandbox/domain/meeting"
+	"sandbox/domain/sbm"
 	"sandbox/domain/transaction"
+	"sandbox/domain/usage"
+	"sandbox/infrastructure/cache"
 	"sandbox/infrastructure/drive"
 	"sandbox/infrastructure/excel"
 	"sandbox/infrastructure/file"
 	"sandbox/infrastructure/gemini"
+	"sandbox/infrastructure/httpclient"
+	"sandbox/infrastructure/ledger"
+	"sandbox/infrastructure/llm"
 	meetingInfra "sandbox/infrastructure/meeting"
 	"sandbox/infrastructure/notification"
+	"sandbox/infrastructure/openai"
+	"sandbox/infrastructure/replay"
+	"sandbox/infrastructure/rulebased"
 	"sandbox/infrastructure/zoom"
 	"sandbox/interfaces/http/handler"
 )
@@ -17,21 +32,33 @@ import (
 // Container holds all application dependencies
 type Container struct {
 	// Handlers
-	TransactionHandler *handler.TransactionHandler
-	MeetingHandler     *handler.MeetingHandler
+	TransactionHandler   *handler.TransactionHandler
+	MeetingHandler       *handler.MeetingHandler
+	ExtractionJobHandler *handler.ExtractionJobHandler
+	PromptHandler        *handler.PromptHandler
+	UsageHandler         *handler.UsageHandler
+	ImportHandler        *handler.ImportHandler
 
 	// Use Cases
 	ExtractTransactionsUseCase *usecase.ExtractTransactionsUseCase
+	ExtractionJobsUseCase      *usecase.ExtractionJobsUseCase
 	GenerateRecapExcelUseCase  *usecase.GenerateRecapExcelUseCase
 	CreateMeetingUseCase       *usecase.CreateMeetingUseCase
+	ManagePromptsUseCase       *usecase.ManagePromptsUseCase
+	ReportUsageUseCase         *usecase.ReportUsageUseCase
+	ImportTransactionsUseCase  *usecase.ImportTransactionsUseCase
 
 	// Services
 	TransactionService *transaction.Service
 	MeetingService     *domainMeeting.Service
+	JobQueue           *job.Queue
+	UsageLedger        *usage.Ledger
 
 	// Repositories
-	GeminiClient    *gemini.Client
-	MeetingRepo     domainMeeting.Repository
+	GeminiClient *gemini.Client
+	OpenAIClient *openai.Client
+	Extractors   *transaction.Registry
+	MeetingRepo  domainMeeting.Repository
 
 	// Processors
 	FileProcessor  *file.Processor
@@ -39,42 +66,217 @@ type Container struct {
 }
 
 // NewContainer creates and wires up all dependencies
-func NewContainer(cfg *Config) *Container {
+func NewContainer(cfg *Config) (*Container, error) {
+	rates, err := sbm.Default()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SBM rate tables: %w", err)
+	}
+
+	prompts, err := llm.NewPrompts(cfg.Prompts.Dir, cfg.Prompts.Version, cfg.Prompts.Locale)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load prompt templates: %w", err)
+	}
+
 	// Infrastructure layer
-	geminiClient := gemini.NewClient(cfg.Gemini.APIKey)
-	fileProcessor := file.NewProcessor()
-	excelGenerator := excel.NewGenerator()
+	// Generation calls have no side effects, so they may be repeated after any failure.
+	// The long timeout covers large documents and local models running on CPU.
+	geminiClient, err := newGeminiClient(cfg, prompts)
+	if err != nil {
+		return nil, err
+	}
+	openAIClient := openai.NewClient(cfg.OpenAI.BaseURL, cfg.OpenAI.APIKey, cfg.OpenAI.Model, prompts,
+		httpclient.New(openai.BackendName, outboundHTTPConfig(cfg.HTTP, 300*time.Second, true)))
+	if cfg.Uploads.SpoolDir != "" {
+		if err := os.MkdirAll(cfg.Uploads.SpoolDir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create upload spool directory: %w", err)
+		}
+	}
+	fileProcessor := file.NewProcessor(uploadLimits(cfg.Uploads), file.PreprocessOptions{
+		Enabled:       cfg.Images.Preprocess,
+		MaxDimension:  cfg.Images.MaxDimension,
+		JPEGQuality:   cfg.Images.JPEGQuality,
+		Grayscale:     cfg.Images.Grayscale,
+		BoostContrast: cfg.Images.BoostContrast,
+	})
+	excelGenerator := excel.NewGenerator(rates)
 
 	// Meeting infrastructure
-	zoomClient := zoom.NewClient(cfg.Zoom.APIKey, cfg.Zoom.APISecret)
-	driveClient := drive.NewClient(cfg.Drive.APIKey)
-	notificationClient := notification.NewClient(cfg.Notification.APIKey)
+	zoomClient := zoom.NewClient(cfg.Zoom.APIKey, cfg.Zoom.APISecret,
+		httpclient.New("zoom", outboundHTTPConfig(cfg.HTTP, 30*time.Second, false)))
+	driveClient := drive.NewClient(cfg.Drive.APIKey,
+		httpclient.New("drive", outboundHTTPConfig(cfg.HTTP, 30*time.Second, false)))
+	notificationClient := notification.NewClient(cfg.Notification.APIKey,
+		httpclient.New("notification", outboundHTTPConfig(cfg.HTTP, 30*time.Second, false)))
 	meetingRepo := meetingInfra.NewRepository(zoomClient, driveClient, notificationClient)
 
+	// Extraction backends, selectable per deployment and per request
+	extractors := transaction.NewRegistry(cfg.Extractor.Backend)
+	extractors.Register(gemini.BackendName, geminiClient)
+	extractors.Register(openai.BackendName, openAIClient)
+	ruleParser := rulebased.NewParser()
+	extractors.Register(rulebased.BackendName, ruleParser)
+
+	// Known vendor e-receipts are read offline whichever backend is selected
+	var offline transaction.OfflineExtractor
+	if cfg.Extractor.OfflineParsers {
+		offline = ruleParser
+	}
+
+	resultCache, err := newResultCache(cfg.Cache)
+	if err != nil {
+		return nil, err
+	}
+
+	usageLedger, err := newUsageLedger(cfg.Usage)
+	if err != nil {
+		return nil, err
+	}
+
 	// Domain layer
-	transactionService := transaction.NewService(geminiClient)
+	transactionService := transaction.NewService(extractors, transaction.ServiceConfig{
+		Concurrency:       cfg.Extractor.Concurrency,
+		ReviewThreshold:   cfg.Extractor.ReviewThreshold,
+		AssigneeThreshold: cfg.Extractor.AssigneeThreshold,
+		Rates:             rates,
+		Cache:             resultCache,
+		Offline:           offline,
+	})
 	meetingService := domainMeeting.NewService(meetingRepo)
+	jobQueue := job.NewQueue(job.QueueConfig{
+		Workers:   cfg.Jobs.Workers,
+		Capacity:  cfg.Jobs.QueueSize,
+		Timeout:   cfg.Jobs.Timeout,
+		Retention: cfg.Jobs.Retention,
+	})
 
 	// Application layer
-	extractTransactionsUseCase := usecase.NewExtractTransactionsUseCase(transactionService)
+	extractTransactionsUseCase := usecase.NewExtractTransactionsUseCase(transactionService, usageLedger)
+	extractionJobsUseCase := usecase.NewExtractionJobsUseCase(extractTransactionsUseCase, jobQueue)
 	generateRecapExcelUseCase := usecase.NewGenerateRecapExcelUseCase(excelGenerator)
 	createMeetingUseCase := usecase.NewCreateMeetingUseCase(meetingService)
+	managePromptsUseCase := usecase.NewManagePromptsUseCase(prompts)
+	reportUsageUseCase := usecase.NewReportUsageUseCase(usageLedger)
+	importTransactionsUseCase := usecase.NewImportTransactionsUseCase(transactionService)
 
 	// Interface layer
 	transactionHandler := handler.NewTransactionHandler(extractTransactionsUseCase, fileProcessor, generateRecapExcelUseCase)
 	meetingHandler := handler.NewMeetingHandler(createMeetingUseCase)
+	extractionJobHandler := handler.NewExtractionJobHandler(extractionJobsUseCase, fileProcessor)
+	promptHandler := handler.NewPromptHandler(managePromptsUseCase)
+	usageHandler := handler.NewUsageHandler(reportUsageUseCase)
+	importHandler := handler.NewImportHandler(importTransactionsUseCase, fileProcessor, generateRecapExcelUseCase)
 
 	return &Container{
 		TransactionHandler:         transactionHandler,
 		MeetingHandler:             meetingHandler,
+		ExtractionJobHandler:       extractionJobHandler,
+		PromptHandler:              promptHandler,
+		UsageHandler:               usageHandler,
+		ImportHandler:              importHandler,
 		ExtractTransactionsUseCase: extractTransactionsUseCase,
+		ExtractionJobsUseCase:      extractionJobsUseCase,
 		GenerateRecapExcelUseCase:  generateRecapExcelUseCase,
 		CreateMeetingUseCase:       createMeetingUseCase,
+		ManagePromptsUseCase:       managePromptsUseCase,
+		ReportUsageUseCase:         reportUsageUseCase,
+		ImportTransactionsUseCase:  importTransactionsUseCase,
 		TransactionService:         transactionService,
 		MeetingService:             meetingService,
+		JobQueue:                   jobQueue,
+		UsageLedger:                usageLedger,
 		GeminiClient:               geminiClient,
+		OpenAIClient:               openAIClient,
+		Extractors:                 extractors,
 		MeetingRepo:                meetingRepo,
 		FileProcessor:              fileProcessor,
 		ExcelGenerator:             excelGenerator,
+	}, nil
+}
+
+// newGeminiClient builds the Gemini client, recording or replaying its calls
+// when GEMINI_MODE asks for it
+func newGeminiClient(cfg *Config, prompts *llm.Prompts) (*gemini.Client, error) {
+	mode, err := replay.ParseMode(cfg.Gemini.Mode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GEMINI_MODE: %w", err)
+	}
+
+	httpConfig := outboundHTTPConfig(cfg.HTTP, 300*time.Second, true)
+	apiKey := cfg.Gemini.APIKey
+	if mode != replay.ModeLive {
+		transport, err := replay.NewTransport(mode, cfg.Gemini.FixturesDir, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up Gemini %s mode: %w", mode, err)
+		}
+		httpConfig.Transport = transport
+	}
+	if mode == replay.ModeReplay && apiKey == "" {
+		// Replayed calls never leave the process, but the client refuses to run without a key
+		apiKey = "replay"
+	}
+
+	return gemini.NewClient(cfg.Gemini.BaseURL, apiKey, cfg.Gemini.Model, cfg.Gemini.MaxRepairAttempts,
+		int64(cfg.Gemini.InlineLimitMB)<<20, prompts, httpclient.New(gemini.BackendName, httpConfig)), nil
+}
+
+// newResultCache builds the configured extraction cache; nil disables caching
+func newResultCache(cfg CacheConfig) (transaction.ResultCache, error) {
+	switch cfg.Backend {
+	case "memory":
+		return cache.NewMemoryStore(cfg.MaxEntries, cfg.TTL), nil
+	case "disk":
+		store, err := cache.NewDiskStore(cfg.Dir, cfg.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up extraction cache: %w", err)
+		}
+		return store, nil
+	}
+	return nil, nil
+}
+
+// newUsageLedger builds the token ledger, persisted to cfg.File when set
+func newUsageLedger(cfg UsageConfig) (*usage.Ledger, error) {
+	var store usage.Store
+	if cfg.File != "" {
+		fileStore, err := ledger.NewFileStore(cfg.File)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up usage ledger: %w", err)
+		}
+		store = fileStore
+	}
+
+	usageLedger, err := usage.NewLedger(context.Background(),
+		usage.Budget{MonthlyTokens: int64(cfg.MonthlyTokenBudget), SoftRatio: cfg.SoftLimit},
+		usage.Prices{PromptPerMillion: cfg.PromptPricePerMillion, OutputPerMillion: cfg.OutputPricePerMillion},
+		usage.Retention{Clients: cfg.Clients, Months: cfg.RetentionMonths},
+		store)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up usage ledger: %w", err)
+	}
+	return usageLedger, nil
+}
+
+// uploadLimits converts the configured upload limits to bytes
+func uploadLimits(uploads UploadConfig) file.Limits {
+	return file.Limits{
+		MaxFileSize:       int64(uploads.MaxFileMB) << 20,
+		MaxRequestSize:    int64(uploads.MaxRequestMB) << 20,
+		MaxFiles:          uploads.MaxFiles,
+		MaxArchiveSize:    int64(uploads.MaxArchiveMB) << 20,
+		MaxArchiveEntries: uploads.MaxArchiveEntries,
+		SpoolDir:          uploads.SpoolDir,
+	}
+}
+
+// outboundHTTPConfig applies the shared retry and circuit breaker policy to one external service
+func outboundHTTPConfig(policy HTTPConfig, timeout time.Duration, retryUnsafe bool) httpclient.Config {
+	return httpclient.Config{
+		Timeout:          timeout,
+		MaxRetries:       policy.MaxRetries,
+		BaseDelay:        policy.RetryBaseDelay,
+		MaxDelay:         policy.RetryMaxDelay,
+		BreakerThreshold: policy.BreakerThreshold,
+		BreakerCooldown:  policy.BreakerCooldown,
+		RetryUnsafe:      retryUnsafe,
 	}
 }
@@ -0,0 +1,203 @@
+package date
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Date is a calendar date without time of day. It accepts the formats found on
+// travel documents and renders in the Indonesian long form used on official
+// documents, e.g. "25 Oktober 2025".
+type Date struct {
+	t time.Time
+}
+
+// IndonesianMonths maps Indonesian month names to month numbers
+var IndonesianMonths = map[string]time.Month{
+	"Januari":   time.January,
+	"Februari":  time.February,
+	"Maret":     time.March,
+	"April":     time.April,
+	"Mei":       time.May,
+	"Juni":      time.June,
+	"Juli":      time.July,
+	"Agustus":   time.August,
+	"September": time.September,
+	"Oktober":   time.October,
+	"November":  time.November,
+	"Desember":  time.December,
+}
+
+var indonesianMonthNames = [...]string{
+	"", "Januari", "Februari", "Maret", "April", "Mei", "Juni",
+	"Juli", "Agustus", "September", "Oktober", "November", "Desember",
+}
+
+// monthNames accepts Indonesian and English names and their common abbreviations
+var monthNames = map[string]time.Month{
+	"januari": time.January, "january": time.January, "jan": time.January,
+	"februari": time.February, "february": time.February, "feb": time.February, "peb": time.February,
+	"maret": time.March, "march": time.March, "mar": time.March,
+	"april": time.April, "apr": time.April,
+	"mei": time.May, "may": time.May,
+	"juni": time.June, "june": time.June, "jun": time.June,
+	"juli": time.July, "july": time.July, "jul": time.July,
+	"agustus": time.August, "august": time.August, "agu": time.August, "agt": time.August, "aug": time.August, "ags": time.August,
+	"september": time.September, "sep": time.September, "sept": time.September,
+	"oktober": time.October, "october": time.October, "okt": time.October, "oct": time.October,
+	"november": time.November, "nov": time.November, "nop": time.November,
+	"desember": time.December, "december": time.December, "des": time.December, "dec": time.December,
+}
+
+var (
+	isoRegex        = regexp.MustCompile(`^(\d{4})-(\d{1,2})-(\d{1,2})(?:[t ].*)?$`)
+	numericRegex    = regexp.MustCompile(`^(\d{1,2})[/.\-](\d{1,2})[/.\-](\d{4})$`)
+	dayMonthRegex   = regexp.MustCompile(`^(\d{1,2})\s+([a-z]+)\.?\s+(\d{4})$`)
+	monthDayRegex   = regexp.MustCompile(`^([a-z]+)\.?\s+(\d{1,2}),?\s+(\d{4})$`)
+	weekdayRegex    = regexp.MustCompile(`^[a-z']+,\s*`)
+	whitespaceRegex = regexp.MustCompile(`\s+`)
+)
+
+// New creates a date from its year, month and day
+func New(year int, month time.Month, day int) Date {
+	return Date{t: time.Date(year, month, day, 0, 0, 0, 0, time.UTC)}
+}
+
+// FromTime returns the calendar date of t in its own location
+func FromTime(t time.Time) Date {
+	return New(t.Year(), t.Month(), t.Day())
+}
+
+// Today returns the current date
+func Today() Date {
+	return FromTime(time.Now())
+}
+
+// Parse reads a date written as ISO ("2025-10-25"), day/month/year
+// ("25/10/2025", "25-10-2025"), or with an Indonesian or English month name
+// ("25 Oktober 2025", "Senin, 25 Okt 2025", "October 25, 2025").
+func Parse(s string) (Date, error) {
+	value := strings.ToLower(strings.TrimSpace(s))
+	value = whitespaceRegex.ReplaceAllString(value, " ")
+	value = weekdayRegex.ReplaceAllString(value, "")
+
+	if value == "" {
+		return Date{}, fmt.Errorf("empty date")
+	}
+
+	var year, day int
+	var month time.Month
+
+	if m := isoRegex.FindStringSubmatch(value); m != nil {
+		year, month, day = atoi(m[1]), time.Month(atoi(m[2])), atoi(m[3])
+	} else if m := numericRegex.FindStringSubmatch(value); m != nil {
+		day, month, year = atoi(m[1]), time.Month(atoi(m[2])), atoi(m[3])
+	} else if m := dayMonthRegex.FindStringSubmatch(value); m != nil {
+		mon, ok := monthNames[m[2]]
+		if !ok {
+			return Date{}, fmt.Errorf("invalid month %q in date %q", m[2], s)
+		}
+		day, month, year = atoi(m[1]), mon, atoi(m[3])
+	} else if m := monthDayRegex.FindStringSubmatch(value); m != nil {
+		mon, ok := monthNames[m[1]]
+		if !ok {
+			return Date{}, fmt.Errorf("invalid month %q in date %q", m[1], s)
+		}
+		month, day, year = mon, atoi(m[2]), atoi(m[3])
+	} else {
+		return Date{}, fmt.Errorf("unrecognized date %q (expected e.g. '25 Oktober 2025', '2025-10-25' or '25/10/2025')", s)
+	}
+
+	if month < time.January || month > time.December {
+		return Date{}, fmt.Errorf("invalid month in date %q", s)
+	}
+
+	d := New(year, month, day)
+	if d.t.Day() != day || d.t.Month() != month {
+		return Date{}, fmt.Errorf("day out of range in date %q", s)
+	}
+
+	return d, nil
+}
+
+// Time returns the date as midnight UTC
+func (d Date) Time() time.Time {
+	return d.t
+}
+
+// IsZero reports whether the date is unset
+func (d Date) IsZero() bool {
+	return d.t.IsZero()
+}
+
+// String renders the Indonesian long form, e.g. "25 Oktober 2025", or "" when unset
+func (d Date) String() string {
+	if d.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("%d %s %d", d.t.Day(), indonesianMonthNames[d.t.Month()], d.t.Year())
+}
+
+// ISO renders the date as YYYY-MM-DD, or "" when unset
+func (d Date) ISO() string {
+	if d.IsZero() {
+		return ""
+	}
+	return d.t.Format("2006-01-02")
+}
+
+func (d Date) Before(other Date) bool {
+	return d.t.Before(other.t)
+}
+
+func (d Date) After(other Date) bool {
+	return d.t.After(other.t)
+}
+
+func (d Date) Equal(other Date) bool {
+	return d.t.Equal(other.t)
+}
+
+// AddDays returns the date n days later (or earlier for negative n)
+func (d Date) AddDays(n int) Date {
+	return Date{t: d.t.AddDate(0, 0, n)}
+}
+
+// DaysUntil returns the number of days from d to other
+func (d Date) DaysUntil(other Date) int {
+	return int(other.t.Sub(d.t).Hours() / 24)
+}
+
+// MarshalJSON renders the date in the Indonesian long form
+func (d Date) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON accepts any format understood by Parse; an empty string leaves the date unset
+func (d *Date) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("date must be a string: %w", err)
+	}
+
+	if strings.TrimSpace(s) == "" {
+		*d = Date{}
+		return nil
+	}
+
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
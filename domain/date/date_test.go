@@ -0,0 +1,82 @@
+package date
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseAcceptsDocumentFormats(t *testing.T) {
+	want := New(2025, time.October, 25)
+
+	inputs := []string{
+		"2025-10-25",
+		"2025-10-25T08:00:00+07:00",
+		"25 Oktober 2025",
+		"25 oktober 2025",
+		"Sabtu, 25 Oktober 2025",
+		"25 Okt 2025",
+		"25/10/2025",
+		"25-10-2025",
+		"25.10.2025",
+		"25 October 2025",
+		"October 25, 2025",
+		"Oct 25 2025",
+	}
+
+	for _, input := range inputs {
+		got, err := Parse(input)
+		if err != nil {
+			t.Errorf("Parse(%q) returned error: %v", input, err)
+			continue
+		}
+		if !got.Equal(want) {
+			t.Errorf("Parse(%q) = %s, want %s", input, got, want)
+		}
+	}
+}
+
+func TestParseRejectsInvalidDates(t *testing.T) {
+	inputs := []string{"", "31 Februari 2025", "25 Foo 2025", "13/13/2025", "tomorrow"}
+
+	for _, input := range inputs {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("Parse(%q) expected error", input)
+		}
+	}
+}
+
+func TestStringRendersIndonesianLongForm(t *testing.T) {
+	if got := New(2025, time.May, 1).String(); got != "1 Mei 2025" {
+		t.Errorf("expected '1 Mei 2025', got %q", got)
+	}
+	if got := (Date{}).String(); got != "" {
+		t.Errorf("expected empty string for zero date, got %q", got)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	var payload struct {
+		Start Date `json:"start"`
+		End   Date `json:"end"`
+	}
+
+	if err := json.Unmarshal([]byte(`{"start":"2025-10-25","end":""}`), &payload); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !payload.End.IsZero() {
+		t.Errorf("expected empty string to leave date unset")
+	}
+
+	out, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(out) != `{"start":"25 Oktober 2025","end":""}` {
+		t.Errorf("unexpected JSON: %s", out)
+	}
+
+	if err := json.Unmarshal([]byte(`{"start":"not a date"}`), &payload); err == nil {
+		t.Errorf("expected error for unreadable date")
+	}
+}
@@ -14,6 +14,8 @@ var (
 	ErrInternal        = errors.New("internal server error")
 	ErrExternalService = errors.New("external service error")
 	ErrValidation      = errors.New("validation error")
+	ErrExtraction      = errors.New("extraction output invalid")
+	ErrBudgetExceeded  = errors.New("usage budget exceeded")
 )
 
 // DomainError represents a domain-specific error
@@ -21,6 +23,11 @@ type DomainError struct {
 	Code    string
 	Message string
 	Err     error
+	// Details carries machine-readable context, such as per-field violations
+	Details interface{}
+	// StatusCode is the HTTP status returned by an external service, or 0 when
+	// the service could not be reached
+	StatusCode int
 }
 
 func (e *DomainError) Error() string {
@@ -52,11 +59,44 @@ func NewValidationError(message string) *DomainError {
 	}
 }
 
-// NewExternalServiceError creates an external service error
-func NewExternalServiceError(service string, err error) *DomainError {
+// NewExternalServiceError creates an external service error. statusCode is the
+// HTTP status the service answered with, or 0 when it could not be reached.
+func NewExternalServiceError(service string, statusCode int, err error) *DomainError {
 	return &DomainError{
-		Code:    "EXTERNAL_SERVICE_ERROR",
-		Message: fmt.Sprintf("error calling %s", service),
-		Err:     err,
+		Code:       "EXTERNAL_SERVICE_ERROR",
+		Message:    fmt.Sprintf("error calling %s", service),
+		Err:        fmt.Errorf("%w: %w", ErrExternalService, err),
+		StatusCode: statusCode,
+	}
+}
+
+// NewExtractionValidationError creates an error for model output that still fails
+// validation after every repair attempt; details holds the remaining violations
+func NewExtractionValidationError(attempts int, details interface{}, err error) *DomainError {
+	return &DomainError{
+		Code:    "EXTRACTION_VALIDATION_ERROR",
+		Message: fmt.Sprintf("extraction output failed validation after %d attempts", attempts),
+		Err:     fmt.Errorf("%w: %v", ErrExtraction, err),
+		Details: details,
+	}
+}
+
+// NewBudgetExceededError creates an error for work refused because the usage budget is spent
+func NewBudgetExceededError(message string) *DomainError {
+	return &DomainError{
+		Code:    "USAGE_BUDGET_EXCEEDED",
+		Message: message,
+		Err:     ErrBudgetExceeded,
+	}
+}
+
+// NewImportValidationError creates an error for an imported file with invalid
+// rows; details holds the problem of each row
+func NewImportValidationError(rows int, details interface{}) *DomainError {
+	return &DomainError{
+		Code:    "IMPORT_VALIDATION_ERROR",
+		Message: fmt.Sprintf("%d row(s) of the imported file are invalid", rows),
+		Err:     ErrValidation,
+		Details: details,
 	}
 }
@@ -0,0 +1,58 @@
+package job
+
+import (
+	"context"
+	"time"
+)
+
+// Status is the lifecycle state of a job
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+)
+
+// Done reports whether the job has reached a final state
+func (s Status) Done() bool {
+	return s == StatusSucceeded || s == StatusFailed || s == StatusCancelled
+}
+
+// EventType distinguishes status changes from progress reported by the job itself
+type EventType string
+
+const (
+	EventTypeStatus   EventType = "status"
+	EventTypeProgress EventType = "progress"
+)
+
+// Event is a notification published while a job moves through its lifecycle.
+// Seq increases by one per event of the same job, starting at 1.
+type Event struct {
+	Seq    int
+	Type   EventType
+	Time   time.Time
+	Status Status
+	// Data is the value passed to the progress callback, nil for status events
+	Data interface{}
+}
+
+// Job is a point-in-time view of a submitted job
+type Job struct {
+	ID         string
+	Status     Status
+	CreatedAt  time.Time
+	StartedAt  time.Time
+	FinishedAt time.Time
+	// LastProgress is the data of the most recent progress event
+	LastProgress interface{}
+	Result       interface{}
+	Err          error
+}
+
+// RunFunc does the work of a job. It must return promptly once ctx is done and
+// may call progress, from any goroutine, to publish a progress event.
+type RunFunc func(ctx context.Context, progress func(data interface{})) (interface{}, error)
@@ -0,0 +1,357 @@
+package job
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	domainErrors "sandbox/domain/errors"
+)
+
+var (
+	// ErrQueueFull is returned by Submit when every queue slot is taken
+	ErrQueueFull = errors.New("job queue is full")
+	// ErrQueueClosed is returned by Submit after Close
+	ErrQueueClosed = errors.New("job queue is closed")
+)
+
+// subscriberBuffer is how many events a slow subscriber may fall behind before
+// it is disconnected; it can resubscribe and replay from the job's history
+const subscriberBuffer = 64
+
+// QueueConfig tunes the job queue
+type QueueConfig struct {
+	// Workers is the number of jobs run at the same time
+	Workers int
+	// Capacity is the number of jobs that may wait for a worker
+	Capacity int
+	// Timeout cancels a job that runs longer; zero means no limit
+	Timeout time.Duration
+	// Retention is how long finished jobs stay queryable. Expired jobs are
+	// evicted on every Submit and once per retention period.
+	Retention time.Duration
+}
+
+// Queue runs submitted jobs on a fixed pool of in-process workers and keeps
+// their state, result and event history until the retention period expires
+type Queue struct {
+	cfg     QueueConfig
+	mu      sync.Mutex
+	jobs    map[string]*entry
+	pending chan *entry
+	closed  bool
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+type entry struct {
+	job         Job
+	run         RunFunc
+	ctx         context.Context
+	cancel      context.CancelFunc
+	events      []Event
+	subscribers map[chan Event]struct{}
+}
+
+// NewQueue creates a queue and starts its workers
+func NewQueue(cfg QueueConfig) *Queue {
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	if cfg.Capacity < 0 {
+		cfg.Capacity = 0
+	}
+
+	q := &Queue{
+		cfg:     cfg,
+		jobs:    make(map[string]*entry),
+		pending: make(chan *entry, cfg.Capacity),
+		done:    make(chan struct{}),
+	}
+
+	for i := 0; i < cfg.Workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+	if cfg.Retention > 0 {
+		q.wg.Add(1)
+		go q.evictPeriodically()
+	}
+
+	return q
+}
+
+// Submit enqueues run and returns the queued job without waiting for it to start
+func (q *Queue) Submit(run RunFunc) (Job, error) {
+	id, err := newID()
+	if err != nil {
+		return Job{}, fmt.Errorf("failed to generate job ID: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	e := &entry{
+		job: Job{
+			ID:        id,
+			Status:    StatusQueued,
+			CreatedAt: time.Now(),
+		},
+		run:         run,
+		ctx:         ctx,
+		cancel:      cancel,
+		subscribers: make(map[chan Event]struct{}),
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		cancel()
+		return Job{}, ErrQueueClosed
+	}
+
+	q.evictExpired()
+
+	select {
+	case q.pending <- e:
+	default:
+		cancel()
+		return Job{}, ErrQueueFull
+	}
+
+	q.jobs[id] = e
+	q.publish(e, EventTypeStatus, nil)
+
+	return e.job, nil
+}
+
+// Get returns the current state of a job
+func (q *Queue) Get(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	e, err := q.lookup(id)
+	if err != nil {
+		return Job{}, err
+	}
+	return e.job, nil
+}
+
+// Cancel stops a queued or running job. Cancelling a finished job is a no-op.
+func (q *Queue) Cancel(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	e, err := q.lookup(id)
+	if err != nil {
+		return Job{}, err
+	}
+
+	if !e.job.Status.Done() {
+		e.cancel()
+		q.finish(e, nil, context.Canceled)
+	}
+	return e.job, nil
+}
+
+// Subscribe returns the events published so far and a channel carrying the
+// ones that follow. The channel is closed once the job is done, or when the
+// subscriber falls too far behind; call unsubscribe to stop listening early.
+func (q *Queue) Subscribe(id string) (history []Event, events <-chan Event, unsubscribe func(), err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	e, err := q.lookup(id)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	history = append([]Event(nil), e.events...)
+	ch := make(chan Event, subscriberBuffer)
+	if e.job.Status.Done() {
+		close(ch)
+		return history, ch, func() {}, nil
+	}
+
+	e.subscribers[ch] = struct{}{}
+	unsubscribe = func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if _, ok := e.subscribers[ch]; ok {
+			delete(e.subscribers, ch)
+			close(ch)
+		}
+	}
+
+	return history, ch, unsubscribe, nil
+}
+
+// Close stops accepting jobs, cancels the ones still queued or running and
+// waits for the workers to exit
+func (q *Queue) Close() {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	close(q.pending)
+	close(q.done)
+	for _, e := range q.jobs {
+		if !e.job.Status.Done() {
+			e.cancel()
+			q.finish(e, nil, context.Canceled)
+		}
+	}
+	q.mu.Unlock()
+
+	q.wg.Wait()
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+
+	for e := range q.pending {
+		q.execute(e)
+	}
+}
+
+func (q *Queue) execute(e *entry) {
+	q.mu.Lock()
+	if e.job.Status.Done() {
+		// Cancelled while waiting for a worker
+		q.mu.Unlock()
+		return
+	}
+	e.job.Status = StatusRunning
+	e.job.StartedAt = time.Now()
+	run := e.run
+	q.publish(e, EventTypeStatus, nil)
+	q.mu.Unlock()
+
+	ctx := e.ctx
+	if q.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, q.cfg.Timeout)
+		defer cancel()
+	}
+
+	result, err := run(ctx, func(data interface{}) {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if !e.job.Status.Done() {
+			e.job.LastProgress = data
+			q.publish(e, EventTypeProgress, data)
+		}
+	})
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !e.job.Status.Done() {
+		q.finish(e, result, err)
+	}
+	e.cancel()
+}
+
+// finish records the final state of a job and disconnects its subscribers. It
+// drops the run function so that a retained job does not keep the documents
+// its closure captured. q.mu must be held.
+func (q *Queue) finish(e *entry, result interface{}, err error) {
+	e.run = nil
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		e.job.Status = StatusCancelled
+		e.job.Err = err
+	case err != nil:
+		e.job.Status = StatusFailed
+		e.job.Err = err
+	default:
+		e.job.Status = StatusSucceeded
+		e.job.Result = result
+	}
+	e.job.FinishedAt = time.Now()
+
+	q.publish(e, EventTypeStatus, nil)
+	for ch := range e.subscribers {
+		delete(e.subscribers, ch)
+		close(ch)
+	}
+}
+
+// publish appends an event to the job's history and fans it out; q.mu must be held
+func (q *Queue) publish(e *entry, eventType EventType, data interface{}) {
+	event := Event{
+		Seq:    len(e.events) + 1,
+		Type:   eventType,
+		Time:   time.Now(),
+		Status: e.job.Status,
+		Data:   data,
+	}
+	e.events = append(e.events, event)
+
+	for ch := range e.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(e.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// lookup finds a job by ID; q.mu must be held
+func (q *Queue) lookup(id string) (*entry, error) {
+	e, ok := q.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("job %s: %w", id, domainErrors.ErrNotFound)
+	}
+	return e, nil
+}
+
+// evictPeriodically evicts expired jobs once per retention period until the
+// queue is closed, so they are forgotten even when no more jobs are submitted
+func (q *Queue) evictPeriodically() {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(q.cfg.Retention)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			q.mu.Lock()
+			q.evictExpired()
+			q.mu.Unlock()
+		case <-q.done:
+			return
+		}
+	}
+}
+
+// evictExpired forgets finished jobs older than the retention period; q.mu must be held
+func (q *Queue) evictExpired() {
+	if q.cfg.Retention <= 0 {
+		return
+	}
+
+	cutoff := time.Now().Add(-q.cfg.Retention)
+	for id, e := range q.jobs {
+		if e.job.Status.Done() && e.job.FinishedAt.Before(cutoff) {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
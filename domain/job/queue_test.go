@@ -0,0 +1,163 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	domainErrors "sandbox/domain/errors"
+)
+
+func waitForStatus(t *testing.T, q *Queue, id string, want Status) Job {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := q.Get(id)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if job.Status == want {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not reach %s", id, want)
+	return Job{}
+}
+
+func TestQueueRunsJobAndStreamsProgress(t *testing.T) {
+	q := NewQueue(QueueConfig{Workers: 2, Capacity: 4})
+	defer q.Close()
+
+	release := make(chan struct{})
+	submitted, err := q.Submit(func(ctx context.Context, progress func(interface{})) (interface{}, error) {
+		<-release
+		progress("half")
+		progress("all")
+		return "report", nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if submitted.Status != StatusQueued {
+		t.Errorf("expected queued job, got %s", submitted.Status)
+	}
+
+	history, events, unsubscribe, err := q.Subscribe(submitted.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer unsubscribe()
+	close(release)
+
+	var progress []interface{}
+	for event := range events {
+		if event.Type == EventTypeProgress {
+			progress = append(progress, event.Data)
+		}
+		history = append(history, event)
+	}
+
+	if len(progress) != 2 || progress[1] != "all" {
+		t.Errorf("expected two progress events, got %v", progress)
+	}
+	for i, event := range history {
+		if event.Seq != i+1 {
+			t.Fatalf("expected contiguous sequence numbers, got %d at %d", event.Seq, i)
+		}
+	}
+
+	job := waitForStatus(t, q, submitted.ID, StatusSucceeded)
+	if job.Result != "report" || job.LastProgress != "all" {
+		t.Errorf("unexpected final job %+v", job)
+	}
+}
+
+func TestQueueCancelStopsRunningJob(t *testing.T) {
+	q := NewQueue(QueueConfig{Workers: 1, Capacity: 1})
+	defer q.Close()
+
+	started := make(chan struct{})
+	stopped := make(chan struct{})
+	submitted, _ := q.Submit(func(ctx context.Context, progress func(interface{})) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		close(stopped)
+		return nil, ctx.Err()
+	})
+
+	<-started
+	job, err := q.Cancel(submitted.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if job.Status != StatusCancelled {
+		t.Errorf("expected cancelled job, got %s", job.Status)
+	}
+
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the job's context to be cancelled")
+	}
+}
+
+func TestQueueRejectsWhenFull(t *testing.T) {
+	q := NewQueue(QueueConfig{Workers: 1, Capacity: 1})
+	defer q.Close()
+
+	block := func(ctx context.Context, progress func(interface{})) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	running, _ := q.Submit(block)
+	waitForStatus(t, q, running.ID, StatusRunning)
+
+	if _, err := q.Submit(block); err != nil {
+		t.Fatalf("expected second job to wait in the queue, got %v", err)
+	}
+	if _, err := q.Submit(block); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("expected ErrQueueFull, got %v", err)
+	}
+}
+
+func TestQueueGetUnknownJob(t *testing.T) {
+	q := NewQueue(QueueConfig{})
+	defer q.Close()
+
+	if _, err := q.Get("missing"); !errors.Is(err, domainErrors.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestQueueEvictsExpiredJobsWithoutNewSubmissions(t *testing.T) {
+	q := NewQueue(QueueConfig{Capacity: 1, Retention: 100 * time.Millisecond})
+	defer q.Close()
+
+	submitted, err := q.Submit(func(ctx context.Context, progress func(interface{})) (interface{}, error) {
+		return "report", nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitForStatus(t, q, submitted.ID, StatusSucceeded)
+
+	q.mu.Lock()
+	run := q.jobs[submitted.ID].run
+	q.mu.Unlock()
+	if run != nil {
+		t.Error("expected the finished job to drop its run function")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := q.Get(submitted.ID); errors.Is(err, domainErrors.ErrNotFound) {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("expected the finished job to be evicted after the retention period")
+}
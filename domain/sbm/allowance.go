@@ -0,0 +1,116 @@
+package sbm
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"sandbox/domain/date"
+	domainErrors "sandbox/domain/errors"
+)
+
+// TripCategory selects the column of the uang harian table
+type TripCategory string
+
+const (
+	// TripCategoryOutOfTown is a trip outside the home city (luar kota)
+	TripCategoryOutOfTown TripCategory = "luar_kota"
+	// TripCategoryInTown is a trip within the home city lasting more than 8 hours
+	TripCategoryInTown TripCategory = "dalam_kota"
+	// TripCategoryTraining is attendance at a training (diklat)
+	TripCategoryTraining TripCategory = "diklat"
+)
+
+// ParseTripCategory accepts a category name; empty means out of town
+func ParseTripCategory(s string) (TripCategory, error) {
+	switch category := TripCategory(strings.ToLower(strings.TrimSpace(s))); category {
+	case "":
+		return TripCategoryOutOfTown, nil
+	case TripCategoryOutOfTown, TripCategoryInTown, TripCategoryTraining:
+		return category, nil
+	}
+	return "", domainErrors.NewValidationError(fmt.Sprintf("unknown trip category %q (available: luar_kota, dalam_kota, diklat)", s))
+}
+
+// label is the Indonesian name of the category used in descriptions
+func (c TripCategory) label() string {
+	switch c {
+	case TripCategoryInTown:
+		return "dalam kota lebih dari 8 jam"
+	case TripCategoryTraining:
+		return "diklat"
+	}
+	return "luar kota"
+}
+
+// AllowanceRate is the daily allowance of one province, in rupiah per person per day
+type AllowanceRate struct {
+	Province  string
+	OutOfTown int32
+	InTown    int32
+	Training  int32
+}
+
+// For returns the rate of the given category
+func (r AllowanceRate) For(category TripCategory) int32 {
+	switch category {
+	case TripCategoryInTown:
+		return r.InTown
+	case TripCategoryTraining:
+		return r.Training
+	}
+	return r.OutOfTown
+}
+
+// Allowance is the daily allowance owed to one traveller
+type Allowance struct {
+	Province string
+	Category TripCategory
+	Days     int32
+	Rate     int32
+	Total    int32
+	// Version names the table the rate was taken from
+	Version string
+}
+
+// Description renders the allowance for the recap, e.g.
+// "Uang harian luar kota JAWA TIMUR 3 hari (SBM 2025)"
+func (a Allowance) Description() string {
+	return fmt.Sprintf("Uang harian %s %s %d hari (%s)", a.Category.label(), a.Province, a.Days, a.Version)
+}
+
+// Allowance computes the daily allowance for a trip to destination from the
+// first to the last day, both included
+func (t *Table) Allowance(destination string, category TripCategory, from, to date.Date) (Allowance, error) {
+	if from.IsZero() || to.IsZero() {
+		return Allowance{}, errors.New("trip dates are required to compute the daily allowance")
+	}
+	if to.Before(from) {
+		return Allowance{}, fmt.Errorf("trip ends on %s before it starts on %s", to, from)
+	}
+
+	province, ok := t.Province(destination)
+	if !ok {
+		return Allowance{}, fmt.Errorf("destination %q is not in the gazetteer", destination)
+	}
+	rate, ok := t.allowance[normalizePlace(province)]
+	if !ok {
+		return Allowance{}, fmt.Errorf("%s has no daily allowance in %s", province, t.Version())
+	}
+
+	days := int64(from.DaysUntil(to)) + 1
+	perDay := rate.For(category)
+	total := days * int64(perDay)
+	if total > math.MaxInt32 {
+		return Allowance{}, fmt.Errorf("daily allowance of %d days at %d per day is too large", days, perDay)
+	}
+	return Allowance{
+		Province: rate.Province,
+		Category: category,
+		Days:     int32(days),
+		Rate:     perDay,
+		Total:    int32(total),
+		Version:  t.Version(),
+	}, nil
+}
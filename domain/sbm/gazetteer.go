@@ -0,0 +1,127 @@
+package sbm
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Gazetteer maps city and regency names to the province they belong to
+type Gazetteer struct {
+	cities    map[string]string // normalized city -> province
+	provinces map[string]string // normalized province -> province
+	// names lists the city keys longest first, for finding a city inside a longer text
+	names []string
+}
+
+// placePrefixes are administrative words written before a place name
+var placePrefixes = map[string]bool{
+	"kota": true, "kabupaten": true, "kab": true, "provinsi": true, "prov": true,
+	"propinsi": true, "daerah": true, "istimewa": true, "khusus": true, "ibukota": true,
+}
+
+// placeSpellings maps alternative spellings to the one used in the tables
+var placeSpellings = map[string]string{
+	"sumatera": "sumatra",
+	"kep":      "kepulauan",
+	"ntb":      "nusa tenggara barat",
+	"ntt":      "nusa tenggara timur",
+	"babel":    "bangka belitung",
+	"kepri":    "kepulauan riau",
+	"jabar":    "jawa barat",
+	"jateng":   "jawa tengah",
+	"jatim":    "jawa timur",
+	"sulsel":   "sulawesi selatan",
+	"sumut":    "sumatra utara",
+}
+
+func readGazetteer(fsys fs.FS, name string) (*Gazetteer, error) {
+	g := &Gazetteer{
+		cities:    make(map[string]string),
+		provinces: make(map[string]string),
+	}
+
+	err := readCSV(fsys, name, 2, func(record []string) error {
+		key := normalizePlace(record[0])
+		if province, ok := g.cities[key]; ok && province != record[1] {
+			return fmt.Errorf("%s is listed under both %s and %s", record[0], province, record[1])
+		}
+		g.cities[key] = record[1]
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for key := range g.cities {
+		g.names = append(g.names, key)
+	}
+	sort.Slice(g.names, func(i, j int) bool {
+		if len(g.names[i]) != len(g.names[j]) {
+			return len(g.names[i]) > len(g.names[j])
+		}
+		return g.names[i] < g.names[j]
+	})
+	return g, nil
+}
+
+func (g *Gazetteer) addProvince(province string) {
+	g.provinces[normalizePlace(province)] = province
+}
+
+// Province resolves destination, such as "Kota Surabaya", "Surabaya, Jawa
+// Timur" or "Provinsi Bali", to a province name. Each comma-separated part is
+// tried as a city and then as a province; failing that, the longest known city
+// named anywhere in destination wins.
+func (g *Gazetteer) Province(destination string) (string, bool) {
+	parts := strings.FieldsFunc(destination, func(r rune) bool {
+		return r == ',' || r == '/' || r == '(' || r == ')' || r == '-'
+	})
+
+	for _, part := range parts {
+		key := normalizePlace(part)
+		if province, ok := g.cities[key]; ok {
+			return province, true
+		}
+		if province, ok := g.provinces[key]; ok {
+			return province, true
+		}
+	}
+
+	text := " " + normalizePlace(strings.Join(parts, " ")) + " "
+	for _, name := range g.names {
+		if strings.Contains(text, " "+name+" ") {
+			return g.cities[name], true
+		}
+	}
+	return "", false
+}
+
+// normalizePlace lowercases s, drops punctuation and administrative prefixes,
+// and unifies common spellings, so "KAB. KULON PROGO" becomes "kulon progo"
+// and "D.K.I. Jakarta" becomes "dki jakarta"
+func normalizePlace(s string) string {
+	var words []string
+	for _, field := range strings.Fields(strings.ToLower(s)) {
+		word := strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return r
+			}
+			return -1
+		}, field)
+		if word == "" {
+			continue
+		}
+		if spelling, ok := placeSpellings[word]; ok {
+			word = spelling
+		}
+		words = append(words, word)
+	}
+
+	for len(words) > 1 && placePrefixes[words[0]] {
+		words = words[1:]
+	}
+	return strings.Join(strings.Fields(strings.Join(words, " ")), " ")
+}
@@ -0,0 +1,177 @@
+package sbm
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	domainErrors "sandbox/domain/errors"
+)
+
+// LodgingClass selects the column of the penginapan table
+type LodgingClass string
+
+const (
+	LodgingClassEselonI  LodgingClass = "eselon_i"
+	LodgingClassEselonII LodgingClass = "eselon_ii"
+	// LodgingClassEselonIII also covers golongan IV
+	LodgingClassEselonIII LodgingClass = "eselon_iii"
+	// LodgingClassEselonIV also covers golongan III, II and I
+	LodgingClassEselonIV LodgingClass = "eselon_iv"
+)
+
+var (
+	eselonPattern   = regexp.MustCompile(`(?i)\beselon\s*(iv|iii|ii|i|[1-4])(?:[.\s/]?[ab])?\b`)
+	golonganPattern = regexp.MustCompile(`(?i)\b(iv|iii|ii|i)\s*/\s*[a-e]\b|\bgol(?:ongan)?\.?\s*(iv|iii|ii|i|[1-4])\b`)
+)
+
+// rankTitles are the pangkat names of each golongan, most specific first
+var rankTitles = []struct {
+	title    string
+	golongan string
+}{
+	{"pembina", "iv"},
+	{"penata", "iii"},
+	{"pengatur", "ii"},
+	{"juru", "i"},
+}
+
+// ClassifyRank derives the lodging class from a traveller's rank, such as
+// "Penata Muda (III/a)" or "IV/b", and position, such as "Kepala Bagian
+// (Eselon III.a)". An eselon takes precedence over the golongan.
+func ClassifyRank(rank, position string) (LodgingClass, bool) {
+	text := rank + " " + position
+
+	if m := eselonPattern.FindStringSubmatch(text); m != nil {
+		switch romanLevel(m[1]) {
+		case 1:
+			return LodgingClassEselonI, true
+		case 2:
+			return LodgingClassEselonII, true
+		case 3:
+			return LodgingClassEselonIII, true
+		case 4:
+			return LodgingClassEselonIV, true
+		}
+	}
+
+	golongan := ""
+	if m := golonganPattern.FindStringSubmatch(rank); m != nil {
+		golongan = m[1] + m[2]
+	} else {
+		lower := strings.ToLower(rank)
+		for _, t := range rankTitles {
+			if strings.Contains(lower, t.title) {
+				golongan = t.golongan
+				break
+			}
+		}
+	}
+
+	switch romanLevel(golongan) {
+	case 4:
+		return LodgingClassEselonIII, true
+	case 1, 2, 3:
+		return LodgingClassEselonIV, true
+	}
+	return "", false
+}
+
+func romanLevel(s string) int {
+	switch strings.ToLower(s) {
+	case "i", "1":
+		return 1
+	case "ii", "2":
+		return 2
+	case "iii", "3":
+		return 3
+	case "iv", "4":
+		return 4
+	}
+	return 0
+}
+
+// LodgingRate is the per-night lodging ceiling of one province by class
+type LodgingRate struct {
+	Province  string
+	EselonI   int32
+	EselonII  int32
+	EselonIII int32
+	EselonIV  int32
+}
+
+// For returns the ceiling of the given class
+func (r LodgingRate) For(class LodgingClass) int32 {
+	switch class {
+	case LodgingClassEselonI:
+		return r.EselonI
+	case LodgingClassEselonII:
+		return r.EselonII
+	case LodgingClassEselonIII:
+		return r.EselonIII
+	}
+	return r.EselonIV
+}
+
+// LodgingCeiling is the most reimbursed per night for one traveller
+type LodgingCeiling struct {
+	Province string
+	Class    LodgingClass
+	PerNight int32
+	// Version names the table the ceiling was taken from
+	Version string
+}
+
+// lumpSumPercent is the share of the ceiling paid per night to a traveller who
+// did not stay in a hotel
+const lumpSumPercent = 30
+
+// LumpSum is the per-night amount paid without a hotel receipt: 30% of the ceiling
+func (c LodgingCeiling) LumpSum() int32 {
+	return c.PerNight * lumpSumPercent / 100
+}
+
+// LumpSumDescription renders a lump-sum stay for the recap, e.g.
+// "Penginapan 30% dari satuan biaya JAWA TIMUR 2 malam, tidak menginap di hotel (SBM 2025)"
+func (c LodgingCeiling) LumpSumDescription(nights int32) string {
+	return fmt.Sprintf("Penginapan %d%% dari satuan biaya %s %d malam, tidak menginap di hotel (%s)",
+		lumpSumPercent, c.Province, nights, c.Version)
+}
+
+// Cap splits a stay of nights at perNight into the reimbursable part, paid up to
+// the ceiling, and the excess the traveller bears. A stay whose amounts do not
+// fit in an int32 is a validation error.
+func (c LodgingCeiling) Cap(perNight, nights int32) (reimbursable, excess int32, err error) {
+	paid := min(perNight, c.PerNight)
+	total, over := int64(paid)*int64(nights), int64(perNight-paid)*int64(nights)
+	if total < math.MinInt32 || total > math.MaxInt32 || over > math.MaxInt32 {
+		return 0, 0, domainErrors.NewValidationError(fmt.Sprintf("lodging of %d nights at %d per night is too large", nights, perNight))
+	}
+	return int32(total), int32(over), nil
+}
+
+// LodgingCeiling returns the per-night ceiling for a traveller of the given rank
+// and position staying at destination
+func (t *Table) LodgingCeiling(destination, rank, position string) (LodgingCeiling, error) {
+	class, ok := ClassifyRank(rank, position)
+	if !ok {
+		return LodgingCeiling{}, fmt.Errorf("rank %q does not name a golongan or eselon", rank)
+	}
+
+	province, ok := t.Province(destination)
+	if !ok {
+		return LodgingCeiling{}, fmt.Errorf("destination %q is not in the gazetteer", destination)
+	}
+	rate, ok := t.lodging[normalizePlace(province)]
+	if !ok {
+		return LodgingCeiling{}, fmt.Errorf("%s has no lodging ceiling in %s", province, t.Version())
+	}
+
+	return LodgingCeiling{
+		Province: rate.Province,
+		Class:    class,
+		PerNight: rate.For(class),
+		Version:  t.Version(),
+	}, nil
+}
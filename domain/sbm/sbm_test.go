@@ -0,0 +1,108 @@
+package sbm
+
+import (
+	"testing"
+	"time"
+
+	"sandbox/domain/date"
+)
+
+func TestProvinceResolvesCitiesAndProvinces(t *testing.T) {
+	schedule, err := Default()
+	if err != nil {
+		t.Fatalf("failed to load the embedded tables: %v", err)
+	}
+	table := schedule.ForYear(2025)
+
+	cases := map[string]string{
+		"Surabaya":                     "JAWA TIMUR",
+		"KOTA SURABAYA":                "JAWA TIMUR",
+		"Kab. Kulon Progo":             "D.I. YOGYAKARTA",
+		"Bandung Barat, Jawa Barat":    "JAWA BARAT",
+		"DKI Jakarta":                  "D.K.I. JAKARTA",
+		"Provinsi Sumatera Utara":      "SUMATRA UTARA",
+		"Hotel Santika Makassar Pusat": "SULAWESI SELATAN",
+		"Daerah Istimewa Yogyakarta":   "D.I. YOGYAKARTA",
+	}
+	for destination, want := range cases {
+		if got, ok := table.Province(destination); !ok || got != want {
+			t.Errorf("Province(%q) = %q, %v; want %q", destination, got, ok, want)
+		}
+	}
+
+	if _, ok := table.Province("Atlantis"); ok {
+		t.Error("expected an unknown destination not to resolve")
+	}
+}
+
+func TestAllowanceCountsBothTravelDays(t *testing.T) {
+	schedule, err := Default()
+	if err != nil {
+		t.Fatalf("failed to load the embedded tables: %v", err)
+	}
+
+	// Later years fall back to the latest published table
+	table := schedule.ForYear(2030)
+	allowance, err := table.Allowance("Surabaya", TripCategoryOutOfTown,
+		date.New(2025, time.October, 25), date.New(2025, time.October, 27))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if allowance.Days != 3 || allowance.Rate != 410000 || allowance.Total != 1230000 {
+		t.Errorf("expected 3 days at 410.000, got %+v", allowance)
+	}
+
+	training, _ := table.Allowance("Surabaya", TripCategoryTraining,
+		date.New(2025, time.October, 25), date.New(2025, time.October, 25))
+	if training.Total != 120000 {
+		t.Errorf("expected one diklat day at 120.000, got %+v", training)
+	}
+
+	if _, err := table.Allowance("Surabaya", TripCategoryOutOfTown, date.Date{}, date.New(2025, time.October, 25)); err == nil {
+		t.Error("expected an error without a departure date")
+	}
+	// 25 years at 410.000 a day does not fit in an int32 amount
+	if long, err := table.Allowance("Surabaya", TripCategoryOutOfTown,
+		date.New(2000, time.January, 1), date.New(2025, time.October, 27)); err == nil {
+		t.Errorf("expected an error for a total that overflows, got %+v", long)
+	}
+}
+
+func TestLodgingCeilingFollowsRankAndProvince(t *testing.T) {
+	schedule, err := Default()
+	if err != nil {
+		t.Fatalf("failed to load the embedded tables: %v", err)
+	}
+	table := schedule.ForYear(2025)
+
+	cases := []struct {
+		rank, position string
+		want           LodgingClass
+	}{
+		{"Penata Muda (III/a)", "Analis Kebijakan", LodgingClassEselonIV},
+		{"IV/b", "Widyaiswara", LodgingClassEselonIII},
+		{"Pembina Utama Muda", "", LodgingClassEselonIII},
+		{"IV/c", "Kepala Biro (Eselon II.a)", LodgingClassEselonII},
+	}
+	for _, c := range cases {
+		if got, ok := ClassifyRank(c.rank, c.position); !ok || got != c.want {
+			t.Errorf("ClassifyRank(%q, %q) = %q, %v; want %q", c.rank, c.position, got, ok, c.want)
+		}
+	}
+
+	ceiling, err := table.LodgingCeiling("Kota Surabaya", "III/b", "Staf")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	reimbursable, excess, err := ceiling.Cap(ceiling.PerNight+100000, 2)
+	if err != nil || reimbursable != 2*ceiling.PerNight || excess != 200000 {
+		t.Errorf("expected 2 nights capped at %d with 200.000 excess, got %d and %d (%v)", ceiling.PerNight, reimbursable, excess, err)
+	}
+	if reimbursable, excess, err := ceiling.Cap(ceiling.PerNight+100000, 100000); err == nil {
+		t.Errorf("expected an error for 100.000 nights, got %d and %d", reimbursable, excess)
+	}
+
+	if _, err := table.LodgingCeiling("Surabaya", "Honorer", ""); err == nil {
+		t.Error("expected an error for a rank without golongan or eselon")
+	}
+}
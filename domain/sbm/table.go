@@ -0,0 +1,227 @@
+package sbm
+
+import (
+	"embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"sandbox/domain/date"
+)
+
+// data holds one directory per fiscal year with the rate tables published for
+// that year, plus the gazetteer shared by every year
+//
+//go:embed data
+var data embed.FS
+
+// Table is the Standar Biaya Masukan (SBM) published for one fiscal year
+type Table struct {
+	year      int
+	allowance map[string]AllowanceRate
+	lodging   map[string]LodgingRate
+	places    *Gazetteer
+}
+
+// Year is the fiscal year the table applies to
+func (t *Table) Year() int {
+	return t.year
+}
+
+// Version identifies the table in provenance and logs, e.g. "SBM 2025"
+func (t *Table) Version() string {
+	return fmt.Sprintf("SBM %d", t.year)
+}
+
+// Province resolves a destination city, regency or province to the province
+// name used by the table
+func (t *Table) Province(destination string) (string, bool) {
+	return t.places.Province(destination)
+}
+
+// Schedule holds the tables of every fiscal year
+type Schedule struct {
+	tables []*Table // ascending by year
+}
+
+var (
+	defaultOnce     sync.Once
+	defaultSchedule *Schedule
+	defaultErr      error
+)
+
+// Default returns the schedule built from the tables shipped with the
+// application. It fails only if the embedded data is malformed.
+func Default() (*Schedule, error) {
+	defaultOnce.Do(func() {
+		defaultSchedule, defaultErr = load(data)
+	})
+	return defaultSchedule, defaultErr
+}
+
+// ForDate returns the table of the fiscal year of d, or of the current year when d is unset
+func (s *Schedule) ForDate(d date.Date) *Table {
+	if d.IsZero() {
+		d = date.Today()
+	}
+	return s.ForYear(d.Time().Year())
+}
+
+// ForYear returns the table of the given fiscal year. Years without a table of
+// their own use the latest earlier one, or the earliest table for years before it.
+func (s *Schedule) ForYear(year int) *Table {
+	table := s.tables[0]
+	for _, t := range s.tables {
+		if t.year <= year {
+			table = t
+		}
+	}
+	return table
+}
+
+func load(fsys fs.FS) (*Schedule, error) {
+	places, err := readGazetteer(fsys, "data/gazetteer.csv")
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := fs.ReadDir(fsys, "data")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list SBM tables: %w", err)
+	}
+
+	schedule := &Schedule{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		year, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("SBM table directory %q is not a year", entry.Name())
+		}
+
+		allowance, err := readAllowanceRates(fsys, path.Join("data", entry.Name(), "uang_harian.csv"))
+		if err != nil {
+			return nil, err
+		}
+		for _, rate := range allowance {
+			places.addProvince(rate.Province)
+		}
+		lodging, err := readLodgingRates(fsys, path.Join("data", entry.Name(), "penginapan.csv"))
+		if err != nil {
+			return nil, err
+		}
+
+		schedule.tables = append(schedule.tables, &Table{
+			year:      year,
+			allowance: allowance,
+			lodging:   lodging,
+			places:    places,
+		})
+	}
+
+	if len(schedule.tables) == 0 {
+		return nil, fmt.Errorf("no SBM tables found")
+	}
+	for city, province := range places.cities {
+		if _, ok := places.provinces[normalizePlace(province)]; !ok {
+			return nil, fmt.Errorf("gazetteer maps %s to %s, which no SBM table knows", city, province)
+		}
+	}
+	sort.Slice(schedule.tables, func(i, j int) bool {
+		return schedule.tables[i].year < schedule.tables[j].year
+	})
+	return schedule, nil
+}
+
+func readAllowanceRates(fsys fs.FS, name string) (map[string]AllowanceRate, error) {
+	rates := make(map[string]AllowanceRate)
+	err := readCSV(fsys, name, 4, func(record []string) error {
+		amounts, err := parseAmounts(record[1:])
+		if err != nil {
+			return err
+		}
+
+		rates[normalizePlace(record[0])] = AllowanceRate{
+			Province:  record[0],
+			OutOfTown: amounts[0],
+			InTown:    amounts[1],
+			Training:  amounts[2],
+		}
+		return nil
+	})
+	return rates, err
+}
+
+func readLodgingRates(fsys fs.FS, name string) (map[string]LodgingRate, error) {
+	rates := make(map[string]LodgingRate)
+	err := readCSV(fsys, name, 5, func(record []string) error {
+		amounts, err := parseAmounts(record[1:])
+		if err != nil {
+			return err
+		}
+
+		rates[normalizePlace(record[0])] = LodgingRate{
+			Province:  record[0],
+			EselonI:   amounts[0],
+			EselonII:  amounts[1],
+			EselonIII: amounts[2],
+			EselonIV:  amounts[3],
+		}
+		return nil
+	})
+	return rates, err
+}
+
+func parseAmounts(fields []string) ([]int32, error) {
+	amounts := make([]int32, len(fields))
+	for i, field := range fields {
+		amount, err := strconv.ParseInt(field, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid amount %q", field)
+		}
+		amounts[i] = int32(amount)
+	}
+	return amounts, nil
+}
+
+// readCSV calls fn for every record of a CSV file after its header. Lines
+// starting with # are comments.
+func readCSV(fsys fs.FS, name string, fields int, fn func(record []string) error) error {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = fields
+	reader.TrimLeadingSpace = true
+
+	if _, err := reader.Read(); err != nil {
+		return fmt.Errorf("failed to read header of %s: %w", name, err)
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		for i := range record {
+			record[i] = strings.TrimSpace(record[i])
+		}
+		if err := fn(record); err != nil {
+			line, _ := reader.FieldPos(0)
+			return fmt.Errorf("%s line %d: %w", name, line, err)
+		}
+	}
+}
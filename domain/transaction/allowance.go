@@ -0,0 +1,84 @@
+package transaction
+
+import (
+	"fmt"
+	"strings"
+
+	"sandbox/application/dto"
+	"sandbox/domain/date"
+	"sandbox/domain/sbm"
+)
+
+// applyAllowances replaces whatever allowance transactions the extractor produced
+// with the daily allowance computed from table, one per assignee. When the
+// allowance cannot be computed, no allowance is added and the returned error
+// says why.
+func applyAllowances(report *dto.RecapReportDTO, table *sbm.Table, category sbm.TripCategory) error {
+	for i := range report.Assignees {
+		report.Assignees[i].Transactions = withoutAllowances(report.Assignees[i].Transactions)
+	}
+	unassigned := report.Unassigned[:0]
+	for _, item := range report.Unassigned {
+		if !isAllowance(item.Transaction) {
+			unassigned = append(unassigned, item)
+		}
+	}
+	report.Unassigned = unassigned
+
+	if len(report.Assignees) == 0 {
+		return nil
+	}
+
+	from, to := tripDates(report)
+	allowance, err := table.Allowance(report.DestinationCity, category, from, to)
+	if err != nil {
+		return fmt.Errorf("daily allowance not computed: %w", err)
+	}
+
+	for i := range report.Assignees {
+		assignee := &report.Assignees[i]
+		assignee.Transactions = append(assignee.Transactions, dto.TransactionDTO{
+			Name:        assignee.Name,
+			Type:        string(TransactionTypeAllowance),
+			Subtype:     "daily_allowance",
+			Amount:      allowance.Rate,
+			Subtotal:    allowance.Total,
+			Description: allowance.Description(),
+			Date:        from,
+			Source: &dto.SourceDTO{
+				Snippet:    allowance.Version,
+				Confidence: 1,
+			},
+		})
+	}
+	return nil
+}
+
+// tripDates returns the first and last day of the trip: the departure and return
+// dates, or the start and end dates when those are missing
+func tripDates(report *dto.RecapReportDTO) (from, to date.Date) {
+	if report.DepartureDate.IsZero() || report.ReturnDate.IsZero() {
+		return report.StartDate, report.EndDate
+	}
+	return report.DepartureDate, report.ReturnDate
+}
+
+// tripStart is the first day of the trip, which selects the fiscal year of the rates
+func tripStart(report *dto.RecapReportDTO) date.Date {
+	from, _ := tripDates(report)
+	return from
+}
+
+func withoutAllowances(txs []dto.TransactionDTO) []dto.TransactionDTO {
+	kept := txs[:0]
+	for _, tx := range txs {
+		if !isAllowance(tx) {
+			kept = append(kept, tx)
+		}
+	}
+	return kept
+}
+
+func isAllowance(tx dto.TransactionDTO) bool {
+	return TransactionType(strings.ToLower(tx.Type)) == TransactionTypeAllowance
+}
@@ -0,0 +1,232 @@
+package transaction
+
+import (
+	"strings"
+	"unicode"
+
+	"sandbox/application/dto"
+)
+
+const (
+	// defaultAssigneeThreshold is the name score at which a receipt is attached to an assignee
+	defaultAssigneeThreshold = 0.6
+	// assigneeMargin is how far the best match must lead the runner-up to be trusted
+	assigneeMargin = 0.1
+)
+
+// honorifics are titles written before (or, on airline tickets, after) a name
+var honorifics = map[string]bool{
+	"bapak": true, "bpk": true, "pak": true, "ibu": true, "bu": true,
+	"sdr": true, "sdri": true, "saudara": true, "saudari": true,
+	"tn": true, "ny": true, "nn": true, "mr": true, "mrs": true, "ms": true, "miss": true,
+	"dr": true, "drs": true, "dra": true, "ir": true, "prof": true,
+	"h": true, "hj": true, "kh": true,
+}
+
+// degrees are academic titles written after a name without a separating comma
+var degrees = map[string]bool{
+	"st": true, "mt": true, "skom": true, "mkom": true, "se": true, "mm": true,
+	"msc": true, "ssi": true, "msi": true, "sh": true, "mh": true, "spd": true,
+	"mpd": true, "ssos": true, "msos": true, "sked": true, "mkes": true, "skm": true,
+	"sak": true, "ak": true, "amd": true, "phd": true, "mba": true, "mph": true,
+}
+
+// nameAliases maps common abbreviations and spellings to one form
+var nameAliases = map[string]string{
+	"muh": "muhammad", "moh": "muhammad", "mhd": "muhammad", "moch": "muhammad",
+	"muhamad": "muhammad", "mohammad": "muhammad", "mohamad": "muhammad",
+	"mochammad": "muhammad", "mochamad": "muhammad", "mukhammad": "muhammad",
+	"abd": "abdul", "achmad": "ahmad",
+}
+
+// assignTransactions attaches every receipt to the assignee whose name best
+// matches the booker on it. Receipts already filed under an assignee whose name
+// does not match theirs are re-matched too. Receipts whose name matches no one
+// closely enough, or two assignees equally well, go to report.Unassigned for the
+// user to resolve. A receipt without any name goes to the only assignee when
+// there is just one.
+func assignTransactions(report *dto.RecapReportDTO, threshold float64) {
+	pending := report.Unassigned
+	report.Unassigned = []dto.UnassignedTransactionDTO{}
+
+	for i := range report.Assignees {
+		assignee := &report.Assignees[i]
+		kept := assignee.Transactions[:0]
+		for _, tx := range assignee.Transactions {
+			if tx.Name != "" && assignee.Name != "" && nameScore(tx.Name, assignee.Name) < threshold {
+				pending = append(pending, dto.UnassignedTransactionDTO{Transaction: tx})
+				continue
+			}
+			kept = append(kept, tx)
+		}
+		assignee.Transactions = kept
+	}
+
+	for _, item := range pending {
+		tx := item.Transaction
+
+		idx, score, ok := -1, 0.0, false
+		if tx.Name == "" {
+			if len(report.Assignees) == 1 {
+				idx, ok = 0, true
+			}
+		} else {
+			idx, score, ok = bestAssignee(report.Assignees, tx.Name, threshold)
+		}
+
+		if !ok {
+			unassigned := dto.UnassignedTransactionDTO{Transaction: tx, Score: score}
+			if idx >= 0 {
+				unassigned.Suggestion = report.Assignees[idx].Name
+			}
+			report.Unassigned = append(report.Unassigned, unassigned)
+			continue
+		}
+
+		tx.Name = report.Assignees[idx].Name
+		report.Assignees[idx].Transactions = append(report.Assignees[idx].Transactions, tx)
+	}
+}
+
+// bestAssignee returns the index and score of the assignee closest to name, and
+// whether the match is good enough and clear of the runner-up. idx is -1 when
+// no assignee shares anything with name.
+func bestAssignee(assignees []dto.AssigneeDTO, name string, threshold float64) (idx int, score float64, ok bool) {
+	idx = -1
+	var runnerUp float64
+	for i, a := range assignees {
+		s := nameScore(name, a.Name)
+		switch {
+		case s > score:
+			idx, score, runnerUp = i, s, score
+		case s > runnerUp:
+			runnerUp = s
+		}
+	}
+	return idx, score, idx >= 0 && score >= threshold && score-runnerUp >= assigneeMargin
+}
+
+// nameScore rates from 0 to 1 how likely a and b name the same person. Each
+// token of the shorter name is paired with its closest unused token of the
+// other; the result is the Dice coefficient of the pairing, so "Budi" scores
+// 0.67 against "Budi Santoso" and "B. Santoso" 0.88.
+func nameScore(a, b string) float64 {
+	tokensA, tokensB := nameTokens(a), nameTokens(b)
+	if len(tokensA) == 0 || len(tokensB) == 0 {
+		return 0
+	}
+	if len(tokensA) > len(tokensB) {
+		tokensA, tokensB = tokensB, tokensA
+	}
+
+	used := make([]bool, len(tokensB))
+	var matched float64
+	for _, x := range tokensA {
+		best, bestIdx := 0.0, -1
+		for j, y := range tokensB {
+			if used[j] {
+				continue
+			}
+			if s := tokenSimilarity(x, y); s > best {
+				best, bestIdx = s, j
+			}
+		}
+		if bestIdx >= 0 {
+			used[bestIdx] = true
+			matched += best
+		}
+	}
+
+	return 2 * matched / float64(len(tokensA)+len(tokensB))
+}
+
+// tokenSimilarity compares two normalized name tokens. An initial matches any
+// token starting with it, and a spelling slip such as "Syaiful" for "Saiful"
+// still counts.
+func tokenSimilarity(x, y string) float64 {
+	if x == y {
+		return 1
+	}
+
+	rx, ry := []rune(x), []rune(y)
+	if (len(rx) == 1 && rx[0] == ry[0]) || (len(ry) == 1 && ry[0] == rx[0]) {
+		return 0.75
+	}
+
+	longer := max(len(rx), len(ry))
+	if longer < 4 {
+		return 0
+	}
+	if s := 1 - float64(levenshtein(rx, ry))/float64(longer); s >= 0.75 {
+		return s
+	}
+	return 0
+}
+
+// nameTokens lowercases name and drops honorifics, academic degrees and
+// punctuation, so that "Dr. Ir. Budi Santoso, M.T." and "SANTOSO/BUDI MR"
+// both become [budi santoso] in some order
+func nameTokens(name string) []string {
+	// Degrees follow the name after a comma
+	if i := strings.IndexByte(name, ','); i >= 0 {
+		name = name[:i]
+	}
+
+	var tokens []string
+	for _, field := range strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return unicode.IsSpace(r) || r == '/' || r == '(' || r == ')'
+	}) {
+		token := strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) {
+				return r
+			}
+			return -1
+		}, field)
+		if token == "" {
+			continue
+		}
+		if alias, ok := nameAliases[token]; ok {
+			token = alias
+		}
+		tokens = append(tokens, token)
+	}
+
+	for len(tokens) > 1 && honorifics[tokens[0]] {
+		tokens = tokens[1:]
+	}
+	for len(tokens) > 1 {
+		last := tokens[len(tokens)-1]
+		// A trailing single letter is an initial rather than "H." for Haji
+		if !degrees[last] && (!honorifics[last] || len(last) == 1) {
+			break
+		}
+		tokens = tokens[:len(tokens)-1]
+	}
+	return tokens
+}
+
+// normalizeName is the canonical form used to recognise the same assignee exactly
+func normalizeName(name string) string {
+	return strings.Join(nameTokens(name), " ")
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,70 @@
+package transaction
+
+import (
+	"testing"
+
+	"sandbox/application/dto"
+)
+
+func TestNameScoreIgnoresTitlesAndAbbreviations(t *testing.T) {
+	cases := []struct {
+		a, b string
+		min  float64
+	}{
+		{"Dr. Ir. Budi Santoso, M.T.", "BUDI SANTOSO", 1},
+		{"SANTOSO/BUDI MR", "Budi Santoso S.T.", 1},
+		{"Bpk. Moh. Rizki", "Muhammad Rizki", 1},
+		{"M. Rizki", "Muhammad Rizki", 0.85},
+		{"Syaiful Anwar", "Saiful Anwar", 0.9},
+	}
+	for _, c := range cases {
+		if got := nameScore(c.a, c.b); got < c.min {
+			t.Errorf("nameScore(%q, %q) = %.2f, want at least %.2f", c.a, c.b, got, c.min)
+		}
+	}
+
+	if got := nameScore("Budi Hartono", "Budi Santoso"); got >= defaultAssigneeThreshold {
+		t.Errorf("expected a different surname to stay below the threshold, got %.2f", got)
+	}
+}
+
+func TestAssignTransactionsLeavesUnknownBookersUnassigned(t *testing.T) {
+	report := &dto.RecapReportDTO{
+		Assignees: []dto.AssigneeDTO{
+			{Name: "Budi Santoso, S.T."},
+			{Name: "Siti Aminah"},
+			{Name: "Siti Rahma"},
+		},
+		Unassigned: []dto.UnassignedTransactionDTO{
+			{Transaction: dto.TransactionDTO{Name: "BUDI SANTOSO", Subtotal: 1}},
+			{Transaction: dto.TransactionDTO{Name: "Andi Wijaya", Subtotal: 2}},
+			{Transaction: dto.TransactionDTO{Name: "Siti", Subtotal: 3}},
+			{Transaction: dto.TransactionDTO{Subtotal: 4}},
+		},
+	}
+	// Filed under Siti by the extractor although someone else booked it
+	report.Assignees[1].Transactions = []dto.TransactionDTO{{Name: "Budi Hartono", Subtotal: 5}}
+
+	assignTransactions(report, defaultAssigneeThreshold)
+
+	if got := report.Assignees[0].Transactions; len(got) != 1 || got[0].Subtotal != 1 || got[0].Name != "Budi Santoso, S.T." {
+		t.Errorf("expected Budi's receipt on Budi under his surat tugas name, got %+v", got)
+	}
+	if got := report.Assignees[1].Transactions; len(got) != 0 {
+		t.Errorf("expected the colleague's receipt to be taken off Siti, got %+v", got)
+	}
+
+	unassigned := map[int32]dto.UnassignedTransactionDTO{}
+	for _, item := range report.Unassigned {
+		unassigned[item.Transaction.Subtotal] = item
+	}
+	if len(unassigned) != 4 {
+		t.Fatalf("expected 4 unassigned receipts, got %+v", report.Unassigned)
+	}
+	if item := unassigned[3]; item.Suggestion != "Siti Aminah" {
+		t.Errorf("expected the ambiguous first name to suggest the first Siti, got %+v", item)
+	}
+	if item := unassigned[5]; item.Suggestion != "Budi Santoso, S.T." || item.Score >= defaultAssigneeThreshold {
+		t.Errorf("expected Budi Hartono to be suggested as Budi below the threshold, got %+v", item)
+	}
+}
@@ -0,0 +1,141 @@
+package transaction
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+
+	"sandbox/application/dto"
+)
+
+// CachedExtraction is a successful extraction as stored in a ResultCache
+type CachedExtraction struct {
+	Report    *dto.RecapReportDTO `json:"report"`
+	Documents []CachedDocument    `json:"documents"`
+	// PromptVersion is the prompt template the report was extracted with
+	PromptVersion string `json:"prompt_version,omitempty"`
+}
+
+// CachedDocument remembers how a document was classified and the filename it
+// was uploaded under, so that provenance can be renamed on a later hit
+type CachedDocument struct {
+	Hash     string       `json:"hash"`
+	Filename string       `json:"filename"`
+	Kind     DocumentKind `json:"kind"`
+	Parser   string       `json:"parser,omitempty"`
+}
+
+// cacheKey hashes the backend, its version and the sorted contents of the
+// documents. Filenames and upload order do not affect the key.
+func cacheKey(backend, version string, documents []Document) string {
+	hashes := make([]string, len(documents))
+	for i, doc := range documents {
+		hashes[i] = documentHash(doc)
+	}
+	sort.Strings(hashes)
+
+	h := sha256.New()
+	h.Write([]byte(backend))
+	h.Write([]byte{0})
+	h.Write([]byte(version))
+	for _, hash := range hashes {
+		h.Write([]byte{0})
+		h.Write([]byte(hash))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func documentHash(doc Document) string {
+	sum := sha256.Sum256(doc.Content)
+	return hex.EncodeToString(sum[:])
+}
+
+func extractorVersion(extractor interface{}) string {
+	if versioned, ok := extractor.(VersionedExtractor); ok {
+		return versioned.Version()
+	}
+	return ""
+}
+
+func extractorPromptVersion(extractor ExtractorRepository) string {
+	if prompted, ok := extractor.(PromptedExtractor); ok {
+		return prompted.PromptVersion()
+	}
+	return ""
+}
+
+// newCachedExtraction records a merged report and the documents it came from
+func newCachedExtraction(report *dto.RecapReportDTO, documents []Document, promptVersion string) *CachedExtraction {
+	entry := &CachedExtraction{
+		Report:        report,
+		Documents:     make([]CachedDocument, len(documents)),
+		PromptVersion: promptVersion,
+	}
+	for i, doc := range documents {
+		entry.Documents[i] = CachedDocument{
+			Hash:     documentHash(doc),
+			Filename: doc.Filename,
+			Kind:     doc.Kind,
+			Parser:   doc.Parser,
+		}
+	}
+	return entry
+}
+
+// resultFromCache rebuilds an extraction result for the current upload, renaming
+// provenance to the filenames the documents were uploaded under this time
+func resultFromCache(entry *CachedExtraction, documents []Document, backend string) *ExtractionResult {
+	byHash := make(map[string]CachedDocument, len(entry.Documents))
+	for _, doc := range entry.Documents {
+		byHash[doc.Hash] = doc
+	}
+
+	renames := make(map[string]string, len(documents))
+	outcomes := make([]DocumentOutcome, len(documents))
+	for i, doc := range documents {
+		cached := byHash[documentHash(doc)]
+		renames[cached.Filename] = doc.Filename
+		outcomes[i] = DocumentOutcome{
+			Filename: doc.Filename,
+			Pages:    doc.Pages,
+			Kind:     cached.Kind,
+			Parser:   cached.Parser,
+		}
+	}
+	renameSources(entry.Report, renames)
+
+	return &ExtractionResult{
+		Report:        entry.Report,
+		Backend:       backend,
+		PromptVersion: entry.PromptVersion,
+		Documents:     outcomes,
+		Cached:        true,
+	}
+}
+
+func renameSources(report *dto.RecapReportDTO, renames map[string]string) {
+	for i := range report.Assignees {
+		assignee := &report.Assignees[i]
+		for j := range assignee.Transactions {
+			if source := assignee.Transactions[j].Source; source != nil {
+				if name, ok := renames[source.Filename]; ok {
+					source.Filename = name
+				}
+			}
+		}
+		for field, source := range assignee.FieldSources {
+			if name, ok := renames[source.Filename]; ok {
+				source.Filename = name
+				assignee.FieldSources[field] = source
+			}
+		}
+	}
+
+	for i := range report.Unassigned {
+		if source := report.Unassigned[i].Transaction.Source; source != nil {
+			if name, ok := renames[source.Filename]; ok {
+				source.Filename = name
+			}
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package transaction
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"sandbox/application/dto"
+)
+
+// DuplicateAction is what the deduplication pass did with a pair of transactions
+type DuplicateAction string
+
+const (
+	// DuplicateActionMerged means the duplicate was folded into the kept transaction and removed
+	DuplicateActionMerged DuplicateAction = "merged"
+	// DuplicateActionFlagged means both transactions were kept and marked for review
+	DuplicateActionFlagged DuplicateAction = "flagged"
+)
+
+const (
+	// mergeScore and flagScore are the duplicate scores at which a pair is merged or flagged
+	mergeScore = 0.75
+	flagScore  = 0.4
+)
+
+// DuplicateDecision records one pair of transactions that looked like the same expense
+type DuplicateDecision struct {
+	Assignee  string
+	Action    DuplicateAction
+	Score     float64
+	Reason    string
+	Kept      dto.TransactionDTO
+	Duplicate dto.TransactionDTO
+}
+
+// deduplicate looks for the same expense extracted twice within each assignee,
+// typically an e-ticket uploaded both as PDF and as a screenshot. Candidates
+// must have the same type, a compatible subtype, the same subtotal (within 1%)
+// and no conflicting dates, and come from different files. They are then
+// scored on date and description: confident matches are merged, keeping the
+// more confident extraction; weaker ones are kept and flagged for review.
+func deduplicate(report *dto.RecapReportDTO) []DuplicateDecision {
+	var decisions []DuplicateDecision
+
+	for a := range report.Assignees {
+		assignee := &report.Assignees[a]
+		txs := assignee.Transactions
+
+		for i := 0; i < len(txs); i++ {
+			for j := i + 1; j < len(txs); j++ {
+				score, reason, ok := duplicateScore(txs[i], txs[j])
+				if !ok || score < flagScore {
+					continue
+				}
+
+				if score < mergeScore {
+					decisions = append(decisions, DuplicateDecision{
+						Assignee:  assignee.Name,
+						Action:    DuplicateActionFlagged,
+						Score:     score,
+						Reason:    reason,
+						Kept:      txs[i],
+						Duplicate: txs[j],
+					})
+					markForReview(&txs[i])
+					markForReview(&txs[j])
+					continue
+				}
+
+				kept, dropped := txs[i], txs[j]
+				if confidence(dropped) > confidence(kept) {
+					kept, dropped = dropped, kept
+				}
+				decisions = append(decisions, DuplicateDecision{
+					Assignee:  assignee.Name,
+					Action:    DuplicateActionMerged,
+					Score:     score,
+					Reason:    reason,
+					Kept:      kept,
+					Duplicate: dropped,
+				})
+
+				txs[i] = mergeTransaction(kept, dropped)
+				txs = append(txs[:j], txs[j+1:]...)
+				j--
+			}
+		}
+
+		assignee.Transactions = txs
+	}
+
+	return decisions
+}
+
+// duplicateScore rates how likely a and b are the same expense, from 0 to 1.
+// ok is false when they cannot be duplicates at all.
+func duplicateScore(a, b dto.TransactionDTO) (score float64, reason string, ok bool) {
+	if !strings.EqualFold(a.Type, b.Type) {
+		return 0, "", false
+	}
+	if a.Subtype != "" && b.Subtype != "" && !strings.EqualFold(a.Subtype, b.Subtype) {
+		return 0, "", false
+	}
+	if !similarAmount(a.Subtotal, b.Subtotal) {
+		return 0, "", false
+	}
+	if fa, fb := sourceFilename(a), sourceFilename(b); fa != "" && fa == fb {
+		// Two equal lines on one document are separate expenses, such as a return trip
+		return 0, "", false
+	}
+
+	var dateScore float64
+	var dateReason string
+	switch {
+	case a.Date.IsZero() || b.Date.IsZero():
+		dateScore, dateReason = 0.25, "date unknown"
+	case a.Date.Equal(b.Date):
+		dateScore, dateReason = 0.5, "same date"
+	default:
+		return 0, "", false
+	}
+
+	similarity := descriptionSimilarity(a.Description, b.Description)
+	score = dateScore + 0.5*similarity
+	reason = fmt.Sprintf("same type and amount, %s, description %.0f%% similar", dateReason, similarity*100)
+	return score, reason, true
+}
+
+// similarAmount allows 1% difference for rounding on screenshots and converted PDFs
+func similarAmount(a, b int32) bool {
+	if a <= 0 || b <= 0 {
+		return a == b
+	}
+	diff := int64(a) - int64(b)
+	if diff < 0 {
+		diff = -diff
+	}
+	larger := int64(a)
+	if int64(b) > larger {
+		larger = int64(b)
+	}
+	return diff*100 <= larger
+}
+
+// descriptionSimilarity is the Dice coefficient of the word sets of a and b
+func descriptionSimilarity(a, b string) float64 {
+	wordsA, wordsB := descriptionWords(a), descriptionWords(b)
+	if len(wordsA) == 0 && len(wordsB) == 0 {
+		return 1
+	}
+	if len(wordsA) == 0 || len(wordsB) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for word := range wordsA {
+		if _, ok := wordsB[word]; ok {
+			shared++
+		}
+	}
+	return 2 * float64(shared) / float64(len(wordsA)+len(wordsB))
+}
+
+func descriptionWords(s string) map[string]struct{} {
+	words := make(map[string]struct{})
+	for _, word := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len(word) > 1 {
+			words[word] = struct{}{}
+		}
+	}
+	return words
+}
+
+// mergeTransaction fills the gaps of kept with what only dropped knows
+func mergeTransaction(kept, dropped dto.TransactionDTO) dto.TransactionDTO {
+	setIfEmpty(&kept.Name, dropped.Name)
+	setIfEmpty(&kept.Subtype, dropped.Subtype)
+	setIfEmpty(&kept.Description, dropped.Description)
+	setIfEmpty(&kept.TransportDetail, dropped.TransportDetail)
+	setIfEmpty(&kept.PaymentType, dropped.PaymentType)
+	setIfEmpty(&kept.Date, dropped.Date)
+	if kept.TotalNight == nil {
+		kept.TotalNight = dropped.TotalNight
+	}
+	return kept
+}
+
+func markForReview(tx *dto.TransactionDTO) {
+	if tx.Source == nil {
+		tx.Source = &dto.SourceDTO{}
+	}
+	tx.Source.NeedsReview = true
+}
+
+func confidence(tx dto.TransactionDTO) float64 {
+	if tx.Source == nil {
+		return 0
+	}
+	return tx.Source.Confidence
+}
+
+func sourceFilename(tx dto.TransactionDTO) string {
+	if tx.Source == nil {
+		return ""
+	}
+	return tx.Source.Filename
+}
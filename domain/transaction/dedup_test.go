@@ -0,0 +1,80 @@
+package transaction
+
+import (
+	"testing"
+	"time"
+
+	"sandbox/application/dto"
+	"sandbox/domain/date"
+)
+
+func TestDeduplicateMergesSameTicketFromTwoFiles(t *testing.T) {
+	flightDate := date.New(2025, time.October, 25)
+	report := &dto.RecapReportDTO{
+		Assignees: []dto.AssigneeDTO{{
+			Name: "Budi Santoso",
+			Transactions: []dto.TransactionDTO{
+				{
+					Type: "transport", Subtype: "flight", Subtotal: 1450000, Date: flightDate,
+					Description: "Garuda GA 312 CGK - SUB",
+					Source:      &dto.SourceDTO{Filename: "ticket.png", Confidence: 0.6},
+				},
+				{
+					Type: "transport", Subtype: "taxi", Subtotal: 85000, Date: flightDate,
+					Description: "Grab Bandara Juanda - Hotel",
+					Source:      &dto.SourceDTO{Filename: "grab.png", Confidence: 0.9},
+				},
+				{
+					Type: "transport", Subtype: "flight", Subtotal: 1450000, Date: flightDate,
+					Description: "E-ticket Garuda GA 312 CGK SUB", TransportDetail: "",
+					Source: &dto.SourceDTO{Filename: "ticket.pdf", Confidence: 0.95},
+				},
+				{
+					Type: "transport", Subtype: "taxi", Subtotal: 85000, Date: flightDate,
+					Description: "Gojek Hotel - Kantor Dinas",
+					Source:      &dto.SourceDTO{Filename: "gojek.png", Confidence: 0.9},
+				},
+			},
+		}},
+	}
+
+	decisions := deduplicate(report)
+
+	txs := report.Assignees[0].Transactions
+	if len(txs) != 3 {
+		t.Fatalf("expected the duplicate ticket to be merged away, got %d transactions", len(txs))
+	}
+	if txs[0].Source.Filename != "ticket.pdf" {
+		t.Errorf("expected the more confident extraction to be kept, got %s", txs[0].Source.Filename)
+	}
+	if len(decisions) != 2 {
+		t.Fatalf("expected a merge and a flag, got %+v", decisions)
+	}
+	if decisions[0].Action != DuplicateActionMerged || decisions[0].Duplicate.Source.Filename != "ticket.png" {
+		t.Errorf("unexpected merge decision %+v", decisions[0])
+	}
+
+	// Same fare on the same day but different routes: kept, but flagged
+	if decisions[1].Action != DuplicateActionFlagged {
+		t.Errorf("expected the two rides to be flagged, got %+v", decisions[1])
+	}
+	if !txs[1].Source.NeedsReview || !txs[2].Source.NeedsReview {
+		t.Error("expected flagged rides to need review")
+	}
+}
+
+func TestDeduplicateKeepsDifferentDatesAndSameFileLines(t *testing.T) {
+	report := &dto.RecapReportDTO{
+		Assignees: []dto.AssigneeDTO{{
+			Transactions: []dto.TransactionDTO{
+				{Type: "transport", Subtotal: 50000, Date: date.New(2025, time.October, 25), Description: "Taxi", Source: &dto.SourceDTO{Filename: "a.png"}},
+				{Type: "transport", Subtotal: 50000, Date: date.New(2025, time.October, 26), Description: "Taxi", Source: &dto.SourceDTO{Filename: "b.png"}},
+				{Type: "transport", Subtotal: 50000, Date: date.New(2025, time.October, 26), Description: "Taxi", Source: &dto.SourceDTO{Filename: "b.png"}},
+			},
+		}},
+	}
+
+	if decisions := deduplicate(report); len(decisions) != 0 {
+		t.Errorf("expected no duplicates, got %+v", decisions)
+	}
+}
@@ -0,0 +1,75 @@
+package transaction
+
+import "strings"
+
+// DocumentKind is the category of an uploaded travel document
+type DocumentKind string
+
+const (
+	DocumentKindAssignmentLetter DocumentKind = "surat_tugas"
+	DocumentKindFlightTicket     DocumentKind = "flight_ticket"
+	DocumentKindHotelInvoice     DocumentKind = "hotel_invoice"
+	DocumentKindRideReceipt      DocumentKind = "ride_receipt"
+	DocumentKindOther            DocumentKind = "other"
+)
+
+// Document represents a document to be processed
+type Document struct {
+	Content  []byte
+	MimeType string
+	Filename string
+	// Pages are the pages of the uploaded PDF this document was split from, in
+	// order; empty when it is a whole upload
+	Pages []int
+	// Email is the email the document came in, when it was the body or an attachment of one
+	Email *EmailOrigin
+	// Kind is set once the document has been classified; empty means unknown
+	Kind DocumentKind
+	// Parser names the offline parser that read the document; empty when it
+	// went to the selected extractor
+	Parser string
+}
+
+// EmailOrigin names the email a document was taken from
+type EmailOrigin struct {
+	Subject string
+	From    string
+}
+
+// ParseDocumentKind maps a free-form label to a known document kind
+func ParseDocumentKind(label string) DocumentKind {
+	label = strings.ToLower(strings.TrimSpace(label))
+	label = strings.Trim(label, "\"'`.")
+
+	switch DocumentKind(label) {
+	case DocumentKindAssignmentLetter, DocumentKindFlightTicket, DocumentKindHotelInvoice, DocumentKindRideReceipt, DocumentKindOther:
+		return DocumentKind(label)
+	}
+
+	return classifyByKeywords(label)
+}
+
+// classifyByKeywords guesses the document kind from a filename or text snippet
+func classifyByKeywords(s string) DocumentKind {
+	s = strings.ToLower(s)
+	switch {
+	case containsAny(s, "surat tugas", "surat_tugas", "surat-tugas", "spt", "sppd", "perjalanan dinas"):
+		return DocumentKindAssignmentLetter
+	case containsAny(s, "e-ticket", "eticket", "boarding", "flight", "pesawat", "garuda", "citilink", "lion air", "batik air"):
+		return DocumentKindFlightTicket
+	case containsAny(s, "hotel", "invoice", "folio", "penginapan", "resort"):
+		return DocumentKindHotelInvoice
+	case containsAny(s, "gojek", "gocar", "grab", "taxi", "taksi", "bluebird", "maxim"):
+		return DocumentKindRideReceipt
+	}
+	return DocumentKindOther
+}
+
+func containsAny(s string, needles ...string) bool {
+	for _, n := range needles {
+		if strings.Contains(s, n) {
+			return true
+		}
+	}
+	return false
+}
@@ -10,6 +10,8 @@ const (
 	TransactionTypeAccommodation TransactionType = "accommodation"
 	TransactionTypeTransport     TransactionType = "transport"
 	TransactionTypeOther         TransactionType = "other"
+	// TransactionTypeAllowance is the daily allowance computed from the SBM tables
+	TransactionTypeAllowance TransactionType = "allowance"
 )
 
 type Transaction struct {
@@ -109,7 +111,7 @@ func (t *Transaction) CalculateTotal() int32 {
 
 func isValidTransactionType(t TransactionType) bool {
 	switch t {
-	case TransactionTypeAccommodation, TransactionTypeTransport, TransactionTypeOther:
+	case TransactionTypeAccommodation, TransactionTypeTransport, TransactionTypeOther, TransactionTypeAllowance:
 		return true
 	}
 	return false
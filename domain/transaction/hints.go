@@ -0,0 +1,35 @@
+package transaction
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+type assigneeHintsKey struct{}
+
+// WithAssigneeHints attaches the names of the expected travellers to ctx, for
+// extractors whose prompt can use them
+func WithAssigneeHints(ctx context.Context, names []string) context.Context {
+	if len(names) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, assigneeHintsKey{}, names)
+}
+
+// AssigneeHints returns the names attached by WithAssigneeHints
+func AssigneeHints(ctx context.Context) []string {
+	names, _ := ctx.Value(assigneeHintsKey{}).([]string)
+	return names
+}
+
+// hintsVersion folds the hints into the cache key, since they change what the
+// extractor is asked. The order the names were given in does not matter.
+func hintsVersion(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+	return "\x00" + strings.Join(sorted, "\x00")
+}
@@ -0,0 +1,177 @@
+package transaction
+
+import (
+	"fmt"
+	"strings"
+
+	"sandbox/application/dto"
+	"sandbox/domain/sbm"
+)
+
+// LodgingSubtypeLumpSum marks the lodging paid at 30% of the ceiling for nights
+// without a hotel receipt
+const LodgingSubtypeLumpSum = "lump_sum"
+
+// IsLumpSumLodging reports whether tx is a lump-sum lodging line rather than a hotel receipt
+func IsLumpSumLodging(tx dto.TransactionDTO) bool {
+	return TransactionType(strings.ToLower(tx.Type)) == TransactionTypeAccommodation &&
+		strings.EqualFold(tx.Subtype, LodgingSubtypeLumpSum)
+}
+
+// LodgingOverage is an accommodation transaction priced above the per-night
+// ceiling of its traveller
+type LodgingOverage struct {
+	Assignee    string
+	Transaction dto.TransactionDTO
+	Ceiling     sbm.LodgingCeiling
+	PerNight    int32
+	Nights      int32
+	// Excess is the part of the stay above the ceiling, which is not reimbursed
+	Excess int32
+}
+
+// LodgingStay returns the per-night price and the number of nights of an
+// accommodation transaction. A transaction without a night count is one night.
+func LodgingStay(tx dto.TransactionDTO) (perNight, nights int32) {
+	nights = 1
+	if tx.TotalNight != nil && *tx.TotalNight > 0 {
+		nights = *tx.TotalNight
+	}
+
+	perNight = tx.Amount
+	if perNight <= 0 {
+		perNight = tx.Subtotal / nights
+	}
+	return perNight, nights
+}
+
+// checkLodgingCeilings compares every accommodation transaction with the
+// per-night ceiling for the destination and its traveller's rank. Overages are
+// marked for review and returned; assignees whose ceiling cannot be determined
+// are reported as warnings.
+func checkLodgingCeilings(report *dto.RecapReportDTO, table *sbm.Table) ([]LodgingOverage, []string) {
+	var overages []LodgingOverage
+	var warnings []string
+
+	for i := range report.Assignees {
+		assignee := &report.Assignees[i]
+
+		var ceiling sbm.LodgingCeiling
+		var ceilingErr error
+		checked := false
+
+		for j := range assignee.Transactions {
+			tx := &assignee.Transactions[j]
+			if TransactionType(strings.ToLower(tx.Type)) != TransactionTypeAccommodation {
+				continue
+			}
+
+			if !checked {
+				ceiling, ceilingErr = table.LodgingCeiling(report.DestinationCity, assignee.Rank, assignee.Position)
+				if ceilingErr != nil {
+					warnings = append(warnings, fmt.Sprintf("lodging ceiling of %s not checked: %v", assignee.Name, ceilingErr))
+				}
+				checked = true
+			}
+			if ceilingErr != nil {
+				break
+			}
+
+			perNight, nights := LodgingStay(*tx)
+			_, excess, err := ceiling.Cap(perNight, nights)
+			if err != nil {
+				markForReview(tx)
+				warnings = append(warnings, fmt.Sprintf("lodging ceiling of %s not checked: %v", assignee.Name, err))
+				continue
+			}
+			if excess <= 0 {
+				continue
+			}
+
+			markForReview(tx)
+			overages = append(overages, LodgingOverage{
+				Assignee:    assignee.Name,
+				Transaction: *tx,
+				Ceiling:     ceiling,
+				PerNight:    perNight,
+				Nights:      nights,
+				Excess:      excess,
+			})
+		}
+	}
+
+	return overages, warnings
+}
+
+// applyLumpSumLodging pays the nights of an out-of-town trip that no hotel
+// receipt covers at 30% of the lodging ceiling, one accommodation line per
+// assignee. Lines from an earlier run are recomputed. Assignees whose ceiling
+// cannot be determined are reported as warnings.
+func applyLumpSumLodging(report *dto.RecapReportDTO, table *sbm.Table, category sbm.TripCategory) []string {
+	var warnings []string
+
+	from, to := tripDates(report)
+	tripNights := 0
+	if !from.IsZero() && !to.IsZero() {
+		tripNights = from.DaysUntil(to)
+	}
+
+	// A hotel receipt still to be assigned may cover the nights of anyone
+	for _, item := range report.Unassigned {
+		if TransactionType(strings.ToLower(item.Transaction.Type)) == TransactionTypeAccommodation {
+			tripNights = 0
+			warnings = append(warnings, "lump-sum lodging not computed while accommodation receipts are unassigned")
+			break
+		}
+	}
+
+	for i := range report.Assignees {
+		assignee := &report.Assignees[i]
+
+		var covered int32
+		kept := assignee.Transactions[:0]
+		for _, tx := range assignee.Transactions {
+			if IsLumpSumLodging(tx) {
+				continue
+			}
+			if TransactionType(strings.ToLower(tx.Type)) == TransactionTypeAccommodation {
+				_, nights := LodgingStay(tx)
+				covered += nights
+			}
+			kept = append(kept, tx)
+		}
+		assignee.Transactions = kept
+
+		if category == sbm.TripCategoryInTown || category == sbm.TripCategoryTraining {
+			continue
+		}
+		nights := int32(tripNights) - covered
+		if nights <= 0 {
+			continue
+		}
+
+		ceiling, err := table.LodgingCeiling(report.DestinationCity, assignee.Rank, assignee.Position)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("lump-sum lodging of %s not computed: %v", assignee.Name, err))
+			continue
+		}
+
+		perNight := ceiling.LumpSum()
+		assignee.Transactions = append(assignee.Transactions, dto.TransactionDTO{
+			Name:        assignee.Name,
+			Type:        string(TransactionTypeAccommodation),
+			Subtype:     LodgingSubtypeLumpSum,
+			Amount:      perNight,
+			TotalNight:  &nights,
+			Subtotal:    perNight * nights,
+			Description: ceiling.LumpSumDescription(nights),
+			Date:        from,
+			Source: &dto.SourceDTO{
+				Snippet:    ceiling.Version,
+				Confidence: 1,
+			},
+		})
+	}
+
+	return warnings
+}
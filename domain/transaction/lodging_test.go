@@ -0,0 +1,103 @@
+package transaction
+
+import (
+	"testing"
+	"time"
+
+	"sandbox/application/dto"
+	"sandbox/domain/date"
+	"sandbox/domain/sbm"
+)
+
+func TestCheckLodgingCeilingsFlagsNightsAboveTheCeiling(t *testing.T) {
+	rates, err := sbm.Default()
+	if err != nil {
+		t.Fatalf("failed to load rate tables: %v", err)
+	}
+	table := rates.ForYear(2025)
+	ceiling, err := table.LodgingCeiling("Surabaya", "III/a", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	nights := int32(2)
+	report := &dto.RecapReportDTO{
+		DestinationCity: "Surabaya",
+		Assignees: []dto.AssigneeDTO{
+			{
+				Name: "Budi Santoso",
+				Rank: "Penata Muda (III/a)",
+				Transactions: []dto.TransactionDTO{
+					{Type: "accommodation", Amount: ceiling.PerNight + 50000, Subtotal: 2 * (ceiling.PerNight + 50000), TotalNight: &nights},
+					{Type: "transport", Subtype: "flight", Subtotal: 1500000},
+				},
+			},
+			{
+				Name:         "Siti Aminah",
+				Transactions: []dto.TransactionDTO{{Type: "accommodation", Amount: 400000, Subtotal: 400000}},
+			},
+		},
+	}
+
+	overages, warnings := checkLodgingCeilings(report, table)
+	if len(overages) != 1 || overages[0].Excess != 100000 || overages[0].Nights != 2 {
+		t.Fatalf("expected one overage of 2 x 50.000, got %+v", overages)
+	}
+	if tx := report.Assignees[0].Transactions[0]; tx.Source == nil || !tx.Source.NeedsReview {
+		t.Error("expected the overpriced stay to be marked for review")
+	}
+	// Siti has no rank, so her ceiling is unknown
+	if len(warnings) != 1 {
+		t.Errorf("expected one warning, got %v", warnings)
+	}
+}
+
+func TestApplyLumpSumLodgingPaysNightsWithoutHotel(t *testing.T) {
+	rates, err := sbm.Default()
+	if err != nil {
+		t.Fatalf("failed to load rate tables: %v", err)
+	}
+	table := rates.ForYear(2025)
+	ceiling, err := table.LodgingCeiling("Surabaya", "III/a", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	hotelNights := int32(1)
+	report := &dto.RecapReportDTO{
+		DestinationCity: "Surabaya",
+		DepartureDate:   date.New(2025, time.October, 25),
+		ReturnDate:      date.New(2025, time.October, 28),
+		Assignees: []dto.AssigneeDTO{
+			{
+				Name: "Budi Santoso",
+				Rank: "III/a",
+				Transactions: []dto.TransactionDTO{
+					{Type: "accommodation", Amount: 500000, Subtotal: 500000, TotalNight: &hotelNights},
+				},
+			},
+		},
+	}
+
+	// Running twice must not add a second line
+	for range 2 {
+		if warnings := applyLumpSumLodging(report, table, sbm.TripCategoryOutOfTown); len(warnings) != 0 {
+			t.Fatalf("unexpected warnings: %v", warnings)
+		}
+	}
+
+	txs := report.Assignees[0].Transactions
+	if len(txs) != 2 || !IsLumpSumLodging(txs[1]) {
+		t.Fatalf("expected the hotel and one lump-sum line, got %+v", txs)
+	}
+	lumpSum := txs[1]
+	if *lumpSum.TotalNight != 2 || lumpSum.Amount != ceiling.PerNight*30/100 || lumpSum.Subtotal != 2*lumpSum.Amount {
+		t.Errorf("expected 2 of 3 nights at 30%% of %d, got %+v", ceiling.PerNight, lumpSum)
+	}
+
+	// A training provides lodging
+	applyLumpSumLodging(report, table, sbm.TripCategoryTraining)
+	if len(report.Assignees[0].Transactions) != 1 {
+		t.Errorf("expected no lump sum on a diklat, got %+v", report.Assignees[0].Transactions)
+	}
+}
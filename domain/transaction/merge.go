@@ -0,0 +1,134 @@
+package transaction
+
+import "sandbox/application/dto"
+
+// documentExtraction is the partial result of extracting a single document
+type documentExtraction struct {
+	Document Document
+	Report   *dto.RecapReportDTO
+	Err      error
+}
+
+// mergeReports combines per-document partial reports into a single recap report.
+// Trip details and assignees come from the surat tugas; receipts contribute
+// transactions, which are attached to the assignee whose name they carry.
+// Receipts naming no one on the surat tugas are left in Unassigned for
+// assignTransactions to match.
+func mergeReports(parts []documentExtraction) *dto.RecapReportDTO {
+	merged := &dto.RecapReportDTO{
+		Assignees:  []dto.AssigneeDTO{},
+		Unassigned: []dto.UnassignedTransactionDTO{},
+	}
+
+	// Assignment letters first so that receipts can be matched against their assignees
+	for _, part := range parts {
+		if part.Err != nil || part.Report == nil || part.Document.Kind != DocumentKindAssignmentLetter {
+			continue
+		}
+		mergeHeader(merged, part.Report)
+		for _, assignee := range part.Report.Assignees {
+			idx := findAssignee(merged.Assignees, assignee.Name, assignee.EmployeeID)
+			if idx < 0 {
+				assignee.Transactions = append([]dto.TransactionDTO{}, assignee.Transactions...)
+				merged.Assignees = append(merged.Assignees, assignee)
+				continue
+			}
+			fillAssignee(&merged.Assignees[idx], assignee)
+			merged.Assignees[idx].Transactions = append(merged.Assignees[idx].Transactions, assignee.Transactions...)
+		}
+	}
+	hasAssignmentLetter := len(merged.Assignees) > 0
+
+	for _, part := range parts {
+		if part.Err != nil || part.Report == nil || part.Document.Kind == DocumentKindAssignmentLetter {
+			continue
+		}
+		mergeHeader(merged, part.Report)
+		for _, assignee := range part.Report.Assignees {
+			for _, tx := range assignee.Transactions {
+				name := tx.Name
+				if name == "" {
+					name = assignee.Name
+				}
+
+				idx := findAssignee(merged.Assignees, name, assignee.EmployeeID)
+				if idx < 0 && hasAssignmentLetter {
+					tx.Name = name
+					merged.Unassigned = append(merged.Unassigned, dto.UnassignedTransactionDTO{Transaction: tx})
+					continue
+				}
+				if idx < 0 {
+					merged.Assignees = append(merged.Assignees, dto.AssigneeDTO{
+						Name:         assignee.Name,
+						SpdNumber:    assignee.SpdNumber,
+						EmployeeID:   assignee.EmployeeID,
+						Position:     assignee.Position,
+						Rank:         assignee.Rank,
+						Transactions: []dto.TransactionDTO{},
+						FieldSources: assignee.FieldSources,
+					})
+					idx = len(merged.Assignees) - 1
+				}
+
+				tx.Name = merged.Assignees[idx].Name
+				merged.Assignees[idx].Transactions = append(merged.Assignees[idx].Transactions, tx)
+			}
+		}
+	}
+
+	return merged
+}
+
+func mergeHeader(dst, src *dto.RecapReportDTO) {
+	setIfEmpty(&dst.StartDate, src.StartDate)
+	setIfEmpty(&dst.EndDate, src.EndDate)
+	setIfEmpty(&dst.ActivityPurpose, src.ActivityPurpose)
+	setIfEmpty(&dst.DestinationCity, src.DestinationCity)
+	setIfEmpty(&dst.SpdDate, src.SpdDate)
+	setIfEmpty(&dst.DepartureDate, src.DepartureDate)
+	setIfEmpty(&dst.ReturnDate, src.ReturnDate)
+	setIfEmpty(&dst.ReceiptSignatureDate, src.ReceiptSignatureDate)
+}
+
+func fillAssignee(dst *dto.AssigneeDTO, src dto.AssigneeDTO) {
+	setIfEmpty(&dst.SpdNumber, src.SpdNumber)
+	setIfEmpty(&dst.EmployeeID, src.EmployeeID)
+	setIfEmpty(&dst.Position, src.Position)
+	setIfEmpty(&dst.Rank, src.Rank)
+
+	// Keep the provenance of fields already set; take the rest from src
+	for field, source := range src.FieldSources {
+		if _, ok := dst.FieldSources[field]; ok {
+			continue
+		}
+		if dst.FieldSources == nil {
+			dst.FieldSources = make(map[string]dto.SourceDTO)
+		}
+		dst.FieldSources[field] = source
+	}
+}
+
+func findAssignee(assignees []dto.AssigneeDTO, name, employeeID string) int {
+	if employeeID != "" {
+		for i, a := range assignees {
+			if a.EmployeeID == employeeID {
+				return i
+			}
+		}
+	}
+
+	key := normalizeName(name)
+	for i, a := range assignees {
+		if normalizeName(a.Name) == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func setIfEmpty[T comparable](dst *T, value T) {
+	var zero T
+	if *dst == zero {
+		*dst = value
+	}
+}
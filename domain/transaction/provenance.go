@@ -0,0 +1,79 @@
+package transaction
+
+import "sandbox/application/dto"
+
+// stampSource records the originating filename on every transaction and assignee
+// field of a per-document report. Values the extractor did not describe get a
+// zero-confidence source so they are flagged for review rather than trusted.
+// For a document split from a PDF, page numbers are turned into pages of the
+// uploaded PDF, and for one taken from an email the email is named.
+func stampSource(report *dto.RecapReportDTO, doc Document) {
+	if report == nil {
+		return
+	}
+
+	var email *dto.EmailDTO
+	if doc.Email != nil {
+		email = &dto.EmailDTO{Subject: doc.Email.Subject, From: doc.Email.From}
+	}
+
+	for i := range report.Assignees {
+		assignee := &report.Assignees[i]
+
+		for j := range assignee.Transactions {
+			tx := &assignee.Transactions[j]
+			if tx.Source == nil {
+				tx.Source = &dto.SourceDTO{}
+			}
+			tx.Source.Filename = doc.Filename
+			tx.Source.Page = originalPage(doc.Pages, tx.Source.Page)
+			tx.Source.Email = email
+		}
+
+		for field, source := range assignee.FieldSources {
+			source.Filename = doc.Filename
+			source.Page = originalPage(doc.Pages, source.Page)
+			source.Email = email
+			assignee.FieldSources[field] = source
+		}
+	}
+}
+
+// originalPage maps a 1-based page of a split document to the page of the PDF
+// it was split from. A page the extractor did not give, or one out of range,
+// is taken to be the first.
+func originalPage(pages []int, page int) int {
+	if len(pages) == 0 {
+		return page
+	}
+	if page >= 1 && page <= len(pages) {
+		return pages[page-1]
+	}
+	return pages[0]
+}
+
+// flagLowConfidence marks every source below threshold as needing review,
+// keeping the flag on values an earlier step already marked, such as lodging
+// above the ceiling
+func flagLowConfidence(report *dto.RecapReportDTO, threshold float64) {
+	for i := range report.Assignees {
+		assignee := &report.Assignees[i]
+
+		for j := range assignee.Transactions {
+			if source := assignee.Transactions[j].Source; source != nil {
+				source.NeedsReview = source.NeedsReview || source.Confidence < threshold
+			}
+		}
+
+		for field, source := range assignee.FieldSources {
+			source.NeedsReview = source.NeedsReview || source.Confidence < threshold
+			assignee.FieldSources[field] = source
+		}
+	}
+
+	for i := range report.Unassigned {
+		if source := report.Unassigned[i].Transaction.Source; source != nil {
+			source.NeedsReview = source.NeedsReview || source.Confidence < threshold
+		}
+	}
+}
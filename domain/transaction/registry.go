@@ -0,0 +1,58 @@
+package transaction
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	domainErrors "sandbox/domain/errors"
+)
+
+// Registry holds the extraction backends available to a deployment, keyed by name
+type Registry struct {
+	extractors     map[string]ExtractorRepository
+	defaultBackend string
+}
+
+// NewRegistry creates an empty registry that resolves to defaultBackend when no backend is requested
+func NewRegistry(defaultBackend string) *Registry {
+	return &Registry{
+		extractors:     make(map[string]ExtractorRepository),
+		defaultBackend: strings.ToLower(defaultBackend),
+	}
+}
+
+// Register adds an extraction backend under the given name
+func (r *Registry) Register(name string, extractor ExtractorRepository) {
+	r.extractors[strings.ToLower(name)] = extractor
+}
+
+// Resolve returns the backend for name, falling back to the default backend when name is empty
+func (r *Registry) Resolve(name string) (string, ExtractorRepository, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = r.defaultBackend
+	}
+
+	extractor, ok := r.extractors[name]
+	if !ok {
+		return "", nil, domainErrors.NewValidationError(fmt.Sprintf("unknown extraction backend %q (available: %s)", name, strings.Join(r.Names(), ", ")))
+	}
+
+	return name, extractor, nil
+}
+
+// Names returns the registered backend names in sorted order
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.extractors))
+	for name := range r.extractors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Default returns the name of the backend used when none is requested
+func (r *Registry) Default() string {
+	return r.defaultBackend
+}
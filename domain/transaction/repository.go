@@ -11,9 +11,72 @@ type ExtractorRepository interface {
 	ExtractFromDocuments(ctx context.Context, documents []Document) (*dto.RecapReportDTO, error)
 }
 
-// Document represents a document to be processed
-type Document struct {
-	Content  []byte
-	MimeType string
-	Filename string
+// DocumentClassifier is implemented by extractors that can tell what kind of
+// document they are looking at before extracting it
+type DocumentClassifier interface {
+	ClassifyDocument(ctx context.Context, document Document) (DocumentKind, error)
+}
+
+// FormatRestrictedExtractor is implemented by extractors that cannot read
+// every accepted upload format. Documents in a format the extractor does not
+// read fail with a reason instead of being sent to it.
+type FormatRestrictedExtractor interface {
+	ReadsMimeType(mimeType string) bool
+}
+
+// SessionExtractor is implemented by extractors that share state between the
+// calls of one extraction run, such as documents uploaded to the provider once
+// and referenced by both classification and extraction. BeginSession returns
+// the context to make those calls with and a function ending the session.
+type SessionExtractor interface {
+	BeginSession(ctx context.Context) (context.Context, func())
+}
+
+// OfflineExtractor reads documents in formats it recognizes, such as the
+// e-receipts of known vendors, without calling an external service. The
+// service tries it on every document and sends only the rest to the selected
+// extractor.
+type OfflineExtractor interface {
+	// ExtractKnownDocument returns the report of document, its kind and the name
+	// of the parser that read it; ok is false when the format is not recognized
+	ExtractKnownDocument(ctx context.Context, document Document) (report *dto.RecapReportDTO, kind DocumentKind, parser string, ok bool)
+}
+
+// VersionedExtractor is implemented by extractors whose output depends on a
+// prompt or rule set; the version is part of the cache key so that changing
+// the prompt invalidates earlier results
+type VersionedExtractor interface {
+	Version() string
+}
+
+// ResultCache stores extraction results by content hash. Implementations must
+// not share entries with callers, who are free to modify what they get or put.
+type ResultCache interface {
+	// Get returns the entry stored under key; ok is false on a miss
+	Get(ctx context.Context, key string) (entry *CachedExtraction, ok bool, err error)
+	Put(ctx context.Context, key string, entry *CachedExtraction) error
+}
+
+// PromptedExtractor is implemented by extractors driven by a prompt template;
+// the ID of the template in use is recorded with every result
+type PromptedExtractor interface {
+	PromptVersion() string
+}
+
+// PromptCatalog manages the prompt template versions of the LLM backends
+type PromptCatalog interface {
+	// PromptVersions lists every available version
+	PromptVersions() ([]PromptTemplateInfo, error)
+	// ActivatePrompt selects the version used from the next extraction on
+	ActivatePrompt(id string) error
+}
+
+// PromptTemplateInfo describes one prompt template version
+type PromptTemplateInfo struct {
+	ID string
+	// Hash identifies the template text
+	Hash string
+	// Source is "builtin" or the directory the template was loaded from
+	Source string
+	Active bool
 }
@@ -3,35 +3,375 @@ package transaction
 import (
 	"context"
 	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
 
 	"sandbox/application/dto"
+	"sandbox/domain/sbm"
 )
 
 // Service provides domain business logic for transactions
 type Service struct {
-	extractor ExtractorRepository
+	extractors      *Registry
+	concurrency     int
+	reviewThreshold float64
+	assignThreshold float64
+	rates           *sbm.Schedule
+	cache           ResultCache
+	offline         OfflineExtractor
+}
+
+// ServiceConfig tunes the transaction service
+type ServiceConfig struct {
+	// Concurrency bounds how many documents are classified or extracted at the same time
+	Concurrency int
+	// ReviewThreshold is the confidence below which extracted values are flagged for review
+	ReviewThreshold float64
+	// AssigneeThreshold is the name match score (0–1) at which a receipt is attached
+	// to an assignee; zero means the default
+	AssigneeThreshold float64
+	// Rates computes the daily allowance of every assignee and checks lodging
+	// against its ceiling; nil skips both
+	Rates *sbm.Schedule
+	// Cache stores results of fully successful extractions; nil disables caching
+	Cache ResultCache
+	// Offline reads the documents it recognizes before the selected extractor
+	// sees them; nil sends every document to the selected extractor
+	Offline OfflineExtractor
 }
 
 // NewService creates a new transaction service
-func NewService(extractor ExtractorRepository) *Service {
+func NewService(extractors *Registry, cfg ServiceConfig) *Service {
+	if cfg.Concurrency < 1 {
+		cfg.Concurrency = 1
+	}
+	if cfg.AssigneeThreshold <= 0 {
+		cfg.AssigneeThreshold = defaultAssigneeThreshold
+	}
+
 	return &Service{
-		extractor: extractor,
+		extractors:      extractors,
+		concurrency:     cfg.Concurrency,
+		reviewThreshold: cfg.ReviewThreshold,
+		assignThreshold: cfg.AssigneeThreshold,
+		rates:           cfg.Rates,
+		cache:           cfg.Cache,
+		offline:         cfg.Offline,
 	}
 }
 
-// ExtractTransactions extracts transactions from multiple documents
-func (s *Service) ExtractTransactions(ctx context.Context, documents []Document) (*dto.RecapReportDTO, error) {
+// ExtractOptions tunes a single extraction run
+type ExtractOptions struct {
+	// Backend selects a registered extractor; empty means the deployment default
+	Backend string
+	// Refresh skips the cache lookup; the fresh result still replaces the cached one
+	Refresh bool
+	// TripCategory selects the daily allowance rate; empty means out of town
+	TripCategory sbm.TripCategory
+	// AssigneeHints are the names of the expected travellers, passed to
+	// extractors whose prompt can use them
+	AssigneeHints []string
+	// Progress, when set, is called as each document moves through the pipeline.
+	// It may be called from several goroutines at once.
+	Progress func(DocumentProgress)
+}
+
+// ProgressStage is the step a document has reached
+type ProgressStage string
+
+const (
+	ProgressStageClassified ProgressStage = "classified"
+	ProgressStageExtracting ProgressStage = "extracting"
+	ProgressStageExtracted  ProgressStage = "extracted"
+	ProgressStageFailed     ProgressStage = "failed"
+)
+
+// DocumentProgress reports a single document reaching a stage
+type DocumentProgress struct {
+	Index    int
+	Total    int
+	Filename string
+	Kind     DocumentKind
+	Stage    ProgressStage
+	// Completed counts the documents extracted or failed so far, including this one
+	Completed int
+	Err       error
+}
+
+// ExtractionResult is the outcome of an extraction run
+type ExtractionResult struct {
+	Report  *dto.RecapReportDTO
+	Backend string
+	// PromptVersion is the prompt template the report was extracted with; empty
+	// for backends without a prompt
+	PromptVersion string
+	Documents     []DocumentOutcome
+	// Duplicates lists the transactions merged or flagged as the same expense
+	Duplicates []DuplicateDecision
+	// LodgingOverages lists accommodation priced above the traveller's ceiling
+	LodgingOverages []LodgingOverage
+	// Warnings describes post-processing steps that could not be completed, such
+	// as a daily allowance for a destination missing from the gazetteer
+	Warnings []string
+	// Cached is set when the result was served from the cache without calling the extractor
+	Cached bool
+}
+
+// DocumentOutcome records how a single uploaded document was handled
+type DocumentOutcome struct {
+	Filename string
+	Pages    []int
+	Kind     DocumentKind
+	// Parser names the offline parser that read the document, if any
+	Parser string
+	Err    error
+}
+
+// ExtractTransactions classifies every document, extracts each one separately
+// on a bounded worker pool and merges the partial results into one report.
+// A failing document is reported in the result without failing the others.
+// Results of uploads with the same document contents are served from the cache.
+func (s *Service) ExtractTransactions(ctx context.Context, documents []Document, opts ExtractOptions) (*ExtractionResult, error) {
 	if len(documents) == 0 {
 		return nil, errors.New("no documents provided")
 	}
 
-	recapReport, err := s.extractor.ExtractFromDocuments(ctx, documents)
+	backend, extractor, err := s.extractors.Resolve(opts.Backend)
 	if err != nil {
 		return nil, err
 	}
 
-	// Additional business logic can be added here
-	// For example: validation, deduplication, etc.
+	promptVersion := extractorPromptVersion(extractor)
+	ctx = WithAssigneeHints(ctx, opts.AssigneeHints)
+
+	var key string
+	if s.cache != nil {
+		version := extractorVersion(extractor) + hintsVersion(opts.AssigneeHints)
+		if s.offline != nil {
+			version += "+offline" + extractorVersion(s.offline)
+		}
+		key = cacheKey(backend, version, documents)
+		if !opts.Refresh {
+			if result := s.lookup(ctx, key, documents, backend); result != nil {
+				s.finalize(result, opts)
+				return result, nil
+			}
+		}
+	}
+
+	progress := opts.Progress
+	if progress == nil {
+		progress = func(DocumentProgress) {}
+	}
+
+	if session, ok := extractor.(SessionExtractor); ok {
+		var end func()
+		ctx, end = session.BeginSession(ctx)
+		defer end()
+	}
+
+	classified, known := s.classifyDocuments(ctx, extractor, documents, progress)
+	parts := s.extractDocuments(ctx, extractor, classified, known, progress)
+
+	outcomes := make([]DocumentOutcome, len(parts))
+	var errs []error
+	for i, part := range parts {
+		outcomes[i] = DocumentOutcome{
+			Filename: part.Document.Filename,
+			Pages:    part.Document.Pages,
+			Kind:     part.Document.Kind,
+			Parser:   part.Document.Parser,
+			Err:      part.Err,
+		}
+		if part.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", part.Document.Filename, part.Err))
+		}
+	}
+
+	if len(errs) == len(parts) {
+		return nil, fmt.Errorf("failed to extract any document: %w", errors.Join(errs...))
+	}
+
+	report := mergeReports(parts)
+	if s.cache != nil && len(errs) == 0 {
+		// Partial results are not cached so that a retry can pick up the failed documents
+		if err := s.cache.Put(ctx, key, newCachedExtraction(report, classified, promptVersion)); err != nil {
+			log.Printf("Failed to cache extraction result: %v", err)
+		}
+	}
+
+	result := &ExtractionResult{
+		Report:        report,
+		Backend:       backend,
+		PromptVersion: promptVersion,
+		Documents:     outcomes,
+	}
+	s.finalize(result, opts)
+
+	return result, nil
+}
+
+// finalize applies the deterministic post-processing steps to a merged report.
+// They also run on cached results, so the cache holds reports before this step.
+// Duplicates are merged first so that the allowance, lump-sum lodging and
+// ceiling steps see each expense once.
+func (s *Service) finalize(result *ExtractionResult, opts ExtractOptions) {
+	assignTransactions(result.Report, s.assignThreshold)
+	result.Duplicates = deduplicate(result.Report)
+	if s.rates != nil {
+		table := s.rates.ForDate(tripStart(result.Report))
+		if err := applyAllowances(result.Report, table, opts.TripCategory); err != nil {
+			result.Warnings = append(result.Warnings, err.Error())
+		}
+		result.Warnings = append(result.Warnings, applyLumpSumLodging(result.Report, table, opts.TripCategory)...)
+		overages, warnings := checkLodgingCeilings(result.Report, table)
+		result.LodgingOverages = overages
+		result.Warnings = append(result.Warnings, warnings...)
+	}
+	flagLowConfidence(result.Report, s.reviewThreshold)
+}
+
+// CheckLodging compares the accommodation of a report built outside
+// extraction, such as an imported spreadsheet, with the lodging ceilings. Unlike
+// extraction it leaves the amounts and allowances of the report as given.
+func (s *Service) CheckLodging(report *dto.RecapReportDTO) ([]LodgingOverage, []string) {
+	if s.rates == nil {
+		return nil, nil
+	}
+	return checkLodgingCeilings(report, s.rates.ForDate(tripStart(report)))
+}
+
+// lookup returns the cached result for key, or nil on a miss. Cache failures are
+// logged and treated as misses.
+func (s *Service) lookup(ctx context.Context, key string, documents []Document, backend string) *ExtractionResult {
+	entry, ok, err := s.cache.Get(ctx, key)
+	if err != nil {
+		log.Printf("Failed to read extraction cache: %v", err)
+		return nil
+	}
+	if !ok || entry.Report == nil {
+		return nil
+	}
+
+	return resultFromCache(entry, documents, backend)
+}
+
+// classifyDocuments sets the Kind of every document. Documents the offline
+// extractor recognizes are read right away and their reports returned at their
+// index; the others are classified by the extractor when it can, and by
+// filename otherwise.
+func (s *Service) classifyDocuments(ctx context.Context, extractor ExtractorRepository, documents []Document, progress func(DocumentProgress)) ([]Document, []*dto.RecapReportDTO) {
+	classified := make([]Document, len(documents))
+	copy(classified, documents)
+	known := make([]*dto.RecapReportDTO, len(documents))
+
+	classifier, canClassify := extractor.(DocumentClassifier)
+
+	s.forEach(len(classified), func(i int) {
+		doc := &classified[i]
+		if s.offline != nil {
+			if report, kind, parser, ok := s.offline.ExtractKnownDocument(ctx, *doc); ok {
+				doc.Kind, doc.Parser = kind, parser
+				known[i] = report
+			}
+		}
+		if known[i] == nil {
+			readable := unreadableFormat(extractor, *doc) == nil
+			doc.Kind = classifyDocument(ctx, classifier, canClassify && readable, *doc)
+		}
+		progress(DocumentProgress{
+			Index:    i,
+			Total:    len(classified),
+			Filename: doc.Filename,
+			Kind:     doc.Kind,
+			Stage:    ProgressStageClassified,
+		})
+	})
+
+	return classified, known
+}
+
+func classifyDocument(ctx context.Context, classifier DocumentClassifier, canClassify bool, doc Document) DocumentKind {
+	if doc.Kind != "" {
+		return doc.Kind
+	}
+	if canClassify {
+		kind, err := classifier.ClassifyDocument(ctx, doc)
+		if err == nil && kind != "" {
+			return kind
+		}
+	}
+	return classifyByKeywords(doc.Filename)
+}
+
+// extractDocuments extracts every document on its own, keeping input order.
+// Documents with a report in known were already read by the offline extractor.
+func (s *Service) extractDocuments(ctx context.Context, extractor ExtractorRepository, documents []Document, known []*dto.RecapReportDTO, progress func(DocumentProgress)) []documentExtraction {
+	parts := make([]documentExtraction, len(documents))
+	var completed int32
+
+	s.forEach(len(documents), func(i int) {
+		doc := documents[i]
+		parts[i].Document = doc
+		event := DocumentProgress{
+			Index:    i,
+			Total:    len(documents),
+			Filename: doc.Filename,
+			Kind:     doc.Kind,
+			Stage:    ProgressStageExtracting,
+		}
+
+		if err := ctx.Err(); err != nil {
+			parts[i].Err = err
+		} else {
+			progress(event)
+			if known[i] != nil {
+				parts[i].Report = known[i]
+			} else if err := unreadableFormat(extractor, doc); err != nil {
+				parts[i].Err = err
+			} else {
+				parts[i].Report, parts[i].Err = extractor.ExtractFromDocuments(ctx, []Document{doc})
+			}
+			stampSource(parts[i].Report, doc)
+		}
+
+		event.Stage = ProgressStageExtracted
+		if parts[i].Err != nil {
+			event.Stage = ProgressStageFailed
+			event.Err = parts[i].Err
+		}
+		event.Completed = int(atomic.AddInt32(&completed, 1))
+		progress(event)
+	})
+
+	return parts
+}
+
+// unreadableFormat returns why extractor cannot read doc, or nil when it can
+func unreadableFormat(extractor ExtractorRepository, doc Document) error {
+	restricted, ok := extractor.(FormatRestrictedExtractor)
+	if !ok || restricted.ReadsMimeType(doc.MimeType) {
+		return nil
+	}
+	return fmt.Errorf("the selected backend cannot read %s files; convert the file to JPEG or PNG, or use the gemini backend", doc.MimeType)
+}
+
+// forEach runs fn for indexes 0..n-1 with at most s.concurrency calls in flight
+func (s *Service) forEach(n int, fn func(i int)) {
+	sem := make(chan struct{}, s.concurrency)
+	var wg sync.WaitGroup
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(i)
+		}(i)
+	}
 
-	return recapReport, nil
+	wg.Wait()
 }
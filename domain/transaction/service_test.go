@@ -0,0 +1,525 @@
+package transaction
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"sandbox/application/dto"
+	"sandbox/domain/date"
+	"sandbox/domain/sbm"
+)
+
+type fakeExtractor struct {
+	reports  map[string]*dto.RecapReportDTO
+	failures map[string]error
+	inFlight int32
+	maxSeen  int32
+}
+
+func (f *fakeExtractor) ExtractFromDocuments(ctx context.Context, documents []Document) (*dto.RecapReportDTO, error) {
+	current := atomic.AddInt32(&f.inFlight, 1)
+	defer atomic.AddInt32(&f.inFlight, -1)
+	for {
+		seen := atomic.LoadInt32(&f.maxSeen)
+		if current <= seen || atomic.CompareAndSwapInt32(&f.maxSeen, seen, current) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	name := documents[0].Filename
+	if err := f.failures[name]; err != nil {
+		return nil, err
+	}
+	return f.reports[name], nil
+}
+
+func newTestService(extractor ExtractorRepository, concurrency int) *Service {
+	registry := NewRegistry("fake")
+	registry.Register("fake", extractor)
+	return NewService(registry, ServiceConfig{Concurrency: concurrency, ReviewThreshold: 0.5})
+}
+
+func TestExtractTransactionsMergesPerDocumentResults(t *testing.T) {
+	extractor := &fakeExtractor{
+		reports: map[string]*dto.RecapReportDTO{
+			"surat_tugas.pdf": {
+				DestinationCity: "Surabaya",
+				Assignees: []dto.AssigneeDTO{
+					{Name: "Budi Santoso", EmployeeID: "1980"},
+					{Name: "Siti Aminah", EmployeeID: "1985"},
+				},
+			},
+			"hotel.pdf": {
+				Assignees: []dto.AssigneeDTO{{
+					Name:         "siti  aminah",
+					Transactions: []dto.TransactionDTO{{Type: "accommodation", Subtotal: 500000}},
+				}},
+			},
+			"grab.png": {
+				Assignees: []dto.AssigneeDTO{{
+					Name: "Budi Santoso",
+					Transactions: []dto.TransactionDTO{{
+						Type:     "transport",
+						Subtotal: 75000,
+						Source:   &dto.SourceDTO{Page: 1, Snippet: "Total Rp75.000", Confidence: 0.9},
+					}},
+				}},
+			},
+		},
+		failures: map[string]error{
+			"blurry.jpg": errors.New("unreadable image"),
+		},
+	}
+
+	service := newTestService(extractor, 2)
+	result, err := service.ExtractTransactions(context.Background(), []Document{
+		{Filename: "grab.png"},
+		{Filename: "blurry.jpg"},
+		{Filename: "surat_tugas.pdf"},
+		{Filename: "hotel.pdf"},
+	}, ExtractOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if extractor.maxSeen > 2 {
+		t.Errorf("expected at most 2 concurrent extractions, saw %d", extractor.maxSeen)
+	}
+
+	report := result.Report
+	if report.DestinationCity != "Surabaya" {
+		t.Errorf("expected header from surat tugas, got %q", report.DestinationCity)
+	}
+	if len(report.Assignees) != 2 {
+		t.Fatalf("expected 2 assignees, got %d", len(report.Assignees))
+	}
+	if got := report.Assignees[0].Transactions; len(got) != 1 || got[0].Subtotal != 75000 {
+		t.Errorf("expected grab receipt on Budi, got %+v", got)
+	}
+	if got := report.Assignees[1].Transactions; len(got) != 1 || got[0].Name != "Siti Aminah" {
+		t.Errorf("expected hotel receipt on Siti, got %+v", got)
+	}
+
+	if source := report.Assignees[0].Transactions[0].Source; source.Filename != "grab.png" || source.NeedsReview {
+		t.Errorf("expected confident source from grab.png, got %+v", source)
+	}
+	if source := report.Assignees[1].Transactions[0].Source; source.Filename != "hotel.pdf" || !source.NeedsReview {
+		t.Errorf("expected hotel transaction without confidence to need review, got %+v", source)
+	}
+
+	if result.Documents[1].Err == nil || result.Documents[1].Filename != "blurry.jpg" {
+		t.Errorf("expected blurry.jpg to be reported as failed, got %+v", result.Documents[1])
+	}
+	if result.Documents[2].Kind != DocumentKindAssignmentLetter {
+		t.Errorf("expected surat tugas to be classified from its filename, got %q", result.Documents[2].Kind)
+	}
+}
+
+func TestExtractTransactionsFailsWhenEveryDocumentFails(t *testing.T) {
+	extractor := &fakeExtractor{
+		failures: map[string]error{
+			"a.pdf": errors.New("boom"),
+			"b.pdf": errors.New("boom"),
+		},
+	}
+
+	service := newTestService(extractor, 4)
+	_, err := service.ExtractTransactions(context.Background(), []Document{{Filename: "a.pdf"}, {Filename: "b.pdf"}}, ExtractOptions{})
+	if err == nil {
+		t.Fatal("expected an error when no document could be extracted")
+	}
+}
+
+func TestExtractTransactionsRejectsUnknownBackend(t *testing.T) {
+	service := newTestService(&fakeExtractor{}, 1)
+	_, err := service.ExtractTransactions(context.Background(), []Document{{Filename: "a.pdf"}}, ExtractOptions{Backend: "nope"})
+	if err == nil {
+		t.Fatal("expected an error for an unknown backend")
+	}
+}
+
+type mapCache struct {
+	entries map[string][]byte
+}
+
+func (m *mapCache) Get(ctx context.Context, key string) (*CachedExtraction, bool, error) {
+	data, ok := m.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	var entry CachedExtraction
+	err := json.Unmarshal(data, &entry)
+	return &entry, err == nil, err
+}
+
+func (m *mapCache) Put(ctx context.Context, key string, entry *CachedExtraction) error {
+	data, err := json.Marshal(entry)
+	m.entries[key] = data
+	return err
+}
+
+func TestExtractTransactionsServesSameContentFromCache(t *testing.T) {
+	extractor := &countingExtractor{}
+	registry := NewRegistry("fake")
+	registry.Register("fake", extractor)
+	service := NewService(registry, ServiceConfig{Concurrency: 2, Cache: &mapCache{entries: map[string][]byte{}}})
+
+	first, err := service.ExtractTransactions(context.Background(), []Document{
+		{Filename: "grab.png", Content: []byte("grab")},
+		{Filename: "hotel.pdf", Content: []byte("hotel")},
+	}, ExtractOptions{})
+	if err != nil || first.Cached {
+		t.Fatalf("expected a fresh extraction, got cached=%v err=%v", first != nil && first.Cached, err)
+	}
+
+	// Same contents under other names and in another order
+	second, err := service.ExtractTransactions(context.Background(), []Document{
+		{Filename: "hotel-fixed.pdf", Content: []byte("hotel")},
+		{Filename: "grab-fixed.png", Content: []byte("grab")},
+	}, ExtractOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !second.Cached || extractor.calls != 2 {
+		t.Fatalf("expected a cache hit without new calls, got cached=%v calls=%d", second.Cached, extractor.calls)
+	}
+	if source := second.Report.Assignees[0].Transactions[0].Source; source.Filename != "grab-fixed.png" {
+		t.Errorf("expected provenance renamed to the new upload, got %q", source.Filename)
+	}
+
+	refreshed, err := service.ExtractTransactions(context.Background(), []Document{
+		{Filename: "grab.png", Content: []byte("grab")},
+		{Filename: "hotel.pdf", Content: []byte("hotel")},
+	}, ExtractOptions{Refresh: true})
+	if err != nil || refreshed.Cached || extractor.calls != 4 {
+		t.Errorf("expected refresh to bypass the cache, got cached=%v calls=%d err=%v", refreshed.Cached, extractor.calls, err)
+	}
+}
+
+// jpegOnlyExtractor reads JPEG photos only, like a backend without HEIC support
+type jpegOnlyExtractor struct {
+	countingExtractor
+}
+
+func (*jpegOnlyExtractor) ReadsMimeType(mimeType string) bool {
+	return mimeType == "image/jpeg"
+}
+
+func TestExtractTransactionsFailsDocumentsTheBackendCannotRead(t *testing.T) {
+	extractor := &jpegOnlyExtractor{}
+	service := newTestService(extractor, 2)
+
+	result, err := service.ExtractTransactions(context.Background(), []Document{
+		{Filename: "taxi.jpg", MimeType: "image/jpeg", Content: []byte("taxi")},
+		{Filename: "hotel.heic", MimeType: "image/heic", Content: []byte("hotel")},
+	}, ExtractOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if extractor.calls != 1 {
+		t.Errorf("expected only the JPEG to be sent to the backend, got %d calls", extractor.calls)
+	}
+	if result.Documents[0].Err != nil || result.Documents[1].Err == nil {
+		t.Fatalf("expected only hotel.heic to fail, got %+v", result.Documents)
+	}
+	if !strings.Contains(result.Documents[1].Err.Error(), "image/heic") {
+		t.Errorf("expected the reason to name the format, got %v", result.Documents[1].Err)
+	}
+}
+
+// countingExtractor returns one transaction named after the document and counts its calls
+type countingExtractor struct {
+	calls int32
+}
+
+func (c *countingExtractor) ExtractFromDocuments(ctx context.Context, documents []Document) (*dto.RecapReportDTO, error) {
+	atomic.AddInt32(&c.calls, 1)
+	return &dto.RecapReportDTO{
+		Assignees: []dto.AssigneeDTO{{
+			Name:         "Budi",
+			Transactions: []dto.TransactionDTO{{Description: string(documents[0].Content)}},
+		}},
+	}, nil
+}
+
+func TestExtractTransactionsComputesAllowanceFromRateTable(t *testing.T) {
+	extractor := &fakeExtractor{
+		reports: map[string]*dto.RecapReportDTO{
+			"surat_tugas.pdf": {
+				DestinationCity: "Kota Surabaya",
+				DepartureDate:   date.New(2025, time.October, 25),
+				ReturnDate:      date.New(2025, time.October, 27),
+				Assignees: []dto.AssigneeDTO{{
+					Name: "Budi Santoso",
+					Rank: "Penata (III/c)",
+					// A model-made allowance must never reach the payout
+					Transactions: []dto.TransactionDTO{{Type: "allowance", Amount: 999000, Subtotal: 2997000}},
+				}},
+			},
+		},
+	}
+	rates, err := sbm.Default()
+	if err != nil {
+		t.Fatalf("failed to load rate tables: %v", err)
+	}
+
+	registry := NewRegistry("fake")
+	registry.Register("fake", extractor)
+	service := NewService(registry, ServiceConfig{Rates: rates})
+
+	result, err := service.ExtractTransactions(context.Background(), []Document{{Filename: "surat_tugas.pdf"}},
+		ExtractOptions{TripCategory: sbm.TripCategoryOutOfTown})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	txs := result.Report.Assignees[0].Transactions
+	if len(txs) != 2 || txs[0].Amount != 410000 || txs[0].Subtotal != 1230000 {
+		t.Fatalf("expected 3 days at the Jawa Timur rate, got %+v", txs)
+	}
+	if !IsLumpSumLodging(txs[1]) || *txs[1].TotalNight != 2 {
+		t.Errorf("expected 2 nights of lump-sum lodging without hotel receipts, got %+v", txs[1])
+	}
+	if len(result.Warnings) != 0 {
+		t.Errorf("unexpected warnings: %v", result.Warnings)
+	}
+}
+
+// knownReceipts recognizes documents whose content starts with "known:"
+type knownReceipts struct{}
+
+func (knownReceipts) ExtractKnownDocument(ctx context.Context, doc Document) (*dto.RecapReportDTO, DocumentKind, string, bool) {
+	if string(doc.Content[:6]) != "known:" {
+		return nil, "", "", false
+	}
+	return &dto.RecapReportDTO{
+		Assignees: []dto.AssigneeDTO{{
+			Name:         "Budi",
+			Transactions: []dto.TransactionDTO{{Name: "Budi", Type: "transport", Subtotal: 75000, Description: "Gojek"}},
+		}},
+	}, DocumentKindRideReceipt, "gojek", true
+}
+
+func TestExtractTransactionsReadsKnownReceiptsOffline(t *testing.T) {
+	extractor := &countingExtractor{}
+	registry := NewRegistry("fake")
+	registry.Register("fake", extractor)
+	service := NewService(registry, ServiceConfig{Concurrency: 2, Offline: knownReceipts{}})
+
+	result, err := service.ExtractTransactions(context.Background(), []Document{
+		{Filename: "gojek.pdf", Content: []byte("known: gojek receipt")},
+		{Filename: "scan.jpg", Content: []byte("scanned receipt")},
+	}, ExtractOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if extractor.calls != 1 {
+		t.Errorf("expected only the unrecognized document to reach the extractor, got %d calls", extractor.calls)
+	}
+	if got := result.Documents[0]; got.Parser != "gojek" || got.Kind != DocumentKindRideReceipt {
+		t.Errorf("expected gojek.pdf to be read by the gojek parser, got %+v", got)
+	}
+	if got := result.Documents[1]; got.Parser != "" {
+		t.Errorf("expected scan.jpg to go to the extractor, got %+v", got)
+	}
+
+	txs := result.Report.Assignees[0].Transactions
+	if len(txs) != 2 || txs[0].Source == nil || txs[0].Source.Filename != "gojek.pdf" {
+		t.Errorf("expected both receipts on Budi with provenance, got %+v", txs)
+	}
+}
+
+// pagedExtractor reads a receipt from each document, reporting the page of the
+// document it was on as its content says
+type pagedExtractor struct{}
+
+func (pagedExtractor) ExtractFromDocuments(ctx context.Context, documents []Document) (*dto.RecapReportDTO, error) {
+	tx := dto.TransactionDTO{Type: "transport", Subtotal: int32(len(documents[0].Content)) * 1000}
+	if string(documents[0].Content) == "on page 2" {
+		tx.Source = &dto.SourceDTO{Page: 2, Confidence: 0.9}
+	}
+	return &dto.RecapReportDTO{Assignees: []dto.AssigneeDTO{{Name: "Budi", Transactions: []dto.TransactionDTO{tx}}}}, nil
+}
+
+func TestExtractTransactionsReportsPagesOfSplitDocuments(t *testing.T) {
+	service := newTestService(pagedExtractor{}, 1)
+	result, err := service.ExtractTransactions(context.Background(), []Document{
+		{Filename: "stack.pdf", Content: []byte("receipt"), Pages: []int{2}},
+		{Filename: "stack.pdf", Content: []byte("on page 2"), Pages: []int{4, 5}},
+	}, ExtractOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	pages := map[int32]int{}
+	for _, tx := range result.Report.Assignees[0].Transactions {
+		pages[tx.Subtotal] = tx.Source.Page
+	}
+	if pages[7000] != 2 || pages[9000] != 5 {
+		t.Errorf("expected receipts on pages 2 and 5 of stack.pdf, got %v", pages)
+	}
+	if got := result.Documents[1].Pages; len(got) != 2 || got[0] != 4 {
+		t.Errorf("expected the second document to report pages 4-5, got %v", got)
+	}
+}
+
+func TestExtractTransactionsKeepsReviewFlagOnLodgingAboveCeiling(t *testing.T) {
+	nights := int32(2)
+	extractor := &fakeExtractor{
+		reports: map[string]*dto.RecapReportDTO{
+			"folio.pdf": {
+				DestinationCity: "Kota Surabaya",
+				DepartureDate:   date.New(2025, time.October, 25),
+				ReturnDate:      date.New(2025, time.October, 27),
+				Assignees: []dto.AssigneeDTO{{
+					Name: "Budi Santoso",
+					Rank: "Penata (III/c)",
+					Transactions: []dto.TransactionDTO{{
+						Name: "Budi Santoso", Type: "accommodation", Subtype: "hotel",
+						Amount: 9000000, Subtotal: 18000000, TotalNight: &nights,
+						Source: &dto.SourceDTO{Filename: "folio.pdf", Confidence: 0.95},
+					}},
+				}},
+			},
+		},
+	}
+	rates, err := sbm.Default()
+	if err != nil {
+		t.Fatalf("failed to load rate tables: %v", err)
+	}
+
+	registry := NewRegistry("fake")
+	registry.Register("fake", extractor)
+	service := NewService(registry, ServiceConfig{Rates: rates, ReviewThreshold: 0.5})
+
+	result, err := service.ExtractTransactions(context.Background(), []Document{{Filename: "folio.pdf"}},
+		ExtractOptions{TripCategory: sbm.TripCategoryOutOfTown})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(result.LodgingOverages) != 1 {
+		t.Fatalf("expected one lodging overage, got %+v", result.LodgingOverages)
+	}
+	for _, tx := range result.Report.Assignees[0].Transactions {
+		if tx.Subtype == "hotel" && (tx.Source == nil || !tx.Source.NeedsReview) {
+			t.Errorf("expected the confidently read stay above the ceiling to stay marked for review, got %+v", tx.Source)
+		}
+	}
+}
+
+func TestExtractTransactionsReportsDuplicateLodgingOverageOnce(t *testing.T) {
+	nights := int32(2)
+	folio := func(filename string) *dto.RecapReportDTO {
+		return &dto.RecapReportDTO{
+			DestinationCity: "Kota Surabaya",
+			DepartureDate:   date.New(2025, time.October, 25),
+			ReturnDate:      date.New(2025, time.October, 27),
+			Assignees: []dto.AssigneeDTO{{
+				Name: "Budi Santoso",
+				Rank: "Penata (III/c)",
+				Transactions: []dto.TransactionDTO{{
+					Name: "Budi Santoso", Type: "accommodation", Subtype: "hotel",
+					Amount: 9000000, Subtotal: 18000000, TotalNight: &nights,
+					Date: date.New(2025, time.October, 25), Description: "Hotel Majapahit",
+					Source: &dto.SourceDTO{Filename: filename, Confidence: 0.9},
+				}},
+			}},
+		}
+	}
+	// The same folio uploaded as a PDF and as a photo
+	extractor := &fakeExtractor{
+		reports: map[string]*dto.RecapReportDTO{
+			"folio.pdf": folio("folio.pdf"),
+			"folio.png": folio("folio.png"),
+		},
+	}
+	rates, err := sbm.Default()
+	if err != nil {
+		t.Fatalf("failed to load rate tables: %v", err)
+	}
+
+	registry := NewRegistry("fake")
+	registry.Register("fake", extractor)
+	service := NewService(registry, ServiceConfig{Rates: rates})
+
+	result, err := service.ExtractTransactions(context.Background(), []Document{{Filename: "folio.pdf"}, {Filename: "folio.png"}},
+		ExtractOptions{TripCategory: sbm.TripCategoryOutOfTown})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(result.Duplicates) != 1 || result.Duplicates[0].Action != DuplicateActionMerged {
+		t.Fatalf("expected the two folios to be merged, got %+v", result.Duplicates)
+	}
+	if len(result.LodgingOverages) != 1 {
+		t.Errorf("expected the stay above the ceiling to be reported once, got %d overages", len(result.LodgingOverages))
+	}
+}
+
+func TestExtractTransactionsPaysLumpSumOnceForDuplicatedHotelReceipt(t *testing.T) {
+	nights := int32(2)
+	folio := func(filename string) *dto.RecapReportDTO {
+		return &dto.RecapReportDTO{
+			DestinationCity: "Kota Surabaya",
+			DepartureDate:   date.New(2025, time.October, 25),
+			ReturnDate:      date.New(2025, time.October, 28),
+			Assignees: []dto.AssigneeDTO{{
+				Name: "Budi Santoso",
+				Rank: "Penata (III/c)",
+				Transactions: []dto.TransactionDTO{{
+					Name: "Budi Santoso", Type: "accommodation", Subtype: "hotel",
+					Amount: 400000, Subtotal: 800000, TotalNight: &nights,
+					Date: date.New(2025, time.October, 25), Description: "Hotel Majapahit",
+					Source: &dto.SourceDTO{Filename: filename, Confidence: 0.9},
+				}},
+			}},
+		}
+	}
+	extractor := &fakeExtractor{
+		reports: map[string]*dto.RecapReportDTO{
+			"folio.pdf": folio("folio.pdf"),
+			"folio.png": folio("folio.png"),
+		},
+	}
+	rates, err := sbm.Default()
+	if err != nil {
+		t.Fatalf("failed to load rate tables: %v", err)
+	}
+	ceiling, err := rates.ForYear(2025).LodgingCeiling("Kota Surabaya", "Penata (III/c)", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	registry := NewRegistry("fake")
+	registry.Register("fake", extractor)
+	service := NewService(registry, ServiceConfig{Rates: rates})
+
+	result, err := service.ExtractTransactions(context.Background(), []Document{{Filename: "folio.pdf"}, {Filename: "folio.png"}},
+		ExtractOptions{TripCategory: sbm.TripCategoryOutOfTown})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Three nights, two of them covered by the one hotel stay uploaded twice
+	var lumpSums []dto.TransactionDTO
+	for _, tx := range result.Report.Assignees[0].Transactions {
+		if IsLumpSumLodging(tx) {
+			lumpSums = append(lumpSums, tx)
+		}
+	}
+	if len(lumpSums) != 1 {
+		t.Fatalf("expected one lump-sum line, got %+v", lumpSums)
+	}
+	if tx := lumpSums[0]; *tx.TotalNight != 1 || tx.Amount != ceiling.LumpSum() || tx.Subtotal != ceiling.LumpSum() {
+		t.Errorf("expected 1 night at %d, got %d nights at %d (subtotal %d)", ceiling.LumpSum(), *tx.TotalNight, tx.Amount, tx.Subtotal)
+	}
+}
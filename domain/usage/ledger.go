@@ -0,0 +1,301 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	domainErrors "sandbox/domain/errors"
+)
+
+const (
+	// dayLayout keys the ledger by calendar day
+	dayLayout = "2006-01-02"
+	// MonthLayout is how months are written in reports
+	MonthLayout = "2006-01"
+
+	// AnonymousClient is the client usage is accounted to when the caller is
+	// not one of the known clients
+	AnonymousClient = "anonymous"
+)
+
+// Entry is the usage of one API client on one endpoint on one day
+type Entry struct {
+	Day      string `json:"day"`
+	Endpoint string `json:"endpoint"`
+	Client   string `json:"client"`
+	Tokens   Tokens `json:"tokens"`
+}
+
+// Store persists the ledger so that the monthly budget survives restarts
+type Store interface {
+	Load(ctx context.Context) ([]Entry, error)
+	Save(ctx context.Context, entries []Entry) error
+}
+
+// Budget limits the tokens spent per calendar month
+type Budget struct {
+	// MonthlyTokens is the hard limit; zero means unlimited
+	MonthlyTokens int64
+	// SoftRatio is the share of MonthlyTokens past which responses carry a warning
+	SoftRatio float64
+}
+
+// Retention bounds what the ledger keeps, so that it cannot grow without end
+type Retention struct {
+	// Clients are the API clients accounted by name; any other caller is
+	// accounted to AnonymousClient
+	Clients []string
+	// Months is how many calendar months, the current one included, are kept
+	// and can be reported; zero keeps every month
+	Months int
+}
+
+// BudgetState is how far the current month is into its budget
+type BudgetState string
+
+const (
+	BudgetStateOK       BudgetState = "ok"
+	BudgetStateWarning  BudgetState = "warning"
+	BudgetStateExceeded BudgetState = "exceeded"
+)
+
+// BudgetStatus is the budget of one month and what has been used of it
+type BudgetStatus struct {
+	Month     string
+	Used      int64
+	SoftLimit int64
+	HardLimit int64
+	State     BudgetState
+}
+
+// Ledger aggregates token usage per day, endpoint and API client and enforces
+// the monthly budget. It is safe for concurrent use.
+type Ledger struct {
+	budget  Budget
+	prices  Prices
+	clients map[string]bool
+	months  int
+	store   Store
+	now     func() time.Time
+
+	mu      sync.Mutex
+	entries map[entryKey]*Entry
+}
+
+type entryKey struct {
+	day, endpoint, client string
+}
+
+// NewLedger loads earlier usage from store, which may be nil to keep usage in memory only
+func NewLedger(ctx context.Context, budget Budget, prices Prices, retention Retention, store Store) (*Ledger, error) {
+	l := &Ledger{
+		budget:  budget,
+		prices:  prices,
+		clients: make(map[string]bool, len(retention.Clients)),
+		months:  retention.Months,
+		store:   store,
+		now:     time.Now,
+		entries: make(map[entryKey]*Entry),
+	}
+	for _, client := range retention.Clients {
+		l.clients[client] = true
+	}
+
+	if store != nil {
+		entries, err := store.Load(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load token usage: %w", err)
+		}
+		for _, e := range entries {
+			entry := e
+			l.entries[entryKey{e.Day, e.Endpoint, e.Client}] = &entry
+		}
+		l.prune()
+	}
+	return l, nil
+}
+
+// Prices returns the prices costs are estimated with
+func (l *Ledger) Prices() Prices {
+	return l.prices
+}
+
+// Check refuses new work once the month's hard limit is reached
+func (l *Ledger) Check() error {
+	status := l.Status()
+	if status.State != BudgetStateExceeded {
+		return nil
+	}
+	return domainErrors.NewBudgetExceededError(fmt.Sprintf(
+		"monthly token budget of %d exhausted: %d tokens used in %s", status.HardLimit, status.Used, status.Month))
+}
+
+// Record adds the tokens used by one request and returns the budget status
+// after it. Usage of an unknown client is accounted to AnonymousClient, and
+// days that have left the retained months are dropped.
+func (l *Ledger) Record(ctx context.Context, endpoint, client string, t Tokens) (BudgetStatus, error) {
+	if t.Calls == 0 {
+		return l.Status(), nil
+	}
+	if !l.clients[client] {
+		client = AnonymousClient
+	}
+
+	// The store is written under the lock so that an older snapshot never
+	// overwrites a newer one
+	l.mu.Lock()
+	key := entryKey{l.now().Format(dayLayout), endpoint, client}
+	entry, ok := l.entries[key]
+	if !ok {
+		entry = &Entry{Day: key.day, Endpoint: endpoint, Client: client}
+		l.entries[key] = entry
+	}
+	entry.Tokens.Add(t)
+	l.prune()
+	var err error
+	if l.store != nil {
+		err = l.store.Save(ctx, l.snapshot())
+	}
+	l.mu.Unlock()
+
+	if err != nil {
+		return l.Status(), fmt.Errorf("failed to save token usage: %w", err)
+	}
+	return l.Status(), nil
+}
+
+// Status reports the budget of the current month
+func (l *Ledger) Status() BudgetStatus {
+	return l.status(l.now().Format(MonthLayout))
+}
+
+// CurrentMonth is the month the budget currently applies to
+func (l *Ledger) CurrentMonth() string {
+	return l.now().Format(MonthLayout)
+}
+
+func (l *Ledger) status(month string) BudgetStatus {
+	l.mu.Lock()
+	var used int64
+	for key, entry := range l.entries {
+		if strings.HasPrefix(key.day, month) {
+			used += entry.Tokens.Total
+		}
+	}
+	l.mu.Unlock()
+
+	status := BudgetStatus{Month: month, Used: used, State: BudgetStateOK}
+	if l.budget.MonthlyTokens <= 0 {
+		return status
+	}
+
+	status.HardLimit = l.budget.MonthlyTokens
+	status.SoftLimit = int64(float64(l.budget.MonthlyTokens) * l.budget.SoftRatio)
+	switch {
+	case used >= status.HardLimit:
+		status.State = BudgetStateExceeded
+	case used >= status.SoftLimit:
+		status.State = BudgetStateWarning
+	}
+	return status
+}
+
+// Report is the usage of one month broken down three ways
+type Report struct {
+	Month      string
+	Total      Tokens
+	ByDay      []Row
+	ByEndpoint []Row
+	ByClient   []Row
+	Budget     BudgetStatus
+}
+
+// Row is the usage of one day, endpoint or client
+type Row struct {
+	Key    string
+	Tokens Tokens
+}
+
+// Report aggregates the usage of month, formatted as MonthLayout
+func (l *Ledger) Report(month string) Report {
+	byDay := make(map[string]*Tokens)
+	byEndpoint := make(map[string]*Tokens)
+	byClient := make(map[string]*Tokens)
+	report := Report{Month: month}
+
+	l.mu.Lock()
+	for key, entry := range l.entries {
+		if !strings.HasPrefix(key.day, month) {
+			continue
+		}
+		report.Total.Add(entry.Tokens)
+		addTo(byDay, key.day, entry.Tokens)
+		addTo(byEndpoint, key.endpoint, entry.Tokens)
+		addTo(byClient, key.client, entry.Tokens)
+	}
+	l.mu.Unlock()
+
+	report.ByDay = rows(byDay)
+	report.ByEndpoint = rows(byEndpoint)
+	report.ByClient = rows(byClient)
+	report.Budget = l.status(month)
+	return report
+}
+
+func addTo(totals map[string]*Tokens, key string, t Tokens) {
+	total, ok := totals[key]
+	if !ok {
+		total = &Tokens{}
+		totals[key] = total
+	}
+	total.Add(t)
+}
+
+func rows(totals map[string]*Tokens) []Row {
+	rows := make([]Row, 0, len(totals))
+	for key, t := range totals {
+		rows = append(rows, Row{Key: key, Tokens: *t})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].Key < rows[j].Key
+	})
+	return rows
+}
+
+// prune drops the days before the retained months; the caller holds l.mu or
+// has not shared the ledger yet
+func (l *Ledger) prune() {
+	if l.months <= 0 {
+		return
+	}
+	now := l.now()
+	first := time.Date(now.Year(), now.Month()-time.Month(l.months-1), 1, 0, 0, 0, 0, now.Location()).Format(dayLayout)
+	for key := range l.entries {
+		if key.day < first {
+			delete(l.entries, key)
+		}
+	}
+}
+
+// snapshot copies the entries for the store; the caller holds l.mu
+func (l *Ledger) snapshot() []Entry {
+	entries := make([]Entry, 0, len(l.entries))
+	for _, entry := range l.entries {
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Day != b.Day {
+			return a.Day < b.Day
+		}
+		if a.Endpoint != b.Endpoint {
+			return a.Endpoint < b.Endpoint
+		}
+		return a.Client < b.Client
+	})
+	return entries
+}
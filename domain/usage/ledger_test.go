@@ -0,0 +1,110 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	domainErrors "sandbox/domain/errors"
+)
+
+func TestLedgerAggregatesUsageAndEnforcesBudget(t *testing.T) {
+	ledger, err := NewLedger(context.Background(), Budget{MonthlyTokens: 1000, SoftRatio: 0.8}, Prices{PromptPerMillion: 1, OutputPerMillion: 4},
+		Retention{Clients: []string{"web", "mobile"}}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+	ledger.now = func() time.Time { return now }
+
+	record := func(endpoint, client string, total int64) BudgetStatus {
+		t.Helper()
+		status, err := ledger.Record(context.Background(), endpoint, client, Tokens{Prompt: total / 2, Candidates: total / 2, Total: total, Calls: 1})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return status
+	}
+
+	if status := record("/api/upload", "web", 500); status.State != BudgetStateOK {
+		t.Errorf("expected ok at 500 of 1000 tokens, got %s", status.State)
+	}
+	now = now.AddDate(0, 0, 1)
+	if status := record("/api/extractions", "mobile", 300); status.State != BudgetStateWarning {
+		t.Errorf("expected warning at 800 of 1000 tokens, got %s", status.State)
+	}
+	if err := ledger.Check(); err != nil {
+		t.Errorf("expected extractions to be allowed below the hard limit, got %v", err)
+	}
+
+	record("/api/upload", "web", 200)
+	if err := ledger.Check(); !errors.Is(err, domainErrors.ErrBudgetExceeded) {
+		t.Errorf("expected budget exceeded at 1000 tokens, got %v", err)
+	}
+
+	report := ledger.Report("2025-03")
+	if report.Total.Total != 1000 || report.Total.Calls != 3 {
+		t.Errorf("expected 1000 tokens in 3 calls, got %+v", report.Total)
+	}
+	if len(report.ByDay) != 2 || report.ByDay[1].Key != "2025-03-11" || report.ByDay[1].Tokens.Total != 500 {
+		t.Errorf("unexpected usage by day: %+v", report.ByDay)
+	}
+	if len(report.ByClient) != 2 || report.ByClient[1].Key != "web" || report.ByClient[1].Tokens.Total != 700 {
+		t.Errorf("unexpected usage by client: %+v", report.ByClient)
+	}
+
+	// A new month starts with a fresh budget
+	now = time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+	if err := ledger.Check(); err != nil {
+		t.Errorf("expected the budget to reset in April, got %v", err)
+	}
+}
+
+// memoryStore keeps the last saved entries
+type memoryStore struct {
+	entries []Entry
+}
+
+func (s *memoryStore) Load(ctx context.Context) ([]Entry, error) {
+	return s.entries, nil
+}
+
+func (s *memoryStore) Save(ctx context.Context, entries []Entry) error {
+	s.entries = entries
+	return nil
+}
+
+func TestLedgerBoundsClientsAndRetainedMonths(t *testing.T) {
+	now := time.Now()
+	lastMonth := time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, time.UTC)
+	expired := time.Date(now.Year(), now.Month()-2, 28, 0, 0, 0, 0, time.UTC)
+	store := &memoryStore{entries: []Entry{
+		{Day: expired.Format(dayLayout), Endpoint: "/api/upload", Client: "web", Tokens: Tokens{Total: 100, Calls: 1}},
+		{Day: lastMonth.Format(dayLayout), Endpoint: "/api/upload", Client: "web", Tokens: Tokens{Total: 200, Calls: 1}},
+	}}
+	ledger, err := NewLedger(context.Background(), Budget{}, Prices{}, Retention{Clients: []string{"web"}, Months: 2}, store)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, client := range []string{"web", "10.0.0.1", "made-up"} {
+		if _, err := ledger.Record(context.Background(), "/api/upload", client, Tokens{Total: 10, Calls: 1}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	report := ledger.Report(ledger.CurrentMonth())
+	if len(report.ByClient) != 2 || report.ByClient[0].Key != AnonymousClient || report.ByClient[0].Tokens.Total != 20 {
+		t.Errorf("expected unknown clients to be accounted as %s, got %+v", AnonymousClient, report.ByClient)
+	}
+	if report := ledger.Report(lastMonth.Format(MonthLayout)); report.Total.Total != 200 {
+		t.Errorf("expected last month to be kept, got %d tokens", report.Total.Total)
+	}
+	if report := ledger.Report(expired.Format(MonthLayout)); report.Total.Calls != 0 {
+		t.Errorf("expected the month before to be dropped, got %+v", report.Total)
+	}
+	if len(store.entries) != 3 {
+		t.Errorf("expected the store to keep last month and the current month's two clients, got %+v", store.entries)
+	}
+}
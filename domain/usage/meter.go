@@ -0,0 +1,72 @@
+package usage
+
+import (
+	"context"
+	"sync"
+)
+
+// Tokens counts the tokens billed for one or more LLM calls
+type Tokens struct {
+	// Prompt is the input: instructions and documents
+	Prompt int64 `json:"prompt_tokens"`
+	// Candidates is the generated answer
+	Candidates int64 `json:"candidate_tokens"`
+	// Total includes tokens a model spends thinking, which are billed as output
+	Total int64 `json:"total_tokens"`
+	Calls int   `json:"calls"`
+}
+
+// Add accumulates other into t
+func (t *Tokens) Add(other Tokens) {
+	t.Prompt += other.Prompt
+	t.Candidates += other.Candidates
+	t.Total += other.Total
+	t.Calls += other.Calls
+}
+
+// Prices are what a million tokens cost, in US dollars
+type Prices struct {
+	PromptPerMillion float64
+	OutputPerMillion float64
+}
+
+// Cost estimates the price of t. Everything beyond the prompt is billed as output.
+func (p Prices) Cost(t Tokens) float64 {
+	return (float64(t.Prompt)*p.PromptPerMillion + float64(t.Total-t.Prompt)*p.OutputPerMillion) / 1e6
+}
+
+// Meter adds up the tokens of the LLM calls made for one request. It is safe
+// for concurrent use, since documents are extracted in parallel.
+type Meter struct {
+	mu     sync.Mutex
+	tokens Tokens
+}
+
+// Record adds the tokens of one call
+func (m *Meter) Record(t Tokens) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokens.Add(t)
+}
+
+// Tokens returns the total recorded so far
+func (m *Meter) Tokens() Tokens {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.tokens
+}
+
+type meterKey struct{}
+
+// WithMeter attaches m to ctx so that LLM clients deep in the call chain can
+// report their usage with Record
+func WithMeter(ctx context.Context, m *Meter) context.Context {
+	return context.WithValue(ctx, meterKey{}, m)
+}
+
+// Record adds the tokens of one call to the meter of ctx, if it has one
+func Record(ctx context.Context, t Tokens) {
+	if m, ok := ctx.Value(meterKey{}).(*Meter); ok {
+		m.Record(t)
+	}
+}
@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"sandbox/domain/transaction"
+)
+
+// DiskStore keeps one JSON file per result in a directory, so that cached
+// results survive restarts and can be shared by instances on the same volume
+type DiskStore struct {
+	dir string
+	ttl time.Duration
+	now func() time.Time
+}
+
+// NewDiskStore creates the cache directory if needed. Results older than ttl
+// are ignored and removed on access; a zero ttl keeps them indefinitely.
+func NewDiskStore(dir string, ttl time.Duration) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	return &DiskStore{
+		dir: dir,
+		ttl: ttl,
+		now: time.Now,
+	}, nil
+}
+
+// Get implements transaction.ResultCache
+func (s *DiskStore) Get(ctx context.Context, key string) (*transaction.CachedExtraction, bool, error) {
+	path := s.path(key)
+
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to stat cached extraction: %w", err)
+	}
+
+	if s.ttl > 0 && s.now().Sub(info.ModTime()) > s.ttl {
+		_ = os.Remove(path)
+		return nil, false, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read cached extraction: %w", err)
+	}
+
+	var cached transaction.CachedExtraction
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, false, fmt.Errorf("failed to decode cached extraction: %w", err)
+	}
+	return &cached, true, nil
+}
+
+// Put implements transaction.ResultCache. The file is written under a temporary
+// name and renamed so that readers never see a partial result.
+func (s *DiskStore) Put(ctx context.Context, key string, cached *transaction.CachedExtraction) error {
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return fmt.Errorf("failed to encode extraction: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(s.dir, key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create cache file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path(key)); err != nil {
+		return fmt.Errorf("failed to store cache file: %w", err)
+	}
+	return nil
+}
+
+// path maps a key to its file. Keys are hex digests, so they are safe file names.
+func (s *DiskStore) path(key string) string {
+	return filepath.Join(s.dir, key+".json")
+}
@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"sandbox/domain/transaction"
+)
+
+// MemoryStore is an in-process least-recently-used cache. Entries are kept as
+// JSON so that callers never share them.
+type MemoryStore struct {
+	maxEntries int
+	ttl        time.Duration
+	now        func() time.Time
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key       string
+	data      []byte
+	expiresAt time.Time
+}
+
+// NewMemoryStore creates a store holding at most maxEntries results, each for
+// at most ttl; a zero ttl keeps results until they are evicted
+func NewMemoryStore(maxEntries int, ttl time.Duration) *MemoryStore {
+	if maxEntries < 1 {
+		maxEntries = 1
+	}
+
+	return &MemoryStore{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		now:        time.Now,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// Get implements transaction.ResultCache
+func (s *MemoryStore) Get(ctx context.Context, key string) (*transaction.CachedExtraction, bool, error) {
+	s.mu.Lock()
+	elem, ok := s.entries[key]
+	if !ok {
+		s.mu.Unlock()
+		return nil, false, nil
+	}
+
+	entry := elem.Value.(*memoryEntry)
+	if !entry.expiresAt.IsZero() && s.now().After(entry.expiresAt) {
+		s.order.Remove(elem)
+		delete(s.entries, key)
+		s.mu.Unlock()
+		return nil, false, nil
+	}
+	s.order.MoveToFront(elem)
+	data := entry.data
+	s.mu.Unlock()
+
+	var cached transaction.CachedExtraction
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, false, fmt.Errorf("failed to decode cached extraction: %w", err)
+	}
+	return &cached, true, nil
+}
+
+// Put implements transaction.ResultCache
+func (s *MemoryStore) Put(ctx context.Context, key string, cached *transaction.CachedExtraction) error {
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return fmt.Errorf("failed to encode extraction: %w", err)
+	}
+
+	var expiresAt time.Time
+	if s.ttl > 0 {
+		expiresAt = s.now().Add(s.ttl)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.entries[key]; ok {
+		entry := elem.Value.(*memoryEntry)
+		entry.data = data
+		entry.expiresAt = expiresAt
+		s.order.MoveToFront(elem)
+		return nil
+	}
+
+	s.entries[key] = s.order.PushFront(&memoryEntry{key: key, data: data, expiresAt: expiresAt})
+	for s.order.Len() > s.maxEntries {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryEntry).key)
+	}
+	return nil
+}
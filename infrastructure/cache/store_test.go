@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"sandbox/application/dto"
+	"sandbox/domain/date"
+	"sandbox/domain/transaction"
+)
+
+func sampleEntry(city string) *transaction.CachedExtraction {
+	return &transaction.CachedExtraction{
+		Report: &dto.RecapReportDTO{
+			DestinationCity: city,
+			StartDate:       date.New(2025, time.October, 25),
+			Assignees:       []dto.AssigneeDTO{{Name: "Budi"}},
+		},
+		Documents: []transaction.CachedDocument{{Hash: "abc", Filename: "st.pdf", Kind: transaction.DocumentKindAssignmentLetter}},
+	}
+}
+
+func TestMemoryStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(2, 0)
+
+	store.Put(ctx, "a", sampleEntry("Surabaya"))
+	store.Put(ctx, "b", sampleEntry("Medan"))
+	store.Get(ctx, "a")
+	store.Put(ctx, "c", sampleEntry("Makassar"))
+
+	if _, ok, _ := store.Get(ctx, "b"); ok {
+		t.Error("expected least recently used entry to be evicted")
+	}
+	entry, ok, err := store.Get(ctx, "a")
+	if err != nil || !ok || entry.Report.DestinationCity != "Surabaya" {
+		t.Fatalf("expected recently used entry to survive, got %+v ok=%v err=%v", entry, ok, err)
+	}
+
+	// Entries are copies
+	entry.Report.DestinationCity = "changed"
+	if again, _, _ := store.Get(ctx, "a"); again.Report.DestinationCity != "Surabaya" {
+		t.Error("expected stored entry to be unaffected by changes to a returned copy")
+	}
+}
+
+func TestMemoryStoreExpiresEntries(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(4, time.Hour)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	store.Put(ctx, "a", sampleEntry("Surabaya"))
+	now = now.Add(2 * time.Hour)
+
+	if _, ok, _ := store.Get(ctx, "a"); ok {
+		t.Error("expected expired entry to be a miss")
+	}
+}
+
+func TestDiskStoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewDiskStore(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, ok, err := store.Get(ctx, "missing"); ok || err != nil {
+		t.Fatalf("expected a clean miss, got ok=%v err=%v", ok, err)
+	}
+
+	if err := store.Put(ctx, "a", sampleEntry("Surabaya")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	entry, ok, err := store.Get(ctx, "a")
+	if err != nil || !ok {
+		t.Fatalf("expected a hit, got ok=%v err=%v", ok, err)
+	}
+	if !entry.Report.StartDate.Equal(date.New(2025, time.October, 25)) || entry.Documents[0].Kind != transaction.DocumentKindAssignmentLetter {
+		t.Errorf("unexpected entry after round trip: %+v", entry)
+	}
+
+	store.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if _, ok, _ := store.Get(ctx, "a"); ok {
+		t.Error("expected expired file to be a miss")
+	}
+}
@@ -5,13 +5,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
-	"time"
+
+	"sandbox/infrastructure/httpclient"
 )
 
 type Client struct {
-	httpClient *http.Client
+	httpClient *httpclient.Client
 	apiKey     string
 	baseURL    string
 }
@@ -32,11 +32,9 @@ type FileResponse struct {
 	WebViewLink string            `json:"webViewLink"`
 }
 
-func NewClient(apiKey string) *Client {
+func NewClient(apiKey string, httpClient *httpclient.Client) *Client {
 	return &Client{
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		httpClient: httpClient,
 		apiKey:  apiKey,
 		baseURL: "https://www.googleapis.com/drive/v3",
 	}
@@ -72,11 +70,6 @@ func (c *Client) CreateFolder(ctx context.Context, parentFolderID, folderName st
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("Drive API returned status %d: %s", resp.StatusCode, string(body))
-	}
-
 	var fileResp FileResponse
 	if err := json.NewDecoder(resp.Body).Decode(&fileResp); err != nil {
 		return "", fmt.Errorf("failed to decode response: %w", err)
@@ -114,11 +107,6 @@ func (c *Client) DuplicateFile(ctx context.Context, templateID, targetFolderID,
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("Drive API returned status %d: %s", resp.StatusCode, string(body))
-	}
-
 	var fileResp FileResponse
 	if err := json.NewDecoder(resp.Body).Decode(&fileResp); err != nil {
 		return "", fmt.Errorf("failed to decode response: %w", err)
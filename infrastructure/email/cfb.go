@@ -0,0 +1,272 @@
+package email
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+// Outlook .msg files are OLE compound files: a small FAT file system whose
+// directory holds storages (folders) and streams (files).
+
+var cfbSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+const (
+	cfbEndOfChain = 0xFFFFFFFE
+	cfbNoStream   = 0xFFFFFFFF
+	cfbDirSize    = 128
+
+	cfbStorage = 1
+	cfbStream  = 2
+	cfbRoot    = 5
+)
+
+var errCorruptCompoundFile = errors.New("corrupt compound file")
+
+// IsCompoundFile reports whether content starts like an OLE compound file
+func IsCompoundFile(content []byte) bool {
+	return bytes.HasPrefix(content, cfbSignature)
+}
+
+// cfbEntry is a storage or stream of the compound file directory
+type cfbEntry struct {
+	name        string
+	kind        byte
+	left, right uint32
+	child       uint32
+	start       uint32
+	size        uint64
+}
+
+// compoundFile reads streams of an OLE compound file held in memory
+type compoundFile struct {
+	content    []byte
+	sectorSize int
+	miniSize   int
+	miniCutoff uint64
+	fat        []uint32
+	miniFAT    []uint32
+	miniStream []byte
+	entries    []cfbEntry
+}
+
+func parseCompoundFile(content []byte) (*compoundFile, error) {
+	if len(content) < 512 || !IsCompoundFile(content) {
+		return nil, errors.New("not a compound file")
+	}
+
+	le := binary.LittleEndian
+	sectorShift := le.Uint16(content[0x1E:])
+	miniShift := le.Uint16(content[0x20:])
+	if sectorShift != 9 && sectorShift != 12 || miniShift != 6 {
+		return nil, errCorruptCompoundFile
+	}
+	cf := &compoundFile{
+		content:    content,
+		sectorSize: 1 << sectorShift,
+		miniSize:   1 << miniShift,
+		miniCutoff: uint64(le.Uint32(content[0x38:])),
+	}
+
+	// The FAT sectors are listed by the 109 header entries, then by a chain of
+	// DIFAT sectors. A file cannot hold more FAT or DIFAT sectors than it has
+	// sectors, nor list one twice.
+	fatSectors := make([]uint32, 0, 109)
+	listed := map[uint32]bool{}
+	addFATSector := func(sector uint32) error {
+		if listed[sector] || len(fatSectors) >= cf.sectorCount() {
+			return errCorruptCompoundFile
+		}
+		listed[sector] = true
+		fatSectors = append(fatSectors, sector)
+		return nil
+	}
+	for i := 0; i < 109; i++ {
+		if sector := le.Uint32(content[0x4C+4*i:]); sector < cfbEndOfChain {
+			if err := addFATSector(sector); err != nil {
+				return nil, err
+			}
+		}
+	}
+	perSector := cf.sectorSize/4 - 1
+	difatSectors := int(le.Uint32(content[0x48:]))
+	if difatSectors > cf.sectorCount() {
+		return nil, errCorruptCompoundFile
+	}
+	visited := map[uint32]bool{}
+	for sector, n := le.Uint32(content[0x44:]), difatSectors; n > 0 && sector < cfbEndOfChain; n-- {
+		if visited[sector] {
+			return nil, errCorruptCompoundFile
+		}
+		visited[sector] = true
+		data, err := cf.sector(sector)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < perSector; i++ {
+			if s := le.Uint32(data[4*i:]); s < cfbEndOfChain {
+				if err := addFATSector(s); err != nil {
+					return nil, err
+				}
+			}
+		}
+		sector = le.Uint32(data[4*perSector:])
+	}
+	for _, sector := range fatSectors {
+		data, err := cf.sector(sector)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < len(data); i += 4 {
+			cf.fat = append(cf.fat, le.Uint32(data[i:]))
+		}
+	}
+
+	directory, err := cf.chain(le.Uint32(content[0x30:]), 0)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read directory: %w", err)
+	}
+	for i := 0; i+cfbDirSize <= len(directory); i += cfbDirSize {
+		cf.entries = append(cf.entries, parseDirEntry(directory[i:i+cfbDirSize]))
+	}
+	if len(cf.entries) == 0 || cf.entries[0].kind != cfbRoot {
+		return nil, errCorruptCompoundFile
+	}
+
+	if miniFAT, err := cf.chain(le.Uint32(content[0x3C:]), 0); err == nil {
+		for i := 0; i+4 <= len(miniFAT); i += 4 {
+			cf.miniFAT = append(cf.miniFAT, le.Uint32(miniFAT[i:]))
+		}
+	}
+	root := cf.entries[0]
+	if root.start < cfbEndOfChain {
+		if cf.miniStream, err = cf.chain(root.start, root.size); err != nil {
+			return nil, fmt.Errorf("cannot read mini stream: %w", err)
+		}
+	}
+	return cf, nil
+}
+
+func parseDirEntry(data []byte) cfbEntry {
+	le := binary.LittleEndian
+	nameLen := int(le.Uint16(data[0x40:]))
+	if nameLen > 64 {
+		nameLen = 64
+	}
+	units := make([]uint16, 0, nameLen/2)
+	for i := 0; i+1 < nameLen; i += 2 {
+		if u := le.Uint16(data[i:]); u != 0 {
+			units = append(units, u)
+		}
+	}
+	return cfbEntry{
+		name:  string(utf16.Decode(units)),
+		kind:  data[0x42],
+		left:  le.Uint32(data[0x44:]),
+		right: le.Uint32(data[0x48:]),
+		child: le.Uint32(data[0x4C:]),
+		start: le.Uint32(data[0x74:]),
+		// Version 3 files may leave garbage in the high half of the size
+		size: uint64(le.Uint32(data[0x78:])),
+	}
+}
+
+// sectorCount is the number of regular sectors the file can hold
+func (cf *compoundFile) sectorCount() int {
+	return len(cf.content)/cf.sectorSize - 1
+}
+
+// sector returns the content of one regular sector
+func (cf *compoundFile) sector(n uint32) ([]byte, error) {
+	offset := (int(n) + 1) * cf.sectorSize
+	if n >= cfbEndOfChain || offset+cf.sectorSize > len(cf.content) {
+		return nil, errCorruptCompoundFile
+	}
+	return cf.content[offset : offset+cf.sectorSize], nil
+}
+
+// chain follows a FAT chain from start, returning at most size bytes, or the
+// whole chain when size is 0. A chain visiting a sector twice, or more sectors
+// than the file holds, is corrupt.
+func (cf *compoundFile) chain(start uint32, size uint64) ([]byte, error) {
+	var out []byte
+	visited := map[uint32]bool{}
+	for sector := start; sector < cfbEndOfChain; {
+		if visited[sector] || len(visited) >= cf.sectorCount() || int(sector) >= len(cf.fat) {
+			return nil, errCorruptCompoundFile
+		}
+		visited[sector] = true
+		data, err := cf.sector(sector)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, data...)
+		if size > 0 && uint64(len(out)) >= size {
+			break
+		}
+		sector = cf.fat[sector]
+	}
+	if size > 0 {
+		if uint64(len(out)) < size {
+			return nil, errCorruptCompoundFile
+		}
+		out = out[:size]
+	}
+	return out, nil
+}
+
+// miniChain follows a mini FAT chain through the mini stream
+func (cf *compoundFile) miniChain(start uint32, size uint64) ([]byte, error) {
+	var out []byte
+	for sector, steps := start, 0; sector < cfbEndOfChain && uint64(len(out)) < size; steps++ {
+		offset := int(sector) * cf.miniSize
+		if steps > len(cf.miniFAT) || int(sector) >= len(cf.miniFAT) || offset+cf.miniSize > len(cf.miniStream) {
+			return nil, errCorruptCompoundFile
+		}
+		out = append(out, cf.miniStream[offset:offset+cf.miniSize]...)
+		sector = cf.miniFAT[sector]
+	}
+	if uint64(len(out)) < size {
+		return nil, errCorruptCompoundFile
+	}
+	return out[:size], nil
+}
+
+// children lists the entries of a storage by name
+func (cf *compoundFile) children(storage int) map[string]int {
+	children := map[string]int{}
+	seen := map[uint32]bool{}
+	var walk func(id uint32)
+	walk = func(id uint32) {
+		if id == cfbNoStream || int(id) >= len(cf.entries) || seen[id] {
+			return
+		}
+		seen[id] = true
+		entry := cf.entries[id]
+		children[entry.name] = int(id)
+		walk(entry.left)
+		walk(entry.right)
+	}
+	walk(cf.entries[storage].child)
+	return children
+}
+
+// stream reads the content of a stream entry
+func (cf *compoundFile) stream(id int) ([]byte, error) {
+	entry := cf.entries[id]
+	if entry.kind != cfbStream {
+		return nil, fmt.Errorf("%s is not a stream", entry.name)
+	}
+	if entry.size == 0 {
+		return nil, nil
+	}
+	if entry.size > uint64(len(cf.content)) {
+		return nil, errCorruptCompoundFile
+	}
+	if entry.size < cf.miniCutoff {
+		return cf.miniChain(entry.start, entry.size)
+	}
+	return cf.chain(entry.start, entry.size)
+}
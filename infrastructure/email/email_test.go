@@ -0,0 +1,307 @@
+package email
+
+import (
+	"bytes"
+	"encoding/binary"
+	"runtime"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+const bookingEmail = "From: =?UTF-8?Q?Hotel_Santika_Pr=C3=A9mi=C3=A8re?= <reservation@santika.example>\r\n" +
+	"To: budi@kemenkeu.example\r\n" +
+	"Subject: =?UTF-8?B?S29uZmlybWFzaSBQZW1lc2FuYW4gIzQ4MjE=?=\r\n" +
+	"Date: Mon, 03 Mar 2025 09:15:00 +0700\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"outer\"\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/related; boundary=\"related\"\r\n" +
+	"\r\n" +
+	"--related\r\n" +
+	"Content-Type: multipart/alternative; boundary=\"alt\"\r\n" +
+	"\r\n" +
+	"--alt\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"Plain version\r\n" +
+	"--alt\r\n" +
+	"Content-Type: text/html; charset=iso-8859-1\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"<html><head><style>td{color:red}</style></head><body><img src=3D\"cid:logo@santika\">" +
+	"<p>Terima kasih, Budi</p><table><tr><td>Check-in</td><td>3 Mar 2025</td></tr>" +
+	"<tr><td>Total</td><td>Rp&nbsp;1.450.000</td></tr></table><p>Caf=E9 included</p></body></html>\r\n" +
+	"--alt--\r\n" +
+	"--related\r\n" +
+	"Content-Type: image/png\r\n" +
+	"Content-ID: <logo@santika>\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"iVBORw0KGgo=\r\n" +
+	"--related--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: application/pdf; name=\"folio.pdf\"\r\n" +
+	"Content-Disposition: attachment; filename=\"folio.pdf\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERi0xLjcK\r\nLi4u\r\n" +
+	"--outer--\r\n"
+
+func TestParseReadsBodyAndAttachments(t *testing.T) {
+	m, err := Parse([]byte(bookingEmail))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if m.Subject != "Konfirmasi Pemesanan #4821" {
+		t.Errorf("Subject = %q", m.Subject)
+	}
+	if m.From != "Hotel Santika Prémière <reservation@santika.example>" {
+		t.Errorf("From = %q", m.From)
+	}
+	if m.Date.IsZero() {
+		t.Error("Date was not read")
+	}
+
+	body := m.Body()
+	for _, want := range []string{"Subject: Konfirmasi Pemesanan #4821", "Check-in | 3 Mar 2025", "Total | Rp 1.450.000", "Café included"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body lacks %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "color:red") || strings.Contains(body, "Plain version") {
+		t.Errorf("body holds styles or the plain alternative:\n%s", body)
+	}
+
+	if len(m.Attachments) != 2 {
+		t.Fatalf("got %d attachments, want 2", len(m.Attachments))
+	}
+	if logo := m.Attachments[0]; !logo.Inline {
+		t.Errorf("logo shown in the body is not inline: %+v", logo)
+	}
+	if folio := m.Attachments[1]; folio.Filename != "folio.pdf" || folio.Inline || string(folio.Content) != "%PDF-1.7\n..." {
+		t.Errorf("folio = %s inline=%v %q", folio.Filename, folio.Inline, folio.Content)
+	}
+}
+
+// cfbNode is a storage, when it has children, or a stream of a test compound file
+type cfbNode struct {
+	name     string
+	data     []byte
+	children []*cfbNode
+}
+
+// buildCompoundFile writes a version 3 compound file keeping every stream in
+// the mini stream, as Outlook does for small properties
+func buildCompoundFile(root []*cfbNode) []byte {
+	le := binary.LittleEndian
+	var dir [][]byte
+	var miniStream []byte
+	var miniFAT []uint32
+
+	var add func(node *cfbNode, kind byte) uint32
+	add = func(node *cfbNode, kind byte) uint32 {
+		entry := make([]byte, cfbDirSize)
+		units := utf16.Encode([]rune(node.name))
+		for i, u := range units {
+			le.PutUint16(entry[2*i:], u)
+		}
+		le.PutUint16(entry[0x40:], uint16(2*len(units)+2))
+		entry[0x42] = kind
+		le.PutUint32(entry[0x44:], cfbNoStream)
+		le.PutUint32(entry[0x48:], cfbNoStream)
+		le.PutUint32(entry[0x4C:], cfbNoStream)
+		id := uint32(len(dir))
+		dir = append(dir, entry)
+
+		if kind == cfbStream {
+			start := uint32(len(miniStream) / 64)
+			le.PutUint32(entry[0x74:], start)
+			le.PutUint32(entry[0x78:], uint32(len(node.data)))
+			miniStream = append(miniStream, node.data...)
+			for len(miniStream)%64 != 0 {
+				miniStream = append(miniStream, 0)
+			}
+			for s := start; s < uint32(len(miniStream)/64); s++ {
+				miniFAT = append(miniFAT, s+1)
+			}
+			miniFAT[len(miniFAT)-1] = cfbEndOfChain
+			return id
+		}
+
+		// Children are chained through their right sibling
+		var previous []byte
+		for _, child := range node.children {
+			kind := byte(cfbStream)
+			if child.children != nil {
+				kind = cfbStorage
+			}
+			childID := add(child, kind)
+			if previous == nil {
+				le.PutUint32(entry[0x4C:], childID)
+			} else {
+				le.PutUint32(previous[0x48:], childID)
+			}
+			previous = dir[childID]
+		}
+		return id
+	}
+	add(&cfbNode{name: "Root Entry", children: root}, cfbRoot)
+
+	sectors := func(n int) int { return (n + 511) / 512 }
+	dirSectors := sectors(len(dir) * cfbDirSize)
+	miniFATSectors := sectors(len(miniFAT) * 4)
+	streamSectors := sectors(len(miniStream))
+
+	fat := []uint32{0xFFFFFFFD}
+	region := func(count int) uint32 {
+		start := uint32(len(fat))
+		for i := 0; i < count; i++ {
+			fat = append(fat, uint32(len(fat))+1)
+		}
+		fat[len(fat)-1] = cfbEndOfChain
+		return start
+	}
+	dirStart := region(dirSectors)
+	miniFATStart := region(miniFATSectors)
+	streamStart := region(streamSectors)
+	le.PutUint32(dir[0][0x74:], streamStart)
+	le.PutUint32(dir[0][0x78:], uint32(len(miniStream)))
+
+	header := make([]byte, 512)
+	copy(header, cfbSignature)
+	le.PutUint16(header[0x18:], 0x3E)
+	le.PutUint16(header[0x1A:], 3)
+	le.PutUint16(header[0x1C:], 0xFFFE)
+	le.PutUint16(header[0x1E:], 9)
+	le.PutUint16(header[0x20:], 6)
+	le.PutUint32(header[0x2C:], 1)
+	le.PutUint32(header[0x30:], dirStart)
+	le.PutUint32(header[0x38:], 4096)
+	le.PutUint32(header[0x3C:], miniFATStart)
+	le.PutUint32(header[0x40:], uint32(miniFATSectors))
+	le.PutUint32(header[0x44:], cfbEndOfChain)
+	for i := 0; i < 109; i++ {
+		le.PutUint32(header[0x4C+4*i:], cfbNoStream)
+	}
+	le.PutUint32(header[0x4C:], 0)
+
+	pad := func(b []byte, n int) []byte { return append(b, make([]byte, n*512-len(b))...) }
+	fatSector := make([]byte, 512)
+	for i := range fatSector {
+		fatSector[i] = 0xFF
+	}
+	for i, next := range fat {
+		le.PutUint32(fatSector[4*i:], next)
+	}
+	var dirBytes, miniFATBytes []byte
+	for _, entry := range dir {
+		dirBytes = append(dirBytes, entry...)
+	}
+	for _, next := range miniFAT {
+		miniFATBytes = le.AppendUint32(miniFATBytes, next)
+	}
+
+	out := append(header, fatSector...)
+	out = append(out, pad(dirBytes, dirSectors)...)
+	out = append(out, pad(miniFATBytes, miniFATSectors)...)
+	return append(out, pad(miniStream, streamSectors)...)
+}
+
+func unicodeProp(s string) []byte {
+	var out []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		out = binary.LittleEndian.AppendUint16(out, u)
+	}
+	return out
+}
+
+func TestParseOutlookReadsPropertiesAndAttachments(t *testing.T) {
+	content := buildCompoundFile([]*cfbNode{
+		{name: "__properties_version1.0", data: make([]byte, 32)},
+		{name: "__substg1.0_0037001F", data: unicodeProp("E-ticket Garuda GA 404")},
+		{name: "__substg1.0_0C1A001F", data: unicodeProp("Garuda Indonesia")},
+		{name: "__substg1.0_5D01001F", data: unicodeProp("noreply@garuda.example")},
+		{name: "__substg1.0_1000001F", data: unicodeProp("Jakarta CGK - Denpasar DPS\nTotal IDR 2.150.000")},
+		{name: "__substg1.0_007D001F", data: unicodeProp("Date: Tue, 04 Mar 2025 10:00:00 +0700\r\nSubject: E-ticket")},
+		{name: "__attach_version1.0_#00000001", children: []*cfbNode{
+			{name: "__substg1.0_3707001F", data: unicodeProp("boarding.png")},
+			{name: "__substg1.0_37010102", data: []byte("\x89PNG\r\n\x1a\n")},
+		}},
+		{name: "__attach_version1.0_#00000000", children: []*cfbNode{
+			{name: "__substg1.0_3707001F", data: unicodeProp("eticket.pdf")},
+			{name: "__substg1.0_37010102", data: []byte("%PDF-1.7\n" + strings.Repeat("x", 200))},
+		}},
+	})
+
+	m, err := ParseOutlook(content)
+	if err != nil {
+		t.Fatalf("ParseOutlook() error = %v", err)
+	}
+	if m.Subject != "E-ticket Garuda GA 404" || m.From != "Garuda Indonesia <noreply@garuda.example>" || m.Date.IsZero() {
+		t.Errorf("headers = %q, %q, %v", m.Subject, m.From, m.Date)
+	}
+	if !strings.Contains(m.Body(), "Total IDR 2.150.000") {
+		t.Errorf("body = %q", m.Body())
+	}
+	if len(m.Attachments) != 2 || m.Attachments[0].Filename != "eticket.pdf" || m.Attachments[1].Filename != "boarding.png" {
+		t.Fatalf("attachments = %+v", m.Attachments)
+	}
+	if len(m.Attachments[0].Content) != 209 {
+		t.Errorf("eticket.pdf has %d bytes, want 209", len(m.Attachments[0].Content))
+	}
+
+	if _, err := ParseOutlook([]byte("not an outlook message")); err == nil {
+		t.Error("ParseOutlook() accepted a file that is not a compound file")
+	}
+}
+
+func TestParseOutlookRejectsLoopingDIFAT(t *testing.T) {
+	content := buildCompoundFile([]*cfbNode{{name: "__properties_version1.0", data: make([]byte, 32)}})
+
+	// A DIFAT sector listing no FAT sectors whose next DIFAT sector is itself
+	le := binary.LittleEndian
+	self := uint32(len(content)/512 - 1)
+	difat := bytes.Repeat([]byte{0xFF}, 512)
+	le.PutUint32(difat[508:], self)
+	content = append(content, difat...)
+
+	for _, count := range []uint32{self + 1, 0xFFFFFFFF} {
+		le.PutUint32(content[0x44:], self)
+		le.PutUint32(content[0x48:], count)
+		if _, err := ParseOutlook(content); err == nil {
+			t.Errorf("ParseOutlook() accepted a DIFAT chain looping %d times", count)
+		}
+	}
+}
+
+func TestParseOutlookRejectsRepeatedAndLoopingFATSectors(t *testing.T) {
+	le := binary.LittleEndian
+	base := buildCompoundFile([]*cfbNode{{name: "__properties_version1.0", data: make([]byte, 32)}})
+
+	// The directory starts at sector 1; its FAT entry points back at itself
+	looping := bytes.Clone(base)
+	le.PutUint32(looping[512+4:], 1)
+
+	// Every header entry lists FAT sector 0, which would multiply the FAT
+	repeated := bytes.Clone(looping)
+	for i := 0; i < 109; i++ {
+		le.PutUint32(repeated[0x4C+4*i:], 0)
+	}
+
+	for name, content := range map[string][]byte{"self-referencing FAT": looping, "repeated FAT sector": repeated} {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		_, err := ParseOutlook(content)
+		runtime.ReadMemStats(&after)
+
+		if err == nil {
+			t.Errorf("%s: ParseOutlook() accepted a corrupt file", name)
+		}
+		if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+			t.Errorf("%s: ParseOutlook() allocated %d bytes for a %d byte file", name, allocated, len(content))
+		}
+	}
+}
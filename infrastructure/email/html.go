@@ -0,0 +1,87 @@
+package email
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// blockTags start a new line of text; cellTags are separated on their line
+var (
+	blockTags = map[string]bool{
+		"address": true, "article": true, "blockquote": true, "br": true, "dd": true, "div": true,
+		"dl": true, "dt": true, "footer": true, "h1": true, "h2": true, "h3": true, "h4": true,
+		"h5": true, "h6": true, "header": true, "hr": true, "li": true, "ol": true, "p": true,
+		"pre": true, "section": true, "table": true, "tbody": true, "thead": true, "tr": true, "ul": true,
+	}
+	cellTags = map[string]bool{"td": true, "th": true}
+	// skippedTags hold no visible text
+	skippedTags = map[string]bool{"head": true, "script": true, "style": true, "title": true}
+)
+
+var (
+	spaceRegex     = regexp.MustCompile(`[ \t\f\v\p{Zs}]+`)
+	blankLineRegex = regexp.MustCompile(`\n{3,}`)
+)
+
+// htmlToText turns an HTML body into plain text, keeping one table row per
+// line with its cells separated by " | " so amounts stay next to their labels
+func htmlToText(source string) string {
+	if strings.TrimSpace(source) == "" {
+		return ""
+	}
+
+	var b strings.Builder
+	tokenizer := html.NewTokenizer(strings.NewReader(source))
+	skipping := ""
+	cellOpen := false
+
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return tidyText(b.String())
+		case html.TextToken:
+			if skipping == "" {
+				b.WriteString(spaceRegex.ReplaceAllString(strings.ReplaceAll(string(tokenizer.Text()), "\n", " "), " "))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := tokenizer.TagName()
+			tag := string(name)
+			switch {
+			case skippedTags[tag]:
+				if skipping == "" {
+					skipping = tag
+				}
+			case blockTags[tag]:
+				b.WriteString("\n")
+				cellOpen = false
+			case cellTags[tag]:
+				if cellOpen {
+					b.WriteString(" | ")
+				}
+				cellOpen = true
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			tag := string(name)
+			switch {
+			case tag == skipping:
+				skipping = ""
+			case blockTags[tag]:
+				b.WriteString("\n")
+				cellOpen = false
+			}
+		}
+	}
+}
+
+// tidyText trims every line and drops runs of blank lines
+func tidyText(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(spaceRegex.ReplaceAllString(line, " "))
+		lines[i] = strings.Trim(line, "| ")
+	}
+	return strings.TrimSpace(blankLineRegex.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
@@ -0,0 +1,255 @@
+// Package email reads booking confirmations sent as emails, either MIME
+// messages (.eml) or Outlook messages (.msg), into their body and attachments.
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// maxDepth bounds how deeply multipart bodies may nest
+const maxDepth = 10
+
+// Message is an email read for extraction
+type Message struct {
+	Subject string
+	From    string
+	// Date is when the message was sent; zero when it does not say
+	Date time.Time
+	// Text and HTML are the plain and HTML bodies, either of which may be empty
+	Text string
+	HTML string
+	// Attachments are the attached files, in order
+	Attachments []Attachment
+}
+
+// Attachment is a file attached to an email
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Content     []byte
+	// Inline is set for images shown in the HTML body, such as logos
+	Inline bool
+}
+
+// Parse reads a MIME message (.eml)
+func Parse(content []byte) (*Message, error) {
+	raw, err := mail.ReadMessage(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("not a readable email: %w", err)
+	}
+	if raw.Header.Get("From") == "" && raw.Header.Get("Subject") == "" && raw.Header.Get("Content-Type") == "" {
+		return nil, errors.New("not a readable email: no From, Subject or Content-Type header")
+	}
+
+	m := &Message{
+		Subject: decodeHeader(raw.Header.Get("Subject")),
+		From:    decodeAddress(raw.Header.Get("From")),
+	}
+	if date, err := raw.Header.Date(); err == nil {
+		m.Date = date
+	}
+
+	var contentIDs []string
+	if err := m.readPart(textproto.MIMEHeader(raw.Header), raw.Body, 0, &contentIDs); err != nil {
+		return nil, err
+	}
+	m.markInline(contentIDs)
+	return m, nil
+}
+
+// readPart walks one MIME part, keeping the first plain and HTML bodies and
+// collecting everything else as attachments. contentIDs follows the
+// attachments, holding the Content-ID of each.
+func (m *Message) readPart(header textproto.MIMEHeader, body io.Reader, depth int, contentIDs *[]string) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+	disposition, dispositionParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if depth >= maxDepth {
+			return errors.New("email parts are nested too deeply")
+		}
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("cannot read email part: %w", err)
+			}
+			if err := m.readPart(part.Header, part, depth+1, contentIDs); err != nil {
+				return err
+			}
+		}
+	}
+
+	content, err := io.ReadAll(transferDecoder(header.Get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return fmt.Errorf("cannot decode email part: %w", err)
+	}
+
+	filename := decodeHeader(dispositionParams["filename"])
+	if filename == "" {
+		filename = decodeHeader(params["name"])
+	}
+
+	isBody := strings.HasPrefix(mediaType, "text/") && disposition != "attachment" && filename == ""
+	switch {
+	case isBody && mediaType == "text/html" && m.HTML == "":
+		m.HTML = decodeCharset(content, params["charset"])
+	case isBody && mediaType == "text/plain" && m.Text == "":
+		m.Text = decodeCharset(content, params["charset"])
+	case isBody:
+		// Further bodies, e.g. calendar invitations, carry no receipts
+	default:
+		if filename == "" {
+			filename = fmt.Sprintf("attachment-%d%s", len(m.Attachments)+1, extensionFor(mediaType))
+		}
+		m.Attachments = append(m.Attachments, Attachment{
+			Filename:    path.Base(strings.ReplaceAll(filename, `\`, "/")),
+			ContentType: mediaType,
+			Content:     content,
+		})
+		*contentIDs = append(*contentIDs, strings.Trim(header.Get("Content-ID"), "<> "))
+	}
+	return nil
+}
+
+// markInline flags attachments the HTML body shows by their Content-ID
+func (m *Message) markInline(contentIDs []string) {
+	for i, id := range contentIDs {
+		if id != "" && strings.Contains(m.HTML, "cid:"+id) {
+			m.Attachments[i].Inline = true
+		}
+	}
+}
+
+// Body returns the text of the message for extraction: the HTML body turned
+// into text, or the plain body when there is no HTML, below the subject,
+// sender and date. It is empty when the message has no body.
+func (m *Message) Body() string {
+	body := strings.TrimSpace(htmlToText(m.HTML))
+	if body == "" {
+		body = strings.TrimSpace(m.Text)
+	}
+	if body == "" {
+		return ""
+	}
+
+	var b strings.Builder
+	if m.Subject != "" {
+		fmt.Fprintf(&b, "Subject: %s\n", m.Subject)
+	}
+	if m.From != "" {
+		fmt.Fprintf(&b, "From: %s\n", m.From)
+	}
+	if !m.Date.IsZero() {
+		fmt.Fprintf(&b, "Date: %s\n", m.Date.Format(time.RFC1123Z))
+	}
+	b.WriteString("\n")
+	b.WriteString(body)
+	b.WriteString("\n")
+	return b.String()
+}
+
+func transferDecoder(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		// The decoder skips the line breaks of wrapped base64
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
+
+// decodeCharset converts text in charset to UTF-8; unknown charsets are kept as they are
+func decodeCharset(content []byte, charset string) string {
+	charset = strings.ToLower(strings.TrimSpace(charset))
+	if charset == "" || charset == "utf-8" || charset == "us-ascii" {
+		return string(content)
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return string(content)
+	}
+	decoded, err := enc.NewDecoder().Bytes(content)
+	if err != nil {
+		return string(content)
+	}
+	return string(decoded)
+}
+
+var wordDecoder = &mime.WordDecoder{
+	CharsetReader: func(charset string, input io.Reader) (io.Reader, error) {
+		enc, err := htmlindex.Get(charset)
+		if err != nil {
+			return nil, err
+		}
+		return enc.NewDecoder().Reader(input), nil
+	},
+}
+
+// decodeHeader decodes RFC 2047 encoded words, as in =?UTF-8?B?...?=
+func decodeHeader(value string) string {
+	decoded, err := wordDecoder.DecodeHeader(value)
+	if err != nil {
+		return strings.TrimSpace(value)
+	}
+	return strings.TrimSpace(decoded)
+}
+
+// decodeAddress formats a From header as "Name <address>"
+func decodeAddress(value string) string {
+	parser := mail.AddressParser{WordDecoder: wordDecoder}
+	address, err := parser.Parse(value)
+	if err != nil {
+		return decodeHeader(value)
+	}
+	if address.Name == "" {
+		return address.Address
+	}
+	return fmt.Sprintf("%s <%s>", address.Name, address.Address)
+}
+
+// extensionFor names attachments that came without a filename
+func extensionFor(mediaType string) string {
+	switch mediaType {
+	case "application/pdf":
+		return ".pdf"
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "message/rfc822":
+		return ".eml"
+	}
+	return ""
+}
+
+// textFromBytes reads text stored by Outlook in the message's code page, which
+// is almost always UTF-8 or Windows-1252
+func textFromBytes(content []byte) string {
+	if utf8.Valid(content) {
+		return string(content)
+	}
+	return decodeCharset(content, "windows-1252")
+}
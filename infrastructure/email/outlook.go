@@ -0,0 +1,153 @@
+package email
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/mail"
+	"path"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// MAPI properties read from Outlook messages
+const (
+	propSubject          = "0037"
+	propTransportHeaders = "007D"
+	propSenderName       = "0C1A"
+	propSenderEmail      = "0C1F"
+	propSenderSMTP       = "5D01"
+	propBody             = "1000"
+	propHTML             = "1013"
+	propAttachData       = "3701"
+	propAttachFilename   = "3704"
+	propAttachLongName   = "3707"
+	propAttachMime       = "370E"
+	propAttachContentID  = "3712"
+	propDisplayName      = "3001"
+)
+
+const attachmentPrefix = "__attach_version1.0_#"
+
+// ParseOutlook reads an Outlook message (.msg). Embedded Outlook messages
+// are not unpacked.
+func ParseOutlook(content []byte) (*Message, error) {
+	cf, err := parseCompoundFile(content)
+	if err != nil {
+		return nil, fmt.Errorf("not a readable Outlook message: %w", err)
+	}
+
+	root := outlookStorage{cf: cf, children: cf.children(0)}
+	if _, ok := root.children["__properties_version1.0"]; !ok {
+		return nil, fmt.Errorf("not a readable Outlook message: no message properties")
+	}
+
+	m := &Message{
+		Subject: root.text(propSubject),
+		Text:    root.text(propBody),
+		HTML:    root.text(propHTML),
+	}
+	if m.HTML == "" {
+		m.HTML = textFromBytes(root.binary(propHTML))
+	}
+
+	name, address := root.text(propSenderName), root.text(propSenderSMTP)
+	if address == "" && strings.Contains(root.text(propSenderEmail), "@") {
+		address = root.text(propSenderEmail)
+	}
+	switch {
+	case name != "" && address != "" && name != address:
+		m.From = fmt.Sprintf("%s <%s>", name, address)
+	case address != "":
+		m.From = address
+	default:
+		m.From = name
+	}
+
+	// The internet headers a received message keeps carry its date
+	if headers := root.text(propTransportHeaders); headers != "" {
+		if raw, err := mail.ReadMessage(strings.NewReader(headers + "\r\n\r\n")); err == nil {
+			if date, err := raw.Header.Date(); err == nil {
+				m.Date = date
+			}
+		}
+	}
+
+	// Attachment storages are numbered in the order the files were attached
+	var storages []string
+	for entryName, id := range root.children {
+		if strings.HasPrefix(entryName, attachmentPrefix) && cf.entries[id].kind == cfbStorage {
+			storages = append(storages, entryName)
+		}
+	}
+	sort.Strings(storages)
+
+	var contentIDs []string
+	for _, entryName := range storages {
+		id := root.children[entryName]
+		attachment := outlookStorage{cf: cf, children: cf.children(id)}
+		data := attachment.binary(propAttachData)
+		if data == nil {
+			// Embedded messages and OLE objects keep no file data
+			continue
+		}
+		filename := firstNonEmpty(attachment.text(propAttachLongName), attachment.text(propAttachFilename), attachment.text(propDisplayName))
+		if filename == "" {
+			filename = "attachment" + strings.TrimPrefix(entryName, attachmentPrefix)
+		}
+		m.Attachments = append(m.Attachments, Attachment{
+			Filename:    path.Base(strings.ReplaceAll(filename, `\`, "/")),
+			ContentType: attachment.text(propAttachMime),
+			Content:     data,
+		})
+		contentIDs = append(contentIDs, strings.Trim(attachment.text(propAttachContentID), "<> "))
+	}
+	m.markInline(contentIDs)
+	return m, nil
+}
+
+// outlookStorage reads the property streams of the message or of an attachment
+type outlookStorage struct {
+	cf       *compoundFile
+	children map[string]int
+}
+
+// text reads a string property, stored as UTF-16 (001F) or in the message's code page (001E)
+func (s outlookStorage) text(prop string) string {
+	if data, ok := s.stream(prop + "001F"); ok {
+		units := make([]uint16, 0, len(data)/2)
+		for i := 0; i+1 < len(data); i += 2 {
+			units = append(units, binary.LittleEndian.Uint16(data[i:]))
+		}
+		return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+	}
+	if data, ok := s.stream(prop + "001E"); ok {
+		return textFromBytes(bytes.TrimRight(data, "\x00"))
+	}
+	return ""
+}
+
+// binary reads a binary property (0102)
+func (s outlookStorage) binary(prop string) []byte {
+	data, _ := s.stream(prop + "0102")
+	return data
+}
+
+func (s outlookStorage) stream(name string) ([]byte, bool) {
+	id, ok := s.children["__substg1.0_"+name]
+	if !ok {
+		return nil, false
+	}
+	data, err := s.cf.stream(id)
+	return data, err == nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -5,9 +5,10 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
-	"time"
 
 	"sandbox/application/dto"
+	"sandbox/domain/date"
+	"sandbox/domain/sbm"
 	"sandbox/domain/transaction"
 	"sandbox/utils"
 
@@ -26,10 +27,15 @@ const (
 	payerId = "197101261997032002"
 )
 
-type Generator struct{}
+// Generator renders recap reports as Excel workbooks
+type Generator struct {
+	rates *sbm.Schedule
+}
 
-func NewGenerator() *Generator {
-	return &Generator{}
+// NewGenerator creates a generator that caps lodging at the SBM ceilings of
+// rates; nil reimburses lodging as claimed
+func NewGenerator(rates *sbm.Schedule) *Generator {
+	return &Generator{rates: rates}
 }
 
 func (g *Generator) generateTitle(f *excelize.File, sheetName string) error {
@@ -225,6 +231,13 @@ func (g *Generator) generateTableHeader(f *excelize.File, sheetName string) erro
 		}
 	}
 
+	if err := f.SetCellValue(sheetName, "X8", "Kelebihan Penginapan (Rp)"); err != nil {
+		return err
+	}
+	if err := f.SetCellValue(sheetName, "Y8", "Keterangan Penginapan"); err != nil {
+		return err
+	}
+
 	if err := f.SetCellValue(sheetName, "AA8", "No SPD"); err != nil {
 		return err
 	}
@@ -312,6 +325,15 @@ func (g *Generator) generateTableHeader(f *excelize.File, sheetName string) erro
 	if err := f.MergeCell(sheetName, "U8", "U10"); err != nil {
 		return err
 	}
+	if err := f.MergeCell(sheetName, "X8", "X10"); err != nil {
+		return err
+	}
+	if err := f.MergeCell(sheetName, "Y8", "Y10"); err != nil {
+		return err
+	}
+	if err := f.SetCellStyle(sheetName, "X8", "Y10", headerStyle); err != nil {
+		return err
+	}
 
 	if sheetName == "PEMANTAUAN REKAP RAMPUNG" {
 		if err := f.MergeCell(sheetName, "W8", "W10"); err != nil {
@@ -360,6 +382,7 @@ type PersonRecap struct {
 	UMPenginapanJmlHari     int32
 	UMPenginapanPerhari     int32
 	UMPenginapanJumlah      int32
+	UMPenginapanKelebihan   int32
 	UMTransportTiketPesawat int32
 	UMTransportAsal         int32
 	UMTransportDaerah       int32
@@ -373,6 +396,8 @@ type PersonRecap struct {
 	RPenginapanJmlHari     int32
 	RPenginapanPerhari     int32
 	RPenginapanJumlah      int32
+	RPenginapanKelebihan   int32
+	RPenginapanLumpSum     int32
 	RTransportTiketPesawat int32
 	RTransportAsal         int32
 	RTransportDaerah       int32
@@ -381,6 +406,19 @@ type PersonRecap struct {
 	RTotalDibayarkan       int32
 }
 
+// lodgingRate returns the per-night rate to show beside the nights and total of
+// a recap, or nil to leave it blank when the lines summed into them had
+// different rates, such as a capped hotel and a lump-sum night, so that no
+// single rate times the nights gives the total. A total that is not a whole
+// multiple of the nights still shows its rounded-down rate.
+func lodgingRate(perNight, nights, total int32) interface{} {
+	paid := int64(perNight) * int64(nights)
+	if nights > 0 && (paid > int64(total) || paid+int64(nights) <= int64(total)) {
+		return nil
+	}
+	return perNight
+}
+
 func (g *Generator) generateTableData(f *excelize.File, sheetName string, req dto.RecapReportDTO, currentRow int) (int, error) {
 	textStyle, err := f.NewStyle(&excelize.Style{
 		Alignment: &excelize.Alignment{
@@ -422,9 +460,6 @@ func (g *Generator) generateTableData(f *excelize.File, sheetName string, req dt
 	}
 
 	personData := make(map[string]*PersonRecap)
-	constUangHarianJmlHari := int32(2)
-	constUangHarianPerhari := int32(688000)
-	constUangHarianJumlah := constUangHarianJmlHari * constUangHarianPerhari
 
 	for _, assignee := range req.Assignees {
 		if assignee.EmployeeID == "" {
@@ -434,16 +469,13 @@ func (g *Generator) generateTableData(f *excelize.File, sheetName string, req dt
 		data, exists := personData[assignee.EmployeeID]
 		if !exists {
 			data = &PersonRecap{
-				Name:                assignee.Name,
-				NIP:                 assignee.EmployeeID,
-				Jabatan:             assignee.Position,
-				Gol:                 assignee.Rank,
-				Tujuan:              req.DestinationCity,
-				Tanggal:             req.DepartureDate,
-				NoSpd:               assignee.SpdNumber,
-				UMUangHarianJmlHari: constUangHarianJmlHari,
-				UMUangHarianPerhari: constUangHarianPerhari,
-				UMUangHarianJumlah:  constUangHarianJumlah,
+				Name:    assignee.Name,
+				NIP:     assignee.EmployeeID,
+				Jabatan: assignee.Position,
+				Gol:     assignee.Rank,
+				Tujuan:  req.DestinationCity,
+				Tanggal: req.DepartureDate.String(),
+				NoSpd:   assignee.SpdNumber,
 			}
 			personData[assignee.EmployeeID] = data
 		}
@@ -455,25 +487,45 @@ func (g *Generator) generateTableData(f *excelize.File, sheetName string, req dt
 			}
 			switch transaction.TransactionType(strings.ToLower(tx.Type)) {
 			case transaction.TransactionTypeAccommodation:
+				perNight, jumlah, kelebihan := tx.Amount, tx.Subtotal, int32(0)
+				if transaction.IsLumpSumLodging(tx) {
+					_, nights := transaction.LodgingStay(tx)
+					data.RPenginapanLumpSum += nights
+				}
+				if ceiling, ok := g.lodgingCeiling(req, assignee); ok {
+					var nights int32
+					perNight, nights = transaction.LodgingStay(tx)
+					if perNight > ceiling.PerNight {
+						var err error
+						if jumlah, kelebihan, err = ceiling.Cap(perNight, nights); err != nil {
+							return currentRow, fmt.Errorf("lodging of %s: %w", assignee.Name, err)
+						}
+						perNight = ceiling.PerNight
+					}
+				}
+
 				if tx.PaymentType == "uang muka" {
 					if tx.TotalNight != nil && *tx.TotalNight > 0 {
 						data.UMPenginapanJmlHari += *tx.TotalNight
 						data.RPenginapanJmlHari += *tx.TotalNight
 					}
-					if tx.Amount > 0 {
-						data.UMPenginapanPerhari = tx.Amount
-						data.RPenginapanPerhari = tx.Amount
+					if perNight > 0 {
+						data.UMPenginapanPerhari = perNight
+						data.RPenginapanPerhari = perNight
 					}
-					data.UMPenginapanJumlah += tx.Subtotal
-					data.RPenginapanJumlah += tx.Subtotal
+					data.UMPenginapanJumlah += jumlah
+					data.RPenginapanJumlah += jumlah
+					data.UMPenginapanKelebihan += kelebihan
+					data.RPenginapanKelebihan += kelebihan
 				} else {
 					if tx.TotalNight != nil && *tx.TotalNight > 0 {
 						data.RPenginapanJmlHari += *tx.TotalNight
 					}
-					if tx.Amount > 0 {
-						data.RPenginapanPerhari = tx.Amount
+					if perNight > 0 {
+						data.RPenginapanPerhari = perNight
 					}
-					data.RPenginapanJumlah += tx.Subtotal
+					data.RPenginapanJumlah += jumlah
+					data.RPenginapanKelebihan += kelebihan
 				}
 			case transaction.TransactionTypeTransport:
 				if tx.PaymentType == "uang muka" {
@@ -516,6 +568,16 @@ func (g *Generator) generateTableData(f *excelize.File, sheetName string, req dt
 
 					data.RTransportJumlah += tx.Subtotal
 				}
+			case transaction.TransactionTypeAllowance:
+				// Uang harian is advanced in full, so both recaps show the same amount
+				if tx.Amount > 0 {
+					data.UMUangHarianJmlHari += tx.Subtotal / tx.Amount
+					data.RUangHarianJmlHari += tx.Subtotal / tx.Amount
+					data.UMUangHarianPerhari = tx.Amount
+					data.RUangHarianPerhari = tx.Amount
+				}
+				data.UMUangHarianJumlah += tx.Subtotal
+				data.RUangHarianJumlah += tx.Subtotal
 			case transaction.TransactionTypeOther:
 				if tx.PaymentType == "uang muka" {
 					data.UMTotalDibayarkan += tx.Subtotal
@@ -572,22 +634,34 @@ func (g *Generator) generateTableData(f *excelize.File, sheetName string, req dt
 			if err := f.SetCellValue(sheetName, fmt.Sprintf("L%d", currentRow), data.UMPenginapanJmlHari); err != nil {
 				return currentRow, err
 			}
-			if err := f.SetCellValue(sheetName, fmt.Sprintf("N%d", currentRow), data.UMPenginapanPerhari); err != nil {
+			if err := f.SetCellValue(sheetName, fmt.Sprintf("N%d", currentRow), lodgingRate(data.UMPenginapanPerhari, data.UMPenginapanJmlHari, data.UMPenginapanJumlah)); err != nil {
 				return currentRow, err
 			}
 			if err := f.SetCellValue(sheetName, fmt.Sprintf("O%d", currentRow), data.UMPenginapanJumlah); err != nil {
 				return currentRow, err
 			}
+			if err := f.SetCellValue(sheetName, fmt.Sprintf("X%d", currentRow), data.UMPenginapanKelebihan); err != nil {
+				return currentRow, err
+			}
 		} else {
 			if err := f.SetCellValue(sheetName, fmt.Sprintf("L%d", currentRow), data.RPenginapanJmlHari); err != nil {
 				return currentRow, err
 			}
-			if err := f.SetCellValue(sheetName, fmt.Sprintf("N%d", currentRow), data.RPenginapanPerhari); err != nil {
+			if err := f.SetCellValue(sheetName, fmt.Sprintf("N%d", currentRow), lodgingRate(data.RPenginapanPerhari, data.RPenginapanJmlHari, data.RPenginapanJumlah)); err != nil {
 				return currentRow, err
 			}
 			if err := f.SetCellValue(sheetName, fmt.Sprintf("O%d", currentRow), data.RPenginapanJumlah); err != nil {
 				return currentRow, err
 			}
+			if err := f.SetCellValue(sheetName, fmt.Sprintf("X%d", currentRow), data.RPenginapanKelebihan); err != nil {
+				return currentRow, err
+			}
+			if data.RPenginapanLumpSum > 0 {
+				note := fmt.Sprintf("%d malam 30%% dari satuan biaya, tidak menginap di hotel", data.RPenginapanLumpSum)
+				if err := f.SetCellValue(sheetName, fmt.Sprintf("Y%d", currentRow), note); err != nil {
+					return currentRow, err
+				}
+			}
 		}
 
 		if sheetName == "PEMANTAUAN REKAP RAMPUNG" {
@@ -675,6 +749,12 @@ func (g *Generator) generateTableData(f *excelize.File, sheetName string, req dt
 			}
 
 		}
+		if err := f.SetCellStyle(sheetName, fmt.Sprintf("X%d", currentRow), fmt.Sprintf("X%d", currentRow), numberStyle); err != nil {
+			return currentRow, err
+		}
+		if err := f.SetCellStyle(sheetName, fmt.Sprintf("Y%d", currentRow), fmt.Sprintf("Y%d", currentRow), textStyle); err != nil {
+			return currentRow, err
+		}
 
 		if err := f.SetRowHeight(sheetName, currentRow, 28); err != nil {
 			return currentRow, err
@@ -686,6 +766,20 @@ func (g *Generator) generateTableData(f *excelize.File, sheetName string, req dt
 	return currentRow, nil
 }
 
+// lodgingCeiling is the SBM lodging ceiling of assignee on the trip of req.
+// Lodging is not capped when there are no rates or the ceiling is unknown.
+func (g *Generator) lodgingCeiling(req dto.RecapReportDTO, assignee dto.AssigneeDTO) (sbm.LodgingCeiling, bool) {
+	if g.rates == nil {
+		return sbm.LodgingCeiling{}, false
+	}
+	start := req.DepartureDate
+	if start.IsZero() {
+		start = req.StartDate
+	}
+	ceiling, err := g.rates.ForDate(start).LodgingCeiling(req.DestinationCity, assignee.Rank, assignee.Position)
+	return ceiling, err == nil
+}
+
 func (g *Generator) generateSummaryRow(f *excelize.File, sheetName string, currentRow int) error {
 	summaryStyle, _ := f.NewStyle(&excelize.Style{
 		Alignment: &excelize.Alignment{
@@ -801,6 +895,12 @@ func (g *Generator) generateSummaryRow(f *excelize.File, sheetName string, curre
 		if err := f.SetCellFormula(sheetName, fmt.Sprintf("W%d", totalRow+3), fmt.Sprintf("=SUM(W11:W%d)", totalRow-1)); err != nil {
 			return err
 		}
+		if err := f.SetCellFormula(sheetName, fmt.Sprintf("X%d", totalRow+1), fmt.Sprintf("=SUM(X11:X%d)", totalRow-1)); err != nil {
+			return err
+		}
+		if err := f.SetCellStyle(sheetName, fmt.Sprintf("X%d", totalRow+1), fmt.Sprintf("X%d", totalRow+1), summaryNumberStyle); err != nil {
+			return err
+		}
 
 		if err := f.SetCellFormula(sheetName, fmt.Sprintf("K%d", totalRow+3), fmt.Sprintf("=K%d-K%d", totalRow+1, totalRow+2)); err != nil {
 			return err
@@ -870,6 +970,12 @@ func (g *Generator) generateSummaryRow(f *excelize.File, sheetName string, curre
 		if err := f.SetCellFormula(sheetName, fmt.Sprintf("U%d", totalRow), fmt.Sprintf("=SUM(U11:U%d)", totalRow-1)); err != nil {
 			return err
 		}
+		if err := f.SetCellFormula(sheetName, fmt.Sprintf("X%d", totalRow), fmt.Sprintf("=SUM(X11:X%d)", totalRow-1)); err != nil {
+			return err
+		}
+		if err := f.SetCellStyle(sheetName, fmt.Sprintf("X%d", totalRow), fmt.Sprintf("X%d", totalRow), summaryNumberStyle); err != nil {
+			return err
+		}
 
 		if err := f.SetCellStyle(sheetName, fmt.Sprintf("A%d", totalRow), fmt.Sprintf("U%d", totalRow), summaryStyle); err != nil {
 			return err
@@ -924,7 +1030,7 @@ func (g *Generator) generateSignatureRow(f *excelize.File, sheetName string, cur
 		return err
 	}
 
-	currentDate := time.Now().Format("2 January 2006")
+	currentDate := date.Today().String()
 	if err := f.SetCellValue(sheetName, fmt.Sprintf("D%d", totalRow), fmt.Sprintf("Tanggal: %s", currentDate)); err != nil {
 		return err
 	}
@@ -1085,6 +1191,12 @@ func (g *Generator) setColumnWidths(f *excelize.File, sheetName string) error {
 	if err := f.SetColWidth(sheetName, "U", "U", 20); err != nil {
 		return err
 	}
+	if err := f.SetColWidth(sheetName, "X", "X", 20); err != nil {
+		return err
+	}
+	if err := f.SetColWidth(sheetName, "Y", "Y", 45); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -1226,7 +1338,7 @@ func (g *Generator) generateKw(f *excelize.File, sheetName string, req dto.Recap
 	if err := f.SetCellValue(sheetName, "F8", ":"); err != nil {
 		return err
 	}
-	if err := f.SetCellValue(sheetName, "G8", req.StartDate); err != nil {
+	if err := f.SetCellValue(sheetName, "G8", req.StartDate.String()); err != nil {
 		return err
 	}
 
@@ -1423,8 +1535,15 @@ func (g *Generator) generateKw(f *excelize.File, sheetName string, req dto.Recap
 	if err := f.SetCellValue(sheetName, "A21", "3"); err != nil {
 		return err
 	}
-	if err := f.SetCellValue(sheetName, "C21", "Biaya Penginapan : "); err != nil {
-		return err
+	if sheetName == "KW RAMPUNG" {
+		// Nights without a hotel receipt are paid as a lump sum, noted in column Y of the rekap
+		if err := f.SetCellFormula(sheetName, "C21", `="Biaya Penginapan"&IF(T(VLOOKUP($T$1,'PEMANTAUAN REKAP RAMPUNG'!$A$11:$AC$100,25,FALSE))="",""," ("&VLOOKUP($T$1,'PEMANTAUAN REKAP RAMPUNG'!$A$11:$AC$100,25,FALSE)&")")&" : "`); err != nil {
+			return err
+		}
+	} else {
+		if err := f.SetCellValue(sheetName, "C21", "Biaya Penginapan : "); err != nil {
+			return err
+		}
 	}
 
 	if sheetName == "KW RAMPUNG" {
@@ -1449,8 +1568,14 @@ func (g *Generator) generateKw(f *excelize.File, sheetName string, req dto.Recap
 	if err := f.SetCellValue(sheetName, "F22", "Rp."); err != nil {
 		return err
 	}
-	if err := f.SetCellFormula(sheetName, "H22", "=VLOOKUP($T$1,'PEMANTAUAN REKAP UANG MUKA'!$A$11:$AC$100,14,FALSE)"); err != nil {
-		return err
+	if sheetName == "KW RAMPUNG" {
+		if err := f.SetCellFormula(sheetName, "H22", "=VLOOKUP($T$1,'PEMANTAUAN REKAP RAMPUNG'!$A$11:$AC$100,14,FALSE)"); err != nil {
+			return err
+		}
+	} else {
+		if err := f.SetCellFormula(sheetName, "H22", "=VLOOKUP($T$1,'PEMANTAUAN REKAP UANG MUKA'!$A$11:$AC$100,14,FALSE)"); err != nil {
+			return err
+		}
 	}
 
 	if err := f.SetCellStyle(sheetName, "H22", "H22", currencyStyle); err != nil {
@@ -1459,8 +1584,14 @@ func (g *Generator) generateKw(f *excelize.File, sheetName string, req dto.Recap
 	if err := f.SetCellValue(sheetName, "L22", "Rp."); err != nil {
 		return err
 	}
-	if err := f.SetCellFormula(sheetName, "M22", "=VLOOKUP($T$1,'PEMANTAUAN REKAP UANG MUKA'!$A$11:$AC$100,15,FALSE)"); err != nil {
-		return err
+	if sheetName == "KW RAMPUNG" {
+		if err := f.SetCellFormula(sheetName, "M22", "=VLOOKUP($T$1,'PEMANTAUAN REKAP RAMPUNG'!$A$11:$AC$100,15,FALSE)"); err != nil {
+			return err
+		}
+	} else {
+		if err := f.SetCellFormula(sheetName, "M22", "=VLOOKUP($T$1,'PEMANTAUAN REKAP UANG MUKA'!$A$11:$AC$100,15,FALSE)"); err != nil {
+			return err
+		}
 	}
 
 	if err := f.SetCellStyle(sheetName, "M22", "M22", currencyStyle); err != nil {
@@ -1573,7 +1704,7 @@ func (g *Generator) generateKw(f *excelize.File, sheetName string, req dto.Recap
 		return err
 	}
 
-	if err := f.SetCellValue(sheetName, "O27", fmt.Sprintf("Jakarta, %s", req.ReceiptSignatureDate)); err != nil {
+	if err := f.SetCellValue(sheetName, "O27", fmt.Sprintf("Jakarta, %s", req.ReceiptSignatureDate.String())); err != nil {
 		return err
 	}
 
@@ -1801,7 +1932,7 @@ func (g *Generator) generateKw(f *excelize.File, sheetName string, req dto.Recap
 	if err := f.SetCellFormula(sheetName, "A61", `="Berdasarkan Surat Perjalanan Dinas ( SPD ) Nomor "&VLOOKUP($T$1,'PEMANTAUAN REKAP UANG MUKA'!$A$11:$AJ$100,22,FALSE)`); err != nil {
 		return err
 	}
-	if err := f.SetCellValue(sheetName, "N61", fmt.Sprintf("tanggal %s", req.SpdDate)); err != nil {
+	if err := f.SetCellValue(sheetName, "N61", fmt.Sprintf("tanggal %s", req.SpdDate.String())); err != nil {
 		return err
 	}
 	if err := f.SetCellValue(sheetName, "A62", "dengan ini kami menyatakan dengan sesungguhnya bahwa :"); err != nil {
@@ -1912,7 +2043,7 @@ func (g *Generator) generateKw(f *excelize.File, sheetName string, req dto.Recap
 	if err := f.SetCellValue(sheetName, "A83", "Mengetahui / Menyetujui"); err != nil {
 		return err
 	}
-	if err := f.SetCellValue(sheetName, "N83", fmt.Sprintf("Jakarta, %s", req.ReceiptSignatureDate)); err != nil {
+	if err := f.SetCellValue(sheetName, "N83", fmt.Sprintf("Jakarta, %s", req.ReceiptSignatureDate.String())); err != nil {
 		return err
 	}
 	if err := f.SetCellValue(sheetName, "N84", "Pelaksana SPD,"); err != nil {
@@ -2300,7 +2431,7 @@ func (g *Generator) generateSppd(f *excelize.File, sheetName string, req dto.Rec
 	if err := f.SetCellValue(sheetName, "D36", "b."); err != nil {
 		return err
 	}
-	if err := f.SetCellValue(sheetName, "E36", req.DepartureDate); err != nil {
+	if err := f.SetCellValue(sheetName, "E36", req.DepartureDate.String()); err != nil {
 		return err
 	}
 
@@ -2313,7 +2444,7 @@ func (g *Generator) generateSppd(f *excelize.File, sheetName string, req dto.Rec
 	if err := f.SetCellValue(sheetName, "D37", "c."); err != nil {
 		return err
 	}
-	if err := f.SetCellValue(sheetName, "E37", req.ReturnDate); err != nil {
+	if err := f.SetCellValue(sheetName, "E37", req.ReturnDate.String()); err != nil {
 		return err
 	}
 	if err := f.SetCellValue(sheetName, "C38", " tempat baru *)"); err != nil {
@@ -2409,7 +2540,7 @@ func (g *Generator) generateSppd(f *excelize.File, sheetName string, req dto.Rec
 	if err := f.SetCellValue(sheetName, "G56", ":"); err != nil {
 		return err
 	}
-	if err := f.SetCellValue(sheetName, "H56", req.ReceiptSignatureDate); err != nil {
+	if err := f.SetCellValue(sheetName, "H56", req.ReceiptSignatureDate.String()); err != nil {
 		return err
 	}
 	if err := f.SetCellValue(sheetName, "F58", "Pejabat Pembuat Komitmen II"); err != nil {
@@ -0,0 +1,59 @@
+package excel
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"sandbox/application/dto"
+	"sandbox/domain/date"
+	domainErrors "sandbox/domain/errors"
+	"sandbox/domain/sbm"
+)
+
+func TestLodgingRateIsBlankForMixedRates(t *testing.T) {
+	tests := []struct {
+		name                    string
+		perNight, nights, total int32
+		want                    interface{}
+	}{
+		{"single hotel", 725000, 2, 1450000, int32(725000)},
+		{"total not a multiple of the nights", 500000, 2, 1000001, int32(500000)},
+		// A hotel capped at 1,000,000 for 2 nights, then 1 lump-sum night at 300,000
+		{"capped hotel and lump-sum night", 300000, 3, 2300000, nil},
+		{"no nights", 0, 0, 0, int32(0)},
+	}
+	for _, tt := range tests {
+		if got := lodgingRate(tt.perNight, tt.nights, tt.total); got != tt.want {
+			t.Errorf("%s: lodgingRate() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateRecapExcelRejectsLodgingThatOverflows(t *testing.T) {
+	rates, err := sbm.Default()
+	if err != nil {
+		t.Fatalf("failed to load the embedded tables: %v", err)
+	}
+	nights := int32(100000)
+	req := dto.RecapReportDTO{
+		DestinationCity: "Surabaya",
+		DepartureDate:   date.New(2025, time.October, 25),
+		Assignees: []dto.AssigneeDTO{{
+			Name:       "Budi",
+			EmployeeID: "198001012005011001",
+			Rank:       "III/b",
+			Transactions: []dto.TransactionDTO{{
+				Name:       "Budi",
+				Type:       "accommodation",
+				Amount:     2000000,
+				Subtotal:   2000000,
+				TotalNight: &nights,
+			}},
+		}},
+	}
+
+	if _, err := NewGenerator(rates).GenerateRecapExcel(req); !errors.Is(err, domainErrors.ErrValidation) {
+		t.Errorf("expected a validation error for 100.000 nights, got %v", err)
+	}
+}
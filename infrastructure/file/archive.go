@@ -0,0 +1,143 @@
+package file
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// archiveJunk are the metadata files archivers add, skipped when unpacking
+var archiveJunk = map[string]bool{
+	".DS_Store":   true,
+	"Thumbs.db":   true,
+	"desktop.ini": true,
+}
+
+// isArchiveName reports whether filename names a ZIP archive
+func isArchiveName(filename string) bool {
+	return strings.EqualFold(path.Ext(filename), ".zip")
+}
+
+// isArchive reports whether content, of which the first bytes will do, is a
+// ZIP archive. Office documents are ZIP files too, so only uploads named .zip
+// are unpacked.
+func isArchive(filename string, content []byte) bool {
+	return isArchiveName(filename) &&
+		(bytes.HasPrefix(content, []byte("PK\x03\x04")) || bytes.HasPrefix(content, []byte("PK\x05\x06")))
+}
+
+// expandArchive unpacks a ZIP upload, folders included, and processes every
+// document in it like a separate upload. Each document is named by its path
+// in the archive under the archive's own name, e.g. trip.zip/hotel/folio.pdf.
+func (p *Processor) expandArchive(archiveName string, archive io.ReaderAt, size int64, opts UploadOptions) ([]*ProcessedFile, []Rejection) {
+	reject := func(reason string) ([]*ProcessedFile, []Rejection) {
+		return nil, []Rejection{{Filename: archiveName, Reason: reason}}
+	}
+
+	// Entry paths are checked one by one below, so an insecure path only
+	// rejects that entry rather than the whole archive
+	reader, err := zip.NewReader(archive, size)
+	if err != nil && !errors.Is(err, zip.ErrInsecurePath) {
+		return reject(fmt.Sprintf("not a readable ZIP archive: %v", err))
+	}
+
+	var entries []*zip.File
+	for _, entry := range reader.File {
+		if entry.FileInfo().IsDir() || isArchiveJunk(entry.Name) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		return reject("archive holds no files")
+	}
+	if len(entries) > p.limits.MaxArchiveEntries {
+		return reject(fmt.Sprintf("archive holds %d files, above the limit of %d", len(entries), p.limits.MaxArchiveEntries))
+	}
+
+	var processedFiles []*ProcessedFile
+	var rejections []Rejection
+	var unpacked int64
+
+	for _, entry := range entries {
+		entryPath, err := archiveEntryPath(entry.Name)
+		if err != nil {
+			rejections = append(rejections, Rejection{Filename: archiveName + "/" + entry.Name, Reason: err.Error()})
+			continue
+		}
+		filename := archiveName + "/" + entryPath
+
+		entryContent, err := p.readArchiveEntry(entry, entryPath)
+		if err != nil {
+			rejections = append(rejections, Rejection{Filename: filename, Reason: err.Error()})
+			continue
+		}
+
+		unpacked += int64(len(entryContent))
+		if unpacked > p.limits.MaxArchiveSize {
+			return reject(fmt.Sprintf("archive unpacks to more than the %.0f MB limit", float64(p.limits.MaxArchiveSize)/(1<<20)))
+		}
+
+		files, rejected := p.processDocument(filename, entryContent, opts)
+		processedFiles = append(processedFiles, files...)
+		rejections = append(rejections, rejected...)
+	}
+
+	return processedFiles, rejections
+}
+
+// readArchiveEntry decompresses one entry, never reading more than the per-file
+// limit whatever size the entry header claims
+func (p *Processor) readArchiveEntry(entry *zip.File, entryPath string) ([]byte, error) {
+	if isArchiveName(entryPath) {
+		return nil, errors.New("archives inside an archive are not unpacked")
+	}
+	if entry.Flags&0x1 != 0 {
+		return nil, errors.New("encrypted archive entries are not supported")
+	}
+	if entry.UncompressedSize64 > uint64(p.limits.MaxFileSize) {
+		return nil, sizeLimitError(int64(entry.UncompressedSize64), p.limits.MaxFileSize)
+	}
+
+	reader, err := entry.Open()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read archive entry: %w", err)
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(io.LimitReader(reader, p.limits.MaxFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read archive entry: %w", err)
+	}
+	if int64(len(content)) > p.limits.MaxFileSize {
+		return nil, fmt.Errorf("file unpacks to more than the %.0f MB limit", float64(p.limits.MaxFileSize)/(1<<20))
+	}
+	return content, nil
+}
+
+// archiveEntryPath cleans an entry name, refusing absolute paths and paths
+// that climb out of the archive (zip slip)
+func archiveEntryPath(name string) (string, error) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	if path.IsAbs(name) || (len(name) >= 2 && name[1] == ':') {
+		return "", errors.New("absolute paths are not allowed in an archive")
+	}
+
+	cleaned := path.Clean(name)
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", errors.New("path points outside the archive")
+	}
+	return cleaned, nil
+}
+
+// isArchiveJunk reports whether an entry is metadata added by the archiver,
+// such as macOS resource forks
+func isArchiveJunk(name string) bool {
+	name = strings.ReplaceAll(name, `\`, "/")
+	base := path.Base(name)
+	return strings.HasPrefix(name, "__MACOSX/") || archiveJunk[base] || strings.HasPrefix(base, "._")
+}
@@ -0,0 +1,56 @@
+package file
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/tiff"
+)
+
+// geminiMimeTypes are the formats sent to the LLM backends as they are;
+// anything else accepted is converted to PNG first. A backend that cannot
+// read one of them, as OpenAI-compatible servers cannot read HEIC, fails that
+// document with a reason instead.
+var geminiMimeTypes = map[string]bool{
+	mimePDF:  true,
+	mimePNG:  true,
+	mimeJPEG: true,
+	mimeWebP: true,
+	mimeHEIC: true,
+	mimeHEIF: true,
+}
+
+// convertibleMimeTypes decode the formats Gemini does not read. Only the
+// first frame of an animated GIF is kept.
+var convertibleMimeTypes = map[string]func(io.Reader) (image.Image, error){
+	mimeGIF:  gif.Decode,
+	mimeTIFF: tiff.Decode,
+}
+
+// toSupportedFormat returns content unchanged when Gemini reads its format,
+// and re-encodes it as PNG otherwise
+func toSupportedFormat(content []byte, mimeType string) ([]byte, string, error) {
+	if geminiMimeTypes[mimeType] {
+		return content, mimeType, nil
+	}
+
+	decode, ok := convertibleMimeTypes[mimeType]
+	if !ok {
+		return nil, "", fmt.Errorf("%s cannot be converted to a supported format", mimeType)
+	}
+
+	img, err := decodeImage(content, decode)
+	if err != nil {
+		return nil, "", fmt.Errorf("file looks like %s but cannot be decoded: %w", mimeType, err)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, "", fmt.Errorf("failed to convert %s to PNG: %w", mimeType, err)
+	}
+	return buf.Bytes(), mimePNG, nil
+}
@@ -0,0 +1,120 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"sandbox/infrastructure/email"
+)
+
+// maxEmailDepth bounds how many emails attached to emails are unpacked
+const maxEmailDepth = 3
+
+// EmailOrigin is the email a document was sent in
+type EmailOrigin struct {
+	Subject string
+	From    string
+}
+
+// isEmailName reports whether filename names a MIME (.eml) or Outlook (.msg) email
+func isEmailName(filename string) bool {
+	ext := strings.ToLower(path.Ext(filename))
+	return ext == ".eml" || ext == ".msg"
+}
+
+// parseEmail reads an email by its extension, checking an Outlook message
+// really is one since other Office files share its container format
+func parseEmail(filename string, content []byte) (*email.Message, error) {
+	if strings.EqualFold(path.Ext(filename), ".msg") {
+		if !email.IsCompoundFile(content) {
+			return nil, errors.New("not a readable Outlook message")
+		}
+		return email.ParseOutlook(content)
+	}
+	return email.Parse(content)
+}
+
+// expandEmail turns an email into documents: its body as text, headed by the
+// subject, sender and date, and every attachment as a separate document named
+// under the email's own name, e.g. booking.eml/invoice.pdf. Each document
+// keeps the subject and sender as its origin. Images shown in the body, such
+// as logos, are left out, as are attachments of a type that is not accepted,
+// each with a note on the first document.
+func (p *Processor) expandEmail(filename string, content []byte, opts UploadOptions, depth int) ([]*ProcessedFile, []Rejection) {
+	if len(content) == 0 {
+		return nil, []Rejection{{Filename: filename, Reason: "file is empty"}}
+	}
+	message, err := parseEmail(filename, content)
+	if err != nil {
+		return nil, []Rejection{{Filename: filename, Reason: err.Error()}}
+	}
+	if len(message.Attachments) > p.limits.MaxArchiveEntries {
+		return nil, []Rejection{{Filename: filename, Reason: fmt.Sprintf("email holds %d attachments, above the limit of %d",
+			len(message.Attachments), p.limits.MaxArchiveEntries)}}
+	}
+
+	origin := &EmailOrigin{Subject: message.Subject, From: message.From}
+	var processedFiles []*ProcessedFile
+	var rejections []Rejection
+	var notes []string
+
+	if body := message.Body(); body != "" {
+		steps := []string{"email body read as text"}
+		if strings.TrimSpace(message.HTML) != "" {
+			steps = []string{"email body converted from HTML to text"}
+		}
+		processedFiles = append(processedFiles, &ProcessedFile{
+			Content:       []byte(body),
+			Filename:      filename,
+			MimeType:      mimeText,
+			OriginalSize:  int64(len(content)),
+			Preprocessing: steps,
+		})
+	}
+
+	for _, attachment := range message.Attachments {
+		name := filename + "/" + attachment.Filename
+		switch {
+		case attachment.Inline:
+			notes = append(notes, fmt.Sprintf("skipped %s: image shown in the email body", attachment.Filename))
+			continue
+		case isEmailName(attachment.Filename) || attachment.ContentType == "message/rfc822":
+			if depth >= maxEmailDepth {
+				rejections = append(rejections, Rejection{Filename: name, Reason: "emails attached this deep are not unpacked"})
+				continue
+			}
+			if !isEmailName(name) {
+				name += ".eml"
+			}
+			files, rejected := p.expandEmail(name, attachment.Content, opts, depth+1)
+			processedFiles = append(processedFiles, files...)
+			rejections = append(rejections, rejected...)
+			continue
+		case len(attachment.Content) > 0 && !p.allowedMimeTypes[p.detectMimeType(attachment.Filename, attachment.Content)]:
+			notes = append(notes, fmt.Sprintf("skipped %s: not a PDF or image", attachment.Filename))
+			continue
+		}
+
+		processed, err := p.processContent(name, attachment.Content)
+		if err != nil {
+			rejections = append(rejections, Rejection{Filename: name, Reason: err.Error()})
+			continue
+		}
+		processedFiles = append(processedFiles, splitDocument(processed, opts.SplitPDF)...)
+	}
+
+	if len(processedFiles) == 0 && len(rejections) == 0 {
+		return nil, []Rejection{{Filename: filename, Reason: "email has no body text and no PDF or image attachments"}}
+	}
+	for _, processed := range processedFiles {
+		if processed.Email == nil {
+			processed.Email = origin
+		}
+	}
+	if len(processedFiles) > 0 {
+		processedFiles[0].Preprocessing = append(processedFiles[0].Preprocessing, notes...)
+	}
+	return processedFiles, rejections
+}
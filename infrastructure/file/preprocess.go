@@ -0,0 +1,173 @@
+package file
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// PreprocessOptions configures how photos are prepared before extraction.
+// Everything they send is base64-inlined into the LLM request, so large phone
+// photos are shrunk to what the model needs to read a receipt.
+type PreprocessOptions struct {
+	Enabled bool
+	// MaxDimension caps the longer side of an image, in pixels
+	MaxDimension int
+	// JPEGQuality is the quality, 1-100, images are re-encoded at
+	JPEGQuality int
+	// Grayscale drops colour, which receipts rarely need
+	Grayscale bool
+	// BoostContrast stretches the brightness range, helping faded thermal paper
+	BoostContrast bool
+}
+
+// preprocessableMimeTypes are the formats that can be decoded and re-encoded;
+// HEIC/HEIF and PDFs are sent as they are
+var preprocessableMimeTypes = map[string]bool{
+	mimeJPEG: true,
+	mimePNG:  true,
+	mimeWebP: true,
+}
+
+// maxDecodePixels bounds the images decoded in memory. A few kilobytes of
+// PNG can declare dimensions whose pixels would take gigabytes.
+const maxDecodePixels = 50 * 1000 * 1000
+
+// contrastClip is the share of the darkest and brightest pixels clipped when
+// stretching contrast, so a few specks do not pin the range
+const contrastClip = 0.01
+
+// preprocess turns an image upright, shrinks it and re-encodes it as JPEG,
+// returning the steps it applied. An image it cannot decode is returned
+// unchanged, as is one that re-encoding alone would only make larger.
+func (o PreprocessOptions) preprocess(content []byte, mimeType string) ([]byte, string, []string) {
+	if !o.Enabled || !preprocessableMimeTypes[mimeType] {
+		return content, mimeType, nil
+	}
+
+	img, err := decodeImage(content, func(r io.Reader) (image.Image, error) {
+		img, _, err := image.Decode(r)
+		return img, err
+	})
+	if err != nil {
+		return content, mimeType, nil
+	}
+
+	var steps []string
+	required := false
+
+	if mimeType == mimeJPEG {
+		if orientation := jpegOrientation(content); orientation != 1 {
+			img = applyOrientation(img, orientation)
+			steps = append(steps, fmt.Sprintf("turned upright (EXIF orientation %d)", orientation))
+			required = true
+		}
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if o.MaxDimension > 0 && max(width, height) > o.MaxDimension {
+		scale := float64(o.MaxDimension) / float64(max(width, height))
+		newWidth, newHeight := max(1, int(float64(width)*scale+0.5)), max(1, int(float64(height)*scale+0.5))
+		resized := image.NewRGBA(image.Rect(0, 0, newWidth, newHeight))
+		draw.BiLinear.Scale(resized, resized.Bounds(), img, bounds, draw.Src, nil)
+		img = resized
+		steps = append(steps, fmt.Sprintf("resized %dx%d to %dx%d", width, height, newWidth, newHeight))
+		required = true
+	}
+
+	rgba := flatten(img)
+	if o.Grayscale {
+		rgba = toGray(rgba)
+		steps = append(steps, "grayscale")
+		required = true
+	}
+	if o.BoostContrast && stretchContrast(rgba) {
+		steps = append(steps, "contrast boosted")
+		required = true
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, rgba, &jpeg.Options{Quality: o.JPEGQuality}); err != nil {
+		return content, mimeType, nil
+	}
+	if !required && buf.Len() >= len(content) {
+		return content, mimeType, nil
+	}
+	steps = append(steps, fmt.Sprintf("jpeg quality %d", o.JPEGQuality))
+	return buf.Bytes(), mimeJPEG, steps
+}
+
+// decodeImage decodes content with decode after checking from its header that
+// it has no more than maxDecodePixels pixels
+func decodeImage(content []byte, decode func(io.Reader) (image.Image, error)) (image.Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	if int64(config.Width)*int64(config.Height) > maxDecodePixels {
+		return nil, fmt.Errorf("image is %dx%d pixels, more than the %d megapixels that can be decoded",
+			config.Width, config.Height, maxDecodePixels/1000/1000)
+	}
+	return decode(bytes.NewReader(content))
+}
+
+// flatten draws img onto white, since JPEG has no transparency
+func flatten(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Over)
+	return dst
+}
+
+// toGray replaces every pixel of img with its brightness
+func toGray(img *image.RGBA) *image.RGBA {
+	for i := 0; i+3 < len(img.Pix); i += 4 {
+		y := color.GrayModel.Convert(color.RGBA{img.Pix[i], img.Pix[i+1], img.Pix[i+2], 0xff}).(color.Gray).Y
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2] = y, y, y
+	}
+	return img
+}
+
+// stretchContrast maps the brightness range of img, less the clipped extremes,
+// onto the full 0-255 range. It reports whether the image changed.
+func stretchContrast(img *image.RGBA) bool {
+	var histogram [256]int
+	pixels := len(img.Pix) / 4
+	for i := 0; i+3 < len(img.Pix); i += 4 {
+		histogram[luminance(img.Pix[i], img.Pix[i+1], img.Pix[i+2])]++
+	}
+
+	clip := int(float64(pixels) * contrastClip)
+	low, high := 0, 255
+	for seen := 0; low < 255 && seen+histogram[low] <= clip; low++ {
+		seen += histogram[low]
+	}
+	for seen := 0; high > 0 && seen+histogram[high] <= clip; high-- {
+		seen += histogram[high]
+	}
+	if high <= low || (low == 0 && high == 255) {
+		return false
+	}
+
+	var lookup [256]uint8
+	for v := range lookup {
+		stretched := (v - low) * 255 / (high - low)
+		lookup[v] = uint8(min(255, max(0, stretched)))
+	}
+	for i := 0; i+3 < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2] = lookup[img.Pix[i]], lookup[img.Pix[i+1]], lookup[img.Pix[i+2]]
+	}
+	return true
+}
+
+func luminance(r, g, b uint8) uint8 {
+	return uint8((299*int(r) + 587*int(g) + 114*int(b)) / 1000)
+}
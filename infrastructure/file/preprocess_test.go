@@ -0,0 +1,156 @@
+package file
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+)
+
+// withOrientation inserts an EXIF segment carrying orientation right after the
+// SOI marker of a JPEG
+func withOrientation(content []byte, orientation byte) []byte {
+	tiff := []byte{
+		'M', 'M', 0x00, 0x2a, 0x00, 0x00, 0x00, 0x08, // header, IFD0 at offset 8
+		0x00, 0x01, // one entry
+		0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01, 0x00, orientation, 0x00, 0x00, // orientation, SHORT
+		0x00, 0x00, 0x00, 0x00, // no next IFD
+	}
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	length := len(payload) + 2
+
+	segment := append([]byte{0xff, 0xe1, byte(length >> 8), byte(length)}, payload...)
+	return append(append([]byte{0xff, 0xd8}, segment...), content[2:]...)
+}
+
+// noisyPhoto is a camera-like image that compresses poorly at high quality
+func noisyPhoto(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 7 % 256), uint8(y * 13 % 256), uint8((x * y) % 256), 0xff})
+		}
+	}
+	return img
+}
+
+func TestPreprocessTurnsUprightAndShrinksPhotos(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, noisyPhoto(800, 400), &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	original := withOrientation(buf.Bytes(), 6)
+	if got := jpegOrientation(original); got != 6 {
+		t.Fatalf("jpegOrientation() = %d, want 6", got)
+	}
+
+	options := PreprocessOptions{Enabled: true, MaxDimension: 400, JPEGQuality: 80}
+	content, mimeType, steps := options.preprocess(original, mimeJPEG)
+
+	if mimeType != mimeJPEG {
+		t.Errorf("mimeType = %q, want image/jpeg", mimeType)
+	}
+	if len(content) >= len(original) {
+		t.Errorf("preprocessed image is %d bytes, not smaller than the original %d", len(content), len(original))
+	}
+	img, err := jpeg.Decode(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Rotated to portrait, 800x400 becomes 400x800 and is shrunk to 200x400
+	if got := img.Bounds().Size(); got != image.Pt(200, 400) {
+		t.Errorf("size = %v, want 200x400", got)
+	}
+	if got := strings.Join(steps, "; "); got != "turned upright (EXIF orientation 6); resized 400x800 to 200x400; jpeg quality 80" {
+		t.Errorf("steps = %q", got)
+	}
+}
+
+func TestPreprocessGrayscaleAndContrast(t *testing.T) {
+	// A faded receipt: every pixel between 100 and 150
+	faded := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			v := uint8(100 + (x+y)*50/126)
+			faded.Set(x, y, color.RGBA{v, v / 2, v, 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, faded, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+
+	options := PreprocessOptions{Enabled: true, MaxDimension: 2048, JPEGQuality: 90, Grayscale: true, BoostContrast: true}
+	content, _, steps := options.preprocess(buf.Bytes(), mimeJPEG)
+
+	img, err := jpeg.Decode(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	darkest, brightest := uint8(255), uint8(0)
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			if r != g || g != b {
+				t.Fatalf("pixel (%d,%d) is not gray", x, y)
+			}
+			darkest, brightest = min(darkest, uint8(r>>8)), max(brightest, uint8(r>>8))
+		}
+	}
+	if darkest > 20 || brightest < 235 {
+		t.Errorf("brightness range = %d-%d, want stretched to about 0-255", darkest, brightest)
+	}
+	if got := strings.Join(steps, "; "); got != "grayscale; contrast boosted; jpeg quality 90" {
+		t.Errorf("steps = %q", got)
+	}
+}
+
+func TestPreprocessDisabledLeavesFilesAlone(t *testing.T) {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, noisyPhoto(300, 300), nil)
+	original := withOrientation(buf.Bytes(), 3)
+
+	content, mimeType, steps := PreprocessOptions{}.preprocess(original, mimeJPEG)
+	if !bytes.Equal(content, original) || mimeType != mimeJPEG || steps != nil {
+		t.Errorf("disabled preprocessing changed the file: %v", steps)
+	}
+}
+
+// withDimensions rewrites the IHDR chunk of a PNG to declare width x height,
+// leaving the pixel data as it is
+func withDimensions(content []byte, width, height uint32) []byte {
+	patched := bytes.Clone(content)
+	ihdr := patched[12:29] // chunk type and data
+	binary.BigEndian.PutUint32(ihdr[4:], width)
+	binary.BigEndian.PutUint32(ihdr[8:], height)
+	binary.BigEndian.PutUint32(patched[29:], crc32.ChecksumIEEE(ihdr))
+	return patched
+}
+
+func TestPreprocessSkipsImagesTooLargeToDecode(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, noisyPhoto(8, 8)); err != nil {
+		t.Fatal(err)
+	}
+	original := withDimensions(buf.Bytes(), 40000, 40000)
+
+	_, err := decodeImage(original, func(io.Reader) (image.Image, error) {
+		t.Fatal("decoded an image of 1600 megapixels")
+		return nil, nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "40000x40000") {
+		t.Errorf("decodeImage() error = %v, want the image refused", err)
+	}
+
+	options := PreprocessOptions{Enabled: true, MaxDimension: 400, JPEGQuality: 80}
+	content, mimeType, steps := options.preprocess(original, mimePNG)
+	if !bytes.Equal(content, original) || mimeType != mimePNG || steps != nil {
+		t.Errorf("preprocessing changed an image too large to decode: %v", steps)
+	}
+}
@@ -2,26 +2,35 @@ package file
 
 import (
 	"errors"
+	"fmt"
 	"io"
-	"mime/multipart"
+	"net/http"
 	"strings"
 )
 
 // Processor handles file processing operations
 type Processor struct {
 	allowedMimeTypes map[string]bool
-	maxFileSize      int64
+	limits           Limits
+	preprocess       PreprocessOptions
 }
 
-// NewProcessor creates a new file processor with default settings
-func NewProcessor() *Processor {
+// NewProcessor creates a new file processor that enforces limits on uploads
+// and prepares images as preprocess says
+func NewProcessor(limits Limits, preprocess PreprocessOptions) *Processor {
 	return &Processor{
 		allowedMimeTypes: map[string]bool{
-			"image/png":       true,
-			"image/jpeg":      true,
-			"application/pdf": true,
+			mimePNG:  true,
+			mimeJPEG: true,
+			mimePDF:  true,
+			mimeWebP: true,
+			mimeHEIC: true,
+			mimeHEIF: true,
+			mimeGIF:  true,
+			mimeTIFF: true,
 		},
-		maxFileSize: 10 * 1024 * 1024, // 10MB
+		limits:     limits,
+		preprocess: preprocess,
 	}
 }
 
@@ -30,69 +39,170 @@ type ProcessedFile struct {
 	Content  []byte
 	Filename string
 	MimeType string
+	// OriginalSize is the size of the upload before it was converted or preprocessed
+	OriginalSize int64
+	// Preprocessing lists the conversions and preprocessing steps applied, if any
+	Preprocessing []string
+	// Pages are the pages of the uploaded PDF this document was split from; empty when it was not split
+	Pages []int
+	// Email is the email the document was the body or an attachment of; nil for other uploads
+	Email *EmailOrigin
 }
 
-func (p *Processor) ProcessUploadedFile(fileHeader *multipart.FileHeader) (*ProcessedFile, error) {
-	if fileHeader == nil {
-		return nil, errors.New("file header is nil")
+// Rejection says why one uploaded file was refused
+type Rejection struct {
+	Filename string `json:"filename"`
+	Reason   string `json:"reason"`
+}
+
+// RejectedFilesError lists every file of an upload that was refused
+type RejectedFilesError struct {
+	Rejections []Rejection
+}
+
+func (e *RejectedFilesError) Error() string {
+	reasons := make([]string, len(e.Rejections))
+	for i, rejection := range e.Rejections {
+		reasons[i] = fmt.Sprintf("%s: %s", rejection.Filename, rejection.Reason)
 	}
+	return fmt.Sprintf("%d file(s) rejected: %s", len(e.Rejections), strings.Join(reasons, "; "))
+}
 
-	if fileHeader.Size > p.maxFileSize {
-		return nil, errors.New("file size exceeds maximum allowed size")
+// ProcessUploadedFile reads one spooled upload, detects its type from its
+// content and converts it to a format the extractors read
+func (p *Processor) ProcessUploadedFile(upload *SpooledFile) (*ProcessedFile, error) {
+	if upload == nil {
+		return nil, errors.New("upload is nil")
 	}
 
-	file, err := fileHeader.Open()
+	content, err := upload.ReadAll()
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
+	return p.processContent(upload.Filename, content)
+}
 
-	content, err := io.ReadAll(file)
-	if err != nil {
-		return nil, err
+// ProcessMultipleFiles processes every upload, unpacking ZIP archives and
+// emails into their documents and splitting PDFs as opts say; when any file is refused it
+// returns a *RejectedFilesError naming each refused file and why
+func (p *Processor) ProcessMultipleFiles(uploads []*SpooledFile, opts UploadOptions) ([]*ProcessedFile, error) {
+	if len(uploads) == 0 {
+		return nil, errors.New("no files provided")
 	}
 
-	mimeType := p.detectMimeType(fileHeader.Filename)
+	processedFiles := make([]*ProcessedFile, 0, len(uploads))
+	var rejections []Rejection
 
-	if !p.allowedMimeTypes[mimeType] {
-		return nil, errors.New("file type not allowed")
+	for _, upload := range uploads {
+		if upload == nil {
+			rejections = append(rejections, Rejection{Reason: "upload is nil"})
+			continue
+		}
+
+		if isArchiveName(upload.Filename) {
+			files, rejected, ok := p.processArchive(upload, opts)
+			if ok {
+				processedFiles = append(processedFiles, files...)
+				rejections = append(rejections, rejected...)
+				continue
+			}
+		}
+
+		content, err := upload.ReadAll()
+		if err != nil {
+			rejections = append(rejections, Rejection{Filename: upload.Filename, Reason: err.Error()})
+			continue
+		}
+
+		files, rejected := p.processDocument(upload.Filename, content, opts)
+		processedFiles = append(processedFiles, files...)
+		rejections = append(rejections, rejected...)
 	}
 
-	return &ProcessedFile{
-		Content:  content,
-		Filename: fileHeader.Filename,
-		MimeType: mimeType,
-	}, nil
+	if len(rejections) > 0 {
+		return nil, &RejectedFilesError{Rejections: rejections}
+	}
+	return processedFiles, nil
 }
 
-func (p *Processor) ProcessMultipleFiles(fileHeaders []*multipart.FileHeader) ([]*ProcessedFile, error) {
-	if len(fileHeaders) == 0 {
-		return nil, errors.New("no files provided")
+// processArchive unpacks a .zip upload straight from its spooled file; ok is
+// false when the content is not a ZIP archive after all
+func (p *Processor) processArchive(upload *SpooledFile, opts UploadOptions) ([]*ProcessedFile, []Rejection, bool) {
+	f, err := upload.Open()
+	if err != nil {
+		return nil, []Rejection{{Filename: upload.Filename, Reason: err.Error()}}, true
 	}
+	defer f.Close()
 
-	processedFiles := make([]*ProcessedFile, 0, len(fileHeaders))
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(f, header); err != nil || !isArchive(upload.Filename, header) {
+		return nil, nil, false
+	}
+	files, rejections := p.expandArchive(upload.Filename, f, upload.Size, opts)
+	return files, rejections, true
+}
 
-	for _, fileHeader := range fileHeaders {
-		processed, err := p.ProcessUploadedFile(fileHeader)
-		if err != nil {
-			return nil, err
-		}
-		processedFiles = append(processedFiles, processed)
+// processDocument turns one upload or archive entry into the documents to
+// extract: those of an email, or the file itself, split as opts say
+func (p *Processor) processDocument(filename string, content []byte, opts UploadOptions) ([]*ProcessedFile, []Rejection) {
+	if isEmailName(filename) {
+		return p.expandEmail(filename, content, opts, 0)
 	}
 
-	return processedFiles, nil
+	processed, err := p.processContent(filename, content)
+	if err != nil {
+		return nil, []Rejection{{Filename: filename, Reason: err.Error()}}
+	}
+	return splitDocument(processed, opts.SplitPDF), nil
 }
 
-func (p *Processor) detectMimeType(filename string) string {
-	lowerFilename := strings.ToLower(filename)
+// processContent validates one document, from an upload or an archive, and
+// converts it to a format the extractors read
+func (p *Processor) processContent(filename string, content []byte) (*ProcessedFile, error) {
+	if len(content) == 0 {
+		return nil, errors.New("file is empty")
+	}
+	if int64(len(content)) > p.limits.MaxFileSize {
+		return nil, sizeLimitError(int64(len(content)), p.limits.MaxFileSize)
+	}
 
-	if strings.HasSuffix(lowerFilename, ".png") {
-		return "image/png"
-	} else if strings.HasSuffix(lowerFilename, ".jpg") || strings.HasSuffix(lowerFilename, ".jpeg") {
-		return "image/jpeg"
-	} else if strings.HasSuffix(lowerFilename, ".pdf") {
-		return "application/pdf"
+	mimeType := p.detectMimeType(filename, content)
+	if !p.allowedMimeTypes[mimeType] {
+		return nil, fmt.Errorf("file type not allowed: content is %s; accepted are PDF, PNG, JPEG, WebP, HEIC/HEIF, GIF and TIFF",
+			http.DetectContentType(content))
 	}
 
-	return "application/octet-stream"
+	originalSize := int64(len(content))
+	detected := mimeType
+	content, mimeType, err := toSupportedFormat(content, mimeType)
+	if err != nil {
+		return nil, err
+	}
+
+	var steps []string
+	if mimeType != detected {
+		steps = append(steps, "converted from "+detected)
+	}
+	content, mimeType, preprocessed := p.preprocess.preprocess(content, mimeType)
+
+	return &ProcessedFile{
+		Content:       content,
+		Filename:      filename,
+		MimeType:      mimeType,
+		OriginalSize:  originalSize,
+		Preprocessing: append(steps, preprocessed...),
+	}, nil
+}
+
+func sizeLimitError(size, limit int64) error {
+	return fmt.Errorf("file is %.1f MB, above the %.0f MB limit", float64(size)/(1<<20), float64(limit)/(1<<20))
+}
+
+// detectMimeType trusts the content over the filename: the extension is only
+// used when the leading bytes match no supported format
+func (p *Processor) detectMimeType(filename string, content []byte) string {
+	if mimeType := sniffMimeType(content); mimeType != "" {
+		return mimeType
+	}
+	return extensionMimeType(filename)
 }
@@ -0,0 +1,377 @@
+package file
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"mime/multipart"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/tiff"
+)
+
+// testLimits are the default limits with uploads spooled to a test directory
+func testLimits(t *testing.T) Limits {
+	limits := DefaultLimits()
+	limits.SpoolDir = t.TempDir()
+	return limits
+}
+
+// multipartBody writes files as the "file" field of a multipart form
+func multipartBody(t *testing.T, files map[string][]byte) (*bytes.Buffer, string) {
+	t.Helper()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, content := range files {
+		part, err := writer.CreateFormFile("file", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(content)
+	}
+	writer.Close()
+	return &body, writer.Boundary()
+}
+
+// multipartFiles spools files as a multipart upload of them would be
+func multipartFiles(t *testing.T, files map[string][]byte) []*SpooledFile {
+	t.Helper()
+
+	body, boundary := multipartBody(t, files)
+	upload, err := NewProcessor(testLimits(t), PreprocessOptions{}).ReadUpload(body, boundary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return upload.Files
+}
+
+func encodeImage(t *testing.T, encode func(*bytes.Buffer, image.Image) error) []byte {
+	t.Helper()
+
+	img := image.NewPaletted(image.Rect(0, 0, 4, 4), color.Palette{color.White, color.Black})
+	var buf bytes.Buffer
+	if err := encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestProcessMultipleFilesDetectsTypeFromContent(t *testing.T) {
+	jpegBytes := encodeImage(t, func(buf *bytes.Buffer, img image.Image) error { return jpeg.Encode(buf, img, nil) })
+	gifBytes := encodeImage(t, func(buf *bytes.Buffer, img image.Image) error { return gif.Encode(buf, img, nil) })
+	tiffBytes := encodeImage(t, func(buf *bytes.Buffer, img image.Image) error { return tiff.Encode(buf, img, nil) })
+	webpBytes := append([]byte("RIFF\x24\x00\x00\x00WEBPVP8 "), make([]byte, 24)...)
+	heicBytes := append([]byte("\x00\x00\x00\x18ftypheic"), make([]byte, 12)...)
+
+	processed, err := NewProcessor(testLimits(t), PreprocessOptions{}).ProcessMultipleFiles(multipartFiles(t, map[string][]byte{
+		"renamed.pdf":  jpegBytes,
+		"photo.gif":    gifBytes,
+		"scan.tif":     tiffBytes,
+		"receipt.webp": webpBytes,
+		"IMG_0001":     heicBytes,
+		"ticket.pdf":   []byte("%PDF-1.7\n..."),
+	}), UploadOptions{})
+	if err != nil {
+		t.Fatalf("ProcessMultipleFiles() error = %v", err)
+	}
+
+	want := map[string]string{
+		"renamed.pdf":  "image/jpeg",
+		"photo.gif":    "image/png",
+		"scan.tif":     "image/png",
+		"receipt.webp": "image/webp",
+		"IMG_0001":     "image/heic",
+		"ticket.pdf":   "application/pdf",
+	}
+	for _, pf := range processed {
+		if pf.MimeType != want[pf.Filename] {
+			t.Errorf("%s: MimeType = %q, want %q", pf.Filename, pf.MimeType, want[pf.Filename])
+		}
+		if want[pf.Filename] == "image/png" && sniffMimeType(pf.Content) != "image/png" {
+			t.Errorf("%s: content was not converted to PNG", pf.Filename)
+		}
+	}
+	if len(processed) != len(want) {
+		t.Errorf("processed %d files, want %d", len(processed), len(want))
+	}
+}
+
+func TestProcessMultipleFilesListsEveryRejectedFile(t *testing.T) {
+	_, err := NewProcessor(testLimits(t), PreprocessOptions{}).ProcessMultipleFiles(multipartFiles(t, map[string][]byte{
+		"notes.txt":   []byte("just some text"),
+		"broken.gif":  []byte("GIF89a not really"),
+		"empty.png":   {},
+		"ticket.pdf":  []byte("%PDF-1.4\n..."),
+		"unknown.bin": {0x00, 0x01, 0x02, 0x03},
+	}), UploadOptions{})
+
+	var rejected *RejectedFilesError
+	if !errors.As(err, &rejected) {
+		t.Fatalf("error = %v, want *RejectedFilesError", err)
+	}
+
+	reasons := map[string]string{}
+	for _, rejection := range rejected.Rejections {
+		reasons[rejection.Filename] = rejection.Reason
+	}
+	for _, name := range []string{"notes.txt", "broken.gif", "empty.png", "unknown.bin"} {
+		if reasons[name] == "" {
+			t.Errorf("%s was not rejected", name)
+		}
+	}
+	if _, ok := reasons["ticket.pdf"]; ok {
+		t.Errorf("ticket.pdf was rejected: %s", reasons["ticket.pdf"])
+	}
+	if len(rejected.Rejections) != 4 {
+		t.Errorf("got %d rejections, want 4: %v", len(rejected.Rejections), rejected.Rejections)
+	}
+}
+
+func TestProcessMultipleFilesRejectsImagesTooLargeToConvert(t *testing.T) {
+	huge := encodeImage(t, func(buf *bytes.Buffer, img image.Image) error { return gif.Encode(buf, img, nil) })
+	huge[6], huge[7], huge[8], huge[9] = 0xff, 0xff, 0xff, 0xff // logical screen of 65535x65535
+
+	_, err := NewProcessor(testLimits(t), PreprocessOptions{}).ProcessMultipleFiles(multipartFiles(t, map[string][]byte{
+		"huge.gif": huge,
+	}), UploadOptions{})
+
+	var rejected *RejectedFilesError
+	if !errors.As(err, &rejected) || len(rejected.Rejections) != 1 {
+		t.Fatalf("error = %v, want huge.gif rejected", err)
+	}
+	if reason := rejected.Rejections[0].Reason; !strings.Contains(reason, "megapixels") {
+		t.Errorf("reason = %q, want the pixel limit", reason)
+	}
+}
+
+// zipArchive packs entries, in order, into a ZIP file
+func zipArchive(t *testing.T, entries ...[2]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		w, err := writer.Create(entry[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(entry[1]))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestProcessMultipleFilesUnpacksZipArchives(t *testing.T) {
+	archive := zipArchive(t,
+		[2]string{"trip/surat_tugas.pdf", "%PDF-1.7\n..."},
+		[2]string{"trip/hotel/folio.pdf", "%PDF-1.4\n..."},
+		[2]string{"trip/hotel/", ""},
+		[2]string{"__MACOSX/trip/._folio.pdf", "resource fork"},
+		[2]string{"trip/.DS_Store", "finder"},
+	)
+
+	processed, err := NewProcessor(testLimits(t), PreprocessOptions{}).ProcessMultipleFiles(multipartFiles(t, map[string][]byte{"trip.zip": archive}), UploadOptions{})
+	if err != nil {
+		t.Fatalf("ProcessMultipleFiles() error = %v", err)
+	}
+
+	var names []string
+	for _, pf := range processed {
+		names = append(names, pf.Filename)
+	}
+	want := []string{"trip.zip/trip/surat_tugas.pdf", "trip.zip/trip/hotel/folio.pdf"}
+	if !slices.Equal(names, want) {
+		t.Errorf("filenames = %v, want %v", names, want)
+	}
+}
+
+func TestProcessMultipleFilesRejectsUnsafeArchiveEntries(t *testing.T) {
+	archive := zipArchive(t,
+		[2]string{"ticket.pdf", "%PDF-1.7\n..."},
+		[2]string{"../../etc/cron.d/evil.pdf", "%PDF-1.7\n..."},
+		[2]string{"/abs/receipt.pdf", "%PDF-1.7\n..."},
+		[2]string{"inner.zip", "PK\x05\x06"},
+		[2]string{"notes.txt", "just some text"},
+	)
+
+	_, err := NewProcessor(testLimits(t), PreprocessOptions{}).ProcessMultipleFiles(multipartFiles(t, map[string][]byte{"trip.zip": archive}), UploadOptions{})
+
+	var rejected *RejectedFilesError
+	if !errors.As(err, &rejected) {
+		t.Fatalf("error = %v, want *RejectedFilesError", err)
+	}
+	var names []string
+	for _, rejection := range rejected.Rejections {
+		names = append(names, rejection.Filename)
+	}
+	want := []string{
+		"trip.zip/../../etc/cron.d/evil.pdf",
+		"trip.zip//abs/receipt.pdf",
+		"trip.zip/inner.zip",
+		"trip.zip/notes.txt",
+	}
+	if !slices.Equal(names, want) {
+		t.Errorf("rejected = %v, want %v", rejected.Rejections, want)
+	}
+}
+
+func TestProcessMultipleFilesEnforcesArchiveLimits(t *testing.T) {
+	processor := NewProcessor(testLimits(t), PreprocessOptions{})
+	processor.limits.MaxArchiveEntries = 2
+
+	archive := zipArchive(t,
+		[2]string{"a.pdf", "%PDF-1.7"},
+		[2]string{"b.pdf", "%PDF-1.7"},
+		[2]string{"c.pdf", "%PDF-1.7"},
+	)
+	_, err := processor.ProcessMultipleFiles(multipartFiles(t, map[string][]byte{"trip.zip": archive}), UploadOptions{})
+
+	var rejected *RejectedFilesError
+	if !errors.As(err, &rejected) || len(rejected.Rejections) != 1 || rejected.Rejections[0].Filename != "trip.zip" {
+		t.Fatalf("error = %v, want the archive itself rejected", err)
+	}
+
+	processor = NewProcessor(testLimits(t), PreprocessOptions{})
+	processor.limits.MaxFileSize = 64
+	bomb := zipArchive(t, [2]string{"big.pdf", "%PDF-1.7\n" + strings.Repeat("0", 1024)})
+	_, err = processor.ProcessMultipleFiles(multipartFiles(t, map[string][]byte{"trip.zip": bomb}), UploadOptions{})
+	if !errors.As(err, &rejected) || rejected.Rejections[0].Filename != "trip.zip/big.pdf" {
+		t.Fatalf("error = %v, want the oversized entry rejected", err)
+	}
+}
+
+const twoPagePDF = "%PDF-1.4\n" +
+	"1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n" +
+	"2 0 obj\n<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /MediaBox [0 0 612 792] >>\nendobj\n" +
+	"3 0 obj\n<< /Type /Page /Parent 2 0 R >>\nendobj\n" +
+	"4 0 obj\n<< /Type /Page /Parent 2 0 R >>\nendobj\n" +
+	"trailer\n<< /Size 5 /Root 1 0 R >>\n%%EOF\n"
+
+func TestProcessMultipleFilesSplitsPDFsIntoPages(t *testing.T) {
+	processed, err := NewProcessor(testLimits(t), PreprocessOptions{}).ProcessMultipleFiles(multipartFiles(t, map[string][]byte{
+		"stack.pdf": []byte(twoPagePDF),
+	}), UploadOptions{SplitPDF: SplitPages})
+	if err != nil {
+		t.Fatalf("ProcessMultipleFiles() error = %v", err)
+	}
+
+	if len(processed) != 2 {
+		t.Fatalf("got %d documents, want 2", len(processed))
+	}
+	for i, pf := range processed {
+		if pf.Filename != "stack.pdf" || !slices.Equal(pf.Pages, []int{i + 1}) || pf.MimeType != "application/pdf" {
+			t.Errorf("document %d = %s pages %v (%s), want stack.pdf page %d", i, pf.Filename, pf.Pages, pf.MimeType, i+1)
+		}
+	}
+
+	processed, err = NewProcessor(testLimits(t), PreprocessOptions{}).ProcessMultipleFiles(multipartFiles(t, map[string][]byte{
+		"broken.pdf": []byte("%PDF-1.7\n..."),
+	}), UploadOptions{SplitPDF: SplitPages})
+	if err != nil {
+		t.Fatalf("ProcessMultipleFiles() error = %v", err)
+	}
+	if len(processed) != 1 || len(processed[0].Preprocessing) != 1 || !strings.HasPrefix(processed[0].Preprocessing[0], "not split: ") {
+		t.Errorf("expected an unreadable PDF to be kept whole with a note, got %+v", processed)
+	}
+}
+
+func TestReadUploadEnforcesLimits(t *testing.T) {
+	pdf := []byte("%PDF-1.7\n" + strings.Repeat("0", 1024))
+	tests := []struct {
+		name  string
+		limit func(*Limits)
+		files map[string][]byte
+		code  string
+	}{
+		{"file size", func(l *Limits) { l.MaxFileSize = 512 }, map[string][]byte{"a.pdf": pdf}, LimitFileSize},
+		{"request size", func(l *Limits) { l.MaxRequestSize = 2048 }, map[string][]byte{"a.pdf": pdf, "b.pdf": pdf}, LimitRequestSize},
+		{"file count", func(l *Limits) { l.MaxFiles = 2 }, map[string][]byte{"a.pdf": pdf, "b.pdf": pdf, "c.pdf": pdf}, LimitFileCount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limits := testLimits(t)
+			tt.limit(&limits)
+			body, boundary := multipartBody(t, tt.files)
+
+			_, err := NewProcessor(limits, PreprocessOptions{}).ReadUpload(body, boundary)
+
+			var limitErr *LimitError
+			if !errors.As(err, &limitErr) || limitErr.Code != tt.code {
+				t.Fatalf("error = %v, want %s", err, tt.code)
+			}
+			if left, _ := os.ReadDir(limits.SpoolDir); len(left) != 0 {
+				t.Errorf("%d spooled file(s) left behind", len(left))
+			}
+		})
+	}
+}
+
+func TestReadUploadSpoolsFilesAndKeepsFields(t *testing.T) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("split_pdf", "pages")
+	part, _ := writer.CreateFormFile("file", "ticket.pdf")
+	part.Write([]byte("%PDF-1.7\n..."))
+	writer.Close()
+
+	limits := testLimits(t)
+	upload, err := NewProcessor(limits, PreprocessOptions{}).ReadUpload(&body, writer.Boundary())
+	if err != nil {
+		t.Fatalf("ReadUpload() error = %v", err)
+	}
+	if upload.Value("split_pdf") != "pages" || len(upload.Files) != 1 || upload.Files[0].Size != 12 {
+		t.Fatalf("upload = %+v, files %+v", upload.Values, upload.Files)
+	}
+
+	upload.Remove()
+	if left, _ := os.ReadDir(limits.SpoolDir); len(left) != 0 {
+		t.Errorf("Remove() left %d spooled file(s)", len(left))
+	}
+}
+
+func TestProcessMultipleFilesUnpacksEmails(t *testing.T) {
+	message := "From: Hotel Santika <reservation@santika.example>\r\n" +
+		"Subject: Booking confirmation\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nTotal Rp 1.450.000\r\n" +
+		"--b\r\nContent-Type: application/pdf\r\nContent-Disposition: attachment; filename=folio.pdf\r\n\r\n%PDF-1.7\n...\r\n" +
+		"--b\r\nContent-Type: text/calendar\r\nContent-Disposition: attachment; filename=stay.ics\r\n\r\nBEGIN:VCALENDAR\r\n" +
+		"--b--\r\n"
+
+	processed, err := NewProcessor(testLimits(t), PreprocessOptions{}).ProcessMultipleFiles(multipartFiles(t, map[string][]byte{
+		"booking.eml": []byte(message),
+	}), UploadOptions{})
+	if err != nil {
+		t.Fatalf("ProcessMultipleFiles() error = %v", err)
+	}
+
+	if len(processed) != 2 {
+		t.Fatalf("got %d documents, want the body and folio.pdf", len(processed))
+	}
+	body, folio := processed[0], processed[1]
+	if body.Filename != "booking.eml" || body.MimeType != "text/plain" || !strings.Contains(string(body.Content), "Total Rp 1.450.000") {
+		t.Errorf("body = %s (%s) %q", body.Filename, body.MimeType, body.Content)
+	}
+	if folio.Filename != "booking.eml/folio.pdf" || folio.MimeType != "application/pdf" {
+		t.Errorf("attachment = %s (%s)", folio.Filename, folio.MimeType)
+	}
+	for _, pf := range processed {
+		if pf.Email == nil || pf.Email.Subject != "Booking confirmation" || pf.Email.From != "Hotel Santika <reservation@santika.example>" {
+			t.Errorf("%s: Email = %+v", pf.Filename, pf.Email)
+		}
+	}
+	if !slices.Contains(body.Preprocessing, "skipped stay.ics: not a PDF or image") {
+		t.Errorf("body preprocessing = %v, want the skipped invitation noted", body.Preprocessing)
+	}
+}
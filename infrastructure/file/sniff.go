@@ -0,0 +1,75 @@
+package file
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+)
+
+// MIME types of the documents the processor accepts
+const (
+	mimePDF     = "application/pdf"
+	mimePNG     = "image/png"
+	mimeJPEG    = "image/jpeg"
+	mimeWebP    = "image/webp"
+	mimeGIF     = "image/gif"
+	mimeTIFF    = "image/tiff"
+	mimeHEIC    = "image/heic"
+	mimeHEIF    = "image/heif"
+	mimeText    = "text/plain"
+	mimeUnknown = "application/octet-stream"
+)
+
+// extensionMimeTypes is the fallback used when the content is not recognized
+var extensionMimeTypes = map[string]string{
+	".pdf":  mimePDF,
+	".png":  mimePNG,
+	".jpg":  mimeJPEG,
+	".jpeg": mimeJPEG,
+	".webp": mimeWebP,
+	".gif":  mimeGIF,
+	".tif":  mimeTIFF,
+	".tiff": mimeTIFF,
+	".heic": mimeHEIC,
+	".heif": mimeHEIF,
+}
+
+// pdfHeaderWindow is how far into a file the %PDF- header may start; some
+// generators write a few bytes of junk before it
+const pdfHeaderWindow = 1024
+
+// sniffMimeType recognizes a supported document from its leading bytes. It
+// returns an empty string when they match none of the supported formats.
+func sniffMimeType(content []byte) string {
+	switch {
+	case bytes.HasPrefix(content, []byte("\x89PNG\r\n\x1a\n")):
+		return mimePNG
+	case bytes.HasPrefix(content, []byte("\xff\xd8\xff")):
+		return mimeJPEG
+	case bytes.HasPrefix(content, []byte("GIF87a")), bytes.HasPrefix(content, []byte("GIF89a")):
+		return mimeGIF
+	case bytes.HasPrefix(content, []byte("II*\x00")), bytes.HasPrefix(content, []byte("MM\x00*")):
+		return mimeTIFF
+	case len(content) >= 12 && string(content[:4]) == "RIFF" && string(content[8:12]) == "WEBP":
+		return mimeWebP
+	case len(content) >= 12 && string(content[4:8]) == "ftyp":
+		switch string(content[8:12]) {
+		case "heic", "heix", "heim", "heis", "hevc", "hevx":
+			return mimeHEIC
+		case "mif1", "msf1", "heif":
+			return mimeHEIF
+		}
+	case bytes.Contains(content[:min(len(content), pdfHeaderWindow)], []byte("%PDF-")):
+		return mimePDF
+	}
+	return ""
+}
+
+// extensionMimeType maps a filename's extension to a supported MIME type, or
+// application/octet-stream when the extension is not one of them
+func extensionMimeType(filename string) string {
+	if mimeType, ok := extensionMimeTypes[strings.ToLower(filepath.Ext(filename))]; ok {
+		return mimeType
+	}
+	return mimeUnknown
+}
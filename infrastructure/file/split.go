@@ -0,0 +1,72 @@
+package file
+
+import (
+	"fmt"
+	"strings"
+
+	"sandbox/infrastructure/pdf"
+)
+
+// SplitMode says whether PDFs are cut into several documents before extraction
+type SplitMode string
+
+const (
+	SplitNone SplitMode = ""
+	// SplitPages makes every page its own document
+	SplitPages SplitMode = "pages"
+	// SplitBlankPages cuts at blank separator pages, dropping them
+	SplitBlankPages SplitMode = "blank_pages"
+)
+
+// ParseSplitMode reads the split_pdf form value; empty and "none" leave PDFs whole
+func ParseSplitMode(value string) (SplitMode, error) {
+	switch mode := SplitMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case SplitNone, "none":
+		return SplitNone, nil
+	case SplitPages, SplitBlankPages:
+		return mode, nil
+	}
+	return SplitNone, fmt.Errorf("invalid split_pdf %q: must be one of none, pages, blank_pages", value)
+}
+
+// UploadOptions are the choices a request makes about how its files are processed
+type UploadOptions struct {
+	SplitPDF SplitMode
+}
+
+// splitDocument cuts a processed PDF into one document per part. A PDF that
+// yields a single part is kept whole, as is one that cannot be read, with a
+// preprocessing step saying why.
+func splitDocument(processed *ProcessedFile, mode SplitMode) []*ProcessedFile {
+	if mode == SplitNone || processed.MimeType != mimePDF {
+		return []*ProcessedFile{processed}
+	}
+
+	var parts []pdf.Part
+	var err error
+	switch mode {
+	case SplitPages:
+		parts, err = pdf.SplitPages(processed.Content)
+	case SplitBlankPages:
+		parts, err = pdf.SplitAtBlankPages(processed.Content)
+	}
+	if err != nil {
+		processed.Preprocessing = append(processed.Preprocessing, "not split: "+err.Error())
+		return []*ProcessedFile{processed}
+	}
+	if len(parts) == 1 {
+		return []*ProcessedFile{processed}
+	}
+
+	files := make([]*ProcessedFile, len(parts))
+	for i, part := range parts {
+		files[i] = &ProcessedFile{
+			Content:      part.Content,
+			Filename:     processed.Filename,
+			MimeType:     mimePDF,
+			OriginalSize: int64(len(part.Content)),
+			Pages:        part.Pages,
+		}
+	}
+	return files
+}
@@ -0,0 +1,222 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+)
+
+// Limit codes name the upload limit a request broke
+const (
+	LimitFileSize    = "FILE_TOO_LARGE"
+	LimitRequestSize = "REQUEST_TOO_LARGE"
+	LimitFileCount   = "TOO_MANY_FILES"
+)
+
+// maxFieldSize bounds a single non-file form field such as assignee
+const maxFieldSize = 64 << 10
+
+// Limits bound what one upload request may carry
+type Limits struct {
+	// MaxFileSize bounds every uploaded file and every document unpacked from an archive
+	MaxFileSize int64
+	// MaxRequestSize bounds the whole multipart body, files and fields together
+	MaxRequestSize int64
+	// MaxFiles bounds the files of one request; an archive or email counts as one
+	MaxFiles int
+	// MaxArchiveSize bounds a ZIP or email upload, and separately everything a ZIP unpacks to
+	MaxArchiveSize    int64
+	MaxArchiveEntries int
+	// SpoolDir is where uploads are written while a request is handled; empty uses the OS temp dir
+	SpoolDir string
+}
+
+// DefaultLimits returns the limits used when none are configured
+func DefaultLimits() Limits {
+	return Limits{
+		MaxFileSize:       10 << 20,
+		MaxRequestSize:    50 << 20,
+		MaxFiles:          20,
+		MaxArchiveSize:    100 << 20,
+		MaxArchiveEntries: 200,
+	}
+}
+
+// LimitError reports an upload that broke one of the Limits. Reading stops at
+// the limit, so the rest of the request is never stored.
+type LimitError struct {
+	// Code is one of LimitFileSize, LimitRequestSize or LimitFileCount
+	Code string
+	// Filename is the file that was too large, for LimitFileSize
+	Filename string
+	// Limit is the limit broken, in bytes or files
+	Limit   int64
+	Message string
+}
+
+func (e *LimitError) Error() string {
+	return e.Message
+}
+
+// RequestSizeError is the error for a request body above limit bytes
+func RequestSizeError(limit int64) *LimitError {
+	return &LimitError{
+		Code:    LimitRequestSize,
+		Limit:   limit,
+		Message: fmt.Sprintf("request is above the %.0f MB limit", float64(limit)/(1<<20)),
+	}
+}
+
+// errRequestTooLarge stops a multipart read at the request limit
+var errRequestTooLarge = errors.New("request body too large")
+
+// limitedBody returns errRequestTooLarge once more than remaining bytes are read
+type limitedBody struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, errRequestTooLarge
+	}
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.r.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n, errRequestTooLarge
+	}
+	return n, err
+}
+
+// SpooledFile is an uploaded file written to a temporary file on disk
+type SpooledFile struct {
+	Filename string
+	Size     int64
+	path     string
+}
+
+// Open opens the spooled content for reading
+func (f *SpooledFile) Open() (*os.File, error) {
+	return os.Open(f.path)
+}
+
+// ReadAll reads the spooled content back into memory
+func (f *SpooledFile) ReadAll() ([]byte, error) {
+	return os.ReadFile(f.path)
+}
+
+// Upload is a multipart request whose files were spooled to disk. Remove must
+// be called once the files have been processed.
+type Upload struct {
+	Values map[string][]string
+	Files  []*SpooledFile
+}
+
+// Value returns the first value of a form field, or an empty string
+func (u *Upload) Value(key string) string {
+	if values := u.Values[key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Remove deletes the spooled files
+func (u *Upload) Remove() {
+	for _, f := range u.Files {
+		os.Remove(f.path)
+	}
+}
+
+// ReadUpload streams a multipart/form-data body, writing every file of the
+// "file" field to the spool directory. Each limit is enforced while reading,
+// so an oversized request fails with a *LimitError without being stored.
+func (p *Processor) ReadUpload(body io.Reader, boundary string) (*Upload, error) {
+	upload := &Upload{Values: map[string][]string{}}
+	reader := multipart.NewReader(&limitedBody{r: body, remaining: p.limits.MaxRequestSize}, boundary)
+
+	err := p.readParts(reader, upload)
+	if errors.Is(err, errRequestTooLarge) {
+		err = RequestSizeError(p.limits.MaxRequestSize)
+	}
+	if err != nil {
+		upload.Remove()
+		return nil, err
+	}
+	return upload, nil
+}
+
+func (p *Processor) readParts(reader *multipart.Reader, upload *Upload) error {
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("cannot read multipart form: %w", err)
+		}
+
+		switch {
+		case part.FileName() == "":
+			value, err := io.ReadAll(io.LimitReader(part, maxFieldSize+1))
+			if err != nil {
+				return fmt.Errorf("cannot read form field %q: %w", part.FormName(), err)
+			}
+			if len(value) > maxFieldSize {
+				return fmt.Errorf("form field %q is longer than %d KB", part.FormName(), maxFieldSize>>10)
+			}
+			upload.Values[part.FormName()] = append(upload.Values[part.FormName()], string(value))
+		case part.FormName() == "file":
+			if len(upload.Files) == p.limits.MaxFiles {
+				return &LimitError{
+					Code:    LimitFileCount,
+					Limit:   int64(p.limits.MaxFiles),
+					Message: fmt.Sprintf("request carries more than the limit of %d files", p.limits.MaxFiles),
+				}
+			}
+			spooled, err := p.spool(part)
+			if spooled != nil {
+				upload.Files = append(upload.Files, spooled)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		// Files sent under other fields are skipped; reading on discards them
+		part.Close()
+	}
+}
+
+// spool writes one file part to a temporary file, stopping at its size limit.
+// The returned file is set whenever something was written, so it can be removed.
+func (p *Processor) spool(part *multipart.Part) (*SpooledFile, error) {
+	limit := p.limits.MaxFileSize
+	if isArchiveName(part.FileName()) || isEmailName(part.FileName()) {
+		limit = p.limits.MaxArchiveSize
+	}
+
+	tmp, err := os.CreateTemp(p.limits.SpoolDir, "upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("cannot spool upload: %w", err)
+	}
+	defer tmp.Close()
+
+	spooled := &SpooledFile{Filename: part.FileName(), path: tmp.Name()}
+	spooled.Size, err = io.Copy(tmp, io.LimitReader(part, limit+1))
+	if err != nil {
+		return spooled, fmt.Errorf("cannot spool upload %s: %w", spooled.Filename, err)
+	}
+	if spooled.Size > limit {
+		return spooled, &LimitError{
+			Code:     LimitFileSize,
+			Filename: spooled.Filename,
+			Limit:    limit,
+			Message:  fmt.Sprintf("%s is above the %.0f MB limit", spooled.Filename, float64(limit)/(1<<20)),
+		}
+	}
+	return spooled, nil
+}
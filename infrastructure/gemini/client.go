@@ -3,268 +3,261 @@ package gemini
 import (
 	"bytes"
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"strings"
 	"time"
 
 	"sandbox/application/dto"
+	domainErrors "sandbox/domain/errors"
 	"sandbox/domain/transaction"
+	"sandbox/domain/usage"
+	"sandbox/infrastructure/httpclient"
+	"sandbox/infrastructure/llm"
 )
 
 const (
-	geminiAPIURL = "https://generativelanguage.googleapis.com/v1beta/models/gemini-2.5-flash:generateContent"
+	// BackendName identifies the Gemini extractor in the extractor registry
+	BackendName = "gemini"
+
+	// DefaultModel is used when no model is configured
+	DefaultModel = "gemini-2.5-flash"
+	// DefaultBaseURL is the public Gemini API
+	DefaultBaseURL = "https://generativelanguage.googleapis.com"
 )
 
+var errAPIKeyMissing = errors.New("GEMINI_API_KEY is not configured. Please set the environment variable and restart the application")
+
 type Client struct {
-	apiKey     string
-	httpClient *http.Client
+	baseURL           string
+	apiKey            string
+	model             string
+	maxRepairAttempts int
+	inlineLimit       int64
+	prompts           *llm.Prompts
+	httpClient        *httpclient.Client
+	pollInterval      time.Duration
 }
 
-func NewClient(apiKey string) *Client {
+// NewClient creates a Gemini client. An empty baseURL or model uses
+// DefaultBaseURL or DefaultModel. maxRepairAttempts is how many times an
+// answer that fails validation is sent back to the model for correction.
+// Documents whose base64 encoding exceeds inlineLimit bytes in total are sent
+// through the File API instead of inline; zero uses DefaultInlineLimit.
+func NewClient(baseURL, apiKey, model string, maxRepairAttempts int, inlineLimit int64, prompts *llm.Prompts, httpClient *httpclient.Client) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	if model == "" {
+		model = DefaultModel
+	}
+	if maxRepairAttempts < 0 {
+		maxRepairAttempts = 0
+	}
+	if inlineLimit <= 0 {
+		inlineLimit = DefaultInlineLimit
+	}
+
 	return &Client{
-		apiKey: apiKey,
-		httpClient: &http.Client{
-			Timeout: 300 * time.Second, // Increased to 5 minutes for large document processing
-		},
+		baseURL:           strings.TrimRight(baseURL, "/"),
+		apiKey:            apiKey,
+		model:             model,
+		maxRepairAttempts: maxRepairAttempts,
+		inlineLimit:       inlineLimit,
+		prompts:           prompts,
+		httpClient:        httpClient,
+		pollInterval:      filePollInterval,
 	}
 }
 
-// ExtractFromDocuments implements the ExtractorRepository interface
+// ExtractFromDocuments implements the ExtractorRepository interface.
+// Output is constrained to the report schema; an answer that still fails
+// validation is sent back to the model with the violations until it passes or
+// the repair attempts run out.
 func (c *Client) ExtractFromDocuments(ctx context.Context, documents []transaction.Document) (*dto.RecapReportDTO, error) {
 	if len(documents) == 0 {
 		return nil, errors.New("no documents provided")
 	}
 
-	// Check if API key is configured
-	if c.apiKey == "" {
-		return nil, errors.New("GEMINI_API_KEY is not configured. Please set the environment variable and restart the application")
+	prompt := c.prompts.Active()
+	extractionPrompt, err := prompt.Extraction(c.prompts.Locale(), documents, transaction.AssigneeHints(ctx))
+	if err != nil {
+		return nil, err
 	}
 
-	// Check if context is already cancelled
-	if err := ctx.Err(); err != nil {
-		return nil, fmt.Errorf("context cancelled before starting API call: %w", err)
+	documentParts, cleanup, err := c.documentParts(ctx, documents)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	contents := []map[string]interface{}{
+		userContent(extractionPrompt, documentParts),
+	}
+	generationConfig := map[string]interface{}{
+		"responseMimeType": "application/json",
+		"responseSchema":   reportSchema,
 	}
+	requireTripDetails := llm.RequiresTripDetails(documents)
+
+	attempts := c.maxRepairAttempts + 1
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		rawText, err := c.generate(ctx, contents, generationConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		report, err := llm.ParseReport(rawText)
+		if err == nil {
+			err = report.ValidateExtracted(requireTripDetails)
+		}
+		if err == nil {
+			return report, nil
+		}
+
+		lastErr = err
+		log.Printf("Gemini answer failed validation (attempt %d/%d): %v", attempt, attempts, err)
 
-	prompt := c.buildPrompt()
+		repairPrompt, renderErr := prompt.Repair(err)
+		if renderErr != nil {
+			return nil, renderErr
+		}
+		contents = append(contents,
+			map[string]interface{}{
+				"role":  "model",
+				"parts": []map[string]interface{}{{"text": rawText}},
+			},
+			userContent(repairPrompt, nil),
+		)
+	}
+
+	return nil, domainErrors.NewExtractionValidationError(attempts, llm.ViolationDetails(lastErr), lastErr)
+}
+
+// Version implements the VersionedExtractor interface. It covers the model, the
+// prompts and the response schema, since each of them changes the output.
+func (c *Client) Version() string {
+	return c.model + "/" + c.prompts.Active().Version() + "/" + schemaVersion
+}
+
+// PromptVersion implements the PromptedExtractor interface
+func (c *Client) PromptVersion() string {
+	return c.prompts.Active().ID()
+}
+
+// ClassifyDocument implements the DocumentClassifier interface
+func (c *Client) ClassifyDocument(ctx context.Context, document transaction.Document) (transaction.DocumentKind, error) {
+	classificationPrompt, err := c.prompts.Active().Classification()
+	if err != nil {
+		return "", err
+	}
+
+	documentParts, cleanup, err := c.documentParts(ctx, []transaction.Document{document})
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	contents := []map[string]interface{}{
+		userContent(classificationPrompt, documentParts),
+	}
+	generationConfig := map[string]interface{}{
+		"responseMimeType": "text/x.enum",
+		"responseSchema":   documentKindSchema,
+	}
+
+	rawText, err := c.generate(ctx, contents, generationConfig)
+	if err != nil {
+		return "", err
+	}
+
+	return transaction.ParseDocumentKind(rawText), nil
+}
+
+// userContent builds a user turn holding the prompt followed by the document parts
+func userContent(prompt string, documentParts []map[string]interface{}) map[string]interface{} {
 	parts := []map[string]interface{}{
 		{"text": prompt},
 	}
+	parts = append(parts, documentParts...)
 
-	// Add all documents to the request
-	for _, doc := range documents {
-		base64Content := base64.StdEncoding.EncodeToString(doc.Content)
-		parts = append(parts, map[string]interface{}{
-			"inline_data": map[string]interface{}{
-				"mime_type": doc.MimeType,
-				"data":      base64Content,
-			},
-		})
+	return map[string]interface{}{
+		"role":  "user",
+		"parts": parts,
+	}
+}
+
+// generate sends the conversation to generateContent and returns the text of the
+// first candidate. The tokens billed for the call are recorded on the meter of ctx.
+func (c *Client) generate(ctx context.Context, contents []map[string]interface{}, generationConfig map[string]interface{}) (string, error) {
+	// Check if API key is configured
+	if c.apiKey == "" {
+		return "", errAPIKeyMissing
+	}
+
+	// Check if context is already cancelled
+	if err := ctx.Err(); err != nil {
+		return "", fmt.Errorf("context cancelled before starting API call: %w", err)
 	}
 
 	body := map[string]interface{}{
-		"contents": []map[string]interface{}{
-			{
-				"parts": parts,
-			},
-		},
+		"contents":         contents,
+		"generationConfig": generationConfig,
 	}
 
 	jsonBody, err := json.Marshal(body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+		return "", fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", c.getAPIURL(), bytes.NewBuffer(jsonBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/v1beta/models/"+c.model+":generateContent", bytes.NewBuffer(jsonBody))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return "", fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	// Sent as a header rather than in the query so that it never shows up in error messages
+	req.Header.Set("x-goog-api-key", c.apiKey)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		// Provide more detailed error information
-		if ctx.Err() != nil {
-			return nil, fmt.Errorf("context cancelled during API call: %w", ctx.Err())
-		}
-		return nil, fmt.Errorf("failed to call Gemini API: %w", err)
+		return "", fmt.Errorf("failed to call Gemini API: %w", err)
 	}
 	defer resp.Body.Close()
 
 	bodyResp, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("gemini api error (status %d): %s", resp.StatusCode, string(bodyResp))
+		return "", fmt.Errorf("failed to read response: %w", err)
 	}
 
-	return c.parseResponse(bodyResp)
-}
-
-func (c *Client) getAPIURL() string {
-	return fmt.Sprintf("%s?key=%s", geminiAPIURL, c.apiKey)
+	return c.parseResponse(ctx, bodyResp)
 }
 
-func (c *Client) buildPrompt() string {
-	return `Baca semua dokumen berikut (gambar atau PDF).
-Ekstrak setiap transaksi dan tampilkan dalam format JSON valid berikut ini:
-
-{
-  "startDate": "YYYY-MM-DD", -> ambil dari file surat tugas
-  "endDate": "YYYY-MM-DD", -> ambil dari file surat tugas
-  "activityPurpose": "TUJUAN_AKTIVITAS", -> ambil dari file surat tugas
-  "destinationCity": "KOTA_TUJUAN", -> ambil dari file surat tugas
-  "spdDate": "YYYY-MM-DD", -> ambil dari file surat tugas
-  "departureDate": "YYYY-MM-DD", -> ambil dari file surat tugas
-  "returnDate": "YYYY-MM-DD", -> ambil dari file surat tugas
-  "assignees": [
-    {
-      "name": "NAMA_PEGAWAI", -> ambil dari file surat tugas
-      "spd_number": "NOMOR_SPD", -> ambil dari file surat tugas
-      "employee_id": "NIP_PEGAWAI", -> ambil dari file surat tugas
-      "position": "JABATAN_PEGAWAI", -> ambil dari file surat tugas
-      "rank": "GOLONGAN_PEGAWAI", -> ambil dari file surat tugas
-      "transactions": [
-        {
-          "name": "NAMA_PEMESAN_TRANSAKSI",
-          "type": "accommodation | transport | other | allowance",
-          "subtype": "hotel | flight | train | taxi | daily_allowance",
-          "amount": number,
-          "total_night": number,
-          "subtotal": number, -> hasil amount*total_night kalo dia accomodation tapi kalo selain itu langsung ambil dari amount aja
-	      "description" : string, -> ini adalah keterangan transaksi ini transaksi apa, misalkan gojek dari alamat1 ke alamat2, kalo hotel jelasin juga hotelnya
-	      "transport_detail" : string, -> ini terisi hanya jika dia transport darat ya (pesawat tidak termasuk) 1.jika dia dari bandara soetta atau tujuannya ke bandara soetta maka valuenya menjadi "transport_asal" atau kalau dia transportasinya di jakarta juga masuk trasnport asal 2.jika mengandung bandara lain selain soetta maka valuenya adalah "transport_daerah"
-        }
-      ]
-    }
-  ]
-}
-
-- Kembalikan hasil hanya dalam JSON valid (tanpa teks tambahan).
-- Jangan bungkus JSON dengan tanda kutip atau karakter escape.
-- Jika total_night tidak ada, field tersebut boleh dihapus.
-- Pastikan angka hanya berupa digit (tanpa simbol mata uang).
-- Untuk data transaksi, nama yang digunakan harus sesuai dengan nama yang tercantum di surat tugas. Harap lakukan pengecekan dan pencocokan dengan surat tugas.
-- Jika nama pemesan di transaksi tersebut tidak tercantum di surat tugas, mohon assign ke salah satu nama yang ada di surat tugas.
-- Jangan menggunakan nama driver sebagai nama transaksi — gunakan nama pemesan.
-- Group semua transaksi di bawah setiap assignee.
-
-di bawah ini data uang harian aku minta untuk ambil datanya untuk di masukkan ke transactions sesuai dengan kota tujuannya yang ada di surat tugas misalnya dia di surabaya maka dia akan mengambil data jawa timur karena surabaya terletak di jawa timur dan jadikan datanya sebagai allowance
-NO,PROVINSI,SATUAN,LUAR KOTA,DALAM KOTA LEBIH DARI 8 JAM,DIKLAT
-1,ACEH,OH,Rp360.000,Rp140.000,Rp110.000
-2,SUMATRA UTARA,OH,Rp370.000,Rp150.000,Rp110.000
-3,RIAU,OH,Rp370.000,Rp150.000,Rp110.000
-4,KEPULAUAN RIAU,OH,Rp370.000,Rp150.000,Rp110.000
-5,JAMBI,OH,Rp370.000,Rp150.000,Rp110.000
-6,SUMATRA BARAT,OH,Rp380.000,Rp150.000,Rp110.000
-7,SUMATRA SELATAN,OH,Rp380.000,Rp150.000,Rp110.000
-8,LAMPUNG,OH,Rp380.000,Rp150.000,Rp110.000
-9,BENGKULU,OH,Rp380.000,Rp150.000,Rp110.000
-10,BANGKA BELITUNG,OH,Rp410.000,Rp160.000,Rp120.000
-11,BANTEN,OH,Rp370.000,Rp150.000,Rp110.000
-12,JAWA BARAT,OH,Rp430.000,Rp170.000,Rp130.000
-13,D.K.I. JAKARTA,OH,Rp530.000,Rp210.000,Rp160.000
-14,JAWA TENGAH,OH,Rp370.000,Rp150.000,Rp110.000
-15,D.I. YOGYAKARTA,OH,Rp420.000,Rp170.000,Rp130.000
-16,JAWA TIMUR,OH,Rp410.000,Rp160.000,Rp120.000
-17,BALI,OH,Rp480.000,Rp190.000,Rp140.000
-18,NUSA TENGGARA BARAT,OH,Rp440.000,Rp190.000,Rp130.000
-19,NUSA TENGGARA TIMUR,OH,Rp430.000,Rp170.000,Rp130.000
-20,KALIMANTAN BARAT,OH,Rp380.000,Rp150.000,Rp110.000
-21,KALIMANTAN TENGAH,OH,Rp360.000,Rp140.000,Rp110.000
-22,KALIMANTAN SELATAN,OH,Rp380.000,Rp150.000,Rp110.000
-23,KALIMANTAN TIMUR,OH,Rp430.000,Rp170.000,Rp130.000
-24,KALIMANTAN UTARA,OH,Rp430.000,Rp170.000,Rp130.000
-25,SULAWESI UTARA,OH,Rp370.000,Rp150.000,Rp110.000
-26,GORONTALO,OH,Rp370.000,Rp150.000,Rp110.000
-27,SULAWESI BARAT,OH,Rp410.000,Rp160.000,Rp120.000
-28,SULAWESI SELATAN,OH,Rp430.000,Rp170.000,Rp130.000
-29,SULAWESI TENGAH,OH,Rp370.000,Rp150.000,Rp110.000
-30,SULAWESI TENGGARA,OH,Rp380.000,Rp150.000,Rp110.000
-31,MALUKU,OH,Rp380.000,Rp150.000,Rp110.000
-32,MALUKU UTARA,OH,Rp430.000,Rp170.000,Rp130.000
-33,PAPUA,OH,Rp580.000,Rp230.000,Rp170.000
-34,PAPUA BARAT,OH,Rp480.000,Rp190.000,Rp140.000
-35,PAPUA BARAT DAYA,OH,Rp480.000,Rp190.000,Rp140.000
-36,PAPUA TENGAH,OH,Rp580.000,Rp230.000,Rp170.000
-37,PAPUA SELATAN,OH,Rp580.000,Rp230.000,Rp170.000
-38,PAPUA PEGUNUNGAN,OH,Rp580.000,Rp230.000,Rp170.000
-`
-}
-
-func (c *Client) parseResponse(bodyResp []byte) (*dto.RecapReportDTO, error) {
+func (c *Client) parseResponse(ctx context.Context, bodyResp []byte) (string, error) {
 	var geminiAPIResponse geminiResponse
 	if err := json.Unmarshal(bodyResp, &geminiAPIResponse); err != nil {
-		return nil, fmt.Errorf("failed to parse Gemini API response wrapper: %w", err)
-	}
-
-	if len(geminiAPIResponse.Candidates) == 0 || len(geminiAPIResponse.Candidates[0].Content.Parts) == 0 {
-		return nil, errors.New("empty response candidates or parts from Gemini API")
-	}
-
-	rawText := geminiAPIResponse.Candidates[0].Content.Parts[0].Text
-	cleanJSON := c.cleanJSON(rawText)
-
-	var geminiRawReport geminiReportResponse
-	if err := json.Unmarshal([]byte(cleanJSON), &geminiRawReport); err != nil {
-		return nil, fmt.Errorf("failed to parse Gemini report content: %w (raw: %s)", err, cleanJSON)
+		return "", fmt.Errorf("failed to parse Gemini API response wrapper: %w", err)
 	}
 
-	geminiRawReport.ReceiptSignatureDate = time.Now().Format("2006-01-02")
-
-	assignees := make([]dto.AssigneeDTO, 0, len(geminiRawReport.Assignees))
-	for _, rawAssignee := range geminiRawReport.Assignees {
-		transactionsDTO := make([]dto.TransactionDTO, 0, len(rawAssignee.Transactions))
-		for _, rawTx := range rawAssignee.Transactions {
-			transactionsDTO = append(transactionsDTO, dto.TransactionDTO{
-				Name:            rawTx.Name,
-				Type:            rawTx.Type,
-				Subtype:         rawTx.Subtype,
-				Amount:          rawTx.Amount,
-				TotalNight:      rawTx.TotalNight,
-				Subtotal:        rawTx.Subtotal,
-				PaymentType:     "", // Assuming default empty, needs to be derived if applicable
-				Description:     rawTx.Description,
-				TransportDetail: rawTx.TransportDetail,
-			})
-		}
+	// Tokens are billed even when the answer turns out to be unusable
+	meta := geminiAPIResponse.UsageMetadata
+	usage.Record(ctx, usage.Tokens{
+		Prompt:     meta.PromptTokenCount,
+		Candidates: meta.CandidatesTokenCount,
+		Total:      meta.TotalTokenCount,
+		Calls:      1,
+	})
 
-		assignees = append(assignees, dto.AssigneeDTO{
-			Name:         rawAssignee.Name,
-			SpdNumber:    rawAssignee.SpdNumber,
-			EmployeeID:   rawAssignee.EmployeeID,
-			Position:     rawAssignee.Position,
-			Rank:         rawAssignee.Rank,
-			Transactions: transactionsDTO,
-		})
+	if len(geminiAPIResponse.Candidates) == 0 || len(geminiAPIResponse.Candidates[0].Content.Parts) == 0 {
+		return "", errors.New("empty response candidates or parts from Gemini API")
 	}
 
-	return &dto.RecapReportDTO{
-		StartDate:            geminiRawReport.StartDate,
-		EndDate:              geminiRawReport.EndDate,
-		ActivityPurpose:      geminiRawReport.ActivityPurpose,
-		DestinationCity:      geminiRawReport.DestinationCity,
-		SpdDate:              geminiRawReport.SpdDate,
-		DepartureDate:        geminiRawReport.DepartureDate,
-		ReturnDate:           geminiRawReport.ReturnDate,
-		ReceiptSignatureDate: geminiRawReport.ReceiptSignatureDate,
-		Assignees:            assignees,
-	}, nil
-}
-
-func (c *Client) cleanJSON(s string) string {
-	s = strings.TrimSpace(s)
-	s = strings.TrimPrefix(s, "```json")
-	s = strings.TrimPrefix(s, "```JSON")
-	s = strings.TrimSuffix(s, "```")
-	return strings.TrimSpace(s)
+	return geminiAPIResponse.Candidates[0].Content.Parts[0].Text, nil
 }
 
 type geminiResponse struct {
@@ -275,36 +268,9 @@ type geminiResponse struct {
 			} `json:"parts"`
 		} `json:"content"`
 	} `json:"candidates"`
-}
-
-type geminiReportResponse struct {
-	StartDate            string                `json:"startDate"`
-	EndDate              string                `json:"endDate"`
-	ActivityPurpose      string                `json:"activityPurpose"`
-	DestinationCity      string                `json:"destinationCity"`
-	SpdDate              string                `json:"spdDate"`
-	DepartureDate        string                `json:"departureDate"`
-	ReturnDate           string                `json:"returnDate"`
-	ReceiptSignatureDate string                `json:"receiptSignatureDate"`
-	Assignees            []rawAssigneeResponse `json:"assignees"`
-}
-
-type rawAssigneeResponse struct {
-	Name         string           `json:"name"`
-	SpdNumber    string           `json:"spd_number"`
-	EmployeeID   string           `json:"employee_id"`
-	Position     string           `json:"position"`
-	Rank         string           `json:"rank"`
-	Transactions []rawTransaction `json:"transactions"`
-}
-
-type rawTransaction struct {
-	Name            string `json:"name"`
-	Type            string `json:"type"`
-	Subtype         string `json:"subtype"`
-	Amount          int32  `json:"amount"`
-	TotalNight      *int32 `json:"total_night,omitempty"`
-	Subtotal        int32  `json:"subtotal"`
-	Description     string `json:"description"`
-	TransportDetail string `json:"transport_detail"`
+	UsageMetadata struct {
+		PromptTokenCount     int64 `json:"promptTokenCount"`
+		CandidatesTokenCount int64 `json:"candidatesTokenCount"`
+		TotalTokenCount      int64 `json:"totalTokenCount"`
+	} `json:"usageMetadata"`
 }
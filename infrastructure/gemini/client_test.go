@@ -0,0 +1,114 @@
+package gemini
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	domainErrors "sandbox/domain/errors"
+	"sandbox/domain/transaction"
+	"sandbox/domain/usage"
+	"sandbox/infrastructure/httpclient"
+	"sandbox/infrastructure/llm"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// scriptedClient returns a client whose requests are answered with the given model texts in order
+func scriptedClient(t *testing.T, answers ...string) (*Client, *[]map[string]interface{}) {
+	t.Helper()
+
+	prompts, err := llm.NewPrompts("", "", "id-ID")
+	if err != nil {
+		t.Fatalf("failed to load prompt templates: %v", err)
+	}
+
+	var requests []map[string]interface{}
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		requests = append(requests, body)
+
+		answer := answers[len(requests)-1]
+		payload, _ := json.Marshal(map[string]interface{}{
+			"candidates": []map[string]interface{}{
+				{"content": map[string]interface{}{"parts": []map[string]interface{}{{"text": answer}}}},
+			},
+			"usageMetadata": map[string]interface{}{
+				"promptTokenCount": 1200, "candidatesTokenCount": 300, "totalTokenCount": 1600,
+			},
+		})
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(bytes.NewReader(payload)),
+			Header:     make(http.Header),
+		}, nil
+	})
+	client := NewClient("", "test-key", "", len(answers)-1, 0, prompts, httpclient.New(BackendName, httpclient.Config{Transport: transport}))
+
+	return client, &requests
+}
+
+func TestExtractFromDocumentsRepairsInvalidAnswer(t *testing.T) {
+	invalid := `{"assignees":[{"name":"Budi","transactions":[{"name":"Budi","type":"transport","subtype":"taxi","amount":0,"subtotal":0,"description":"Grab"}]}]}`
+	valid := `{"assignees":[{"name":"Budi","transactions":[{"name":"Budi","type":"transport","subtype":"taxi","amount":75000,"subtotal":75000,"description":"Grab"}]}]}`
+
+	client, requests := scriptedClient(t, invalid, valid)
+	meter := &usage.Meter{}
+	report, err := client.ExtractFromDocuments(usage.WithMeter(context.Background(), meter), []transaction.Document{
+		{Filename: "grab.png", MimeType: "image/png", Content: []byte("png"), Kind: transaction.DocumentKindRideReceipt},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := report.Assignees[0].Transactions[0].Subtotal; got != 75000 {
+		t.Errorf("expected repaired subtotal 75000, got %d", got)
+	}
+
+	if len(*requests) != 2 {
+		t.Fatalf("expected 2 calls, got %d", len(*requests))
+	}
+	if tokens := meter.Tokens(); tokens.Calls != 2 || tokens.Prompt != 2400 || tokens.Total != 3200 {
+		t.Errorf("expected the tokens of both calls to be metered, got %+v", tokens)
+	}
+	first := (*requests)[0]
+	config := first["generationConfig"].(map[string]interface{})
+	if config["responseMimeType"] != "application/json" || config["responseSchema"] == nil {
+		t.Errorf("expected schema-constrained JSON output, got %v", config)
+	}
+
+	repair := (*requests)[1]["contents"].([]interface{})
+	if len(repair) != 3 {
+		t.Fatalf("expected original turn, model answer and repair turn, got %d turns", len(repair))
+	}
+	repairText, _ := json.Marshal(repair[2])
+	if !strings.Contains(string(repairText), "amount") {
+		t.Errorf("expected repair turn to mention the failing field, got %s", repairText)
+	}
+}
+
+func TestExtractFromDocumentsGivesUpWithStructuredError(t *testing.T) {
+	client, _ := scriptedClient(t, "not json", "still not json")
+	_, err := client.ExtractFromDocuments(context.Background(), []transaction.Document{
+		{Filename: "grab.png", MimeType: "image/png", Content: []byte("png"), Kind: transaction.DocumentKindRideReceipt},
+	})
+
+	var domainErr *domainErrors.DomainError
+	if !errors.As(err, &domainErr) || domainErr.Code != "EXTRACTION_VALIDATION_ERROR" {
+		t.Fatalf("expected EXTRACTION_VALIDATION_ERROR, got %v", err)
+	}
+	if !errors.Is(err, domainErrors.ErrExtraction) {
+		t.Errorf("expected error to wrap ErrExtraction")
+	}
+}
@@ -0,0 +1,306 @@
+package gemini
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"sandbox/domain/transaction"
+	"sandbox/infrastructure/httpclient"
+)
+
+const (
+	// DefaultInlineLimit is the base64 payload size above which documents are
+	// uploaded through the File API. Gemini rejects requests over 20MB.
+	DefaultInlineLimit = 18 << 20
+
+	// filePollInterval is how often an uploaded file is checked until Gemini has processed it
+	filePollInterval = 2 * time.Second
+)
+
+// Processing states of an uploaded file
+const (
+	fileStateProcessing = "PROCESSING"
+	fileStateActive     = "ACTIVE"
+	fileStateFailed     = "FAILED"
+)
+
+// uploadedFile is a file stored with the File API
+type uploadedFile struct {
+	Name     string `json:"name"`
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType"`
+	State    string `json:"state"`
+}
+
+type uploadSessionKey struct{}
+
+// uploadSession holds the documents uploaded during one extraction run, so
+// that classifying and extracting a document share a single upload
+type uploadSession struct {
+	mu      sync.Mutex
+	uploads map[[sha256.Size]byte]*sessionUpload
+}
+
+type sessionUpload struct {
+	mu   sync.Mutex
+	file *uploadedFile
+}
+
+// BeginSession implements the SessionExtractor interface. Documents uploaded
+// through the File API while the session is open are reused by later calls,
+// and deleted when it ends.
+func (c *Client) BeginSession(ctx context.Context) (context.Context, func()) {
+	session := &uploadSession{uploads: make(map[[sha256.Size]byte]*sessionUpload)}
+	end := func() {
+		session.mu.Lock()
+		defer session.mu.Unlock()
+
+		// The documents must go even when the extraction was cancelled
+		deleteCtx := context.WithoutCancel(ctx)
+		for _, upload := range session.uploads {
+			if upload.file == nil {
+				continue
+			}
+			if err := c.deleteFile(deleteCtx, upload.file.Name); err != nil {
+				log.Printf("Failed to delete uploaded Gemini file %s: %v", upload.file.Name, err)
+			}
+		}
+	}
+	return context.WithValue(ctx, uploadSessionKey{}, session), end
+}
+
+// upload returns the copy of doc uploaded earlier in the session, uploading it
+// on first use. A failed upload is tried again by the next call.
+func (s *uploadSession) upload(ctx context.Context, c *Client, doc transaction.Document) (*uploadedFile, error) {
+	key := sha256.Sum256(append([]byte(doc.MimeType+"\x00"), doc.Content...))
+
+	s.mu.Lock()
+	upload, ok := s.uploads[key]
+	if !ok {
+		upload = &sessionUpload{}
+		s.uploads[key] = upload
+	}
+	s.mu.Unlock()
+
+	upload.mu.Lock()
+	defer upload.mu.Unlock()
+	if upload.file == nil {
+		file, err := c.uploadFile(ctx, doc)
+		if err != nil {
+			return nil, err
+		}
+		upload.file = file
+	}
+	return upload.file, nil
+}
+
+// documentParts returns the request parts carrying documents: inline data when
+// the documents fit within the inline limit, otherwise references to copies
+// uploaded through the File API. Within a session started by BeginSession
+// each document is uploaded once and kept until the session ends; otherwise
+// the returned cleanup deletes the uploads and must be called once the parts
+// are no longer needed.
+func (c *Client) documentParts(ctx context.Context, documents []transaction.Document) ([]map[string]interface{}, func(), error) {
+	// Without a key no request can succeed, so nothing is uploaded
+	if c.apiKey == "" {
+		return nil, nil, errAPIKeyMissing
+	}
+
+	var payload int64
+	for _, doc := range documents {
+		payload += int64(base64.StdEncoding.EncodedLen(len(doc.Content)))
+	}
+
+	if payload <= c.inlineLimit {
+		parts := make([]map[string]interface{}, len(documents))
+		for i, doc := range documents {
+			parts[i] = map[string]interface{}{
+				"inline_data": map[string]interface{}{
+					"mime_type": doc.MimeType,
+					"data":      base64.StdEncoding.EncodeToString(doc.Content),
+				},
+			}
+		}
+		return parts, func() {}, nil
+	}
+
+	var uploaded []uploadedFile
+	cleanup := func() {
+		// The documents must go even when the request that uploaded them was cancelled
+		deleteCtx := context.WithoutCancel(ctx)
+		for _, file := range uploaded {
+			if err := c.deleteFile(deleteCtx, file.Name); err != nil {
+				log.Printf("Failed to delete uploaded Gemini file %s: %v", file.Name, err)
+			}
+		}
+	}
+
+	session, _ := ctx.Value(uploadSessionKey{}).(*uploadSession)
+	parts := make([]map[string]interface{}, len(documents))
+	for i, doc := range documents {
+		var file *uploadedFile
+		var err error
+		if session != nil {
+			file, err = session.upload(ctx, c, doc)
+		} else if file, err = c.uploadFile(ctx, doc); err == nil {
+			uploaded = append(uploaded, *file)
+		}
+		if err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("failed to upload %s to the Gemini File API: %w", doc.Filename, err)
+		}
+
+		parts[i] = map[string]interface{}{
+			"file_data": map[string]interface{}{
+				"mime_type": doc.MimeType,
+				"file_uri":  file.URI,
+			},
+		}
+	}
+	return parts, cleanup, nil
+}
+
+// uploadFile stores doc with a resumable upload and waits until it can be used
+func (c *Client) uploadFile(ctx context.Context, doc transaction.Document) (*uploadedFile, error) {
+	uploadURL, err := c.startUpload(ctx, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	// Finalizing twice after a lost answer could store the document twice, so
+	// this call is not repeated after a server error
+	req, err := http.NewRequestWithContext(httpclient.WithoutUnsafeRetries(ctx), http.MethodPost, uploadURL, bytes.NewReader(doc.Content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload request: %w", err)
+	}
+	req.Header.Set("X-Goog-Upload-Command", "upload, finalize")
+	req.Header.Set("X-Goog-Upload-Offset", "0")
+
+	var uploaded struct {
+		File uploadedFile `json:"file"`
+	}
+	if err := c.doJSON(req, &uploaded); err != nil {
+		return nil, err
+	}
+	if uploaded.File.URI == "" {
+		return nil, errors.New("upload response has no file URI")
+	}
+
+	file, err := c.waitActive(ctx, uploaded.File)
+	if err != nil {
+		// The document is stored even though it cannot be used, and must go
+		// even when waiting was cancelled
+		if deleteErr := c.deleteFile(context.WithoutCancel(ctx), uploaded.File.Name); deleteErr != nil {
+			log.Printf("Failed to delete uploaded Gemini file %s: %v", uploaded.File.Name, deleteErr)
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+// startUpload opens a resumable upload session and returns its URL
+func (c *Client) startUpload(ctx context.Context, doc transaction.Document) (string, error) {
+	metadata, err := json.Marshal(map[string]interface{}{
+		"file": map[string]interface{}{"display_name": doc.Filename},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal file metadata: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/upload/v1beta/files", bytes.NewReader(metadata))
+	if err != nil {
+		return "", fmt.Errorf("failed to create upload request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-goog-api-key", c.apiKey)
+	req.Header.Set("X-Goog-Upload-Protocol", "resumable")
+	req.Header.Set("X-Goog-Upload-Command", "start")
+	req.Header.Set("X-Goog-Upload-Header-Content-Length", strconv.Itoa(len(doc.Content)))
+	req.Header.Set("X-Goog-Upload-Header-Content-Type", doc.MimeType)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	uploadURL := resp.Header.Get("X-Goog-Upload-URL")
+	if uploadURL == "" {
+		return "", errors.New("upload session has no upload URL")
+	}
+	return uploadURL, nil
+}
+
+// waitActive polls file until Gemini has finished processing it. PDFs are
+// usually ready at once; the wait is bounded by ctx.
+func (c *Client) waitActive(ctx context.Context, file uploadedFile) (*uploadedFile, error) {
+	for {
+		switch file.State {
+		case fileStateActive, "":
+			return &file, nil
+		case fileStateFailed:
+			return nil, fmt.Errorf("gemini could not process uploaded file %s", file.Name)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for uploaded file %s: %w", file.Name, ctx.Err())
+		case <-time.After(c.pollInterval):
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/v1beta/"+file.Name, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create file status request: %w", err)
+		}
+		req.Header.Set("x-goog-api-key", c.apiKey)
+
+		var current uploadedFile
+		if err := c.doJSON(req, &current); err != nil {
+			return nil, err
+		}
+		file = current
+	}
+}
+
+// deleteFile removes an uploaded file. Gemini would drop it after 48 hours, but
+// the documents hold personal data and should not be kept longer than needed.
+func (c *Client) deleteFile(ctx context.Context, name string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, c.baseURL+"/v1beta/"+name, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create delete request: %w", err)
+	}
+	req.Header.Set("x-goog-api-key", c.apiKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// doJSON sends req and decodes the JSON response into out
+func (c *Client) doJSON(req *http.Request, out interface{}) error {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to parse File API response: %w", err)
+	}
+	return nil
+}
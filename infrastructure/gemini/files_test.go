@@ -0,0 +1,225 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"sandbox/domain/transaction"
+	"sandbox/infrastructure/httpclient"
+	"sandbox/infrastructure/llm"
+)
+
+// fakeFileAPI serves the File API and generateContent endpoints used by the client
+type fakeFileAPI struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu       sync.Mutex
+	starts   int
+	uploads  map[string][]byte // file name -> content
+	polled   map[string]bool
+	deleted  []string
+	generate []map[string]interface{}
+	// pollState is the state reported once an upload is polled
+	pollState string
+}
+
+func newFakeFileAPI(t *testing.T, answer string) *fakeFileAPI {
+	f := &fakeFileAPI{t: t, uploads: make(map[string][]byte), polled: make(map[string]bool), pollState: "ACTIVE"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /upload/v1beta/files", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.starts++
+		f.mu.Unlock()
+		if r.Header.Get("X-Goog-Upload-Command") != "start" || r.Header.Get("x-goog-api-key") != "test-key" {
+			http.Error(w, "bad start request", http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		id := fmt.Sprintf("doc%d", len(f.uploads)+1)
+		f.uploads["files/"+id] = nil
+		f.mu.Unlock()
+		w.Header().Set("X-Goog-Upload-URL", f.server.URL+"/upload/session/"+id)
+	})
+	mux.HandleFunc("POST /upload/session/{id}", func(w http.ResponseWriter, r *http.Request) {
+		content, _ := io.ReadAll(r.Body)
+		name := "files/" + r.PathValue("id")
+		f.mu.Lock()
+		f.uploads[name] = content
+		f.mu.Unlock()
+		writeJSON(w, map[string]interface{}{"file": f.file(name, "PROCESSING")})
+	})
+	mux.HandleFunc("GET /v1beta/files/{id}", func(w http.ResponseWriter, r *http.Request) {
+		name := "files/" + r.PathValue("id")
+		f.mu.Lock()
+		f.polled[name] = true
+		state := f.pollState
+		f.mu.Unlock()
+		writeJSON(w, f.file(name, state))
+	})
+	mux.HandleFunc("DELETE /v1beta/files/{id}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.deleted = append(f.deleted, "files/"+r.PathValue("id"))
+		f.mu.Unlock()
+		writeJSON(w, map[string]interface{}{})
+	})
+	mux.HandleFunc("POST /v1beta/models/{model}", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.generate = append(f.generate, body)
+		f.mu.Unlock()
+		writeJSON(w, map[string]interface{}{
+			"candidates": []map[string]interface{}{
+				{"content": map[string]interface{}{"parts": []map[string]interface{}{{"text": answer}}}},
+			},
+		})
+	})
+
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeFileAPI) file(name, state string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":     name,
+		"uri":      f.server.URL + "/v1beta/" + name,
+		"mimeType": "application/pdf",
+		"state":    state,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestExtractFromDocumentsUploadsLargeDocumentsThroughFileAPI(t *testing.T) {
+	answer := `{"assignees":[{"name":"Budi","transactions":[{"name":"Budi","type":"transport","subtype":"taxi","amount":75000,"subtotal":75000,"description":"Grab"}]}]}`
+	fake := newFakeFileAPI(t, answer)
+
+	prompts, err := llm.NewPrompts("", "", "id-ID")
+	if err != nil {
+		t.Fatalf("failed to load prompt templates: %v", err)
+	}
+	client := NewClient(fake.server.URL, "test-key", "", 0, 16, prompts, httpclient.New(BackendName, httpclient.Config{}))
+	client.pollInterval = time.Millisecond
+
+	documents := []transaction.Document{
+		{Filename: "surat_tugas.pdf", MimeType: "application/pdf", Content: []byte(strings.Repeat("scan", 10))},
+		{Filename: "grab.pdf", MimeType: "application/pdf", Content: []byte("receipt")},
+	}
+	if _, err := client.ExtractFromDocuments(context.Background(), documents); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(fake.uploads) != 2 || string(fake.uploads["files/doc1"]) != string(documents[0].Content) {
+		t.Fatalf("expected both documents to be uploaded, got %d uploads", len(fake.uploads))
+	}
+	if !fake.polled["files/doc1"] || !fake.polled["files/doc2"] {
+		t.Errorf("expected the client to wait for processing to finish, polled %v", fake.polled)
+	}
+
+	if len(fake.generate) != 1 {
+		t.Fatalf("expected 1 generate call, got %d", len(fake.generate))
+	}
+	request, _ := json.Marshal(fake.generate[0])
+	if strings.Contains(string(request), "inline_data") {
+		t.Errorf("expected no inline documents, got %s", request)
+	}
+	for _, name := range []string{"files/doc1", "files/doc2"} {
+		if !strings.Contains(string(request), fake.server.URL+"/v1beta/"+name) {
+			t.Errorf("expected the request to reference %s, got %s", name, request)
+		}
+	}
+
+	if len(fake.deleted) != 2 {
+		t.Errorf("expected both uploads to be deleted, deleted %v", fake.deleted)
+	}
+}
+
+func TestSessionUploadsDocumentOnceForClassificationAndExtraction(t *testing.T) {
+	answer := `{"assignees":[{"name":"Budi","transactions":[{"name":"Budi","type":"transport","subtype":"taxi","amount":75000,"subtotal":75000,"description":"Grab"}]}]}`
+	fake := newFakeFileAPI(t, answer)
+
+	prompts, err := llm.NewPrompts("", "", "id-ID")
+	if err != nil {
+		t.Fatalf("failed to load prompt templates: %v", err)
+	}
+	client := NewClient(fake.server.URL, "test-key", "", 0, 16, prompts, httpclient.New(BackendName, httpclient.Config{}))
+	client.pollInterval = time.Millisecond
+
+	document := transaction.Document{Filename: "grab.pdf", MimeType: "application/pdf", Content: []byte(strings.Repeat("scan", 10))}
+	ctx, end := client.BeginSession(context.Background())
+	if _, err := client.ClassifyDocument(ctx, document); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := client.ExtractFromDocuments(ctx, []transaction.Document{document}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(fake.uploads) != 1 || len(fake.generate) != 2 {
+		t.Fatalf("expected 1 upload shared by 2 generate calls, got %d uploads and %d calls", len(fake.uploads), len(fake.generate))
+	}
+	if len(fake.deleted) != 0 {
+		t.Errorf("expected the upload to be kept until the session ends, deleted %v", fake.deleted)
+	}
+
+	end()
+	if len(fake.deleted) != 1 || fake.deleted[0] != "files/doc1" {
+		t.Errorf("expected the upload to be deleted when the session ends, deleted %v", fake.deleted)
+	}
+}
+
+func TestUploadDeletesFileGeminiCannotProcess(t *testing.T) {
+	fake := newFakeFileAPI(t, `{"assignees":[]}`)
+	fake.pollState = "FAILED"
+
+	prompts, err := llm.NewPrompts("", "", "id-ID")
+	if err != nil {
+		t.Fatalf("failed to load prompt templates: %v", err)
+	}
+	client := NewClient(fake.server.URL, "test-key", "", 0, 16, prompts, httpclient.New(BackendName, httpclient.Config{}))
+	client.pollInterval = time.Millisecond
+
+	documents := []transaction.Document{{Filename: "hotel.pdf", MimeType: "application/pdf", Content: []byte(strings.Repeat("scan", 10))}}
+	if _, err := client.ExtractFromDocuments(context.Background(), documents); err == nil {
+		t.Fatal("expected an error for a file Gemini could not process")
+	}
+
+	if len(fake.deleted) != 1 || fake.deleted[0] != "files/doc1" {
+		t.Errorf("expected the failed upload to be deleted, deleted %v", fake.deleted)
+	}
+}
+
+func TestExtractFromDocumentsUploadsNothingWithoutAPIKey(t *testing.T) {
+	fake := newFakeFileAPI(t, `{"assignees":[]}`)
+
+	prompts, err := llm.NewPrompts("", "", "id-ID")
+	if err != nil {
+		t.Fatalf("failed to load prompt templates: %v", err)
+	}
+	client := NewClient(fake.server.URL, "", "", 0, 16, prompts, httpclient.New(BackendName, httpclient.Config{}))
+
+	documents := []transaction.Document{{Filename: "hotel.pdf", MimeType: "application/pdf", Content: []byte(strings.Repeat("scan", 10))}}
+	if _, err := client.ExtractFromDocuments(context.Background(), documents); err == nil {
+		t.Fatal("expected an error without an API key")
+	}
+
+	if fake.starts != 0 {
+		t.Errorf("expected nothing to be uploaded without an API key, started %d uploads", fake.starts)
+	}
+}
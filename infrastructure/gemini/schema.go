@@ -0,0 +1,108 @@
+package gemini
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"sandbox/domain/transaction"
+	"sandbox/infrastructure/llm"
+)
+
+var (
+	// reportSchema constrains generateContent output to the shape of llm.ReportResponse
+	reportSchema = schemaFor(reflect.TypeOf(llm.ReportResponse{}))
+
+	// schemaVersion changes whenever the report schema does
+	schemaVersion = func() string {
+		data, _ := json.Marshal(reportSchema)
+		sum := sha256.Sum256(data)
+		return hex.EncodeToString(sum[:6])
+	}()
+
+	// documentKindSchema constrains classification output to one of the known document kinds
+	documentKindSchema = map[string]interface{}{
+		"type": "STRING",
+		"enum": []string{
+			string(transaction.DocumentKindAssignmentLetter),
+			string(transaction.DocumentKindFlightTicket),
+			string(transaction.DocumentKindHotelInvoice),
+			string(transaction.DocumentKindRideReceipt),
+			string(transaction.DocumentKindOther),
+		},
+	}
+)
+
+// schemaFor converts a Go type into the OpenAPI subset accepted as responseSchema.
+// Fields are required unless their json tag has omitempty; an enum tag lists the
+// allowed values of a string field.
+func schemaFor(t reflect.Type) map[string]interface{} {
+	nullable := false
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		nullable = true
+	}
+
+	var schema map[string]interface{}
+	switch t.Kind() {
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		ordering := make([]string, 0, t.NumField())
+		required := make([]string, 0, t.NumField())
+
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if tag == "-" || !field.IsExported() {
+				continue
+			}
+
+			name, opts, _ := strings.Cut(tag, ",")
+			if name == "" {
+				name = field.Name
+			}
+
+			property := schemaFor(field.Type)
+			if enum := field.Tag.Get("enum"); enum != "" {
+				property["enum"] = strings.Split(enum, ",")
+			}
+
+			properties[name] = property
+			ordering = append(ordering, name)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+
+		schema = map[string]interface{}{
+			"type":             "OBJECT",
+			"properties":       properties,
+			"propertyOrdering": ordering,
+		}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+	case reflect.Slice, reflect.Array:
+		schema = map[string]interface{}{
+			"type":  "ARRAY",
+			"items": schemaFor(t.Elem()),
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		schema = map[string]interface{}{"type": "INTEGER"}
+	case reflect.Float32, reflect.Float64:
+		schema = map[string]interface{}{"type": "NUMBER"}
+	case reflect.Bool:
+		schema = map[string]interface{}{"type": "BOOLEAN"}
+	default:
+		schema = map[string]interface{}{"type": "STRING"}
+	}
+
+	if nullable {
+		schema["nullable"] = true
+	}
+
+	return schema
+}
@@ -0,0 +1,265 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	domainErrors "sandbox/domain/errors"
+)
+
+const (
+	// maxErrorBody bounds how much of a failed response is kept in the error
+	maxErrorBody = 4 << 10
+
+	defaultBaseDelay = 500 * time.Millisecond
+	defaultMaxDelay  = 30 * time.Second
+)
+
+// Config tunes retries and the circuit breaker of a Client
+type Config struct {
+	// Timeout bounds a single attempt, including reading the response headers
+	Timeout time.Duration
+	// MaxRetries is how many times a failed attempt is repeated
+	MaxRetries int
+	// BaseDelay is the backoff before the first retry; it doubles on every retry
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff. A Retry-After longer than this is not waited for.
+	MaxDelay time.Duration
+	// BreakerThreshold is the number of consecutive failures that opens the
+	// circuit; zero disables the breaker
+	BreakerThreshold int
+	// BreakerCooldown is how long an open circuit rejects calls before probing
+	BreakerCooldown time.Duration
+	// RetryUnsafe allows retrying POST and PATCH requests after a 5xx or a network
+	// error. Only set it for services whose calls have no side effects, since the
+	// failed attempt may have been processed. 429 and 503 are always retried.
+	RetryUnsafe bool
+	// Transport overrides the underlying round tripper, mainly for tests
+	Transport http.RoundTripper
+}
+
+// Client performs HTTP calls to one external service with retries, backoff and
+// a circuit breaker shared by every call to that service. Every response that
+// is not 2xx is turned into a domain external service error.
+type Client struct {
+	service    string
+	cfg        Config
+	httpClient *http.Client
+	breaker    *breaker
+	sleep      func(ctx context.Context, d time.Duration) error
+}
+
+// New creates a client for the named service
+func New(service string, cfg Config) *Client {
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+	if cfg.BaseDelay <= 0 {
+		cfg.BaseDelay = defaultBaseDelay
+	}
+	if cfg.MaxDelay <= 0 {
+		cfg.MaxDelay = defaultMaxDelay
+	}
+
+	return &Client{
+		service: service,
+		cfg:     cfg,
+		httpClient: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: cfg.Transport,
+		},
+		breaker: newBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown),
+		sleep:   sleepContext,
+	}
+}
+
+// Service returns the name used in errors and logs
+func (c *Client) Service() string {
+	return c.service
+}
+
+// Do sends req and returns the response of the first successful attempt. The
+// caller must close its body. Requests with a body must be replayable, which
+// is the case for bodies built from bytes.Buffer, bytes.Reader or strings.Reader.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	for attempt := 0; ; attempt++ {
+		if !c.breaker.allow() {
+			return nil, domainErrors.NewExternalServiceError(c.service, http.StatusServiceUnavailable, ErrCircuitOpen)
+		}
+
+		resp, err := c.attempt(req, attempt)
+		if err == nil {
+			c.breaker.success()
+			return resp, nil
+		}
+
+		if ctx.Err() != nil {
+			c.breaker.release()
+			return nil, fmt.Errorf("%s call cancelled: %w", c.service, ctx.Err())
+		}
+
+		statusCode, retryAfter := 0, time.Duration(0)
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) {
+			statusCode, retryAfter = statusErr.StatusCode, statusErr.RetryAfter
+		}
+
+		if statusCode == 0 || statusCode == http.StatusTooManyRequests || statusCode >= 500 {
+			c.breaker.failure()
+		} else {
+			// A 4xx answer means the service is up; the request itself is at fault
+			c.breaker.success()
+		}
+
+		if attempt >= c.cfg.MaxRetries || !c.retryable(req, statusCode) {
+			return nil, domainErrors.NewExternalServiceError(c.service, statusCode, err)
+		}
+
+		delay := c.backoff(attempt)
+		if retryAfter > 0 {
+			if retryAfter > c.cfg.MaxDelay {
+				return nil, domainErrors.NewExternalServiceError(c.service, statusCode,
+					fmt.Errorf("%w (retry after %s exceeds the %s limit)", err, retryAfter, c.cfg.MaxDelay))
+			}
+			delay = retryAfter
+		}
+
+		log.Printf("%s call failed (attempt %d/%d), retrying in %s: %v", c.service, attempt+1, c.cfg.MaxRetries+1, delay, err)
+
+		if err := c.sleep(ctx, delay); err != nil {
+			return nil, fmt.Errorf("%s call cancelled: %w", c.service, err)
+		}
+	}
+}
+
+// attempt sends a single try of req, rewinding its body for retries
+func (c *Client) attempt(req *http.Request, attempt int) (*http.Response, error) {
+	if attempt > 0 && req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil, errors.New("request body cannot be replayed for a retry")
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("failed to rewind request body: %w", err)
+		}
+		req = req.Clone(req.Context())
+		req.Body = body
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+
+	return nil, &StatusError{
+		StatusCode: resp.StatusCode,
+		Body:       strings.TrimSpace(string(body)),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// retryable reports whether a failure of req with the given status (0 for a
+// network error) is worth another attempt
+func (c *Client) retryable(req *http.Request, statusCode int) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		// The request was not processed, so repeating it is always safe
+		return true
+	case 0, http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		retryUnsafe := c.cfg.RetryUnsafe && req.Context().Value(noUnsafeRetriesKey{}) == nil
+		return retryUnsafe || idempotent(req.Method)
+	}
+	return false
+}
+
+type noUnsafeRetriesKey struct{}
+
+// WithoutUnsafeRetries marks the requests sent with ctx as having side effects,
+// so that a POST or PATCH is not repeated after a 5xx or a network error even
+// on a client with RetryUnsafe set
+func WithoutUnsafeRetries(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noUnsafeRetriesKey{}, true)
+}
+
+// backoff returns a random delay up to BaseDelay * 2^attempt, capped at MaxDelay ("full jitter")
+func (c *Client) backoff(attempt int) time.Duration {
+	ceiling := c.cfg.BaseDelay << attempt
+	if ceiling <= 0 || ceiling > c.cfg.MaxDelay {
+		ceiling = c.cfg.MaxDelay
+	}
+	return rand.N(ceiling) + 1
+}
+
+// StatusError describes a response with a non-2xx status
+type StatusError struct {
+	StatusCode int
+	Body       string
+	// RetryAfter is the wait requested by the service, or 0 when it did not ask for one
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("status %d: %s", e.StatusCode, e.Body)
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if at, err := http.ParseTime(value); err == nil {
+		if d := at.Sub(now); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,159 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	domainErrors "sandbox/domain/errors"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// scriptedClient answers requests with the given statuses in order and records the waits between them
+func scriptedClient(cfg Config, responses ...*http.Response) (*Client, *[]string, *[]time.Duration) {
+	var bodies []string
+	var waits []time.Duration
+
+	cfg.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		body := ""
+		if req.Body != nil {
+			b, _ := io.ReadAll(req.Body)
+			body = string(b)
+		}
+		bodies = append(bodies, body)
+		return responses[len(bodies)-1], nil
+	})
+
+	client := New("test", cfg)
+	client.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	return client, &bodies, &waits
+}
+
+func response(status int, header ...string) *http.Response {
+	resp := &http.Response{
+		StatusCode: status,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader("body")),
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		resp.Header.Set(header[i], header[i+1])
+	}
+	return resp
+}
+
+func TestDoRetriesAndHonorsRetryAfter(t *testing.T) {
+	client, bodies, waits := scriptedClient(Config{MaxRetries: 3},
+		response(http.StatusTooManyRequests, "Retry-After", "2"),
+		response(http.StatusServiceUnavailable),
+		response(http.StatusOK),
+	)
+
+	req, _ := http.NewRequest(http.MethodPost, "http://example.test", strings.NewReader(`{"a":1}`))
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if len(*bodies) != 3 || (*bodies)[2] != `{"a":1}` {
+		t.Errorf("expected the body to be replayed on every attempt, got %q", *bodies)
+	}
+	if (*waits)[0] != 2*time.Second {
+		t.Errorf("expected to wait the requested 2s, waited %s", (*waits)[0])
+	}
+	if (*waits)[1] <= 0 || (*waits)[1] > 2*defaultBaseDelay {
+		t.Errorf("expected jittered backoff up to %s, waited %s", 2*defaultBaseDelay, (*waits)[1])
+	}
+}
+
+func TestDoDoesNotRepeatUnsafeRequestAfterServerError(t *testing.T) {
+	client, bodies, _ := scriptedClient(Config{MaxRetries: 3},
+		response(http.StatusInternalServerError),
+		response(http.StatusOK),
+	)
+
+	req, _ := http.NewRequest(http.MethodPost, "http://example.test", nil)
+	_, err := client.Do(req)
+
+	var domainErr *domainErrors.DomainError
+	if !errors.As(err, &domainErr) || domainErr.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected external service error with status 500, got %v", err)
+	}
+	if !errors.Is(err, domainErrors.ErrExternalService) {
+		t.Errorf("expected error to wrap ErrExternalService")
+	}
+	if len(*bodies) != 1 {
+		t.Errorf("expected a single attempt, got %d", len(*bodies))
+	}
+}
+
+func TestDoDoesNotRepeatRequestMarkedUnsafe(t *testing.T) {
+	client, bodies, _ := scriptedClient(Config{MaxRetries: 3, RetryUnsafe: true},
+		response(http.StatusBadGateway),
+		response(http.StatusOK),
+	)
+
+	req, _ := http.NewRequestWithContext(WithoutUnsafeRetries(context.Background()), http.MethodPost, "http://example.test", nil)
+	if _, err := client.Do(req); err == nil {
+		t.Fatal("expected the 502 to be returned")
+	}
+	if len(*bodies) != 1 {
+		t.Errorf("expected a single attempt, got %d", len(*bodies))
+	}
+}
+
+func TestDoOpensCircuitAfterConsecutiveFailures(t *testing.T) {
+	client, bodies, _ := scriptedClient(Config{BreakerThreshold: 2, BreakerCooldown: time.Minute},
+		response(http.StatusBadGateway),
+		response(http.StatusBadGateway),
+		response(http.StatusOK),
+		response(http.StatusOK),
+	)
+	now := time.Now()
+	client.breaker.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "http://example.test", nil)
+		_, err := client.Do(req)
+		if i == 2 && !errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("expected open circuit on call %d, got %v", i+1, err)
+		}
+	}
+	if len(*bodies) != 2 {
+		t.Errorf("expected the open circuit to skip the service, got %d calls", len(*bodies))
+	}
+
+	now = now.Add(time.Minute)
+	req, _ := http.NewRequest(http.MethodGet, "http://example.test", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("expected probe after cooldown to succeed, got %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 10, 25, 8, 0, 0, 0, time.UTC)
+
+	if got := parseRetryAfter("120", now); got != 2*time.Minute {
+		t.Errorf("expected 2m from seconds, got %s", got)
+	}
+	if got := parseRetryAfter("Sat, 25 Oct 2025 08:00:30 GMT", now); got != 30*time.Second {
+		t.Errorf("expected 30s from HTTP date, got %s", got)
+	}
+	if got := parseRetryAfter("soon", now); got != 0 {
+		t.Errorf("expected 0 for an unreadable value, got %s", got)
+	}
+}
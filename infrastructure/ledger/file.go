@@ -0,0 +1,70 @@
+package ledger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"sandbox/domain/usage"
+)
+
+// FileStore keeps the token usage ledger in one JSON file
+type FileStore struct {
+	path string
+}
+
+// NewFileStore creates the directory of path if needed
+func NewFileStore(path string) (*FileStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create usage directory: %w", err)
+	}
+	return &FileStore{path: path}, nil
+}
+
+// Load implements usage.Store. A missing file is an empty ledger.
+func (s *FileStore) Load(ctx context.Context) ([]usage.Entry, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read usage file: %w", err)
+	}
+
+	var entries []usage.Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to decode usage file: %w", err)
+	}
+	return entries, nil
+}
+
+// Save implements usage.Store. The file is written under a temporary name and
+// renamed so that a crash never leaves a partial ledger behind.
+func (s *FileStore) Save(ctx context.Context, entries []usage.Entry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode usage: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create usage file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write usage file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write usage file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to store usage file: %w", err)
+	}
+	return nil
+}
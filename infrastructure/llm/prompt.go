@@ -0,0 +1,266 @@
+package llm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	domainErrors "sandbox/domain/errors"
+	"sandbox/domain/transaction"
+)
+
+// DefaultPromptVersion is the built-in template used until another one is activated
+const DefaultPromptVersion = "v1"
+
+// promptTemplateExt is the extension of template files; the rest of the file
+// name is the version ID
+const promptTemplateExt = ".tmpl"
+
+// builtinPrompts holds the templates shipped with the application
+//
+//go:embed prompts/*.tmpl
+var builtinPrompts embed.FS
+
+var documentKindLabels = map[transaction.DocumentKind]string{
+	transaction.DocumentKindAssignmentLetter: "surat tugas / SPD",
+	transaction.DocumentKindFlightTicket:     "e-tiket pesawat",
+	transaction.DocumentKindHotelInvoice:     "invoice / folio hotel",
+	transaction.DocumentKindRideReceipt:      "struk transportasi darat (taksi, Gojek, Grab)",
+	transaction.DocumentKindOther:            "dokumen lain",
+}
+
+// ExtractionPromptData is what the "extraction" template is rendered with
+type ExtractionPromptData struct {
+	// Locale is the language and number format the documents are written in, e.g. "id-ID"
+	Locale string
+	// Documents lists the attached documents whose kind is known
+	Documents []DocumentHint
+	// Assignees are the names of the expected travellers, when the caller supplied them
+	Assignees []string
+}
+
+// DocumentHint tells the model what one attached document is
+type DocumentHint struct {
+	// Index is the position of the document in the request, starting at 1
+	Index    int
+	Filename string
+	Label    string
+}
+
+// PromptTemplate is one version of the extraction, classification and repair prompts
+type PromptTemplate struct {
+	id     string
+	hash   string
+	source string
+	tmpl   *template.Template
+}
+
+// ID names the version, e.g. "v1"
+func (t *PromptTemplate) ID() string {
+	return t.id
+}
+
+// Version identifies the exact template text for cache keys, so editing a
+// template file invalidates the results it produced
+func (t *PromptTemplate) Version() string {
+	return t.id + "-" + t.hash
+}
+
+// Extraction renders the instruction sent to every LLM backend together with
+// the uploaded documents, hinting at each document's kind when known
+func (t *PromptTemplate) Extraction(locale string, documents []transaction.Document, assignees []string) (string, error) {
+	data := ExtractionPromptData{Locale: locale, Assignees: assignees}
+	for i, doc := range documents {
+		if label, ok := documentKindLabels[doc.Kind]; ok {
+			data.Documents = append(data.Documents, DocumentHint{Index: i + 1, Filename: doc.Filename, Label: label})
+		}
+	}
+	return t.render("extraction", data)
+}
+
+// Classification asks the model to label a single document with one DocumentKind
+func (t *PromptTemplate) Classification() (string, error) {
+	return t.render("classification", nil)
+}
+
+// Repair asks the model to correct its previous answer given the validation errors
+func (t *PromptTemplate) Repair(err error) (string, error) {
+	return t.render("repair", struct{ Error string }{err.Error()})
+}
+
+func (t *PromptTemplate) render(name string, data interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := t.tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", fmt.Errorf("failed to render %s prompt of version %s: %w", name, t.id, err)
+	}
+	return buf.String(), nil
+}
+
+// Prompts holds every prompt template version and the one in use. Besides the
+// built-in versions, each *.tmpl file in a directory is a version named after
+// the file, so prompts can be changed without a rebuild.
+type Prompts struct {
+	dir    string
+	locale string
+
+	mu       sync.RWMutex
+	versions map[string]*PromptTemplate
+	active   string
+}
+
+// NewPrompts loads the built-in templates and those in dir, which may be empty,
+// and activates the given version (DefaultPromptVersion when empty). locale is
+// passed to the extraction template.
+func NewPrompts(dir, active, locale string) (*Prompts, error) {
+	if active == "" {
+		active = DefaultPromptVersion
+	}
+
+	p := &Prompts{dir: dir, locale: locale}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	if _, ok := p.versions[active]; !ok {
+		return nil, fmt.Errorf("prompt version %q not found", active)
+	}
+	p.active = active
+	return p, nil
+}
+
+// Locale is passed to the extraction template
+func (p *Prompts) Locale() string {
+	return p.locale
+}
+
+// Active returns the template in use
+func (p *Prompts) Active() *PromptTemplate {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.versions[p.active]
+}
+
+// Reload rescans the template directory. The active version stays in use even
+// if its file was removed.
+func (p *Prompts) Reload() error {
+	versions := make(map[string]*PromptTemplate)
+	if err := loadPromptTemplates(builtinPrompts, "prompts", "builtin", versions); err != nil {
+		return err
+	}
+	if p.dir != "" {
+		if _, err := os.Stat(p.dir); err != nil {
+			return fmt.Errorf("failed to read prompt directory: %w", err)
+		}
+		if err := loadPromptTemplates(os.DirFS(p.dir), ".", p.dir, versions); err != nil {
+			return err
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if current, ok := p.versions[p.active]; ok {
+		if _, ok := versions[p.active]; !ok {
+			versions[p.active] = current
+		}
+	}
+	p.versions = versions
+	return nil
+}
+
+// PromptVersions implements the transaction.PromptCatalog interface
+func (p *Prompts) PromptVersions() ([]transaction.PromptTemplateInfo, error) {
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	infos := make([]transaction.PromptTemplateInfo, 0, len(p.versions))
+	for _, t := range p.versions {
+		infos = append(infos, transaction.PromptTemplateInfo{
+			ID:     t.id,
+			Hash:   t.hash,
+			Source: t.source,
+			Active: t.id == p.active,
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ID < infos[j].ID
+	})
+	return infos, nil
+}
+
+// ActivatePrompt implements the transaction.PromptCatalog interface. Files added
+// to the template directory since the last scan can be activated right away.
+func (p *Prompts) ActivatePrompt(id string) error {
+	if err := p.Reload(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.versions[id]; !ok {
+		return fmt.Errorf("prompt version %q: %w", id, domainErrors.ErrNotFound)
+	}
+	p.active = id
+	return nil
+}
+
+// loadPromptTemplates parses every template file of dir into versions. A file
+// may not reuse the ID of a built-in version, so that an ID always names one text.
+func loadPromptTemplates(fsys fs.FS, dir, source string, versions map[string]*PromptTemplate) error {
+	matches, err := fs.Glob(fsys, path.Join(dir, "*"+promptTemplateExt))
+	if err != nil {
+		return fmt.Errorf("failed to list prompt templates: %w", err)
+	}
+
+	for _, name := range matches {
+		id := strings.TrimSuffix(path.Base(name), promptTemplateExt)
+		if existing, ok := versions[id]; ok {
+			return fmt.Errorf("prompt version %s in %s is already defined by %s", id, source, existing.source)
+		}
+
+		text, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return fmt.Errorf("failed to read prompt template %s: %w", name, err)
+		}
+		tmpl, err := template.New(id).Funcs(template.FuncMap{"join": strings.Join}).Parse(string(text))
+		if err != nil {
+			return fmt.Errorf("invalid prompt template %s: %w", name, err)
+		}
+		sum := sha256.Sum256(text)
+		t := &PromptTemplate{
+			id:     id,
+			hash:   hex.EncodeToString(sum[:6]),
+			source: source,
+			tmpl:   tmpl,
+		}
+		if err := t.check(); err != nil {
+			return fmt.Errorf("invalid prompt template %s: %w", name, err)
+		}
+		versions[id] = t
+	}
+	return nil
+}
+
+// check renders every prompt once, so that a broken template fails at load
+// rather than on the first extraction
+func (t *PromptTemplate) check() error {
+	documents := []transaction.Document{{Filename: "surat_tugas.pdf", Kind: transaction.DocumentKindAssignmentLetter}}
+	if _, err := t.Extraction("id-ID", documents, []string{"Budi Santoso"}); err != nil {
+		return err
+	}
+	if _, err := t.Classification(); err != nil {
+		return err
+	}
+	_, err := t.Repair(fmt.Errorf("amount must be positive"))
+	return err
+}
@@ -0,0 +1,72 @@
+package llm
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	domainErrors "sandbox/domain/errors"
+	"sandbox/domain/transaction"
+)
+
+func TestBuiltinPromptRendersDocumentAndAssigneeHints(t *testing.T) {
+	prompts, err := NewPrompts("", "", "id-ID")
+	if err != nil {
+		t.Fatalf("failed to load prompt templates: %v", err)
+	}
+
+	documents := []transaction.Document{
+		{Filename: "st.pdf", Kind: transaction.DocumentKindAssignmentLetter},
+		{Filename: "scan.jpg"},
+	}
+	prompt, err := prompts.Active().Extraction(prompts.Locale(), documents, []string{"Budi Santoso", "Siti Aminah"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, want := range []string{
+		"Dokumen ke-1 (st.pdf) adalah surat tugas / SPD.",
+		"Budi Santoso, Siti Aminah",
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("expected the prompt to contain %q", want)
+		}
+	}
+	if strings.Contains(prompt, "scan.jpg") {
+		t.Error("expected no hint for a document of unknown kind")
+	}
+}
+
+func TestPromptDirectoryAddsVersionsThatCanBeActivated(t *testing.T) {
+	dir := t.TempDir()
+	prompts, err := NewPrompts(dir, "", "id-ID")
+	if err != nil {
+		t.Fatalf("failed to load prompt templates: %v", err)
+	}
+
+	// Added after startup, picked up by the next listing
+	text := `{{define "extraction"}}Ekstrak {{len .Documents}} dokumen{{end}}{{define "classification"}}Jenis?{{end}}{{define "repair"}}Perbaiki: {{.Error}}{{end}}`
+	if err := os.WriteFile(filepath.Join(dir, "v2-short.tmpl"), []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := prompts.ActivatePrompt("v2-short"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := prompts.Active().ID(); got != "v2-short" {
+		t.Fatalf("expected v2-short to be active, got %s", got)
+	}
+
+	if err := prompts.ActivatePrompt("v9"); !errors.Is(err, domainErrors.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for an unknown version, got %v", err)
+	}
+
+	// A file may not redefine a built-in version
+	if err := os.WriteFile(filepath.Join(dir, DefaultPromptVersion+".tmpl"), []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := prompts.PromptVersions(); err == nil {
+		t.Error("expected an error for a file named after a built-in version")
+	}
+}
@@ -0,0 +1,202 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"sandbox/application/dto"
+	"sandbox/domain/date"
+	"sandbox/domain/transaction"
+
+	"github.com/invopop/validation"
+)
+
+// ReportResponse is the JSON document the extraction prompt asks the model to return.
+// Trip details are optional because a single receipt does not carry them.
+type ReportResponse struct {
+	StartDate            string                `json:"startDate,omitempty"`
+	EndDate              string                `json:"endDate,omitempty"`
+	ActivityPurpose      string                `json:"activityPurpose,omitempty"`
+	DestinationCity      string                `json:"destinationCity,omitempty"`
+	SpdDate              string                `json:"spdDate,omitempty"`
+	DepartureDate        string                `json:"departureDate,omitempty"`
+	ReturnDate           string                `json:"returnDate,omitempty"`
+	ReceiptSignatureDate string                `json:"receiptSignatureDate,omitempty"`
+	Assignees            []RawAssigneeResponse `json:"assignees"`
+}
+
+type RawAssigneeResponse struct {
+	Name         string           `json:"name"`
+	SpdNumber    string           `json:"spd_number,omitempty"`
+	EmployeeID   string           `json:"employee_id,omitempty"`
+	Position     string           `json:"position,omitempty"`
+	Rank         string           `json:"rank,omitempty"`
+	Transactions []RawTransaction `json:"transactions"`
+	FieldSources []RawFieldSource `json:"field_sources,omitempty"`
+}
+
+type RawTransaction struct {
+	Name            string    `json:"name"`
+	Type            string    `json:"type" enum:"accommodation,transport,other"`
+	Subtype         string    `json:"subtype"`
+	Amount          int32     `json:"amount"`
+	TotalNight      *int32    `json:"total_night,omitempty"`
+	Subtotal        int32     `json:"subtotal"`
+	Description     string    `json:"description"`
+	TransportDetail string    `json:"transport_detail,omitempty" enum:"transport_asal,transport_daerah,transport_darat"`
+	Date            string    `json:"date,omitempty"`
+	Source          RawSource `json:"source"`
+}
+
+// RawSource is the model's account of where on the document it read a value
+type RawSource struct {
+	Page       int     `json:"page,omitempty"`
+	Snippet    string  `json:"snippet,omitempty"`
+	Confidence float64 `json:"confidence"`
+}
+
+// RawFieldSource is a RawSource for a single assignee field
+type RawFieldSource struct {
+	Field      string  `json:"field" enum:"name,spd_number,employee_id,position,rank"`
+	Page       int     `json:"page,omitempty"`
+	Snippet    string  `json:"snippet,omitempty"`
+	Confidence float64 `json:"confidence"`
+}
+
+// ParseReport decodes the model's text answer into a recap report
+func ParseReport(rawText string) (*dto.RecapReportDTO, error) {
+	cleanJSON := CleanJSON(rawText)
+
+	var rawReport ReportResponse
+	if err := json.Unmarshal([]byte(cleanJSON), &rawReport); err != nil {
+		return nil, fmt.Errorf("failed to parse report content: %w (raw: %s)", err, cleanJSON)
+	}
+
+	report, err := rawReport.ToDTO()
+	if err != nil {
+		return nil, err
+	}
+
+	report.ReceiptSignatureDate = date.Today()
+
+	return report, nil
+}
+
+// ToDTO converts the raw model answer into the application DTO. Dates may use any
+// format understood by date.Parse; unreadable dates are returned as validation errors.
+func (r *ReportResponse) ToDTO() (*dto.RecapReportDTO, error) {
+	errs := validation.Errors{}
+	parseDate := func(field, value string) date.Date {
+		if strings.TrimSpace(value) == "" {
+			return date.Date{}
+		}
+		parsed, err := date.Parse(value)
+		if err != nil {
+			errs[field] = validation.NewError("date", err.Error())
+		}
+		return parsed
+	}
+
+	assignees := make([]dto.AssigneeDTO, 0, len(r.Assignees))
+	for i, rawAssignee := range r.Assignees {
+		transactionsDTO := make([]dto.TransactionDTO, 0, len(rawAssignee.Transactions))
+		for j, rawTx := range rawAssignee.Transactions {
+			transactionsDTO = append(transactionsDTO, dto.TransactionDTO{
+				Name:            rawTx.Name,
+				Type:            rawTx.Type,
+				Subtype:         rawTx.Subtype,
+				Amount:          rawTx.Amount,
+				TotalNight:      rawTx.TotalNight,
+				Subtotal:        rawTx.Subtotal,
+				PaymentType:     "", // Assuming default empty, needs to be derived if applicable
+				Description:     rawTx.Description,
+				TransportDetail: rawTx.TransportDetail,
+				Date:            parseDate(fmt.Sprintf("assignees.%d.transactions.%d.date", i, j), rawTx.Date),
+				Source:          rawTx.Source.toDTO(),
+			})
+		}
+
+		var fieldSources map[string]dto.SourceDTO
+		if len(rawAssignee.FieldSources) > 0 {
+			fieldSources = make(map[string]dto.SourceDTO, len(rawAssignee.FieldSources))
+			for _, fs := range rawAssignee.FieldSources {
+				fieldSources[fs.Field] = *RawSource{Page: fs.Page, Snippet: fs.Snippet, Confidence: fs.Confidence}.toDTO()
+			}
+		}
+
+		assignees = append(assignees, dto.AssigneeDTO{
+			Name:         rawAssignee.Name,
+			SpdNumber:    rawAssignee.SpdNumber,
+			EmployeeID:   rawAssignee.EmployeeID,
+			Position:     rawAssignee.Position,
+			Rank:         rawAssignee.Rank,
+			Transactions: transactionsDTO,
+			FieldSources: fieldSources,
+		})
+	}
+
+	report := &dto.RecapReportDTO{
+		StartDate:            parseDate("startDate", r.StartDate),
+		EndDate:              parseDate("endDate", r.EndDate),
+		ActivityPurpose:      r.ActivityPurpose,
+		DestinationCity:      r.DestinationCity,
+		SpdDate:              parseDate("spdDate", r.SpdDate),
+		DepartureDate:        parseDate("departureDate", r.DepartureDate),
+		ReturnDate:           parseDate("returnDate", r.ReturnDate),
+		ReceiptSignatureDate: parseDate("receiptSignatureDate", r.ReceiptSignatureDate),
+		Assignees:            assignees,
+	}
+
+	if err := errs.Filter(); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// toDTO converts the model's source, clamping confidence to [0, 1]. The filename
+// is filled in by the caller, which knows which document was sent.
+func (s RawSource) toDTO() *dto.SourceDTO {
+	confidence := s.Confidence
+	if confidence < 0 {
+		confidence = 0
+	} else if confidence > 1 {
+		confidence = 1
+	}
+	return &dto.SourceDTO{
+		Page:       s.Page,
+		Snippet:    strings.TrimSpace(s.Snippet),
+		Confidence: confidence,
+	}
+}
+
+// CleanJSON strips the markdown code fences models like to wrap JSON answers in
+func CleanJSON(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "```json")
+	s = strings.TrimPrefix(s, "```JSON")
+	s = strings.TrimSuffix(s, "```")
+	return strings.TrimSpace(s)
+}
+
+// RequiresTripDetails reports whether a batch includes a surat tugas, in which
+// case the extracted report must carry the trip header and assignee identities
+func RequiresTripDetails(documents []transaction.Document) bool {
+	for _, doc := range documents {
+		if doc.Kind == transaction.DocumentKindAssignmentLetter {
+			return true
+		}
+	}
+	return false
+}
+
+// ViolationDetails turns a validation failure into a JSON-friendly value
+func ViolationDetails(err error) interface{} {
+	var verrs validation.Errors
+	if errors.As(err, &verrs) {
+		return verrs
+	}
+	return err.Error()
+}
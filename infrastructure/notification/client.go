@@ -5,15 +5,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
-	"time"
 
 	"sandbox/domain/meeting"
+	"sandbox/infrastructure/httpclient"
 )
 
 type Client struct {
-	httpClient *http.Client
+	httpClient *httpclient.Client
 	apiKey     string
 	baseURL    string
 }
@@ -30,11 +29,9 @@ type EmailResponse struct {
 	Status    string `json:"status"`
 }
 
-func NewClient(apiKey string) *Client {
+func NewClient(apiKey string, httpClient *httpclient.Client) *Client {
 	return &Client{
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		httpClient: httpClient,
 		apiKey:  apiKey,
 		baseURL: "https://api.notification-service.com/v1", // Example service
 	}
@@ -68,11 +65,6 @@ func (c *Client) SendEmail(ctx context.Context, to []string, subject, body strin
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("Notification API returned status %d: %s", resp.StatusCode, string(body))
-	}
-
 	return nil
 }
 
@@ -0,0 +1,229 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"sandbox/application/dto"
+	"sandbox/domain/transaction"
+	"sandbox/domain/usage"
+	"sandbox/infrastructure/httpclient"
+	"sandbox/infrastructure/llm"
+)
+
+const (
+	// BackendName identifies the OpenAI-compatible extractor in the extractor registry
+	BackendName = "openai"
+)
+
+// imageMimeTypes are the image formats OpenAI-compatible servers accept as
+// image_url parts. HEIC/HEIF photos, which Gemini reads, are not among them.
+var imageMimeTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/webp": true,
+	"image/gif":  true,
+}
+
+// Client talks to any server exposing the OpenAI chat completions API,
+// including self-hosted Ollama and llama.cpp servers
+type Client struct {
+	baseURL    string
+	apiKey     string
+	model      string
+	prompts    *llm.Prompts
+	httpClient *httpclient.Client
+}
+
+func NewClient(baseURL, apiKey, model string, prompts *llm.Prompts, httpClient *httpclient.Client) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		model:      model,
+		prompts:    prompts,
+		httpClient: httpClient,
+	}
+}
+
+// Version implements the VersionedExtractor interface
+func (c *Client) Version() string {
+	return c.model + "/" + c.prompts.Active().Version()
+}
+
+// PromptVersion implements the PromptedExtractor interface
+func (c *Client) PromptVersion() string {
+	return c.prompts.Active().ID()
+}
+
+// ReadsMimeType implements the FormatRestrictedExtractor interface
+func (c *Client) ReadsMimeType(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "text/") || mimeType == "application/pdf" || imageMimeTypes[mimeType]
+}
+
+// ExtractFromDocuments implements the ExtractorRepository interface
+func (c *Client) ExtractFromDocuments(ctx context.Context, documents []transaction.Document) (*dto.RecapReportDTO, error) {
+	if len(documents) == 0 {
+		return nil, errors.New("no documents provided")
+	}
+
+	prompt, err := c.prompts.Active().Extraction(c.prompts.Locale(), documents, transaction.AssigneeHints(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	rawText, err := c.complete(ctx, prompt, documents, true)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := llm.ParseReport(rawText)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse chat completions report content: %w", err)
+	}
+
+	return report, nil
+}
+
+// ClassifyDocument implements the DocumentClassifier interface
+func (c *Client) ClassifyDocument(ctx context.Context, document transaction.Document) (transaction.DocumentKind, error) {
+	prompt, err := c.prompts.Active().Classification()
+	if err != nil {
+		return "", err
+	}
+
+	rawText, err := c.complete(ctx, prompt, []transaction.Document{document}, false)
+	if err != nil {
+		return "", err
+	}
+
+	return transaction.ParseDocumentKind(rawText), nil
+}
+
+// complete sends the prompt and documents as one user message and returns the
+// first choice's content. The tokens billed for the call are recorded on the meter of ctx.
+func (c *Client) complete(ctx context.Context, prompt string, documents []transaction.Document, jsonOutput bool) (string, error) {
+	if c.baseURL == "" || c.model == "" {
+		return "", errors.New("OPENAI_BASE_URL and OPENAI_MODEL must be configured to use the openai extraction backend")
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", fmt.Errorf("context cancelled before starting API call: %w", err)
+	}
+
+	content := []map[string]interface{}{
+		{"type": "text", "text": prompt},
+	}
+
+	for _, doc := range documents {
+		// Text documents, such as email bodies, are sent as text since most
+		// servers only read PDFs as files
+		if strings.HasPrefix(doc.MimeType, "text/") {
+			content = append(content, map[string]interface{}{
+				"type": "text",
+				"text": fmt.Sprintf("Document %s:\n%s", doc.Filename, doc.Content),
+			})
+			continue
+		}
+
+		dataURL := fmt.Sprintf("data:%s;base64,%s", doc.MimeType, base64.StdEncoding.EncodeToString(doc.Content))
+		if strings.HasPrefix(doc.MimeType, "image/") {
+			content = append(content, map[string]interface{}{
+				"type":      "image_url",
+				"image_url": map[string]interface{}{"url": dataURL},
+			})
+			continue
+		}
+
+		content = append(content, map[string]interface{}{
+			"type": "file",
+			"file": map[string]interface{}{
+				"filename":  doc.Filename,
+				"file_data": dataURL,
+			},
+		})
+	}
+
+	body := map[string]interface{}{
+		"model": c.model,
+		"messages": []map[string]interface{}{
+			{
+				"role":    "user",
+				"content": content,
+			},
+		},
+		"temperature": 0,
+	}
+	if jsonOutput {
+		body["response_format"] = map[string]interface{}{
+			"type": "json_object",
+		}
+	}
+
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/chat/completions", bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to call chat completions API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	bodyResp, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+
+	return c.parseResponse(ctx, bodyResp)
+}
+
+func (c *Client) parseResponse(ctx context.Context, bodyResp []byte) (string, error) {
+	var completion chatCompletionResponse
+	if err := json.Unmarshal(bodyResp, &completion); err != nil {
+		return "", fmt.Errorf("failed to parse chat completions response wrapper: %w", err)
+	}
+
+	usage.Record(ctx, usage.Tokens{
+		Prompt:     completion.Usage.PromptTokens,
+		Candidates: completion.Usage.CompletionTokens,
+		Total:      completion.Usage.TotalTokens,
+		Calls:      1,
+	})
+
+	if len(completion.Choices) == 0 || completion.Choices[0].Message.Content == "" {
+		return "", errors.New("empty choices from chat completions API")
+	}
+
+	return completion.Choices[0].Message.Content, nil
+}
+
+type chatCompletionResponse struct {
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int64 `json:"prompt_tokens"`
+		CompletionTokens int64 `json:"completion_tokens"`
+		TotalTokens      int64 `json:"total_tokens"`
+	} `json:"usage"`
+}
@@ -0,0 +1,119 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"sandbox/domain/transaction"
+	"sandbox/domain/usage"
+	"sandbox/infrastructure/httpclient"
+	"sandbox/infrastructure/llm"
+)
+
+// chatRequest is the part of a chat completions request the tests look at
+type chatRequest struct {
+	Model          string `json:"model"`
+	ResponseFormat *struct {
+		Type string `json:"type"`
+	} `json:"response_format"`
+	Messages []struct {
+		Role    string                   `json:"role"`
+		Content []map[string]interface{} `json:"content"`
+	} `json:"messages"`
+}
+
+func TestExtractFromDocumentsRoundTrip(t *testing.T) {
+	answer := `{"assignees":[{"name":"Budi","transactions":[{"name":"Budi","type":"transport","subtype":"taxi","amount":75000,"subtotal":75000,"description":"Grab"}]}]}`
+
+	var received chatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer test-key" {
+			http.Error(w, "unexpected request "+r.Method+" "+r.URL.Path, http.StatusBadRequest)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]interface{}{"role": "assistant", "content": answer}}},
+			"usage":   map[string]interface{}{"prompt_tokens": 900, "completion_tokens": 100, "total_tokens": 1000},
+		})
+	}))
+	defer server.Close()
+
+	prompts, err := llm.NewPrompts("", "", "id-ID")
+	if err != nil {
+		t.Fatalf("failed to load prompt templates: %v", err)
+	}
+	client := NewClient(server.URL+"/v1/", "test-key", "qwen2.5-vl", prompts, httpclient.New(BackendName, httpclient.Config{}))
+
+	meter := &usage.Meter{}
+	report, err := client.ExtractFromDocuments(usage.WithMeter(context.Background(), meter), []transaction.Document{
+		{Filename: "grab.png", MimeType: "image/png", Content: []byte("png")},
+		{Filename: "hotel.pdf", MimeType: "application/pdf", Content: []byte("%PDF-1.7")},
+		{Filename: "email.txt", MimeType: "text/plain", Content: []byte("Total Rp 75.000")},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(report.Assignees) != 1 || report.Assignees[0].Transactions[0].Subtotal != 75000 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if tokens := meter.Tokens(); tokens.Calls != 1 || tokens.Prompt != 900 || tokens.Total != 1000 {
+		t.Errorf("expected the tokens of the call to be metered, got %+v", tokens)
+	}
+
+	if received.Model != "qwen2.5-vl" || received.ResponseFormat == nil || received.ResponseFormat.Type != "json_object" {
+		t.Errorf("expected the model and JSON output to be requested, got %+v", received)
+	}
+	if len(received.Messages) != 1 || len(received.Messages[0].Content) != 4 {
+		t.Fatalf("expected one user message with the prompt and three documents, got %+v", received.Messages)
+	}
+	var types []string
+	for _, part := range received.Messages[0].Content {
+		types = append(types, part["type"].(string))
+	}
+	if got := strings.Join(types, ","); got != "text,image_url,file,text" {
+		t.Errorf("content part types = %s, want text,image_url,file,text", got)
+	}
+	image := received.Messages[0].Content[1]["image_url"].(map[string]interface{})
+	if image["url"] != "data:image/png;base64,cG5n" {
+		t.Errorf("image url = %v, want a base64 data URL", image["url"])
+	}
+	file := received.Messages[0].Content[2]["file"].(map[string]interface{})
+	if file["filename"] != "hotel.pdf" || file["file_data"] != "data:application/pdf;base64,JVBERi0xLjc=" {
+		t.Errorf("file part = %v", file)
+	}
+}
+
+func TestExtractFromDocumentsRequiresConfiguration(t *testing.T) {
+	prompts, err := llm.NewPrompts("", "", "id-ID")
+	if err != nil {
+		t.Fatalf("failed to load prompt templates: %v", err)
+	}
+	client := NewClient("", "", "", prompts, httpclient.New(BackendName, httpclient.Config{}))
+
+	_, err = client.ExtractFromDocuments(context.Background(), []transaction.Document{{Filename: "a.pdf", MimeType: "application/pdf"}})
+	if err == nil || !strings.Contains(err.Error(), "OPENAI_BASE_URL") {
+		t.Errorf("expected a configuration error, got %v", err)
+	}
+}
+
+func TestReadsMimeTypeLeavesOutHEIC(t *testing.T) {
+	client := NewClient("", "", "", nil, nil)
+	for mimeType, want := range map[string]bool{
+		"image/jpeg": true, "image/webp": true, "application/pdf": true, "text/plain": true,
+		"image/heic": false, "image/heif": false,
+	} {
+		if got := client.ReadsMimeType(mimeType); got != want {
+			t.Errorf("ReadsMimeType(%q) = %v, want %v", mimeType, got, want)
+		}
+	}
+}
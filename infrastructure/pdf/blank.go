@@ -0,0 +1,186 @@
+package pdf
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"strings"
+)
+
+const (
+	// inkLuminance is the brightness below which a scanned pixel counts as ink
+	inkLuminance = 160
+	// maxBlankInk is the share of ink pixels a scanned page may have and still be
+	// blank, allowing for dust and the shadow of the sheet's edge
+	maxBlankInk = 0.003
+	// blankSamples bounds how many pixels of a scan are looked at
+	blankSamples = 40000
+)
+
+// paintOperators are the content stream operators that put marks on a page
+var paintOperators = map[string]bool{
+	"f": true, "F": true, "f*": true, "S": true, "s": true,
+	"B": true, "B*": true, "b": true, "b*": true, "sh": true, "BI": true,
+}
+
+// isBlank reports whether a page shows nothing: no text, no graphics and no
+// images other than scans of an empty sheet. Anything it cannot read, such as
+// content in an unsupported encoding, counts as not blank.
+func (d *document) isBlank(p page) bool {
+	entries := d.pageEntries(p)
+
+	contents, ok := lookup(entries, "Contents")
+	if !ok {
+		return true
+	}
+	// Contents is one stream, or an array of streams that may itself be indirect
+	refs := [][]byte{contents}
+	if _, obj := d.resolve(contents); obj == nil || !obj.isStream {
+		array, _ := d.resolve(contents)
+		refs = referenceRegex.FindAll(array, -1)
+	}
+
+	var xobjects []string
+	for _, ref := range refs {
+		_, obj := d.resolve(ref)
+		if obj == nil || !obj.isStream {
+			continue
+		}
+		stream, ok := d.decodeStream(obj)
+		if !ok {
+			return false
+		}
+		if strings.TrimSpace(textFromContentStream(stream)) != "" {
+			return false
+		}
+		names, paints := scanPaintOperators(stream)
+		if paints {
+			return false
+		}
+		xobjects = append(xobjects, names...)
+	}
+
+	if len(xobjects) == 0 {
+		return true
+	}
+	resources, _ := lookup(entries, "Resources")
+	resources, _ = d.resolve(resources)
+	xobjectDict, _ := dictValue(resources, "XObject")
+	xobjectDict, _ = d.resolve(xobjectDict)
+
+	for _, name := range xobjects {
+		ref, ok := dictValue(xobjectDict, name)
+		if !ok {
+			return false
+		}
+		_, obj := d.resolve(ref)
+		if obj == nil || !obj.isStream || !d.isBlankImage(obj) {
+			return false
+		}
+	}
+	return true
+}
+
+// scanPaintOperators lists the XObjects a content stream draws with Do and
+// reports whether it paints paths, shadings or inline images
+func scanPaintOperators(stream []byte) (xobjects []string, paints bool) {
+	var lastName string
+	for i := 0; i < len(stream); {
+		ch := stream[i]
+		switch {
+		case ch == '(':
+			_, i = readLiteralString(stream, i)
+		case ch == '<' && i+1 < len(stream) && stream[i+1] != '<':
+			_, i = readHexString(stream, i)
+		case ch == '/':
+			start := i + 1
+			i++
+			for i < len(stream) && !isWhitespace(stream[i]) && !isDelimiter(stream[i]) {
+				i++
+			}
+			lastName = string(stream[start:i])
+		case ch == '%':
+			for i < len(stream) && stream[i] != '\n' && stream[i] != '\r' {
+				i++
+			}
+		case isWhitespace(ch) || isDelimiter(ch):
+			i++
+		default:
+			start := i
+			for i < len(stream) && !isWhitespace(stream[i]) && !isDelimiter(stream[i]) {
+				i++
+			}
+			token := string(stream[start:i])
+			switch {
+			case token == "Do":
+				xobjects = append(xobjects, lastName)
+			case paintOperators[token]:
+				return nil, true
+			}
+		}
+	}
+	return xobjects, false
+}
+
+// isBlankImage reports whether an image XObject is a scan of an empty sheet.
+// JPEG images and 8-bit gray or RGB Flate images are read; others are not.
+func (d *document) isBlankImage(obj *object) bool {
+	subtype, _ := dictValue(obj.dict, "Subtype")
+	if string(bytes.TrimSpace(subtype)) != "/Image" {
+		return false
+	}
+
+	filter, _ := dictValue(obj.dict, "Filter")
+	filter = bytes.Trim(bytes.TrimSpace(filter), "[] ")
+	if string(filter) == "/DCTDecode" {
+		img, err := jpeg.Decode(bytes.NewReader(obj.stream))
+		return err == nil && isBlankScan(img)
+	}
+
+	width, okWidth := dictInt(obj.dict, "Width")
+	height, okHeight := dictInt(obj.dict, "Height")
+	bits, _ := dictInt(obj.dict, "BitsPerComponent")
+	colorSpace, _ := dictValue(obj.dict, "ColorSpace")
+	components := map[string]int{"/DeviceGray": 1, "/DeviceRGB": 3}[string(bytes.TrimSpace(colorSpace))]
+	if !okWidth || !okHeight || bits != 8 || components == 0 || width <= 0 || height <= 0 {
+		return false
+	}
+	samples, ok := d.decodeStream(obj)
+	if !ok || len(samples) < width*height*components {
+		return false
+	}
+
+	var img image.Image
+	if components == 1 {
+		img = &image.Gray{Pix: samples, Stride: width, Rect: image.Rect(0, 0, width, height)}
+	} else {
+		rgba := image.NewRGBA(image.Rect(0, 0, width, height))
+		for i := 0; i < width*height; i++ {
+			copy(rgba.Pix[i*4:], samples[i*3:i*3+3])
+			rgba.Pix[i*4+3] = 0xff
+		}
+		img = rgba
+	}
+	return isBlankScan(img)
+}
+
+// isBlankScan samples img and reports whether almost none of it is ink
+func isBlankScan(img image.Image) bool {
+	bounds := img.Bounds()
+	step := 1
+	for (bounds.Dx()/step)*(bounds.Dy()/step) > blankSamples {
+		step++
+	}
+
+	var total, ink int
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			r, g, b, _ := img.At(x, y).RGBA()
+			if (299*r+587*g+114*b)/1000>>8 < inkLuminance {
+				ink++
+			}
+			total++
+		}
+	}
+	return total > 0 && float64(ink)/float64(total) <= maxBlankInk
+}
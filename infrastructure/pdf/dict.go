@@ -0,0 +1,182 @@
+package pdf
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// dictEntry is one key of a PDF dictionary with its value as written
+type dictEntry struct {
+	key   string
+	value []byte
+}
+
+// parseDict splits a dictionary into its top-level entries, keeping nested
+// values as raw bytes
+func parseDict(data []byte) ([]dictEntry, bool) {
+	i := skipSpace(data, 0)
+	if !bytes.HasPrefix(data[i:], []byte("<<")) {
+		return nil, false
+	}
+	i += 2
+
+	var entries []dictEntry
+	for {
+		i = skipSpace(data, i)
+		if i >= len(data) {
+			return entries, false
+		}
+		if bytes.HasPrefix(data[i:], []byte(">>")) {
+			return entries, true
+		}
+		if data[i] != '/' {
+			return entries, false
+		}
+		keyStart := i + 1
+		i = skipValue(data, i)
+		key := string(data[keyStart:i])
+
+		valueStart := skipSpace(data, i)
+		i = skipValue(data, valueStart)
+		entries = append(entries, dictEntry{key: key, value: data[valueStart:i]})
+	}
+}
+
+// skipValue returns the position right after the value starting at i
+func skipValue(data []byte, i int) int {
+	i = skipSpace(data, i)
+	if i >= len(data) {
+		return i
+	}
+
+	switch {
+	case bytes.HasPrefix(data[i:], []byte("<<")):
+		i += 2
+		for {
+			i = skipSpace(data, i)
+			if i >= len(data) {
+				return i
+			}
+			if bytes.HasPrefix(data[i:], []byte(">>")) {
+				return i + 2
+			}
+			i = skipValue(data, i)
+		}
+	case data[i] == '[':
+		i++
+		for {
+			i = skipSpace(data, i)
+			if i >= len(data) {
+				return i
+			}
+			if data[i] == ']' {
+				return i + 1
+			}
+			i = skipValue(data, i)
+		}
+	case data[i] == '(':
+		_, next := readLiteralString(data, i)
+		return next
+	case data[i] == '<':
+		end := bytes.IndexByte(data[i:], '>')
+		if end < 0 {
+			return len(data)
+		}
+		return i + end + 1
+	case data[i] == '/':
+		i++
+		for i < len(data) && !isWhitespace(data[i]) && !isDelimiter(data[i]) {
+			i++
+		}
+		return i
+	}
+
+	start := i
+	for i < len(data) && !isWhitespace(data[i]) && !isDelimiter(data[i]) {
+		i++
+	}
+	if i == start {
+		// A stray delimiter; step over it so callers always advance
+		return i + 1
+	}
+
+	// An "N G R" reference is a single value
+	if isNumber(string(data[start:i])) {
+		j := skipSpace(data, i)
+		k := j
+		for k < len(data) && data[k] >= '0' && data[k] <= '9' {
+			k++
+		}
+		if k > j {
+			k = skipSpace(data, k)
+			if k < len(data) && data[k] == 'R' && (k+1 == len(data) || isWhitespace(data[k+1]) || isDelimiter(data[k+1])) {
+				return k + 1
+			}
+		}
+	}
+	return i
+}
+
+func skipSpace(data []byte, i int) int {
+	for i < len(data) {
+		switch {
+		case isWhitespace(data[i]):
+			i++
+		case data[i] == '%':
+			for i < len(data) && data[i] != '\n' && data[i] != '\r' {
+				i++
+			}
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+func lookup(entries []dictEntry, key string) ([]byte, bool) {
+	for _, entry := range entries {
+		if entry.key == key {
+			return entry.value, true
+		}
+	}
+	return nil, false
+}
+
+// setEntry replaces the value of key, or appends it when missing
+func setEntry(entries []dictEntry, key string, value []byte) []dictEntry {
+	for i := range entries {
+		if entries[i].key == key {
+			entries[i].value = value
+			return entries
+		}
+	}
+	return append(entries, dictEntry{key: key, value: value})
+}
+
+func dictValue(data []byte, key string) ([]byte, bool) {
+	entries, _ := parseDict(data)
+	return lookup(entries, key)
+}
+
+func dictInt(data []byte, key string) (int, bool) {
+	value, ok := dictValue(data, key)
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(string(bytes.TrimSpace(value)))
+	return n, err == nil
+}
+
+// formatDict writes entries back as a dictionary
+func formatDict(entries []dictEntry) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("<<")
+	for _, entry := range entries {
+		buf.WriteString(" /")
+		buf.WriteString(entry.key)
+		buf.WriteByte(' ')
+		buf.Write(entry.value)
+	}
+	buf.WriteString(" >>")
+	return buf.Bytes()
+}
@@ -0,0 +1,312 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"strconv"
+)
+
+var (
+	objectHeaderRegex = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+	referenceRegex    = regexp.MustCompile(`(\d+)\s+(\d+)\s+R\b`)
+	rootRegex         = regexp.MustCompile(`/Root\s+(\d+)\s+\d+\s+R\b`)
+	encryptRegex      = regexp.MustCompile(`/Encrypt\s+\d+\s+\d+\s+R\b`)
+	directLengthRegex = regexp.MustCompile(`/Length\s+(\d+)(\s*[/>])`)
+	lengthRegex       = regexp.MustCompile(`/Length\s+(\d+\s+\d+\s+R|\d+)`)
+	objStmRegex       = regexp.MustCompile(`/Type\s*/ObjStm\b`)
+
+	ErrEncrypted = errors.New("pdf is encrypted")
+)
+
+// inheritableKeys are the page attributes a page takes from its ancestors in
+// the page tree when it does not set them itself
+var inheritableKeys = []string{"Resources", "MediaBox", "CropBox", "Rotate"}
+
+// object is an indirect object of a PDF file
+type object struct {
+	// dict is the object's value; for a stream object, its dictionary
+	dict []byte
+	// stream is the still encoded data of a stream object
+	stream   []byte
+	isStream bool
+}
+
+// page is a leaf of the page tree with the attributes it inherits
+type page struct {
+	num       int
+	inherited []dictEntry
+}
+
+// document is the object table and page list of a parsed PDF. It is read by
+// scanning for objects rather than through the cross-reference table, which
+// also copes with the slightly broken files some scanners write.
+type document struct {
+	objects map[int]*object
+	// treeNodes are the catalog and the intermediate nodes of the page tree
+	treeNodes map[int]bool
+	pages     []page
+	// decodeBudget is how many more bytes the document's streams may inflate to
+	decodeBudget int
+}
+
+func parseDocument(content []byte) (*document, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(content), []byte("%PDF")) {
+		return nil, errors.New("content is not a PDF document")
+	}
+	if encryptRegex.Match(content) {
+		return nil, ErrEncrypted
+	}
+
+	doc := &document{objects: map[int]*object{}, treeNodes: map[int]bool{}, decodeBudget: maxDecodedSize}
+	for pos := 0; pos < len(content); {
+		loc := objectHeaderRegex.FindSubmatchIndex(content[pos:])
+		if loc == nil {
+			break
+		}
+		num, _ := strconv.Atoi(string(content[pos+loc[2] : pos+loc[3]]))
+		obj, next := readObject(content, pos+loc[1])
+		// Incremental updates append newer versions of an object
+		doc.objects[num] = obj
+		pos = next
+	}
+	doc.expandObjectStreams()
+
+	roots := rootRegex.FindAllSubmatch(content, -1)
+	if len(roots) == 0 {
+		return nil, errors.New("pdf has no document catalog")
+	}
+	root, _ := strconv.Atoi(string(roots[len(roots)-1][1]))
+	doc.treeNodes[root] = true
+
+	catalog, ok := doc.objects[root]
+	if !ok {
+		return nil, errors.New("pdf document catalog is missing")
+	}
+	pagesRef, ok := dictValue(catalog.dict, "Pages")
+	if !ok {
+		return nil, errors.New("pdf has no page tree")
+	}
+	if num, ok := referenceNumber(pagesRef); ok {
+		doc.walkPageTree(num, nil)
+	}
+	if len(doc.pages) == 0 {
+		return nil, errors.New("pdf has no pages")
+	}
+
+	return doc, nil
+}
+
+// readObject reads the body of an object starting right after its "obj"
+// keyword and returns it with the position after its "endobj"
+func readObject(content []byte, start int) (*object, int) {
+	rest := content[start:]
+	end := bytes.Index(rest, []byte("endobj"))
+	keyword := streamKeyword(rest)
+
+	if keyword < 0 || (end >= 0 && end < keyword) {
+		if end < 0 {
+			return &object{dict: bytes.TrimSpace(rest)}, len(content)
+		}
+		return &object{dict: bytes.TrimSpace(rest[:end])}, start + end + len("endobj")
+	}
+
+	obj := &object{dict: bytes.TrimSpace(rest[:keyword]), isStream: true}
+	dataStart := keyword + len("stream")
+	if dataStart < len(rest) && rest[dataStart] == '\r' {
+		dataStart++
+	}
+	if dataStart < len(rest) && rest[dataStart] == '\n' {
+		dataStart++
+	}
+
+	// A direct /Length is trusted when endstream follows it; otherwise the
+	// data runs to the next endstream
+	dataEnd := -1
+	if m := directLengthRegex.FindSubmatch(obj.dict); m != nil {
+		if n, err := strconv.Atoi(string(m[1])); err == nil && dataStart+n <= len(rest) &&
+			bytes.HasPrefix(bytes.TrimLeft(rest[dataStart+n:], "\r\n \t"), []byte("endstream")) {
+			dataEnd = dataStart + n
+		}
+	}
+	if dataEnd < 0 {
+		idx := bytes.Index(rest[dataStart:], []byte("endstream"))
+		if idx < 0 {
+			obj.stream = rest[dataStart:]
+			return obj, len(content)
+		}
+		dataEnd = dataStart + idx
+		for dataEnd > dataStart && (rest[dataEnd-1] == '\n' || rest[dataEnd-1] == '\r') {
+			dataEnd--
+		}
+	}
+	obj.stream = rest[dataStart:dataEnd]
+
+	after := bytes.Index(rest[dataEnd:], []byte("endobj"))
+	if after < 0 {
+		return obj, len(content)
+	}
+	return obj, start + dataEnd + after + len("endobj")
+}
+
+// streamKeyword finds the stream keyword that starts an object's data, skipping
+// endstream
+func streamKeyword(data []byte) int {
+	for offset := 0; ; {
+		idx := bytes.Index(data[offset:], []byte("stream"))
+		if idx < 0 {
+			return -1
+		}
+		idx += offset
+		after := idx + len("stream")
+		if !bytes.HasSuffix(data[:idx], []byte("end")) && after < len(data) && (data[after] == '\r' || data[after] == '\n') {
+			return idx
+		}
+		offset = after
+	}
+}
+
+// expandObjectStreams adds the objects stored compressed inside object streams.
+// Objects also found outside an object stream keep that definition.
+func (d *document) expandObjectStreams() {
+	for _, obj := range d.objects {
+		if !obj.isStream || !objStmRegex.Match(obj.dict) {
+			continue
+		}
+		data, ok := d.decodeStream(obj)
+		if !ok {
+			continue
+		}
+		count, okN := dictInt(obj.dict, "N")
+		first, okFirst := dictInt(obj.dict, "First")
+		if !okN || !okFirst || count < 0 || first < 0 || first > len(data) {
+			continue
+		}
+
+		header := bytes.Fields(data[:first])
+		if count > len(header)/2 {
+			continue
+		}
+		for i := 0; i < count; i++ {
+			num, err1 := strconv.Atoi(string(header[2*i]))
+			offset, err2 := strconv.Atoi(string(header[2*i+1]))
+			if err1 != nil || err2 != nil || offset < 0 || offset > len(data)-first {
+				continue
+			}
+			end := len(data)
+			if i+1 < count {
+				if next, err := strconv.Atoi(string(header[2*i+3])); err == nil && next <= len(data)-first && next >= offset {
+					end = first + next
+				}
+			}
+			if _, exists := d.objects[num]; !exists {
+				d.objects[num] = &object{dict: bytes.TrimSpace(data[first+offset : end])}
+			}
+		}
+	}
+}
+
+// walkPageTree collects the pages under node in order
+func (d *document) walkPageTree(num int, inherited []dictEntry) {
+	// A node seen before means a malformed, cyclic tree
+	if d.treeNodes[num] || d.isPage(num) {
+		return
+	}
+	obj, ok := d.objects[num]
+	if !ok {
+		return
+	}
+	entries, ok := parseDict(obj.dict)
+	if !ok {
+		return
+	}
+
+	kids, isNode := lookup(entries, "Kids")
+	typeName, _ := lookup(entries, "Type")
+	if string(typeName) == "/Page" || !isNode {
+		d.pages = append(d.pages, page{num: num, inherited: inherited})
+		return
+	}
+
+	d.treeNodes[num] = true
+	own := append([]dictEntry(nil), inherited...)
+	for _, key := range inheritableKeys {
+		if value, ok := lookup(entries, key); ok {
+			own = setEntry(own, key, value)
+		}
+	}
+
+	if ref, ok := referenceNumber(kids); ok {
+		if resolved, found := d.objects[ref]; found {
+			kids = resolved.dict
+		}
+	}
+	for _, m := range referenceRegex.FindAllSubmatch(kids, -1) {
+		kid, _ := strconv.Atoi(string(m[1]))
+		d.walkPageTree(kid, own)
+	}
+}
+
+func (d *document) isPage(num int) bool {
+	for _, p := range d.pages {
+		if p.num == num {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve follows a reference to the value of the object it points to
+func (d *document) resolve(value []byte) ([]byte, *object) {
+	if num, ok := referenceNumber(value); ok {
+		if obj, found := d.objects[num]; found {
+			return obj.dict, obj
+		}
+		return nil, nil
+	}
+	return value, nil
+}
+
+// pageEntries returns a page's dictionary with its inherited attributes filled in
+func (d *document) pageEntries(p page) []dictEntry {
+	entries, _ := parseDict(d.objects[p.num].dict)
+	for _, inherited := range p.inherited {
+		if _, ok := lookup(entries, inherited.key); !ok {
+			entries = append(entries, inherited)
+		}
+	}
+	return entries
+}
+
+// decodeStream returns the decoded data of an unfiltered or FlateDecode stream.
+// Inflated data is charged to the document's decode budget, and a stream that
+// does not fit in what is left cannot be decoded.
+func (d *document) decodeStream(obj *object) ([]byte, bool) {
+	filter, ok := dictValue(obj.dict, "Filter")
+	if !ok {
+		return obj.stream, true
+	}
+	filter = bytes.Trim(bytes.TrimSpace(filter), "[] ")
+	if string(filter) != "/FlateDecode" {
+		return nil, false
+	}
+	if _, hasParms := dictValue(obj.dict, "DecodeParms"); hasParms {
+		return nil, false
+	}
+	decoded, err := inflate(obj.stream, d.decodeBudget)
+	if err != nil {
+		return nil, false
+	}
+	d.decodeBudget -= len(decoded)
+	return decoded, true
+}
+
+// referenceNumber returns the object number of an "N G R" reference
+func referenceNumber(value []byte) (int, bool) {
+	m := referenceRegex.FindSubmatchIndex(value)
+	if m == nil || len(bytes.TrimSpace(value)) != m[1]-m[0] {
+		return 0, false
+	}
+	num, err := strconv.Atoi(string(value[m[2]:m[3]]))
+	return num, err == nil
+}
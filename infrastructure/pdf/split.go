@@ -0,0 +1,185 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Part is a PDF made of some of the pages of another
+type Part struct {
+	Content []byte
+	// Pages are the 1-based numbers of its pages in the original document
+	Pages []int
+}
+
+// PageCount returns the number of pages of a PDF
+func PageCount(content []byte) (int, error) {
+	doc, err := parseDocument(content)
+	if err != nil {
+		return 0, err
+	}
+	return len(doc.pages), nil
+}
+
+// SplitPages returns one single-page PDF per page of content
+func SplitPages(content []byte) ([]Part, error) {
+	doc, err := parseDocument(content)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make([]Part, len(doc.pages))
+	for i := range doc.pages {
+		parts[i] = Part{Content: doc.build([]int{i}), Pages: []int{i + 1}}
+	}
+	return parts, nil
+}
+
+// SplitAtBlankPages cuts content at its blank pages, such as the empty sheets
+// put between receipts before scanning a stack. The blank pages are dropped.
+func SplitAtBlankPages(content []byte) ([]Part, error) {
+	doc, err := parseDocument(content)
+	if err != nil {
+		return nil, err
+	}
+
+	var parts []Part
+	var group []int
+	flush := func() {
+		if len(group) == 0 {
+			return
+		}
+		numbers := make([]int, len(group))
+		for i, index := range group {
+			numbers[i] = index + 1
+		}
+		parts = append(parts, Part{Content: doc.build(group), Pages: numbers})
+		group = nil
+	}
+
+	for i, p := range doc.pages {
+		if doc.isBlank(p) {
+			flush()
+			continue
+		}
+		group = append(group, i)
+	}
+	flush()
+
+	if len(parts) == 0 {
+		return nil, errors.New("every page of the pdf is blank")
+	}
+	return parts, nil
+}
+
+// build writes a new PDF holding the pages at the given indexes and every
+// object they use. References to other pages and to the page tree, e.g. from
+// link annotations, are replaced by null.
+func (d *document) build(indexes []int) []byte {
+	// Objects 1 and 2 are the new catalog and page tree
+	renumbered := map[int]int{}
+	var order []int
+	bodies := map[int][]byte{}
+	assign := func(num int) {
+		renumbered[num] = len(order) + 3
+		order = append(order, num)
+	}
+
+	for _, index := range indexes {
+		p := d.pages[index]
+		var entries []dictEntry
+		for _, entry := range d.pageEntries(p) {
+			if entry.key != "Parent" {
+				entries = append(entries, entry)
+			}
+		}
+		assign(p.num)
+		bodies[p.num] = formatDict(entries)
+	}
+
+	for queue := 0; queue < len(order); queue++ {
+		num := order[queue]
+		body, ok := bodies[num]
+		if !ok {
+			obj := d.objects[num]
+			body = obj.dict
+			if obj.isStream {
+				body = setLength(body, len(obj.stream))
+			}
+			bodies[num] = body
+		}
+		for _, m := range referenceRegex.FindAllSubmatch(body, -1) {
+			ref, _ := strconv.Atoi(string(m[1]))
+			if _, seen := renumbered[ref]; seen || d.treeNodes[ref] || d.isPage(ref) || d.objects[ref] == nil {
+				continue
+			}
+			assign(ref)
+		}
+	}
+
+	renumber := func(body []byte) []byte {
+		return referenceRegex.ReplaceAllFunc(body, func(ref []byte) []byte {
+			num, _ := strconv.Atoi(string(referenceRegex.FindSubmatch(ref)[1]))
+			if n, ok := renumbered[num]; ok {
+				return []byte(fmt.Sprintf("%d 0 R", n))
+			}
+			return []byte("null")
+		})
+	}
+
+	var buf bytes.Buffer
+	offsets := make([]int, len(order)+3)
+	buf.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+
+	offsets[1] = buf.Len()
+	buf.WriteString("1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	offsets[2] = buf.Len()
+	buf.WriteString("2 0 obj\n<< /Type /Pages /Kids [")
+	for i := range indexes {
+		fmt.Fprintf(&buf, " %d 0 R", i+3)
+	}
+	fmt.Fprintf(&buf, " ] /Count %d >>\nendobj\n", len(indexes))
+
+	for i, num := range order {
+		offsets[i+3] = buf.Len()
+		body := renumber(bodies[num])
+		if i < len(indexes) {
+			body = append([]byte("<< /Parent 2 0 R"), bytes.TrimPrefix(body, []byte("<<"))...)
+		}
+		fmt.Fprintf(&buf, "%d 0 obj\n", i+3)
+		buf.Write(body)
+		if obj := d.objects[num]; obj.isStream {
+			buf.WriteString("\nstream\n")
+			buf.Write(obj.stream)
+			buf.WriteString("\nendstream")
+		}
+		buf.WriteString("\nendobj\n")
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets))
+	for _, offset := range offsets[1:] {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets), xref)
+
+	return buf.Bytes()
+}
+
+// setLength makes a stream dictionary's /Length the direct length of its data
+func setLength(dict []byte, length int) []byte {
+	replacement := []byte("/Length " + strconv.Itoa(length))
+	if lengthRegex.Match(dict) {
+		done := false
+		return lengthRegex.ReplaceAllFunc(dict, func(match []byte) []byte {
+			if done {
+				return match
+			}
+			done = true
+			return replacement
+		})
+	}
+	return append(append([]byte("<< "), replacement...), bytes.TrimPrefix(dict, []byte("<<"))...)
+}
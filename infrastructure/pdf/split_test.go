@@ -0,0 +1,178 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"slices"
+	"testing"
+)
+
+// testPage describes one page of a generated PDF: text to show, or a JPEG
+// scan to draw, or neither for an empty page
+type testPage struct {
+	text string
+	scan []byte
+}
+
+// buildPDF writes a PDF whose pages inherit their font, media box and
+// resources from the page tree, with compressed content streams
+func buildPDF(t *testing.T, pages ...testPage) []byte {
+	t.Helper()
+
+	var objects []string
+	add := func(body string) int {
+		objects = append(objects, body)
+		return len(objects)
+	}
+	stream := func(dict string, data []byte) string {
+		return fmt.Sprintf("%s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+	}
+	flate := func(data string) []byte {
+		var buf bytes.Buffer
+		w := zlib.NewWriter(&buf)
+		w.Write([]byte(data))
+		w.Close()
+		return buf.Bytes()
+	}
+
+	catalog := add("") // filled in below
+	tree := add("")
+	font := add("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>")
+
+	var kids []string
+	for i, p := range pages {
+		var content string
+		resources := ""
+		switch {
+		case p.text != "":
+			content = fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj ET", p.text)
+		case p.scan != nil:
+			image := add(stream("<< /Type /XObject /Subtype /Image /Width 64 /Height 64 /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /DCTDecode", p.scan))
+			resources = fmt.Sprintf(" /Resources << /XObject << /Im%d %d 0 R >> >>", i, image)
+			content = fmt.Sprintf("q 612 0 0 792 0 0 cm /Im%d Do Q", i)
+		}
+		contents := add(stream("<< /Filter /FlateDecode", flate(content)))
+		kid := add(fmt.Sprintf("<< /Type /Page /Parent %d 0 R /Contents %d 0 R%s >>", tree, contents, resources))
+		kids = append(kids, fmt.Sprintf("%d 0 R", kid))
+	}
+	objects[catalog-1] = fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", tree)
+	objects[tree-1] = fmt.Sprintf("<< /Type /Pages /Kids %v /Count %d /MediaBox [0 0 612 792] /Resources << /Font << /F1 %d 0 R >> >> >>",
+		kids, len(kids), font)
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	for i, body := range objects {
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, body)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root %d 0 R >>\n%%%%EOF\n", len(objects)+1, catalog)
+	return buf.Bytes()
+}
+
+func scanJPEG(t *testing.T, marks bool) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.RGBA{250, 250, 248, 0xff})
+			if marks && y%8 < 2 && x > 8 && x < 56 {
+				img.Set(x, y, color.Black)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSplitPagesWritesOneDocumentPerPage(t *testing.T) {
+	content := buildPDF(t, testPage{text: "Hotel Santika 1.450.000"}, testPage{text: "Grab 85.000"}, testPage{text: "Garuda GA 404"})
+
+	parts, err := SplitPages(content)
+	if err != nil {
+		t.Fatalf("SplitPages() error = %v", err)
+	}
+	if len(parts) != 3 {
+		t.Fatalf("got %d parts, want 3", len(parts))
+	}
+
+	for i, want := range []string{"Hotel Santika 1.450.000", "Grab 85.000", "Garuda GA 404"} {
+		part := parts[i]
+		if !slices.Equal(part.Pages, []int{i + 1}) {
+			t.Errorf("part %d pages = %v, want [%d]", i, part.Pages, i+1)
+		}
+		if count, err := PageCount(part.Content); err != nil || count != 1 {
+			t.Errorf("part %d has %d pages (%v), want 1", i, count, err)
+		}
+		text, err := ExtractText(part.Content)
+		if err != nil || text != want {
+			t.Errorf("part %d text = %q (%v), want %q", i, text, err, want)
+		}
+		// The font is inherited from the original page tree and must come along
+		if !bytes.Contains(part.Content, []byte("/BaseFont /Helvetica")) {
+			t.Errorf("part %d lost the inherited font", i)
+		}
+	}
+}
+
+func TestSplitAtBlankPagesGroupsReceiptsBetweenSeparators(t *testing.T) {
+	content := buildPDF(t,
+		testPage{text: "Hotel Santika folio page 1"},
+		testPage{text: "Hotel Santika folio page 2"},
+		testPage{},                         // empty separator sheet
+		testPage{scan: scanJPEG(t, true)},  // scanned receipt
+		testPage{scan: scanJPEG(t, false)}, // scanned empty sheet
+		testPage{text: "Grab 85.000"},
+	)
+
+	parts, err := SplitAtBlankPages(content)
+	if err != nil {
+		t.Fatalf("SplitAtBlankPages() error = %v", err)
+	}
+
+	var groups [][]int
+	for _, part := range parts {
+		groups = append(groups, part.Pages)
+		count, err := PageCount(part.Content)
+		if err != nil || count != len(part.Pages) {
+			t.Errorf("part %v has %d pages (%v)", part.Pages, count, err)
+		}
+	}
+	want := [][]int{{1, 2}, {4}, {6}}
+	if !slices.EqualFunc(groups, want, slices.Equal[[]int]) {
+		t.Errorf("groups = %v, want %v", groups, want)
+	}
+}
+
+func TestSplitRejectsEncryptedDocuments(t *testing.T) {
+	content := append(buildPDF(t, testPage{text: "secret"}), []byte("trailer\n<< /Encrypt 9 0 R >>\n")...)
+	if _, err := SplitPages(content); err != ErrEncrypted {
+		t.Errorf("SplitPages() error = %v, want ErrEncrypted", err)
+	}
+}
+
+func TestSplitIgnoresObjectStreamsWithNegativeOffsets(t *testing.T) {
+	objStm := func(num int, dict, data string) string {
+		return fmt.Sprintf("%d 0 obj\n<< /Type /ObjStm %s /Length %d >>\nstream\n%s\nendstream\nendobj\n", num, dict, len(data), data)
+	}
+	for name, object := range map[string]string{
+		"negative First":  objStm(90, "/N 1 /First -1", "7 0 << >>"),
+		"negative offset": objStm(91, "/N 1 /First 5", "7 -3 << /Type /Page >>"),
+		"oversized N":     objStm(92, "/N 4611686018427387904 /First 4", "7 0 << >>"),
+	} {
+		content := buildPDF(t, testPage{text: "Hotel Santika 1.450.000"}, testPage{text: "Grab 85.000"})
+		trailer := bytes.LastIndex(content, []byte("trailer"))
+		content = slices.Concat(content[:trailer], []byte(object), content[trailer:])
+
+		parts, err := SplitPages(content)
+		if err != nil || len(parts) != 2 {
+			t.Errorf("%s: SplitPages() = %d parts, %v, want the 2 pages", name, len(parts), err)
+		}
+	}
+}
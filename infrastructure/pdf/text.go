@@ -0,0 +1,331 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var (
+	streamStartRegex = regexp.MustCompile(`stream\r?\n`)
+	ErrNoTextLayer   = errors.New("pdf has no extractable text layer")
+)
+
+// ExtractText returns the text drawn by the content streams of a PDF.
+// It only understands uncompressed and FlateDecode streams with simple
+// font encodings, which covers the machine-generated receipts we receive;
+// scanned documents return ErrNoTextLayer.
+func ExtractText(content []byte) (string, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(content), []byte("%PDF")) {
+		return "", errors.New("content is not a PDF document")
+	}
+
+	var sb strings.Builder
+	for _, stream := range contentStreams(content, maxDecodedSize) {
+		text := textFromContentStream(stream)
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		sb.WriteString(text)
+		sb.WriteString("\n")
+	}
+
+	text := strings.TrimSpace(sb.String())
+	if text == "" {
+		return "", ErrNoTextLayer
+	}
+
+	return text, nil
+}
+
+// contentStreams returns the decoded bodies of every stream object in the file.
+// Decoding stops once the streams have inflated to budget bytes, keeping the
+// streams read until then.
+func contentStreams(content []byte, budget int) [][]byte {
+	var streams [][]byte
+
+	for _, loc := range streamStartRegex.FindAllIndex(content, -1) {
+		dictStart := bytes.LastIndex(content[:loc[0]], []byte("<<"))
+		if dictStart < 0 {
+			continue
+		}
+		dict := content[dictStart:loc[0]]
+
+		end := bytes.Index(content[loc[1]:], []byte("endstream"))
+		if end < 0 {
+			continue
+		}
+		raw := content[loc[1] : loc[1]+end]
+
+		// Images, fonts and metadata never contain text operators
+		if bytes.Contains(dict, []byte("/Image")) || bytes.Contains(dict, []byte("/FontFile")) || bytes.Contains(dict, []byte("/XML")) {
+			continue
+		}
+
+		if bytes.Contains(dict, []byte("/FlateDecode")) {
+			decoded, err := inflate(raw, budget)
+			if errors.Is(err, errDecodedTooLarge) {
+				break
+			}
+			if err != nil {
+				continue
+			}
+			budget -= len(decoded)
+			raw = decoded
+		} else if bytes.Contains(dict, []byte("/Filter")) {
+			// Other filters (DCT, LZW, ...) are not text content
+			continue
+		}
+
+		streams = append(streams, raw)
+	}
+
+	return streams
+}
+
+// maxDecodedSize bounds the decompressed streams of one document, ten times
+// the default upload limit, so neither one deflate bomb nor many small ones
+// are expanded in memory
+const maxDecodedSize = 100 << 20
+
+var errDecodedTooLarge = errors.New("pdf streams inflate to more than 100 MB")
+
+// inflate decompresses a FlateDecode stream. A stream that would inflate past
+// limit bytes is an error, like one that cannot be decoded.
+func inflate(raw []byte, limit int) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	// Truncated streams still yield useful text, so keep whatever was decoded
+	out, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if len(out) > limit {
+		return nil, errDecodedTooLarge
+	}
+	if len(out) > 0 {
+		return out, nil
+	}
+	return nil, err
+}
+
+// textFromContentStream walks the operators of a content stream and collects
+// the strings shown by Tj, TJ, ' and ".
+func textFromContentStream(stream []byte) string {
+	var sb strings.Builder
+	var operands []string
+	inText := false
+
+	for i := 0; i < len(stream); {
+		ch := stream[i]
+		switch {
+		case ch == '(':
+			s, next := readLiteralString(stream, i)
+			operands = append(operands, s)
+			i = next
+		case ch == '<' && i+1 < len(stream) && stream[i+1] != '<':
+			s, next := readHexString(stream, i)
+			operands = append(operands, s)
+			i = next
+		case ch == '[' || ch == ']':
+			i++
+		case ch == '%':
+			for i < len(stream) && stream[i] != '\n' && stream[i] != '\r' {
+				i++
+			}
+		case isWhitespace(ch):
+			i++
+		default:
+			start := i
+			for i < len(stream) && !isWhitespace(stream[i]) && !isDelimiter(stream[i]) {
+				i++
+			}
+			if i == start {
+				i++
+				continue
+			}
+			token := string(stream[start:i])
+			if isNumber(token) {
+				// Large negative kerning inside TJ arrays usually marks a word gap
+				if strings.HasPrefix(token, "-") && len(token) > 3 && len(operands) > 0 {
+					operands = append(operands, " ")
+				}
+				continue
+			}
+
+			switch token {
+			case "BT":
+				inText = true
+			case "ET":
+				inText = false
+				sb.WriteString("\n")
+			case "Tj", "TJ":
+				if inText {
+					sb.WriteString(strings.Join(operands, ""))
+				}
+			case "'", "\"":
+				if inText {
+					sb.WriteString("\n")
+					sb.WriteString(strings.Join(operands, ""))
+				}
+			case "Td", "TD", "T*":
+				if inText {
+					sb.WriteString("\n")
+				}
+			}
+			operands = operands[:0]
+		}
+	}
+
+	return collapseBlankLines(sb.String())
+}
+
+func readLiteralString(stream []byte, i int) (string, int) {
+	var sb strings.Builder
+	depth := 0
+	i++ // skip opening parenthesis
+
+	for i < len(stream) {
+		ch := stream[i]
+		switch ch {
+		case '\\':
+			if i+1 >= len(stream) {
+				return sb.String(), i + 1
+			}
+			next := stream[i+1]
+			switch next {
+			case 'n':
+				sb.WriteByte('\n')
+			case 'r':
+				sb.WriteByte('\r')
+			case 't':
+				sb.WriteByte('\t')
+			case 'b', 'f':
+			case '(', ')', '\\':
+				sb.WriteByte(next)
+			case '\r', '\n':
+				// Line continuation
+			default:
+				if next >= '0' && next <= '7' {
+					value := 0
+					j := i + 1
+					for k := 0; k < 3 && j < len(stream) && stream[j] >= '0' && stream[j] <= '7'; k++ {
+						value = value*8 + int(stream[j]-'0')
+						j++
+					}
+					sb.WriteByte(byte(value))
+					i = j
+					continue
+				}
+				sb.WriteByte(next)
+			}
+			i += 2
+		case '(':
+			depth++
+			sb.WriteByte(ch)
+			i++
+		case ')':
+			if depth == 0 {
+				return sb.String(), i + 1
+			}
+			depth--
+			sb.WriteByte(ch)
+			i++
+		default:
+			sb.WriteByte(ch)
+			i++
+		}
+	}
+
+	return sb.String(), i
+}
+
+func readHexString(stream []byte, i int) (string, int) {
+	end := bytes.IndexByte(stream[i:], '>')
+	if end < 0 {
+		return "", len(stream)
+	}
+
+	hex := make([]byte, 0, end)
+	for _, ch := range stream[i+1 : i+end] {
+		if !isWhitespace(ch) {
+			hex = append(hex, ch)
+		}
+	}
+	if len(hex)%2 == 1 {
+		hex = append(hex, '0')
+	}
+
+	out := make([]byte, 0, len(hex)/2)
+	for j := 0; j+1 < len(hex); j += 2 {
+		out = append(out, hexValue(hex[j])<<4|hexValue(hex[j+1]))
+	}
+
+	// Two-byte glyph codes are common for Identity-H fonts; keep the printable byte
+	if len(out) >= 2 && out[0] == 0 {
+		single := make([]byte, 0, len(out)/2)
+		for j := 1; j < len(out); j += 2 {
+			single = append(single, out[j])
+		}
+		out = single
+	}
+
+	return string(out), i + end + 1
+}
+
+func hexValue(ch byte) byte {
+	switch {
+	case ch >= '0' && ch <= '9':
+		return ch - '0'
+	case ch >= 'a' && ch <= 'f':
+		return ch - 'a' + 10
+	case ch >= 'A' && ch <= 'F':
+		return ch - 'A' + 10
+	}
+	return 0
+}
+
+func isWhitespace(ch byte) bool {
+	switch ch {
+	case ' ', '\t', '\r', '\n', '\f', 0:
+		return true
+	}
+	return false
+}
+
+func isDelimiter(ch byte) bool {
+	switch ch {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func isNumber(token string) bool {
+	if token == "" {
+		return false
+	}
+	for i, ch := range token {
+		if (ch < '0' || ch > '9') && ch != '.' && !(i == 0 && (ch == '-' || ch == '+')) {
+			return false
+		}
+	}
+	return true
+}
+
+func collapseBlankLines(s string) string {
+	lines := strings.Split(s, "\n")
+	out := make([]string, 0, len(lines))
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n")
+}
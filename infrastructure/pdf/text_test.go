@@ -0,0 +1,42 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"testing"
+)
+
+func deflate(data []byte) []byte {
+	var compressed bytes.Buffer
+	w := zlib.NewWriter(&compressed)
+	w.Write(data)
+	w.Close()
+	return compressed.Bytes()
+}
+
+func TestInflateRefusesStreamsPastTheLimit(t *testing.T) {
+	compressed := deflate(make([]byte, maxDecodedSize+1))
+
+	if out, err := inflate(compressed, maxDecodedSize); err == nil {
+		t.Errorf("inflate() returned %d bytes from a %d byte stream, want an error", len(out), len(compressed))
+	}
+}
+
+func TestContentStreamsStopsWhenTheBudgetIsSpent(t *testing.T) {
+	bomb := deflate(make([]byte, 1000))
+	var content bytes.Buffer
+	content.WriteString("%PDF-1.4\n")
+	for i := 1; i <= 10; i++ {
+		fmt.Fprintf(&content, "%d 0 obj\n<< /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream\nendobj\n", i, len(bomb), bomb)
+	}
+
+	streams := contentStreams(content.Bytes(), 3500)
+	decoded := 0
+	for _, stream := range streams {
+		decoded += len(stream)
+	}
+	if len(streams) != 3 || decoded != 3000 {
+		t.Errorf("contentStreams() decoded %d streams of %d bytes, want the 3 that fit in the budget", len(streams), decoded)
+	}
+}
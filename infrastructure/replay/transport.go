@@ -0,0 +1,253 @@
+package replay
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Mode selects whether a Transport talks to the real service
+type Mode string
+
+const (
+	// ModeLive passes requests through untouched
+	ModeLive Mode = "live"
+	// ModeRecord passes requests through and saves every response as a fixture
+	ModeRecord Mode = "record"
+	// ModeReplay answers from the fixtures without any network access
+	ModeReplay Mode = "replay"
+)
+
+// ParseMode validates a mode name; empty is ModeLive
+func ParseMode(s string) (Mode, error) {
+	switch mode := Mode(strings.ToLower(strings.TrimSpace(s))); mode {
+	case "":
+		return ModeLive, nil
+	case ModeLive, ModeRecord, ModeReplay:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown mode %q: must be one of live, record, replay", s)
+}
+
+// Fixture holds the responses recorded for one request fingerprint, in the
+// order they were received. Polling the same URL yields several.
+type Fixture struct {
+	Method    string     `json:"method"`
+	Path      string     `json:"path"`
+	Responses []Response `json:"responses"`
+}
+
+// Response is one recorded answer
+type Response struct {
+	Status int               `json:"status"`
+	Header map[string]string `json:"header,omitempty"`
+	// Body is kept as text so that fixtures can be read and edited by hand
+	Body string `json:"body"`
+}
+
+// recordedHeaders are the response headers kept in fixtures; the rest are
+// transport details
+var recordedHeaders = []string{"Content-Type", "Retry-After", "X-Goog-Upload-URL", "X-Goog-Upload-Status"}
+
+// Transport records or replays the HTTP calls of one service. Requests are
+// matched by method, path, query and a hash of the body, so the host may
+// change between recording and replay and credentials in headers are never
+// stored. Fixtures hold response bodies only; the documents sent are not kept.
+type Transport struct {
+	mode Mode
+	dir  string
+	next http.RoundTripper
+
+	mu       sync.Mutex
+	recorded map[string]bool // fingerprints recorded by this process
+	served   map[string]int  // fingerprint -> responses replayed so far
+}
+
+// NewTransport creates a transport keeping fixtures in dir. next sends the
+// requests in live and record mode; nil uses http.DefaultTransport.
+func NewTransport(mode Mode, dir string, next http.RoundTripper) (*Transport, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if mode == ModeRecord {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create fixture directory: %w", err)
+		}
+	}
+
+	return &Transport{
+		mode:     mode,
+		dir:      dir,
+		next:     next,
+		recorded: make(map[string]bool),
+		served:   make(map[string]int),
+	}, nil
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.mode == ModeLive {
+		return t.next.RoundTrip(req)
+	}
+
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	key := fingerprint(req, body)
+
+	if t.mode == ModeReplay {
+		return t.replay(req, key)
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	return t.record(req, key, resp)
+}
+
+func (t *Transport) replay(req *http.Request, key string) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	fixture, err := t.load(key)
+	if errors.Is(err, os.ErrNotExist) {
+		return newResponse(req, Response{
+			Status: http.StatusNotFound,
+			Header: map[string]string{"Content-Type": "text/plain"},
+			Body: fmt.Sprintf("no recorded response for %s %s (fixture %s.json); record one in record mode",
+				req.Method, req.URL.Path, key),
+		}), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Repeated calls walk through the recorded responses and then stay on the last one
+	i := t.served[key]
+	if i >= len(fixture.Responses) {
+		i = len(fixture.Responses) - 1
+	}
+	t.served[key]++
+	return newResponse(req, fixture.Responses[i]), nil
+}
+
+func (t *Transport) record(req *http.Request, key string, resp *http.Response) (*http.Response, error) {
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response to record: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	recorded := Response{Status: resp.StatusCode, Header: make(map[string]string), Body: string(body)}
+	for _, name := range recordedHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			recorded.Header[name] = value
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// A fingerprint seen for the first time in this process replaces what an
+	// earlier recording left, so that re-recording does not mix two runs
+	fixture := &Fixture{Method: req.Method, Path: req.URL.Path}
+	if t.recorded[key] {
+		if existing, err := t.load(key); err == nil {
+			fixture = existing
+		}
+	}
+	fixture.Responses = append(fixture.Responses, recorded)
+	t.recorded[key] = true
+
+	if err := t.save(key, fixture); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (t *Transport) path(key string) string {
+	return filepath.Join(t.dir, key+".json")
+}
+
+func (t *Transport) load(key string) (*Fixture, error) {
+	data, err := os.ReadFile(t.path(key))
+	if err != nil {
+		return nil, err
+	}
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("failed to decode fixture %s: %w", key, err)
+	}
+	if len(fixture.Responses) == 0 {
+		return nil, fmt.Errorf("fixture %s has no responses", key)
+	}
+	return &fixture, nil
+}
+
+func (t *Transport) save(key string, fixture *Fixture) error {
+	data, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode fixture: %w", err)
+	}
+	if err := os.WriteFile(t.path(key), data, 0o644); err != nil {
+		return fmt.Errorf("failed to write fixture: %w", err)
+	}
+	return nil
+}
+
+// readBody returns the request body and leaves an unread copy in its place
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// fingerprint identifies a request by everything but its host and headers
+func fingerprint(req *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(req.Method))
+	h.Write([]byte{0})
+	h.Write([]byte(req.URL.Path))
+	h.Write([]byte{0})
+	h.Write([]byte(req.URL.RawQuery))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))[:24]
+}
+
+func newResponse(req *http.Request, recorded Response) *http.Response {
+	header := make(http.Header)
+	for name, value := range recorded.Header {
+		header.Set(name, value)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.Status, http.StatusText(recorded.Status)),
+		StatusCode:    recorded.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(recorded.Body)),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,67 @@
+package replay
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestTransportReplaysRecordedResponsesOffline(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Goog-Upload-URL", "https://upload.example/session/1")
+		fmt.Fprintf(w, `{"call":%d,"echo":%q}`, n, body)
+	}))
+
+	dir := t.TempDir()
+	recorder, err := NewTransport(ModeRecord, dir, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	send := func(rt http.RoundTripper, host, body string) (string, *http.Response) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, host+"/v1beta/models/m:generateContent", strings.NewReader(body))
+		req.Header.Set("x-goog-api-key", "secret")
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return string(data), resp
+	}
+
+	first, _ := send(recorder, server.URL, "hello")
+	second, _ := send(recorder, server.URL, "hello")
+	other, _ := send(recorder, server.URL, "bye")
+	server.Close()
+
+	// Replay against a host that does not exist: nothing may reach the network
+	replayer, err := NewTransport(ModeReplay, dir, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, resp := send(replayer, "http://gemini.invalid", "hello"); got != first || resp.Header.Get("X-Goog-Upload-URL") == "" {
+		t.Errorf("expected first recorded response %s with its upload URL, got %s", first, got)
+	}
+	if got, _ := send(replayer, "http://gemini.invalid", "hello"); got != second {
+		t.Errorf("expected second recorded response %s, got %s", second, got)
+	}
+	if got, _ := send(replayer, "http://gemini.invalid", "hello"); got != second {
+		t.Errorf("expected the last response to repeat, got %s", got)
+	}
+	if got, _ := send(replayer, "http://gemini.invalid", "bye"); got != other {
+		t.Errorf("expected response recorded for the other body %s, got %s", other, got)
+	}
+
+	if _, resp := send(replayer, "http://gemini.invalid", "never recorded"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for an unrecorded request, got %d", resp.StatusCode)
+	}
+}
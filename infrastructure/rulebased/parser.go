@@ -0,0 +1,353 @@
+package rulebased
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"sandbox/application/dto"
+	"sandbox/domain/date"
+	"sandbox/domain/transaction"
+	"sandbox/infrastructure/pdf"
+)
+
+const (
+	// BackendName identifies the rule-based extractor in the extractor registry
+	BackendName = "rulebased"
+
+	// rulesVersion must be bumped whenever a rule changes what is extracted,
+	// so that results cached under the old rules are not served
+	rulesVersion = "2"
+
+	// ruleConfidence is reported for values read by a matching rule. Rules do not
+	// guess, but they can match the wrong line on an unusual layout.
+	ruleConfidence = 0.8
+)
+
+var (
+	nameRegex        = regexp.MustCompile(`(?im)^\s*nama\s*(?:pegawai)?\s*:\s*(.+)$`)
+	employeeIDRegex  = regexp.MustCompile(`(?im)^\s*nip\s*:\s*([\d ]+)$`)
+	positionRegex    = regexp.MustCompile(`(?im)^\s*jabatan\s*:\s*(.+)$`)
+	rankRegex        = regexp.MustCompile(`(?im)^\s*(?:pangkat\s*/\s*)?gol(?:ongan)?[^:\n]*:\s*(.+)$`)
+	spdNumberRegex   = regexp.MustCompile(`(?im)^\s*(?:nomor|no\.?)\s*(?:spd|sppd)\s*:\s*(.+)$`)
+	purposeRegex     = regexp.MustCompile(`(?im)^\s*(?:maksud perjalanan dinas|untuk|dalam rangka)\s*:\s*(.+)$`)
+	destinationRegex = regexp.MustCompile(`(?im)^\s*(?:kota tujuan|tempat tujuan|tujuan)\s*:\s*(.+)$`)
+	departureRegex   = regexp.MustCompile(`(?im)^\s*tanggal berangkat\s*:\s*(.+)$`)
+	returnRegex      = regexp.MustCompile(`(?im)^\s*tanggal (?:harus )?kembali\s*:\s*(.+)$`)
+	spdDateRegex     = regexp.MustCompile(`(?im)^\s*(?:tanggal spd|ditetapkan tanggal|pada tanggal)\s*:\s*(.+)$`)
+	totalRegex       = regexp.MustCompile(`(?im)(?:grand total|total pembayaran|total bayar|total harga|total|jumlah)\s*:?\s*(?:rp\.?|idr)\s*([\d.,]+)`)
+	nightsRegex      = regexp.MustCompile(`(?i)(\d+)\s*(?:malam|night|nights|mlm)\b`)
+)
+
+// Parser extracts transactions with fixed text rules and never sends documents
+// to an external service. It only works on documents that carry a text layer.
+type Parser struct{}
+
+func NewParser() *Parser {
+	return &Parser{}
+}
+
+// ExtractFromDocuments implements the ExtractorRepository interface
+func (p *Parser) ExtractFromDocuments(ctx context.Context, documents []transaction.Document) (*dto.RecapReportDTO, error) {
+	if len(documents) == 0 {
+		return nil, errors.New("no documents provided")
+	}
+
+	report := &dto.RecapReportDTO{}
+	var receipts []string
+	var unreadable []string
+
+	for _, doc := range documents {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		text, err := documentText(doc)
+		if err != nil {
+			unreadable = append(unreadable, fmt.Sprintf("%s (%v)", doc.Filename, err))
+			continue
+		}
+
+		if isAssignmentLetter(text) {
+			p.parseAssignmentLetter(text, report)
+			continue
+		}
+		receipts = append(receipts, text)
+	}
+
+	if len(unreadable) > 0 {
+		return nil, fmt.Errorf("rule-based extraction cannot read: %s", strings.Join(unreadable, ", "))
+	}
+
+	if len(report.Assignees) == 0 {
+		if len(receipts) == 0 {
+			return nil, errors.New("rule-based extraction found no surat tugas with assignee details")
+		}
+		// Receipts extracted on their own are matched to assignees when the reports are merged
+		report.Assignees = append(report.Assignees, dto.AssigneeDTO{Transactions: []dto.TransactionDTO{}})
+	}
+
+	for _, text := range receipts {
+		tx, ok := parseReceipt(text)
+		if !ok {
+			continue
+		}
+		idx := matchAssignee(report.Assignees, text)
+		if report.Assignees[idx].Name != "" || tx.Name == "" {
+			tx.Name = report.Assignees[idx].Name
+		}
+		report.Assignees[idx].Transactions = append(report.Assignees[idx].Transactions, tx)
+	}
+
+	return report, nil
+}
+
+// Version implements the VersionedExtractor interface
+func (p *Parser) Version() string {
+	return rulesVersion
+}
+
+// ExtractKnownDocument implements the OfflineExtractor interface. Only receipts
+// of a known vendor with a text layer are recognized.
+func (p *Parser) ExtractKnownDocument(ctx context.Context, document transaction.Document) (*dto.RecapReportDTO, transaction.DocumentKind, string, bool) {
+	text, err := documentText(document)
+	if err != nil || isAssignmentLetter(text) {
+		return nil, "", "", false
+	}
+
+	tx, kind, vendor, ok := parseVendorReceipt(text)
+	if !ok {
+		return nil, "", "", false
+	}
+	return &dto.RecapReportDTO{
+		Assignees: []dto.AssigneeDTO{{Name: tx.Name, Transactions: []dto.TransactionDTO{tx}}},
+	}, kind, vendor, true
+}
+
+// ClassifyDocument implements the DocumentClassifier interface
+func (p *Parser) ClassifyDocument(ctx context.Context, document transaction.Document) (transaction.DocumentKind, error) {
+	text, err := documentText(document)
+	if err != nil {
+		return "", err
+	}
+
+	if isAssignmentLetter(text) {
+		return transaction.DocumentKindAssignmentLetter, nil
+	}
+	if _, kind, _, ok := parseVendorReceipt(text); ok {
+		return kind, nil
+	}
+
+	switch _, subtype := classifyReceipt(text); subtype {
+	case "hotel":
+		return transaction.DocumentKindHotelInvoice, nil
+	case "flight":
+		return transaction.DocumentKindFlightTicket, nil
+	case "taxi":
+		return transaction.DocumentKindRideReceipt, nil
+	}
+	return transaction.DocumentKindOther, nil
+}
+
+func documentText(doc transaction.Document) (string, error) {
+	switch {
+	case strings.HasPrefix(doc.MimeType, "text/"):
+		return string(doc.Content), nil
+	case doc.MimeType == "application/pdf":
+		return pdf.ExtractText(doc.Content)
+	}
+	return "", fmt.Errorf("%s has no text layer", doc.MimeType)
+}
+
+func isAssignmentLetter(text string) bool {
+	lower := strings.ToLower(text)
+	return strings.Contains(lower, "surat tugas") || strings.Contains(lower, "surat perjalanan dinas")
+}
+
+func (p *Parser) parseAssignmentLetter(text string, report *dto.RecapReportDTO) {
+	setIfEmpty(&report.ActivityPurpose, firstMatch(purposeRegex, text))
+	setIfEmpty(&report.DestinationCity, firstMatch(destinationRegex, text))
+	setDateIfEmpty(&report.DepartureDate, firstMatch(departureRegex, text))
+	setDateIfEmpty(&report.ReturnDate, firstMatch(returnRegex, text))
+	setDateIfEmpty(&report.SpdDate, firstMatch(spdDateRegex, text))
+	if report.StartDate.IsZero() {
+		report.StartDate = report.DepartureDate
+	}
+	if report.EndDate.IsZero() {
+		report.EndDate = report.ReturnDate
+	}
+
+	fields := map[string][][]string{
+		"name":        nameRegex.FindAllStringSubmatch(text, -1),
+		"employee_id": employeeIDRegex.FindAllStringSubmatch(text, -1),
+		"position":    positionRegex.FindAllStringSubmatch(text, -1),
+		"rank":        rankRegex.FindAllStringSubmatch(text, -1),
+		"spd_number":  spdNumberRegex.FindAllStringSubmatch(text, -1),
+	}
+
+	for i := range fields["name"] {
+		assignee := dto.AssigneeDTO{
+			Name:         at(fields["name"], i),
+			EmployeeID:   strings.ReplaceAll(at(fields["employee_id"], i), " ", ""),
+			Position:     at(fields["position"], i),
+			Rank:         at(fields["rank"], i),
+			SpdNumber:    at(fields["spd_number"], i),
+			Transactions: []dto.TransactionDTO{},
+			FieldSources: make(map[string]dto.SourceDTO),
+		}
+		for field, matches := range fields {
+			if i < len(matches) {
+				assignee.FieldSources[field] = dto.SourceDTO{
+					Snippet:    strings.TrimSpace(matches[i][0]),
+					Confidence: ruleConfidence,
+				}
+			}
+		}
+		report.Assignees = append(report.Assignees, assignee)
+	}
+}
+
+// parseReceipt reads a receipt with its vendor's parser, falling back to the
+// generic rules for vendors without one
+func parseReceipt(text string) (dto.TransactionDTO, bool) {
+	if tx, _, _, ok := parseVendorReceipt(text); ok {
+		return tx, true
+	}
+
+	amount, snippet, ok := parseTotal(text)
+	if !ok {
+		return dto.TransactionDTO{}, false
+	}
+
+	txType, subtype := classifyReceipt(text)
+	tx := dto.TransactionDTO{
+		Type:        string(txType),
+		Subtype:     subtype,
+		Amount:      amount,
+		Subtotal:    amount,
+		Description: firstLine(text),
+		Source:      &dto.SourceDTO{Snippet: snippet, Confidence: ruleConfidence},
+	}
+
+	if txType == transaction.TransactionTypeAccommodation {
+		if m := nightsRegex.FindStringSubmatch(text); m != nil {
+			if nights, err := strconv.ParseInt(m[1], 10, 32); err == nil && nights > 0 {
+				n := int32(nights)
+				tx.TotalNight = &n
+				tx.Amount = amount / n
+			}
+		}
+	}
+
+	return tx, true
+}
+
+func classifyReceipt(text string) (transaction.TransactionType, string) {
+	lower := strings.ToLower(text)
+	switch {
+	case containsAny(lower, "hotel", "check-in", "check in", "folio", "penginapan"):
+		return transaction.TransactionTypeAccommodation, "hotel"
+	case containsAny(lower, "e-ticket", "boarding pass", "penerbangan", "flight", "maskapai"):
+		return transaction.TransactionTypeTransport, "flight"
+	case containsAny(lower, "kereta", "kai ", "train"):
+		return transaction.TransactionTypeTransport, "train"
+	case containsAny(lower, "gojek", "grab", "taxi", "taksi", "bluebird", "maxim"):
+		return transaction.TransactionTypeTransport, "taxi"
+	}
+	return transaction.TransactionTypeOther, ""
+}
+
+// parseTotal returns the largest "total" amount on the receipt, in rupiah,
+// together with the text it was read from
+func parseTotal(text string) (int32, string, bool) {
+	var best int64
+	var snippet string
+	for _, m := range totalRegex.FindAllStringSubmatch(text, -1) {
+		value := parseRupiah(m[1])
+		if value > best {
+			best = value
+			snippet = strings.TrimSpace(m[0])
+		}
+	}
+	if best <= 0 {
+		return 0, "", false
+	}
+	return int32(best), snippet, true
+}
+
+// parseRupiah reads Indonesian formatted amounts such as "1.250.000" or
+// "1.250.000,00". Amounts too large for the int32 of the report read as 0,
+// like text that is not an amount.
+func parseRupiah(s string) int64 {
+	if idx := strings.LastIndex(s, ","); idx >= 0 && len(s)-idx <= 3 {
+		s = s[:idx]
+	}
+	s = strings.NewReplacer(".", "", ",", "").Replace(s)
+	value, err := strconv.ParseInt(s, 10, 32)
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+func matchAssignee(assignees []dto.AssigneeDTO, text string) int {
+	lower := strings.ToLower(text)
+	for i, a := range assignees {
+		if a.Name != "" && strings.Contains(lower, strings.ToLower(a.Name)) {
+			return i
+		}
+	}
+	return 0
+}
+
+func firstMatch(re *regexp.Regexp, text string) string {
+	if m := re.FindStringSubmatch(text); m != nil {
+		return strings.TrimSpace(m[1])
+	}
+	return ""
+}
+
+// at returns the trimmed first capture group of the i-th match, or "" when there is none
+func at(matches [][]string, i int) string {
+	if i < len(matches) {
+		return strings.TrimSpace(matches[i][1])
+	}
+	return ""
+}
+
+func setIfEmpty(dst *string, value string) {
+	if *dst == "" {
+		*dst = value
+	}
+}
+
+// setDateIfEmpty stores value when dst is unset and value is a readable date
+func setDateIfEmpty(dst *date.Date, value string) {
+	if !dst.IsZero() {
+		return
+	}
+	if parsed, err := date.Parse(value); err == nil {
+		*dst = parsed
+	}
+}
+
+func firstLine(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+func containsAny(s string, needles ...string) bool {
+	for _, n := range needles {
+		if strings.Contains(s, n) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,18 @@
+package rulebased
+
+import "testing"
+
+func TestParseTotalRejectsAmountsBeyondInt32(t *testing.T) {
+	amount, snippet, ok := parseTotal("Subtotal Rp 150.000\nTotal Rp 99.999.999.999")
+	if !ok || amount != 150000 || snippet != "total Rp 150.000" {
+		t.Errorf("parseTotal() = %d, %q, %v, want the amount that fits", amount, snippet, ok)
+	}
+	if amount, _, ok := parseTotal("Total Rp 9.999.999.999"); ok {
+		t.Errorf("parseTotal() = %d, want no total", amount)
+	}
+
+	tx, ok := parseReceipt("Hotel Santika\nTotal Rp 1.000.000\n4294967296 malam")
+	if !ok || tx.Subtotal != 1000000 || tx.TotalNight != nil {
+		t.Errorf("parseReceipt() = %+v, %v, want the total without a night count", tx, ok)
+	}
+}
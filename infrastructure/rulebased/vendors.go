@@ -0,0 +1,261 @@
+package rulebased
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"sandbox/application/dto"
+	"sandbox/domain/date"
+	"sandbox/domain/transaction"
+)
+
+// vendorConfidence is reported for values read by a vendor parser, whose
+// layouts are fixed by the vendor's receipt generator
+const vendorConfidence = 0.95
+
+var (
+	passengerRegex = labelRegex("nama penumpang", "penumpang", "passenger name", "passenger",
+		"nama tamu", "guest name", "guest", "nama pemesan", "nama pelanggan", "customer", "penumpang 1")
+	travelDateRegex = labelRegex("tanggal berangkat", "tanggal keberangkatan", "departure date", "departure",
+		"tanggal perjalanan", "tanggal", "date")
+	checkInRegex  = labelRegex("check-in", "check in", "arrival", "tanggal kedatangan", "kedatangan")
+	checkOutRegex = labelRegex("check-out", "check out", "departure", "tanggal keberangkatan", "keberangkatan")
+	hotelRegex    = labelRegex("nama hotel", "hotel name", "hotel", "properti", "property")
+	trainRegex    = labelRegex("nama kereta", "kereta", "train")
+	pickupRegex   = labelRegex("lokasi jemput", "dijemput di", "lokasi penjemputan", "pick-up location", "pick-up", "pickup", "dari", "from")
+	dropoffRegex  = labelRegex("lokasi tujuan", "diantar ke", "drop-off location", "drop-off", "dropoff", "tujuan", "to")
+
+	routeRegex      = regexp.MustCompile(`\(([A-Z]{3})\)[^\n(]*?(?:→|->|–|-|ke|to)[^\n(]*?\(([A-Z]{3})\)`)
+	flightRegex     = regexp.MustCompile(`\b(GA|JT|ID|IU|IW|QG|QZ|SJ|IN|8B)[ -]?(\d{2,4})\b`)
+	grabRegex       = regexp.MustCompile(`\bgrab(?:car|bike|taxi|\.com)?\b`)
+	dateInTextRegex = regexp.MustCompile(`(?i)\d{4}-\d{1,2}-\d{1,2}|\d{1,2}[/.\-]\d{1,2}[/.\-]\d{4}|\d{1,2}\s+[a-z]+\.?\s+\d{4}|[a-z]+\.?\s+\d{1,2},?\s+\d{4}`)
+)
+
+// airlines names the carriers of flightRegex
+var airlines = map[string]string{
+	"GA": "Garuda Indonesia", "JT": "Lion Air", "ID": "Batik Air", "IU": "Super Air Jet",
+	"IW": "Wings Air", "QG": "Citilink", "QZ": "Indonesia AirAsia", "SJ": "Sriwijaya Air",
+	"IN": "NAM Air", "8B": "TransNusa",
+}
+
+// vendorParser reads the machine-generated receipts of one vendor
+type vendorParser struct {
+	name string
+	// recognize reports whether lower, the lowercased text, comes from the vendor
+	recognize func(lower string) bool
+	// totals match the amount paid, most specific label first
+	totals []*regexp.Regexp
+	parse  func(text, lower string, tx *dto.TransactionDTO) (transaction.DocumentKind, bool)
+}
+
+// travelAgentTotals match the amount paid on Traveloka and tiket.com receipts
+var travelAgentTotals = amountRegexes("total pembayaran", "total harga", "harga total", "total price",
+	"total payment", "grand total", "total")
+
+// vendorParsers are tried in order; travel agents come first because their
+// receipts mention the airline, railway or hotel they sold
+var vendorParsers = []vendorParser{
+	{
+		name:      "traveloka",
+		recognize: func(lower string) bool { return strings.Contains(lower, "traveloka") },
+		totals:    travelAgentTotals,
+		parse:     parseTravelAgentReceipt,
+	},
+	{
+		name:      "tiket.com",
+		recognize: func(lower string) bool { return strings.Contains(lower, "tiket.com") },
+		totals:    travelAgentTotals,
+		parse:     parseTravelAgentReceipt,
+	},
+	{
+		name: "kai",
+		recognize: func(lower string) bool {
+			return containsAny(lower, "kereta api indonesia", "kai access", "booking.kai.id")
+		},
+		totals: amountRegexes("total pembayaran", "total harga", "total bayar", "total"),
+		parse:  parseTrainTicket,
+	},
+	{
+		name:      "gojek",
+		recognize: func(lower string) bool { return containsAny(lower, "gojek", "goride", "gocar") },
+		totals:    amountRegexes("total bayar", "total pembayaran", "total dibayar", "total"),
+		parse:     parseRideReceipt("Gojek"),
+	},
+	{
+		name:      "grab",
+		recognize: func(lower string) bool { return grabRegex.MatchString(lower) },
+		totals:    amountRegexes("total paid", "jumlah dibayar", "total dibayar", "total bayar", "total"),
+		parse:     parseRideReceipt("Grab"),
+	},
+	{
+		name: "hotel_folio",
+		recognize: func(lower string) bool {
+			return strings.Contains(lower, "folio") && containsAny(lower, "arrival", "check-in", "check in", "kedatangan")
+		},
+		totals: amountRegexes("total charges", "total tagihan", "grand total", "total"),
+		parse:  parseHotelStay,
+	},
+}
+
+// parseVendorReceipt reads text with the parser of the vendor that generated
+// it. ok is false when no vendor is recognized or its receipt lacks the amount
+// paid, in which case the document is left to the general extractors.
+func parseVendorReceipt(text string) (tx dto.TransactionDTO, kind transaction.DocumentKind, vendor string, ok bool) {
+	lower := strings.ToLower(text)
+	for _, v := range vendorParsers {
+		if !v.recognize(lower) {
+			continue
+		}
+
+		amount, snippet, found := labelledAmount(text, v.totals)
+		if !found {
+			return dto.TransactionDTO{}, "", "", false
+		}
+		tx = dto.TransactionDTO{
+			Name:     firstMatch(passengerRegex, text),
+			Amount:   amount,
+			Subtotal: amount,
+			Source:   &dto.SourceDTO{Snippet: snippet, Confidence: vendorConfidence},
+		}
+		kind, ok = v.parse(text, lower, &tx)
+		if !ok {
+			return dto.TransactionDTO{}, "", "", false
+		}
+		return tx, kind, v.name, true
+	}
+	return dto.TransactionDTO{}, "", "", false
+}
+
+// parseTravelAgentReceipt reads a flight, train or hotel booked through an online travel agent
+func parseTravelAgentReceipt(text, lower string, tx *dto.TransactionDTO) (transaction.DocumentKind, bool) {
+	switch {
+	case containsAny(lower, "check-in", "check in"):
+		return parseHotelStay(text, lower, tx)
+	case containsAny(lower, "kereta", "train"):
+		return parseTrainTicket(text, lower, tx)
+	case containsAny(lower, "penerbangan", "flight", "pesawat", "e-ticket", "e-tiket"):
+		return parseFlightTicket(text, lower, tx)
+	}
+	return "", false
+}
+
+func parseFlightTicket(text, lower string, tx *dto.TransactionDTO) (transaction.DocumentKind, bool) {
+	tx.Type = string(transaction.TransactionTypeTransport)
+	tx.Subtype = "flight"
+	tx.Date = labelledDate(travelDateRegex, text)
+
+	var detail []string
+	if m := flightRegex.FindStringSubmatch(text); m != nil {
+		detail = append(detail, airlines[m[1]]+" "+m[1]+" "+m[2])
+	}
+	if m := routeRegex.FindStringSubmatch(text); m != nil {
+		detail = append(detail, m[1]+" - "+m[2])
+	}
+	tx.TransportDetail = strings.Join(detail, " ")
+	tx.Description = strings.TrimSpace("Tiket pesawat " + tx.TransportDetail)
+	return transaction.DocumentKindFlightTicket, true
+}
+
+func parseTrainTicket(text, lower string, tx *dto.TransactionDTO) (transaction.DocumentKind, bool) {
+	tx.Type = string(transaction.TransactionTypeTransport)
+	tx.Subtype = "train"
+	tx.Date = labelledDate(travelDateRegex, text)
+
+	detail := firstMatch(trainRegex, text)
+	if m := routeRegex.FindStringSubmatch(text); m != nil {
+		detail = strings.TrimSpace(detail + " " + m[1] + " - " + m[2])
+	}
+	tx.TransportDetail = detail
+	tx.Description = strings.TrimSpace("Tiket kereta " + detail)
+	return transaction.DocumentKindOther, true
+}
+
+// parseRideReceipt reads a ride-hailing receipt of the named app
+func parseRideReceipt(app string) func(text, lower string, tx *dto.TransactionDTO) (transaction.DocumentKind, bool) {
+	return func(text, lower string, tx *dto.TransactionDTO) (transaction.DocumentKind, bool) {
+		tx.Type = string(transaction.TransactionTypeTransport)
+		tx.Subtype = "taxi"
+		tx.Date = labelledDate(travelDateRegex, text)
+
+		pickup, dropoff := firstMatch(pickupRegex, text), firstMatch(dropoffRegex, text)
+		if pickup != "" && dropoff != "" {
+			tx.TransportDetail = pickup + " - " + dropoff
+		}
+		tx.Description = strings.TrimSpace(app + " " + tx.TransportDetail)
+		return transaction.DocumentKindRideReceipt, true
+	}
+}
+
+// parseHotelStay reads a hotel folio or voucher. The amount per night is the
+// total divided by the nights between check-in and check-out.
+func parseHotelStay(text, lower string, tx *dto.TransactionDTO) (transaction.DocumentKind, bool) {
+	tx.Type = string(transaction.TransactionTypeAccommodation)
+	tx.Subtype = "hotel"
+
+	checkIn, checkOut := labelledDate(checkInRegex, text), labelledDate(checkOutRegex, text)
+	tx.Date = checkIn
+
+	nights := 0
+	if !checkIn.IsZero() && checkOut.After(checkIn) {
+		nights = checkIn.DaysUntil(checkOut)
+	} else if m := nightsRegex.FindStringSubmatch(text); m != nil {
+		nights, _ = strconv.Atoi(m[1])
+	}
+	if nights > 0 && nights <= math.MaxInt32 {
+		n := int32(nights)
+		tx.TotalNight = &n
+		tx.Amount = tx.Subtotal / n
+	}
+
+	hotel := firstMatch(hotelRegex, text)
+	if hotel == "" {
+		// Folios carry the hotel's name in their letterhead
+		hotel = firstLine(text)
+	}
+	tx.Description = strings.TrimSpace("Penginapan " + hotel)
+	return transaction.DocumentKindHotelInvoice, true
+}
+
+// labelRegex matches a "label: value" line for any of labels and captures the value
+func labelRegex(labels ...string) *regexp.Regexp {
+	quoted := make([]string, len(labels))
+	for i, label := range labels {
+		quoted[i] = regexp.QuoteMeta(label)
+	}
+	return regexp.MustCompile(`(?im)^[^\S\n]*(?:` + strings.Join(quoted, "|") + `)[^\S\n]*:[^\S\n]*(.+)$`)
+}
+
+// amountRegexes matches a rupiah amount after each of labels
+func amountRegexes(labels ...string) []*regexp.Regexp {
+	regexes := make([]*regexp.Regexp, len(labels))
+	for i, label := range labels {
+		regexes[i] = regexp.MustCompile(`(?im)\b` + regexp.QuoteMeta(label) + `\b[^\S\n]*:?[^\S\n]*(?:rp\.?|idr)[^\S\n]*(\d[\d.,]*)`)
+	}
+	return regexes
+}
+
+// labelledAmount returns the amount matched by the first of regexes that finds one
+func labelledAmount(text string, regexes []*regexp.Regexp) (int32, string, bool) {
+	for _, re := range regexes {
+		for _, m := range re.FindAllStringSubmatch(text, -1) {
+			if value := parseRupiah(m[1]); value > 0 {
+				return int32(value), strings.TrimSpace(m[0]), true
+			}
+		}
+	}
+	return 0, "", false
+}
+
+// labelledDate reads the date in the value of the first line re matches
+func labelledDate(re *regexp.Regexp, text string) date.Date {
+	for _, m := range re.FindAllStringSubmatch(text, -1) {
+		if found := dateInTextRegex.FindString(m[1]); found != "" {
+			if d, err := date.Parse(found); err == nil {
+				return d
+			}
+		}
+	}
+	return date.Date{}
+}
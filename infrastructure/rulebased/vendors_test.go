@@ -0,0 +1,128 @@
+package rulebased
+
+import (
+	"context"
+	"testing"
+
+	"sandbox/domain/date"
+	"sandbox/domain/transaction"
+)
+
+func TestExtractKnownDocumentReadsVendorReceipts(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		vendor    string
+		kind      transaction.DocumentKind
+		subtype   string
+		passenger string
+		subtotal  int32
+		amount    int32
+		date      date.Date
+		detail    string
+	}{
+		{
+			name: "traveloka flight",
+			text: `traveloka
+E-tiket Penerbangan
+Kode Booking: 1234567890
+Nama Penumpang: Tn. Budi Santoso
+Garuda Indonesia GA 404
+Jakarta (CGK) → Surabaya (SUB)
+Tanggal Berangkat: Sen, 10 Mar 2025 06:00
+Total Pembayaran Rp 1.450.000`,
+			vendor: "traveloka", kind: transaction.DocumentKindFlightTicket, subtype: "flight",
+			passenger: "Tn. Budi Santoso", subtotal: 1450000, amount: 1450000,
+			date: date.New(2025, 3, 10), detail: "Garuda Indonesia GA 404 CGK - SUB",
+		},
+		{
+			name: "tiket.com hotel",
+			text: `tiket.com - Voucher Hotel
+Nama Hotel: Hotel Majapahit Surabaya
+Nama Tamu: Budi Santoso
+Check-in: 10 Maret 2025
+Check-out: 12 Maret 2025
+Total Harga Rp 1.800.000`,
+			vendor: "tiket.com", kind: transaction.DocumentKindHotelInvoice, subtype: "hotel",
+			passenger: "Budi Santoso", subtotal: 1800000, amount: 900000, date: date.New(2025, 3, 10),
+		},
+		{
+			name: "gojek ride",
+			text: `Gojek
+GoCar
+Tanggal: 10/03/2025
+Lokasi jemput: Bandara Juanda
+Lokasi tujuan: Hotel Majapahit
+Subtotal Rp 120.000
+Total bayar Rp 115.000`,
+			vendor: "gojek", kind: transaction.DocumentKindRideReceipt, subtype: "taxi",
+			subtotal: 115000, amount: 115000, date: date.New(2025, 3, 10),
+			detail: "Bandara Juanda - Hotel Majapahit",
+		},
+		{
+			name: "kai train",
+			text: `PT Kereta Api Indonesia (Persero)
+Kode Booking: ABC123
+Nama Penumpang: Budi Santoso
+Kereta: Argo Bromo Anggrek
+Gambir (GMR) → Surabaya Pasarturi (SBI)
+Tanggal Berangkat: 2025-03-12
+Total Pembayaran: Rp 650.000`,
+			vendor: "kai", kind: transaction.DocumentKindOther, subtype: "train",
+			passenger: "Budi Santoso", subtotal: 650000, amount: 650000, date: date.New(2025, 3, 12),
+			detail: "Argo Bromo Anggrek GMR - SBI",
+		},
+		{
+			name: "hotel folio",
+			text: `HOTEL MAJAPAHIT SURABAYA
+Guest Folio
+Guest Name: Budi Santoso
+Arrival: 10/03/2025
+Departure: 13/03/2025
+Total Charges IDR 2.700.000,00
+Balance IDR 0`,
+			vendor: "hotel_folio", kind: transaction.DocumentKindHotelInvoice, subtype: "hotel",
+			passenger: "Budi Santoso", subtotal: 2700000, amount: 900000, date: date.New(2025, 3, 10),
+		},
+	}
+
+	parser := NewParser()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, kind, vendor, ok := parser.ExtractKnownDocument(context.Background(), transaction.Document{
+				Filename: "receipt.txt", MimeType: "text/plain", Content: []byte(tt.text),
+			})
+			if !ok {
+				t.Fatal("expected the receipt to be recognized")
+			}
+			if vendor != tt.vendor || kind != tt.kind {
+				t.Errorf("expected %s %s, got %s %s", tt.vendor, tt.kind, vendor, kind)
+			}
+
+			tx := report.Assignees[0].Transactions[0]
+			if tx.Subtype != tt.subtype || tx.Name != tt.passenger || tx.Subtotal != tt.subtotal || tx.Amount != tt.amount {
+				t.Errorf("unexpected transaction %+v", tx)
+			}
+			if !tx.Date.Equal(tt.date) {
+				t.Errorf("expected date %s, got %s", tt.date, tx.Date)
+			}
+			if tt.detail != "" && tx.TransportDetail != tt.detail {
+				t.Errorf("expected transport detail %q, got %q", tt.detail, tx.TransportDetail)
+			}
+		})
+	}
+}
+
+func TestExtractKnownDocumentLeavesUnknownReceiptsToTheBackend(t *testing.T) {
+	for _, text := range []string{
+		"Toko Sumber Rejeki\nTotal Rp 50.000",
+		"Gojek\nGoCar\nTerima kasih sudah menggunakan Gojek",
+	} {
+		_, _, _, ok := NewParser().ExtractKnownDocument(context.Background(), transaction.Document{
+			Filename: "receipt.txt", MimeType: "text/plain", Content: []byte(text),
+		})
+		if ok {
+			t.Errorf("expected %q not to be recognized", text)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Package spreadsheet reads the rows of XLSX workbooks and CSV files
+package spreadsheet
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Limits on what one file may hold
+const (
+	// MaxRows bounds the rows read from one file, header included
+	MaxRows = 5000
+	// MaxColumns bounds the cells of a single row
+	MaxColumns = 256
+	// MaxUnzipSize bounds what a workbook unpacks to, so that a zip bomb is
+	// refused rather than expanded
+	MaxUnzipSize = 100 << 20
+)
+
+var zipSignature = []byte("PK\x03\x04")
+
+// Table is the rows of one sheet. Rows are as long as their last cell, so
+// they may differ in width.
+type Table struct {
+	// Sheet is the worksheet the rows were read from; empty for CSV
+	Sheet string
+	Rows  [][]string
+}
+
+// IsWorkbook reports whether content is an XLSX workbook rather than CSV text
+func IsWorkbook(filename string, content []byte) bool {
+	ext := strings.ToLower(path.Ext(filename))
+	return ext == ".xlsx" || ext == ".xlsm" || bytes.HasPrefix(content, zipSignature)
+}
+
+// Read reads the rows of an XLSX workbook or CSV file. sheet selects the
+// worksheet of a workbook; empty reads the first one. Cells of a workbook are
+// read as stored, so dates are Excel serial numbers and amounts are unformatted.
+func Read(filename string, content []byte, sheet string) (*Table, error) {
+	if len(content) == 0 {
+		return nil, errors.New("file is empty")
+	}
+
+	var table *Table
+	var err error
+	if IsWorkbook(filename, content) {
+		table, err = readWorkbook(content, sheet)
+	} else {
+		table, err = readCSV(content)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range table.Rows {
+		for j := range row {
+			row[j] = strings.TrimSpace(row[j])
+		}
+	}
+	return table, nil
+}
+
+func readWorkbook(content []byte, sheet string) (*Table, error) {
+	workbook, err := excelize.OpenReader(bytes.NewReader(content), excelize.Options{UnzipSizeLimit: MaxUnzipSize})
+	if err != nil {
+		return nil, fmt.Errorf("cannot open workbook: %w", err)
+	}
+	defer workbook.Close()
+
+	if sheet == "" {
+		sheets := workbook.GetSheetList()
+		if len(sheets) == 0 {
+			return nil, errors.New("workbook has no sheets")
+		}
+		sheet = sheets[0]
+	} else if index, err := workbook.GetSheetIndex(sheet); err != nil || index < 0 {
+		return nil, fmt.Errorf("workbook has no sheet named %q", sheet)
+	}
+
+	rows, err := workbook.Rows(sheet)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read sheet %q: %w", sheet, err)
+	}
+	defer rows.Close()
+
+	table := &Table{Sheet: sheet}
+	for rows.Next() {
+		if len(table.Rows) == MaxRows {
+			return nil, fmt.Errorf("sheet %q has more than %d rows", sheet, MaxRows)
+		}
+		row, err := rows.Columns(excelize.Options{RawCellValue: true})
+		if err != nil {
+			return nil, fmt.Errorf("cannot read sheet %q: %w", sheet, err)
+		}
+		if len(row) > MaxColumns {
+			return nil, fmt.Errorf("row %d of sheet %q has more than %d columns", len(table.Rows)+1, sheet, MaxColumns)
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	if err := rows.Error(); err != nil {
+		return nil, fmt.Errorf("cannot read sheet %q: %w", sheet, err)
+	}
+	return table, nil
+}
+
+// readCSV reads comma, semicolon or tab separated text. Files saved by Excel
+// with a regional setting may use semicolons and the Windows-1252 charset.
+func readCSV(content []byte) (*Table, error) {
+	content = bytes.TrimPrefix(content, []byte("\xEF\xBB\xBF"))
+	if !utf8.Valid(content) {
+		decoded, err := charmap.Windows1252.NewDecoder().Bytes(content)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode file: %w", err)
+		}
+		content = decoded
+	}
+
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.Comma = detectDelimiter(content)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	table := &Table{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CSV: %w", err)
+		}
+		if len(table.Rows) == MaxRows {
+			return nil, fmt.Errorf("file has more than %d rows", MaxRows)
+		}
+		if len(record) > MaxColumns {
+			return nil, fmt.Errorf("row %d has more than %d columns", len(table.Rows)+1, MaxColumns)
+		}
+		table.Rows = append(table.Rows, record)
+	}
+	return table, nil
+}
+
+// detectDelimiter picks the separator occurring most often on the header line
+// outside quotes, preferring a comma on a tie
+func detectDelimiter(content []byte) rune {
+	line := content
+	if end := bytes.IndexByte(content, '\n'); end >= 0 {
+		line = content[:end]
+	}
+
+	counts := map[rune]int{}
+	quoted := false
+	for _, r := range string(line) {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case !quoted && (r == ',' || r == ';' || r == '\t'):
+			counts[r]++
+		}
+	}
+
+	delimiter := ','
+	for _, candidate := range []rune{';', '\t'} {
+		if counts[candidate] > counts[delimiter] {
+			delimiter = candidate
+		}
+	}
+	return delimiter
+}
@@ -0,0 +1,23 @@
+package spreadsheet
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadKeepsRowsAsLongAsTheirCells(t *testing.T) {
+	table, err := Read("biaya.csv", []byte("name;amount;note\n Budi ; 725000\n"), "")
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if len(table.Rows) != 2 || len(table.Rows[1]) != 2 || table.Rows[1][0] != "Budi" {
+		t.Errorf("rows = %q", table.Rows)
+	}
+}
+
+func TestReadRejectsTooManyColumns(t *testing.T) {
+	row := strings.Repeat("x,", MaxColumns) + "x\n"
+	if _, err := Read("biaya.csv", []byte(row), ""); err == nil {
+		t.Fatalf("Read() accepted a row of %d columns", MaxColumns+1)
+	}
+}
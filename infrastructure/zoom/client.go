@@ -5,15 +5,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"time"
 
 	"sandbox/domain/meeting"
+	"sandbox/infrastructure/httpclient"
 )
 
 type Client struct {
-	httpClient *http.Client
+	httpClient *httpclient.Client
 	apiKey     string
 	apiSecret  string
 	baseURL    string
@@ -61,11 +61,9 @@ type AuthResponse struct {
 	ExpiresIn   int    `json:"expires_in"`
 }
 
-func NewClient(apiKey, apiSecret string) *Client {
+func NewClient(apiKey, apiSecret string, httpClient *httpclient.Client) *Client {
 	return &Client{
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		httpClient: httpClient,
 		apiKey:    apiKey,
 		apiSecret: apiSecret,
 		baseURL:   "https://api.zoom.us/v2",
@@ -93,11 +91,6 @@ func (c *Client) getAccessToken(ctx context.Context) (string, error) {
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("auth failed with status %d: %s", resp.StatusCode, string(body))
-	}
-
 	var authResp AuthResponse
 	if err := json.NewDecoder(resp.Body).Decode(&authResp); err != nil {
 		return "", fmt.Errorf("failed to decode auth response: %w", err)
@@ -148,11 +141,6 @@ func (c *Client) CreateZoomMeeting(ctx context.Context, meeting meeting.Meeting)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusCreated {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("Zoom API returned status %d: %s", resp.StatusCode, string(body))
-	}
-
 	var zoomResp CreateMeetingResponse
 	if err := json.NewDecoder(resp.Body).Decode(&zoomResp); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	domainErrors "sandbox/domain/errors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// externalServiceStatus maps a failed call to an external service to the status
+// returned to our client: 503 when the service asked us to back off or its
+// circuit is open, so the client can retry later, and 502 otherwise
+func externalServiceStatus(err error) (int, bool) {
+	if !errors.Is(err, domainErrors.ErrExternalService) {
+		return 0, false
+	}
+
+	var domainErr *domainErrors.DomainError
+	if errors.As(err, &domainErr) {
+		switch domainErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			return fiber.StatusServiceUnavailable, true
+		}
+	}
+	return fiber.StatusBadGateway, true
+}
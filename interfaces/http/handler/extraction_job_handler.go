@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"sandbox/application/usecase"
+	domainErrors "sandbox/domain/errors"
+	"sandbox/domain/job"
+	"sandbox/infrastructure/file"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// sseKeepAlive is how often an idle event stream sends a comment, which keeps
+// proxies from timing it out and detects clients that went away
+const sseKeepAlive = 15 * time.Second
+
+// ExtractionJobHandler handles HTTP requests for asynchronous extraction jobs
+type ExtractionJobHandler struct {
+	jobsUseCase   *usecase.ExtractionJobsUseCase
+	fileProcessor *file.Processor
+}
+
+// NewExtractionJobHandler creates a new extraction job handler
+func NewExtractionJobHandler(jobsUseCase *usecase.ExtractionJobsUseCase, fileProcessor *file.Processor) *ExtractionJobHandler {
+	return &ExtractionJobHandler{
+		jobsUseCase:   jobsUseCase,
+		fileProcessor: fileProcessor,
+	}
+}
+
+// CreateJob accepts the same upload as /api/upload and returns a job ID right away
+func (h *ExtractionJobHandler) CreateJob(c *fiber.Ctx) error {
+	request, err := parseExtractRequest(c, h.fileProcessor)
+	if err != nil {
+		return c.Status(uploadErrorStatus(err)).JSON(uploadErrorBody(err))
+	}
+
+	created, err := h.jobsUseCase.Submit(*request)
+	if err != nil {
+		log.Printf("Error submitting extraction job: %v", err)
+		return c.Status(jobErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	log.Printf("Queued extraction job %s with %d file(s)", created.ID, len(request.Files))
+	c.Location("/api/extractions/" + created.ID)
+	return c.Status(fiber.StatusAccepted).JSON(created)
+}
+
+// GetJob returns the status of a job, and its result once it has succeeded
+func (h *ExtractionJobHandler) GetJob(c *fiber.Ctx) error {
+	found, err := h.jobsUseCase.Get(c.Params("id"))
+	if err != nil {
+		return c.Status(jobErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(found)
+}
+
+// CancelJob stops a queued or running job
+func (h *ExtractionJobHandler) CancelJob(c *fiber.Ctx) error {
+	cancelled, err := h.jobsUseCase.Cancel(c.Params("id"))
+	if err != nil {
+		return c.Status(jobErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(cancelled)
+}
+
+// StreamJobEvents streams a job's status and per-document progress as
+// server-sent events. Past events are replayed first, skipping those up to the
+// Last-Event-ID header when a client reconnects; the stream ends with the job.
+func (h *ExtractionJobHandler) StreamJobEvents(c *fiber.Ctx) error {
+	history, events, unsubscribe, err := h.jobsUseCase.Subscribe(c.Params("id"))
+	if err != nil {
+		return c.Status(jobErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	lastSeq, _ := strconv.Atoi(c.Get("Last-Event-ID"))
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer unsubscribe()
+
+		for _, event := range history {
+			if event.Seq <= lastSeq {
+				continue
+			}
+			if err := writeJobEvent(w, event); err != nil {
+				return
+			}
+		}
+
+		keepAlive := time.NewTicker(sseKeepAlive)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				if err := writeJobEvent(w, event); err != nil {
+					return
+				}
+			case <-keepAlive.C:
+				if _, err := w.WriteString(": keep-alive\n\n"); err != nil {
+					return
+				}
+				if err := w.Flush(); err != nil {
+					return
+				}
+			}
+		}
+	})
+
+	return nil
+}
+
+func writeJobEvent(w *bufio.Writer, event job.Event) error {
+	data, err := json.Marshal(usecase.ToExtractionEventDTO(event))
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Seq, event.Type, data); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// jobErrorStatus maps job queue errors to HTTP status codes
+func jobErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, domainErrors.ErrNotFound):
+		return fiber.StatusNotFound
+	case errors.Is(err, job.ErrQueueFull), errors.Is(err, job.ErrQueueClosed):
+		return fiber.StatusServiceUnavailable
+	case errors.Is(err, domainErrors.ErrBudgetExceeded):
+		return fiber.StatusTooManyRequests
+	}
+	return fiber.StatusInternalServerError
+}
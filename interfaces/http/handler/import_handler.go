@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"sandbox/application/dto"
+	"sandbox/application/usecase"
+	domainErrors "sandbox/domain/errors"
+	"sandbox/infrastructure/file"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ImportHandler handles the spreadsheet import of transactions
+type ImportHandler struct {
+	importUseCase             *usecase.ImportTransactionsUseCase
+	fileProcessor             *file.Processor
+	generateRecapExcelUseCase *usecase.GenerateRecapExcelUseCase
+}
+
+// NewImportHandler creates a new import handler
+func NewImportHandler(
+	importUseCase *usecase.ImportTransactionsUseCase,
+	fileProcessor *file.Processor,
+	generateRecapExcelUseCase *usecase.GenerateRecapExcelUseCase,
+) *ImportHandler {
+	return &ImportHandler{
+		importUseCase:             importUseCase,
+		fileProcessor:             fileProcessor,
+		generateRecapExcelUseCase: generateRecapExcelUseCase,
+	}
+}
+
+// ImportTransactions builds a recap report from an uploaded XLSX or CSV file.
+// It returns the report as JSON, or the KW/SPPD Excel recap with ?format=xlsx.
+func (h *ImportHandler) ImportTransactions(c *fiber.Ctx) error {
+	log.Println("Processing import request")
+
+	format := c.Query("format", "json")
+	if format != "json" && format != "xlsx" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("unknown format %q; use json or xlsx", format),
+		})
+	}
+
+	request, err := h.parseImportRequest(c)
+	if err != nil {
+		return c.Status(uploadErrorStatus(err)).JSON(uploadErrorBody(err))
+	}
+
+	response, err := h.importUseCase.Execute(c.Context(), *request)
+	if err != nil {
+		return c.Status(importErrorStatus(err)).JSON(importErrorBody(err))
+	}
+
+	if format == "json" {
+		return c.JSON(response)
+	}
+
+	excel, err := h.generateRecapExcelUseCase.Execute(c.Context(), response.Report)
+	if err != nil {
+		log.Printf("Error generating Excel recap: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to generate Excel recap file",
+			"details": err.Error(),
+		})
+	}
+
+	c.Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	c.Set("Content-Disposition", "attachment; filename=\"kwitansi-perjadin.xlsx\"")
+	return c.Send(excel.FileContent)
+}
+
+// parseImportRequest reads the uploaded spreadsheet, its column mapping and
+// the trip fields sent with it
+func (h *ImportHandler) parseImportRequest(c *fiber.Ctx) (*dto.ImportTransactionsRequest, error) {
+	boundary := string(c.Request().Header.MultipartFormBoundary())
+	if boundary == "" {
+		return nil, errors.New("Failed to parse form data")
+	}
+
+	form, err := h.fileProcessor.ReadUpload(requestBody(c), boundary)
+	if err != nil {
+		return nil, err
+	}
+	defer form.Remove()
+
+	if len(form.Files) != 1 {
+		return nil, errors.New("Upload exactly one XLSX or CSV file")
+	}
+	content, err := form.Files[0].ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read upload: %w", err)
+	}
+
+	request := &dto.ImportTransactionsRequest{
+		Filename: form.Files[0].Filename,
+		Content:  content,
+		Sheet:    form.Value("sheet"),
+		Trip:     map[string]string{},
+	}
+	if mapping := form.Value("mapping"); mapping != "" {
+		if err := json.Unmarshal([]byte(mapping), &request.Mapping); err != nil {
+			return nil, fmt.Errorf("mapping must be a JSON object of field names to column headers: %w", err)
+		}
+	}
+	for _, field := range usecase.ImportTripFields() {
+		if value := form.Value(field); value != "" {
+			request.Trip[field] = value
+		}
+	}
+	return request, nil
+}
+
+// importErrorStatus maps import errors to HTTP status codes: 422 for a file
+// with invalid rows and 400 for a file that cannot be read at all
+func importErrorStatus(err error) int {
+	var domainErr *domainErrors.DomainError
+	if errors.As(err, &domainErr) && domainErr.Details != nil {
+		return fiber.StatusUnprocessableEntity
+	}
+	if errors.Is(err, domainErrors.ErrValidation) {
+		return fiber.StatusBadRequest
+	}
+	log.Printf("Error importing transactions: %v", err)
+	return fiber.StatusInternalServerError
+}
+
+// importErrorBody builds the JSON error body, listing the invalid rows when
+// there are any
+func importErrorBody(err error) fiber.Map {
+	body := fiber.Map{
+		"error": err.Error(),
+	}
+
+	var domainErr *domainErrors.DomainError
+	if errors.As(err, &domainErr) {
+		body["error"] = domainErr.Message
+		body["code"] = domainErr.Code
+		if domainErr.Details != nil {
+			body["rows"] = domainErr.Details
+		}
+	}
+	return body
+}
@@ -42,6 +42,13 @@ func (h *MeetingHandler) CreateMeeting(c *fiber.Ctx) error {
 
 	response, err := h.createMeetingUseCase.Execute(ctx, reqBody)
 	if err != nil {
+		if status, ok := externalServiceStatus(err); ok {
+			return c.Status(status).JSON(fiber.Map{
+				"success": false,
+				"message": "External service unavailable",
+				"error":   err.Error(),
+			})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
 			"message": "Internal server error",
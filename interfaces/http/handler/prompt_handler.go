@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"errors"
+	"log"
+
+	"sandbox/application/dto"
+	"sandbox/application/usecase"
+	domainErrors "sandbox/domain/errors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// PromptHandler handles the admin endpoints for prompt template versions
+type PromptHandler struct {
+	promptsUseCase *usecase.ManagePromptsUseCase
+}
+
+// NewPromptHandler creates a new prompt handler
+func NewPromptHandler(promptsUseCase *usecase.ManagePromptsUseCase) *PromptHandler {
+	return &PromptHandler{
+		promptsUseCase: promptsUseCase,
+	}
+}
+
+// ListPrompts returns every available prompt template version
+func (h *PromptHandler) ListPrompts(c *fiber.Ctx) error {
+	versions, err := h.promptsUseCase.List()
+	if err != nil {
+		log.Printf("Error listing prompt templates: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{
+		"versions": versions,
+	})
+}
+
+// ActivatePrompt selects the prompt template version used from the next extraction on
+func (h *PromptHandler) ActivatePrompt(c *fiber.Ctx) error {
+	var reqBody dto.ActivatePromptRequest
+	if err := c.BodyParser(&reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid request body",
+			"details": err.Error(),
+		})
+	}
+
+	versions, err := h.promptsUseCase.Activate(reqBody)
+	if err != nil {
+		return c.Status(promptErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	log.Printf("Activated prompt template %s", reqBody.Version)
+	return c.JSON(fiber.Map{
+		"versions": versions,
+	})
+}
+
+func promptErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, domainErrors.ErrValidation):
+		return fiber.StatusBadRequest
+	case errors.Is(err, domainErrors.ErrNotFound):
+		return fiber.StatusNotFound
+	}
+	return fiber.StatusInternalServerError
+}
@@ -1,10 +1,15 @@
 package handler
 
 import (
+	"bytes"
+	"errors"
+	"io"
 	"log"
+	"strings"
 
 	"sandbox/application/dto"
 	"sandbox/application/usecase"
+	domainErrors "sandbox/domain/errors"
 	"sandbox/infrastructure/file"
 
 	"github.com/gofiber/fiber/v2"
@@ -34,53 +39,20 @@ func NewTransactionHandler(
 func (h *TransactionHandler) UploadAndExtract(c *fiber.Ctx) error {
 	log.Println("Processing upload request")
 
-	// Parse multipart form
-	form, err := c.MultipartForm()
+	request, err := parseExtractRequest(c, h.fileProcessor)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Failed to parse form data",
-		})
-	}
-
-	fileHeaders := form.File["file"]
-	if len(fileHeaders) == 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "No files uploaded",
-		})
-	}
-
-	// Process uploaded files
-	processedFiles, err := h.fileProcessor.ProcessMultipleFiles(fileHeaders)
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return c.Status(uploadErrorStatus(err)).JSON(uploadErrorBody(err))
 	}
 
-	// Convert to DTO
-	fileUploads := make([]dto.FileUpload, len(processedFiles))
-	for i, pf := range processedFiles {
-		fileUploads[i] = dto.FileUpload{
-			Content:  pf.Content,
-			Filename: pf.Filename,
-			MimeType: pf.MimeType,
-		}
-	}
-
-	// Execute use case
-	request := dto.ExtractTransactionsRequest{
-		Files: fileUploads,
-	}
-
-	response, err := h.extractUseCase.Execute(c.Context(), request)
+	response, err := h.extractUseCase.Execute(c.Context(), *request)
 	if err != nil {
 		log.Printf("Error extracting transactions: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Failed to extract transactions",
-			"details": err.Error(),
-		})
+		return c.Status(extractionErrorStatus(err)).JSON(extractionErrorBody(err))
 	}
 
+	setCacheHeader(c, response.Cached)
+	c.Set("X-Prompt-Version", response.PromptVersion)
+
 	// Return the complete report structure as requested
 	return c.JSON(response.Report)
 }
@@ -106,8 +78,13 @@ func (h *TransactionHandler) GenerateRecapExcel(c *fiber.Ctx) error {
 
 	response, err := h.generateRecapExcelUseCase.Execute(c.Context(), reqBody)
 	if err != nil {
-		log.Printf("Error generating Excel recap: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, domainErrors.ErrValidation) {
+			status = fiber.StatusBadRequest
+		} else {
+			log.Printf("Error generating Excel recap: %v", err)
+		}
+		return c.Status(status).JSON(fiber.Map{
 			"error":   "Failed to generate Excel recap file",
 			"details": err.Error(),
 		})
@@ -122,53 +99,185 @@ func (h *TransactionHandler) GenerateRecapExcel(c *fiber.Ctx) error {
 func (h *TransactionHandler) UploadAndExtractDetailed(c *fiber.Ctx) error {
 	log.Println("Processing upload request (detailed)")
 
-	// Parse multipart form
-	form, err := c.MultipartForm()
+	request, err := parseExtractRequest(c, h.fileProcessor)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Failed to parse form data",
-		})
+		return c.Status(uploadErrorStatus(err)).JSON(uploadErrorBody(err))
 	}
 
-	fileHeaders := form.File["file"]
-	if len(fileHeaders) == 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "No files uploaded",
-		})
+	response, err := h.extractUseCase.Execute(c.Context(), *request)
+	if err != nil {
+		log.Printf("Error extracting transactions: %v", err)
+		return c.Status(extractionErrorStatus(err)).JSON(extractionErrorBody(err))
+	}
+
+	setCacheHeader(c, response.Cached)
+
+	// Return full response
+	return c.JSON(response)
+}
+
+// parseExtractRequest reads the uploaded files and extraction options from a
+// multipart request. The body is streamed, with files spooled to disk while
+// they are checked and converted.
+func parseExtractRequest(c *fiber.Ctx, fileProcessor *file.Processor) (*dto.ExtractTransactionsRequest, error) {
+	boundary := string(c.Request().Header.MultipartFormBoundary())
+	if boundary == "" {
+		return nil, errors.New("Failed to parse form data")
+	}
+
+	form, err := fileProcessor.ReadUpload(requestBody(c), boundary)
+	if err != nil {
+		return nil, err
+	}
+	defer form.Remove()
+
+	if len(form.Files) == 0 {
+		return nil, errors.New("No files uploaded")
+	}
+
+	split, err := file.ParseSplitMode(form.Value("split_pdf"))
+	if err != nil {
+		return nil, err
 	}
 
 	// Process uploaded files
-	processedFiles, err := h.fileProcessor.ProcessMultipleFiles(fileHeaders)
+	processedFiles, err := fileProcessor.ProcessMultipleFiles(form.Files, file.UploadOptions{SplitPDF: split})
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return nil, err
 	}
 
 	// Convert to DTO
 	fileUploads := make([]dto.FileUpload, len(processedFiles))
 	for i, pf := range processedFiles {
 		fileUploads[i] = dto.FileUpload{
-			Content:  pf.Content,
-			Filename: pf.Filename,
-			MimeType: pf.MimeType,
+			Content:       pf.Content,
+			Filename:      pf.Filename,
+			MimeType:      pf.MimeType,
+			OriginalSize:  pf.OriginalSize,
+			Preprocessing: pf.Preprocessing,
+			Pages:         pf.Pages,
+		}
+		if pf.Email != nil {
+			fileUploads[i].Email = &dto.EmailDTO{Subject: pf.Email.Subject, From: pf.Email.From}
 		}
 	}
 
-	// Execute use case
-	request := dto.ExtractTransactionsRequest{
-		Files: fileUploads,
+	var assignees []string
+	for _, name := range form.Values["assignee"] {
+		if name = strings.TrimSpace(name); name != "" {
+			assignees = append(assignees, name)
+		}
 	}
 
-	response, err := h.extractUseCase.Execute(c.Context(), request)
-	if err != nil {
-		log.Printf("Error extracting transactions: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Failed to extract transactions",
-			"details": err.Error(),
-		})
+	// Query values are copied because fiber reuses the request buffer once the
+	// handler returns, while an asynchronous job still needs them
+	return &dto.ExtractTransactionsRequest{
+		Files:        fileUploads,
+		Backend:      strings.Clone(c.Query("backend")),
+		Refresh:      c.QueryBool("refresh"),
+		TripCategory: strings.Clone(c.Query("trip_category")),
+		Assignees:    assignees,
+		Endpoint:     strings.Clone(c.Route().Path),
+		Client:       apiClient(c),
+	}, nil
+}
+
+// requestBody returns the request body as a stream, which it is unless the
+// server was set up without StreamRequestBody
+func requestBody(c *fiber.Ctx) io.Reader {
+	if stream := c.Context().RequestBodyStream(); stream != nil {
+		return stream
 	}
+	return bytes.NewReader(c.Body())
+}
 
-	// Return full response
-	return c.JSON(response)
+// apiClient names the caller that tokens are accounted to, from the X-Client-ID
+// header. The ledger accounts names it does not know as anonymous.
+func apiClient(c *fiber.Ctx) string {
+	return strings.Clone(strings.TrimSpace(c.Get("X-Client-ID")))
+}
+
+// setCacheHeader tells clients of /api/upload, whose body is only the report,
+// whether the report came from the extraction cache
+func setCacheHeader(c *fiber.Ctx, cached bool) {
+	if cached {
+		c.Set("X-Cache", "HIT")
+	} else {
+		c.Set("X-Cache", "MISS")
+	}
+}
+
+// extractionErrorStatus maps extraction errors to HTTP status codes
+func extractionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, domainErrors.ErrValidation):
+		return fiber.StatusBadRequest
+	case errors.Is(err, domainErrors.ErrExtraction):
+		return fiber.StatusUnprocessableEntity
+	case errors.Is(err, domainErrors.ErrBudgetExceeded):
+		return fiber.StatusTooManyRequests
+	}
+	if status, ok := externalServiceStatus(err); ok {
+		return status
+	}
+	return fiber.StatusInternalServerError
+}
+
+// uploadErrorStatus maps upload errors to HTTP status codes: 413 for a file or
+// request too large, 422 for too many files and 400 for anything else
+func uploadErrorStatus(err error) int {
+	var limitErr *file.LimitError
+	if errors.As(err, &limitErr) {
+		if limitErr.Code == file.LimitFileCount {
+			return fiber.StatusUnprocessableEntity
+		}
+		return fiber.StatusRequestEntityTooLarge
+	}
+	return fiber.StatusBadRequest
+}
+
+// uploadErrorBody describes a refused upload, listing each rejected file and
+// why, or naming the limit the request broke
+func uploadErrorBody(err error) fiber.Map {
+	body := fiber.Map{
+		"error": err.Error(),
+	}
+
+	var limitErr *file.LimitError
+	if errors.As(err, &limitErr) {
+		body["code"] = limitErr.Code
+		body["limit"] = limitErr.Limit
+		if limitErr.Filename != "" {
+			body["filename"] = limitErr.Filename
+		}
+	}
+
+	var rejected *file.RejectedFilesError
+	if errors.As(err, &rejected) {
+		body["error"] = "Some uploaded files were rejected"
+		body["rejected"] = rejected.Rejections
+	}
+
+	return body
+}
+
+// extractionErrorBody builds the JSON error body, exposing the code and details of domain errors
+func extractionErrorBody(err error) fiber.Map {
+	body := fiber.Map{
+		"error":   "Failed to extract transactions",
+		"details": err.Error(),
+	}
+
+	var domainErr *domainErrors.DomainError
+	if errors.As(err, &domainErr) {
+		body["code"] = domainErr.Code
+		if domainErr.StatusCode != 0 {
+			body["upstream_status"] = domainErr.StatusCode
+		}
+		if domainErr.Details != nil {
+			body["violations"] = domainErr.Details
+		}
+	}
+
+	return body
 }
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"errors"
+	"log"
+
+	"sandbox/application/dto"
+	"sandbox/application/usecase"
+	domainErrors "sandbox/domain/errors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// UsageHandler handles the admin endpoint reporting LLM token usage
+type UsageHandler struct {
+	reportUsageUseCase *usecase.ReportUsageUseCase
+}
+
+// NewUsageHandler creates a new usage handler
+func NewUsageHandler(reportUsageUseCase *usecase.ReportUsageUseCase) *UsageHandler {
+	return &UsageHandler{
+		reportUsageUseCase: reportUsageUseCase,
+	}
+}
+
+// GetUsage returns the tokens spent in a month by day, endpoint and API client,
+// and the state of the monthly budget
+func (h *UsageHandler) GetUsage(c *fiber.Ctx) error {
+	req := dto.UsageReportRequest{Month: c.Query("month")}
+
+	report, err := h.reportUsageUseCase.Execute(req)
+	if err != nil {
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, domainErrors.ErrValidation) {
+			status = fiber.StatusBadRequest
+		} else {
+			log.Printf("Error reporting token usage: %v", err)
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(report)
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// LimitRequestBody refuses, before reading it, a request whose declared body
+// is larger than maxBytes. A chunked body declares no length, so it is only
+// accepted for multipart uploads, whose handlers stream and bound it; other
+// chunked requests, such as JSON sent without a Content-Length, are refused.
+func LimitRequestBody(maxBytes int64) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		header := &c.Request().Header
+		if length := header.ContentLength(); int64(length) > maxBytes {
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+				"error": fmt.Sprintf("request is above the %.0f MB limit", float64(maxBytes)/(1<<20)),
+				"code":  "REQUEST_TOO_LARGE",
+				"limit": maxBytes,
+			})
+		} else if length == -1 && len(header.MultipartFormBoundary()) == 0 {
+			return c.Status(fiber.StatusLengthRequired).JSON(fiber.Map{
+				"error": "request body must have a Content-Length unless it is a multipart upload",
+				"code":  "LENGTH_REQUIRED",
+			})
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestLimitRequestBodyRefusesChunkedJSON(t *testing.T) {
+	app := fiber.New(fiber.Config{StreamRequestBody: true, DisableStartupMessage: true})
+	app.Use(LimitRequestBody(1 << 20))
+	app.Post("/", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(ln)
+	defer app.Shutdown()
+
+	tests := []struct {
+		contentType string
+		want        int
+	}{
+		{fiber.MIMEApplicationJSON, fiber.StatusLengthRequired},
+		{fiber.MIMEMultipartForm + "; boundary=x", fiber.StatusOK},
+	}
+	for _, tt := range tests {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(conn, "POST / HTTP/1.1\r\nHost: test\r\nContent-Type: %s\r\nTransfer-Encoding: chunked\r\n\r\n2\r\n{}\r\n0\r\n\r\n", tt.contentType)
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		conn.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.contentType, resp.StatusCode, tt.want)
+		}
+	}
+}
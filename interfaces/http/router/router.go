@@ -7,7 +7,16 @@ import (
 )
 
 // SetupRoutes configures all application routes
-func SetupRoutes(app *fiber.App, transactionHandler *handler.TransactionHandler, meetingHandler *handler.MeetingHandler) {
+func SetupRoutes(
+	app *fiber.App,
+	transactionHandler *handler.TransactionHandler,
+	extractionJobHandler *handler.ExtractionJobHandler,
+	meetingHandler *handler.MeetingHandler,
+	promptHandler *handler.PromptHandler,
+	usageHandler *handler.UsageHandler,
+	importHandler *handler.ImportHandler,
+	adminAuth fiber.Handler,
+) {
 	api := app.Group("/api")
 
 	// Transaction routes
@@ -15,9 +24,24 @@ func SetupRoutes(app *fiber.App, transactionHandler *handler.TransactionHandler,
 	api.Post("/upload/detailed", transactionHandler.UploadAndExtractDetailed)
 	api.Post("/report/excel", transactionHandler.GenerateRecapExcel)
 
+	// Spreadsheet import, an alternative to extraction
+	api.Post("/import", importHandler.ImportTransactions)
+
+	// Asynchronous extraction jobs
+	api.Post("/extractions", extractionJobHandler.CreateJob)
+	api.Get("/extractions/:id", extractionJobHandler.GetJob)
+	api.Get("/extractions/:id/events", extractionJobHandler.StreamJobEvents)
+	api.Delete("/extractions/:id", extractionJobHandler.CancelJob)
+
 	// Meeting routes
 	api.Post("/meetings", meetingHandler.CreateMeeting)
 
+	// Admin routes
+	admin := api.Group("/admin", adminAuth)
+	admin.Get("/prompts", promptHandler.ListPrompts)
+	admin.Put("/prompts/active", promptHandler.ActivatePrompt)
+	admin.Get("/usage", usageHandler.GetUsage)
+
 	// Health check
 	api.Get("/health", func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{
@@ -19,20 +19,29 @@ func main() {
 	}
 
 	// Initialize dependency injection container
-	container := config.NewContainer(cfg)
+	container, err := config.NewContainer(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize application: %v", err)
+	}
 
-	// Setup Fiber app
+	// Setup Fiber app. Request bodies are streamed: only the first BodyLimit
+	// bytes are buffered, and uploads are spooled to disk by the handlers.
 	app := fiber.New(fiber.Config{
-		ErrorHandler: customErrorHandler,
+		ErrorHandler:                 customErrorHandler,
+		BodyLimit:                    1 << 20,
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
 	})
 
 	// Setup middleware
 	app.Use(middleware.ConfigureLogger())
 	app.Use(middleware.ConfigureRecovery())
 	app.Use(middleware.ConfigureCORS(cfg.CORS.AllowOrigins))
+	app.Use(middleware.LimitRequestBody(int64(cfg.Uploads.MaxRequestMB) << 20))
 
 	// Setup routes
-	router.SetupRoutes(app, container.TransactionHandler, container.MeetingHandler)
+	router.SetupRoutes(app, container.TransactionHandler, container.ExtractionJobHandler, container.MeetingHandler,
+		container.PromptHandler, container.UsageHandler, container.ImportHandler, middleware.RequireAdminToken(cfg.Admin.Token))
 
 	// Start server
 	fmt.Printf("🚀 Server running on port %s\n", cfg.Server.Port)